@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+)
+
+// maxAgePasswordSize age加密文件解密后的最大长度，文件内容只是加密密码
+const maxAgePasswordSize = 64 << 10
+
+// unwrapAgePassword 使用age身份文件解密password_age_file得到加密密码。
+// 已经通过命令行参数、环境变量或配置文件直接提供密码时不读取该文件，config age-wrap据此用新的密码重新加密
+func (c *Config) unwrapAgePassword() error {
+	if c.PasswordAgeFile == "" || c.Password != "" {
+		return nil
+	}
+	if c.AgeIdentityFile == "" {
+		return fmt.Errorf("password_age_file requires age_identity_file")
+	}
+
+	identities, err := parseAgeIdentities(c.AgeIdentityFile)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(c.PasswordAgeFile)
+	if err != nil {
+		return fmt.Errorf("read password_age_file: %w", err)
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return fmt.Errorf("decrypt password_age_file %s: %w", c.PasswordAgeFile, err)
+	}
+	password, err := io.ReadAll(io.LimitReader(r, maxAgePasswordSize+1))
+	if err != nil {
+		return fmt.Errorf("decrypt password_age_file %s: %w", c.PasswordAgeFile, err)
+	}
+	if len(password) > maxAgePasswordSize {
+		return fmt.Errorf("password_age_file %s is too large", c.PasswordAgeFile)
+	}
+
+	c.Password = strings.TrimRight(string(password), "\r\n")
+	if c.Password == "" {
+		return fmt.Errorf("password_age_file %s is empty", c.PasswordAgeFile)
+	}
+	c.setSource("password", "age加密文件 "+c.PasswordAgeFile)
+	return nil
+}
+
+// parseAgeIdentities 读取age身份文件，支持age-keygen生成的密钥和未设置口令的SSH私钥
+func parseAgeIdentities(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read age_identity_file: %w", err)
+	}
+	if bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		identity, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse age_identity_file %s: %w", path, err)
+		}
+		return []age.Identity{identity}, nil
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse age_identity_file %s: %w", path, err)
+	}
+	return identities, nil
+}
+
+// parseAgeRecipients 解析接收者列表，每一项是age公钥（age1...）、SSH公钥（ssh-ed25519或ssh-rsa），
+// 或者每行一个接收者的文件路径，文件中以#开头的行和空行被忽略
+func parseAgeRecipients(entries []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if isAgeRecipient(entry) {
+			recipient, err := parseAgeRecipient(entry)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, recipient)
+			continue
+		}
+
+		f, err := os.Open(entry)
+		if err != nil {
+			return nil, fmt.Errorf("read age recipients file: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			recipient, err := parseAgeRecipient(line)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s: %w", entry, err)
+			}
+			recipients = append(recipients, recipient)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read age recipients file: %w", err)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("age_recipients is empty")
+	}
+	return recipients, nil
+}
+
+// isAgeRecipient 判断接收者列表中的一项是公钥本身而不是文件路径
+func isAgeRecipient(entry string) bool {
+	return strings.HasPrefix(entry, "age1") || strings.HasPrefix(entry, "ssh-")
+}
+
+// parseAgeRecipient 解析一个age公钥或SSH公钥
+func parseAgeRecipient(s string) (age.Recipient, error) {
+	if strings.HasPrefix(s, "ssh-") {
+		recipient, err := agessh.ParseRecipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+		}
+		return recipient, nil
+	}
+	recipient, err := age.ParseX25519Recipient(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+	}
+	return recipient, nil
+}
+
+// WrapPasswordFile 为age_recipients中的每个接收者加密密码，以ASCII armor格式写入password_age_file。
+// 任何一个接收者的身份文件都能解密，明文密码不会写入磁盘
+func (c *Config) WrapPasswordFile() (int, error) {
+	if c.PasswordAgeFile == "" {
+		return 0, fmt.Errorf("password_age_file is not set")
+	}
+	if c.Password == "" {
+		return 0, fmt.Errorf("password is empty")
+	}
+	recipients, err := parseAgeRecipients(c.AgeRecipients)
+	if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return 0, fmt.Errorf("encrypt password: %w", err)
+	}
+	if _, err := io.WriteString(w, c.Password); err != nil {
+		return 0, fmt.Errorf("encrypt password: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("encrypt password: %w", err)
+	}
+	if err := aw.Close(); err != nil {
+		return 0, fmt.Errorf("encrypt password: %w", err)
+	}
+
+	// 先写入临时文件再重命名，写入失败时不会破坏原来的文件
+	tmp, err := os.CreateTemp(filepath.Dir(c.PasswordAgeFile), ".password-age-*")
+	if err != nil {
+		return 0, fmt.Errorf("write password_age_file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("write password_age_file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("write password_age_file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.PasswordAgeFile); err != nil {
+		return 0, fmt.Errorf("write password_age_file: %w", err)
+	}
+	return len(recipients), nil
+}
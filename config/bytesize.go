@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize 字节大小，配置中可以写为整数或带单位的字符串，如 10MiB、512KB
+type ByteSize int64
+
+// 字节单位，K/M/G/T及KiB/MiB/GiB/TiB按1024进制，KB/MB/GB/TB按1000进制
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KIB": 1 << 10,
+	"KB":  1000,
+	"M":   1 << 20,
+	"MIB": 1 << 20,
+	"MB":  1000 * 1000,
+	"G":   1 << 30,
+	"GIB": 1 << 30,
+	"GB":  1000 * 1000 * 1000,
+	"T":   1 << 40,
+	"TIB": 1 << 40,
+	"TB":  1000 * 1000 * 1000 * 1000,
+}
+
+// ParseByteSize 解析字节大小字符串
+func ParseByteSize(value string) (ByteSize, error) {
+	value = strings.TrimSpace(value)
+	i := 0
+	for i < len(value) && (value[i] >= '0' && value[i] <= '9' || value[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid byte size: %q", value)
+	}
+
+	number, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size: %q", value)
+	}
+	unit, ok := byteSizeUnits[strings.ToUpper(strings.TrimSpace(value[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size unit: %q", value)
+	}
+	return ByteSize(number * float64(unit)), nil
+}
+
+// UnmarshalYAML 支持在YAML中使用整数或带单位的字符串
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := ParseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
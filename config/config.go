@@ -1,51 +1,197 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"webdav-proxy/pkg/encryption"
 	"webdav-proxy/utils"
 
+	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
 )
 
 // Config 配置结构
 type Config struct {
-	ListenAddr          string        `yaml:"listen_addr" env:"LISTEN_ADDR" default:":8080"`                      // 监听地址，格式为：:端口
-	BackendURL          string        `yaml:"backend_url" env:"BACKEND_URL" default:""`                           // 后端WebDAV服务器URL
-	Password            string        `yaml:"password" env:"PASSWORD" default:""`                                 // 加密密码
-	Algorithm           string        `yaml:"algorithm" env:"ALGORITHM" default:"aesctr"`                         // 加密算法，可选值：mix, rc4, aesctr
-	ChunkSize           int           `yaml:"chunk_size" env:"CHUNK_SIZE" default:"8192"`                         // 块大小（字节）
-	Debug               bool          `yaml:"debug" env:"DEBUG" default:"false"`                                  // 是否启用调试模式（向后兼容，建议使用log_level）
-	LogLevel            string        `yaml:"log_level" env:"LOG_LEVEL" default:"info"`                           // 日志级别：trace, debug, info, warn, error, fatal
-	BackendUser         string        `yaml:"backend_user" env:"BACKEND_USER" default:""`                         // 后端WebDAV服务器用户名
-	BackendPass         string        `yaml:"backend_pass" env:"BACKEND_PASS" default:""`                         // 后端WebDAV服务器密码
-	EnableAuth          bool          `yaml:"enable_auth" env:"ENABLE_AUTH" default:"false"`                      // 是否启用代理端基本认证
-	AuthUser            string        `yaml:"auth_user" env:"AUTH_USER" default:""`                               // 代理认证用户名
-	AuthPass            string        `yaml:"auth_pass" env:"AUTH_PASS" default:""`                               // 代理认证密码
-	Timeout             time.Duration `yaml:"timeout" env:"TIMEOUT" default:"300s"`                               // 请求超时时间
-	MaxIdleConns        int           `yaml:"max_idle_conns" env:"MAX_IDLE_CONNS" default:"100"`                  // 最大空闲连接数
-	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" env:"MAX_IDLE_CONNS_PER_HOST" default:"10"` // 每个主机的最大空闲连接数
-	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout" env:"IDLE_CONN_TIMEOUT" default:"90s"`            // 空闲连接超时时间
-	DnsServers          []string      `yaml:"dns_servers" env:"DNS_SERVERS" default:"8.8.8.8:53,8.8.4.4:53"`      // 公共DNS服务器列表，格式为：IP:端口
-	ConfigFile          string        `yaml:"-" env:"CONFIG_FILE" default:""`                                     // 配置文件路径
+	ListenAddr                  string                   `yaml:"listen_addr" env:"LISTEN_ADDR" default:":8080"`                                      // 监听地址，格式为：:端口
+	BackendURL                  string                   `yaml:"backend_url" env:"BACKEND_URL" default:""`                                           // 后端WebDAV服务器URL
+	LocalDir                    string                   `yaml:"local_dir" env:"LOCAL_DIR" default:""`                                               // 本地目录模式，设置后直接将该目录作为加密WebDAV服务器，不再使用后端
+	BackendURLs                 []string                 `yaml:"backend_urls" env:"BACKEND_URLS" default:""`                                         // 其他等价后端URL列表，与backend_url保存相同数据，用于负载均衡
+	FallbackBackendURL          string                   `yaml:"fallback_backend_url" env:"FALLBACK_BACKEND_URL" default:""`                         // 备用后端URL，所有主后端不可用时切换，需要启用健康检查
+	FailoverWrites              string                   `yaml:"failover_writes" env:"FAILOVER_WRITES" default:"block"`                              // 切换到备用后端后写请求的处理方式：block或fallback
+	LoadBalance                 string                   `yaml:"load_balance" env:"LOAD_BALANCE" default:"round_robin"`                              // 多后端选择策略：round_robin或least_latency
+	Password                    string                   `yaml:"password" env:"PASSWORD" default:""`                                                 // 加密密码
+	PasswordAgeFile             string                   `yaml:"password_age_file" env:"PASSWORD_AGE_FILE" default:""`                               // age加密保存加密密码的文件，启动时用age_identity_file解密
+	AgeIdentityFile             string                   `yaml:"age_identity_file" env:"AGE_IDENTITY_FILE" default:""`                               // 解密password_age_file的age身份文件或SSH私钥
+	AgeRecipients               []string                 `yaml:"age_recipients" env:"AGE_RECIPIENTS" default:""`                                     // config age-wrap加密密码时的接收者公钥或公钥文件列表
+	Algorithm                   string                   `yaml:"algorithm" env:"ALGORITHM" default:"aesctr"`                                         // 加密算法，可选值：aesctr, chacha20, rc4, mix, auto
+	EncryptorPlugins            []string                 `yaml:"encryptor_plugins" env:"ENCRYPTOR_PLUGINS" default:""`                               // 加密器插件文件列表，需要使用plugins构建标签
+	SelfTest                    bool                     `yaml:"self_test" env:"SELF_TEST" default:"false"`                                          // 启动时对使用的每种算法做加密解密往返自检，失败时拒绝启动
+	EncryptAll                  bool                     `yaml:"encrypt_all" env:"ENCRYPT_ALL" default:"false"`                                      // 加解密所有非集合路径的内容，不再根据Content-Type和扩展名判断
+	FileExtensions              []string                 `yaml:"file_extensions" env:"FILE_EXTENSIONS" default:""`                                   // 额外视为文件的扩展名
+	FileContentTypes            []string                 `yaml:"file_content_types" env:"FILE_CONTENT_TYPES" default:""`                             // 额外视为文件的Content-Type前缀
+	NonFileContentTypes         []string                 `yaml:"non_file_content_types" env:"NON_FILE_CONTENT_TYPES" default:""`                     // 额外视为非文件的Content-Type前缀
+	ReplaceFileDetection        bool                     `yaml:"replace_file_detection" env:"REPLACE_FILE_DETECTION" default:"false"`                // 使用上面三个列表替换内置列表，而不是追加
+	MinEncryptSize              ByteSize                 `yaml:"min_encrypt_size" env:"MIN_ENCRYPT_SIZE" default:"0"`                                // 小于该大小的文件不加密，0表示不限制
+	EncryptionRules             []EncryptionRuleConfig   `yaml:"encryption_rules"`                                                                   // 按路径前缀指定加密算法和密码
+	Compress                    string                   `yaml:"compress" env:"COMPRESS" default:""`                                                 // 加密前的压缩算法，目前支持gzip，为空时不压缩
+	RestoreContentType          bool                     `yaml:"restore_content_type" env:"RESTORE_CONTENT_TYPE" default:"true"`                     // 后端返回application/octet-stream等通用类型时，按扩展名或解密后的内容恢复Content-Type
+	RedirectMode                string                   `yaml:"redirect_mode" env:"REDIRECT_MODE" default:"follow"`                                 // 下载时后端重定向的处理方式：follow由代理跟随，rewrite改写为代理地址由客户端重新请求
+	RedirectMaxHops             int                      `yaml:"redirect_max_hops" env:"REDIRECT_MAX_HOPS" default:"10"`                             // 最多跟随的重定向次数
+	RedirectAllowHosts          []string                 `yaml:"redirect_allow_hosts" env:"REDIRECT_ALLOW_HOSTS" default:""`                         // 允许重定向到的主机，支持*通配符，为空时允许所有主机
+	ExcludePaths                []string                 `yaml:"exclude_paths" env:"EXCLUDE_PATHS" default:""`                                       // 不加密的路径规则，支持glob和re:前缀的正则表达式
+	CacheControl                string                   `yaml:"cache_control" env:"CACHE_CONTROL" default:"no-cache, no-store, must-revalidate"`    // 解密后的文件下载响应的Cache-Control，为空时保留后端返回的值
+	CacheControlRules           []CacheControlRuleConfig `yaml:"cache_control_rules"`                                                                // 按路径指定的Cache-Control，使用第一条匹配的规则
+	RequestHeaders              []HeaderRuleConfig       `yaml:"request_headers"`                                                                    // 修改发往后端的请求头的规则
+	ResponseHeaders             []HeaderRuleConfig       `yaml:"response_headers"`                                                                   // 修改后端返回的响应头的规则
+	ChunkSize                   int                      `yaml:"chunk_size" env:"CHUNK_SIZE" default:"8192"`                                         // 块大小（字节）
+	Debug                       bool                     `yaml:"debug" env:"DEBUG" default:"false"`                                                  // 是否启用调试模式（向后兼容，建议使用log_level）
+	LogLevel                    string                   `yaml:"log_level" env:"LOG_LEVEL" default:"info"`                                           // 日志级别：trace, debug, info, warn, error, fatal
+	TraceBodyBytes              ByteSize                 `yaml:"trace_body_bytes" env:"TRACE_BODY_BYTES" default:"0"`                                // 在TRACE级别日志中记录上传下载加解密前后开头的字节数，0表示不记录
+	BackendUser                 string                   `yaml:"backend_user" env:"BACKEND_USER" default:""`                                         // 后端WebDAV服务器用户名
+	BackendPass                 string                   `yaml:"backend_pass" env:"BACKEND_PASS" default:""`                                         // 后端WebDAV服务器密码
+	BackendAuth                 string                   `yaml:"backend_auth" env:"BACKEND_AUTH" default:"static"`                                   // 后端认证方式：static使用backend_user/backend_pass，passthrough转发客户端的Authorization头
+	BackendUserAgent            string                   `yaml:"backend_user_agent" env:"BACKEND_USER_AGENT" default:""`                             // 替换发往后端的请求的User-Agent，支持windows、finder、davfs2、rclone、cyberduck、winscp等预设名称
+	EnableAuth                  bool                     `yaml:"enable_auth" env:"ENABLE_AUTH" default:"false"`                                      // 是否启用代理端基本认证
+	AuthUser                    string                   `yaml:"auth_user" env:"AUTH_USER" default:""`                                               // 代理认证用户名
+	AuthPass                    string                   `yaml:"auth_pass" env:"AUTH_PASS" default:""`                                               // 代理认证密码
+	AuthTokens                  []string                 `yaml:"auth_tokens" env:"AUTH_TOKENS" default:""`                                           // 代理认证令牌列表，支持Bearer和X-Api-Key
+	OIDCIssuer                  string                   `yaml:"oidc_issuer" env:"OIDC_ISSUER" default:""`                                           // OIDC令牌签发者，设置后启用JWT令牌认证
+	OIDCAudience                string                   `yaml:"oidc_audience" env:"OIDC_AUDIENCE" default:""`                                       // OIDC令牌受众
+	OIDCJWKSURL                 string                   `yaml:"oidc_jwks_url" env:"OIDC_JWKS_URL" default:""`                                       // OIDC JWKS地址，为空时自动发现
+	ShareSecret                 string                   `yaml:"share_secret" env:"SHARE_SECRET" default:""`                                         // 分享链接的签名密钥，为空表示不启用分享链接
+	ShareMaxExpiry              time.Duration            `yaml:"share_max_expiry" env:"SHARE_MAX_EXPIRY" default:"168h"`                             // 分享链接的最长有效期，0表示不限制
+	AuthMaxFailures             int                      `yaml:"auth_max_failures" env:"AUTH_MAX_FAILURES" default:"10"`                             // 认证失败封禁阈值，0表示不封禁
+	AuthFailureWindow           time.Duration            `yaml:"auth_failure_window" env:"AUTH_FAILURE_WINDOW" default:"5m"`                         // 认证失败计数窗口
+	AuthBanDuration             time.Duration            `yaml:"auth_ban_duration" env:"AUTH_BAN_DURATION" default:"15m"`                            // 认证失败封禁时长
+	AllowedMethods              []string                 `yaml:"allowed_methods" env:"ALLOWED_METHODS" default:""`                                   // 允许转发的HTTP方法，为空时允许所有WebDAV方法
+	CORSAllowedOrigins          []string                 `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" default:""`                         // 允许跨域访问的来源，支持*通配符，为空表示不启用CORS
+	CORSAllowedMethods          []string                 `yaml:"cors_allowed_methods" env:"CORS_ALLOWED_METHODS" default:""`                         // 允许跨域使用的方法，为空时允许所有WebDAV方法
+	CORSAllowedHeaders          []string                 `yaml:"cors_allowed_headers" env:"CORS_ALLOWED_HEADERS" default:""`                         // 允许跨域携带的请求头，为空时使用内置的WebDAV请求头列表
+	CORSExposedHeaders          []string                 `yaml:"cors_exposed_headers" env:"CORS_EXPOSED_HEADERS" default:""`                         // 允许网页读取的响应头，为空时使用内置的WebDAV响应头列表
+	CORSAllowCredentials        bool                     `yaml:"cors_allow_credentials" env:"CORS_ALLOW_CREDENTIALS" default:"false"`                // 是否允许跨域请求携带Cookie和认证信息
+	CORSMaxAge                  time.Duration            `yaml:"cors_max_age" env:"CORS_MAX_AGE" default:"10m"`                                      // 浏览器缓存预检请求结果的时间
+	HSTSMaxAge                  time.Duration            `yaml:"hsts_max_age" env:"HSTS_MAX_AGE" default:"0s"`                                       // Strict-Transport-Security的有效期，0表示不发送
+	HSTSIncludeSubdomains       bool                     `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS" default:"false"`              // HSTS是否包含子域名
+	ContentTypeNosniff          bool                     `yaml:"content_type_nosniff" env:"CONTENT_TYPE_NOSNIFF" default:"false"`                    // 是否发送X-Content-Type-Options: nosniff
+	QuotaBytes                  ByteSize                 `yaml:"quota_bytes" env:"QUOTA_BYTES" default:"0"`                                          // 每个用户的上传配额(字节)，0表示不限制
+	QuotaStateFile              string                   `yaml:"quota_state_file" env:"QUOTA_STATE_FILE" default:"quota.json"`                       // 已用配额的持久化文件
+	TusPath                     string                   `yaml:"tus_path" env:"TUS_PATH" default:""`                                                 // TUS断点续传上传端点路径，为空表示不启用
+	TusDir                      string                   `yaml:"tus_dir" env:"TUS_DIR" default:"tus-uploads"`                                        // 暂存未完成上传的本地目录
+	TusMaxSize                  ByteSize                 `yaml:"tus_max_size" env:"TUS_MAX_SIZE" default:"0"`                                        // 单个TUS上传的大小上限，0表示不限制
+	TusExpiration               time.Duration            `yaml:"tus_expiration" env:"TUS_EXPIRATION" default:"24h"`                                  // 未完成的TUS上传过期时间
+	SFTPListen                  string                   `yaml:"sftp_listen" env:"SFTP_LISTEN" default:""`                                           // SFTP监听地址，为空表示不启用
+	SFTPHostKey                 string                   `yaml:"sftp_host_key" env:"SFTP_HOST_KEY" default:"sftp_host_ed25519_key"`                  // SFTP服务器的主机私钥文件，不存在时自动生成
+	SFTPAuthorizedKeys          string                   `yaml:"sftp_authorized_keys" env:"SFTP_AUTHORIZED_KEYS" default:""`                         // 允许SFTP公钥登录的authorized_keys文件，%u替换为登录的用户名
+	TrashDir                    string                   `yaml:"trash_dir" env:"TRASH_DIR" default:""`                                               // 回收站目录，设置后DELETE会把文件移动到该目录，为空表示直接删除
+	TrashRetention              time.Duration            `yaml:"trash_retention" env:"TRASH_RETENTION" default:"720h"`                               // 回收站中文件的保留时间，0表示不自动清除
+	VersionsDir                 string                   `yaml:"versions_dir" env:"VERSIONS_DIR" default:""`                                         // 历史版本目录，设置后覆盖上传前会把旧文件复制到该目录，为空表示不保留
+	VersionsKeep                int                      `yaml:"versions_keep" env:"VERSIONS_KEEP" default:"10"`                                     // 每个文件保留的历史版本数量
+	WebhookURL                  string                   `yaml:"webhook_url" env:"WEBHOOK_URL" default:""`                                           // 写操作成功后发送事件通知的地址，为空表示不启用
+	WebhookSecret               string                   `yaml:"webhook_secret" env:"WEBHOOK_SECRET" default:""`                                     // 事件通知的HMAC签名密钥
+	WebhookRetries              int                      `yaml:"webhook_retries" env:"WEBHOOK_RETRIES" default:"3"`                                  // 事件通知发送失败后的重试次数
+	WebhookTimeout              time.Duration            `yaml:"webhook_timeout" env:"WEBHOOK_TIMEOUT" default:"10s"`                                // 单次发送事件通知的超时时间
+	LockMode                    string                   `yaml:"lock_mode" env:"LOCK_MODE" default:"passthrough"`                                    // 锁处理方式：passthrough转发给后端，local由代理在内存中管理
+	LockTimeout                 time.Duration            `yaml:"lock_timeout" env:"LOCK_TIMEOUT" default:"1h"`                                       // 内置锁管理器中锁的最长有效期
+	RateLimitKey                string                   `yaml:"rate_limit_key" env:"RATE_LIMIT_KEY" default:"ip"`                                   // 限流维度：ip或user
+	RateLimitRequests           float64                  `yaml:"rate_limit_requests" env:"RATE_LIMIT_REQUESTS" default:"0"`                          // 每个客户端每秒请求数上限，0表示不限制
+	RateLimitBurst              int                      `yaml:"rate_limit_burst" env:"RATE_LIMIT_BURST" default:"0"`                                // 请求突发上限，0表示与每秒请求数相同
+	RateLimitBandwidth          ByteSize                 `yaml:"rate_limit_bandwidth" env:"RATE_LIMIT_BANDWIDTH" default:"0"`                        // 每个客户端带宽上限(字节/秒)，0表示不限制
+	MaxUploadRate               ByteSize                 `yaml:"max_upload_rate" env:"MAX_UPLOAD_RATE" default:"0"`                                  // 全局上传带宽上限(字节/秒)，0表示不限制
+	MaxDownloadRate             ByteSize                 `yaml:"max_download_rate" env:"MAX_DOWNLOAD_RATE" default:"0"`                              // 全局下载带宽上限(字节/秒)，0表示不限制
+	BlockCacheDir               string                   `yaml:"block_cache_dir" env:"BLOCK_CACHE_DIR" default:""`                                   // 解密数据块缓存目录，为空表示不启用
+	BlockCacheSize              ByteSize                 `yaml:"block_cache_size" env:"BLOCK_CACHE_SIZE" default:"1GiB"`                             // 解密数据块缓存总大小上限
+	BlockCacheBlockSize         ByteSize                 `yaml:"block_cache_block_size" env:"BLOCK_CACHE_BLOCK_SIZE" default:"1MiB"`                 // 缓存块大小
+	KeyCacheSize                int                      `yaml:"key_cache_size" env:"KEY_CACHE_SIZE" default:"1000"`                                 // 派生密钥缓存的最大项数，超过时淘汰最近最少使用的项
+	KeyCacheTTL                 time.Duration            `yaml:"key_cache_ttl" env:"KEY_CACHE_TTL" default:"1h"`                                     // 派生密钥多长时间未使用后从缓存中清理
+	PropfindCacheTTL            time.Duration            `yaml:"propfind_cache_ttl" env:"PROPFIND_CACHE_TTL" default:"0s"`                           // PROPFIND响应缓存时间，0表示不缓存
+	ReadAheadChunks             int                      `yaml:"read_ahead_chunks" env:"READ_AHEAD_CHUNKS" default:"0"`                              // 顺序下载时预读的块数，0表示不启用
+	ReadAheadChunkSize          ByteSize                 `yaml:"read_ahead_chunk_size" env:"READ_AHEAD_CHUNK_SIZE" default:"256KiB"`                 // 预读块大小
+	ParallelDownloadThreshold   ByteSize                 `yaml:"parallel_download_threshold" env:"PARALLEL_DOWNLOAD_THRESHOLD" default:"0"`          // 下载大小达到该值时从后端并行分段下载，0表示不启用
+	ParallelDownloadConnections int                      `yaml:"parallel_download_connections" env:"PARALLEL_DOWNLOAD_CONNECTIONS" default:"4"`      // 并行下载的连接数
+	ParallelDownloadSegmentSize ByteSize                 `yaml:"parallel_download_segment_size" env:"PARALLEL_DOWNLOAD_SEGMENT_SIZE" default:"8MiB"` // 并行下载的分段大小
+	SplitUploadSize             ByteSize                 `yaml:"split_upload_size" env:"SPLIT_UPLOAD_SIZE" default:"0"`                              // 超过该大小的上传拆分为多个后端文件，0表示不拆分
+	NextcloudChunking           bool                     `yaml:"nextcloud_chunking" env:"NEXTCLOUD_CHUNKING" default:"true"`                         // 由代理合并Nextcloud/ownCloud客户端的分块上传
+	OCChecksum                  string                   `yaml:"oc_checksum" env:"OC_CHECKSUM" default:"strip"`                                      // OC-Checksum处理方式：strip不发给后端并去掉后端的校验和，passthrough原样转发
+	StableETags                 bool                     `yaml:"stable_etags" env:"STABLE_ETAGS" default:"false"`                                    // 把后端ETag转换为与明文内容对应、在各种请求中一致的ETag
+	MaxTransferRate             ByteSize                 `yaml:"max_transfer_rate" env:"MAX_TRANSFER_RATE" default:"0"`                              // 单个传输的带宽上限(字节/秒)，0表示不限制
+	MaxConcurrentTransfers      int                      `yaml:"max_concurrent_transfers" env:"MAX_CONCURRENT_TRANSFERS" default:"0"`                // 同时进行的GET/PUT传输上限，0表示不限制
+	TransferQueueTimeout        time.Duration            `yaml:"transfer_queue_timeout" env:"TRANSFER_QUEUE_TIMEOUT" default:"0s"`                   // 超出并发上限时的排队时间，0表示直接返回503
+	ReadTimeout                 time.Duration            `yaml:"read_timeout" env:"READ_TIMEOUT" default:"300s"`                                     // 代理服务器读取请求超时时间，0表示不限制
+	WriteTimeout                time.Duration            `yaml:"write_timeout" env:"WRITE_TIMEOUT" default:"300s"`                                   // 代理服务器写入响应超时时间，0表示不限制
+	IdleTimeout                 time.Duration            `yaml:"idle_timeout" env:"IDLE_TIMEOUT" default:"60s"`                                      // 代理服务器空闲连接超时时间
+	ShutdownTimeout             time.Duration            `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"60s"`                              // 关闭服务时等待进行中的上传下载完成的时间
+	MaxHeaderBytes              ByteSize                 `yaml:"max_header_bytes" env:"MAX_HEADER_BYTES" default:"1MiB"`                             // 请求头最大字节数
+	MetadataTimeout             time.Duration            `yaml:"metadata_timeout" env:"METADATA_TIMEOUT" default:"300s"`                             // PROPFIND、MKCOL等元数据请求超时时间，0表示不限制
+	DataTimeout                 time.Duration            `yaml:"data_timeout" env:"DATA_TIMEOUT" default:"300s"`                                     // GET、PUT等数据传输请求超时时间，0表示不限制
+	MethodTimeouts              map[string]time.Duration `yaml:"method_timeouts" env:"METHOD_TIMEOUTS" default:""`                                   // 按方法单独指定的超时时间，格式为：方法=时长
+	RetryCount                  int                      `yaml:"retry_count" env:"RETRY_COUNT" default:"2"`                                          // GET、HEAD、PROPFIND请求失败时的重试次数，0表示不重试
+	RetryBackoff                time.Duration            `yaml:"retry_backoff" env:"RETRY_BACKOFF" default:"500ms"`                                  // 首次重试前的等待时间，之后每次翻倍
+	RetryMaxBackoff             time.Duration            `yaml:"retry_max_backoff" env:"RETRY_MAX_BACKOFF" default:"10s"`                            // 单次重试等待时间上限
+	RetryStatusCodes            []int                    `yaml:"retry_status_codes" env:"RETRY_STATUS_CODES" default:"502,503,504"`                  // 需要重试的后端响应状态码
+	HealthPath                  string                   `yaml:"health_path" env:"HEALTH_PATH" default:"/health"`                                    // 健康检查端点路径，不需要认证，为空表示不启用
+	StatusPath                  string                   `yaml:"status_path" env:"STATUS_PATH" default:""`                                           // 传输状态端点路径，返回进行中的上传下载，路径加/events推送实时进度，需要认证，为空表示不启用
+	HealthCheckInterval         time.Duration            `yaml:"health_check_interval" env:"HEALTH_CHECK_INTERVAL" default:"0s"`                     // 后端健康检查间隔，0表示不启用
+	HealthCheckTimeout          time.Duration            `yaml:"health_check_timeout" env:"HEALTH_CHECK_TIMEOUT" default:"5s"`                       // 单次健康检查超时时间
+	HealthCheckMethod           string                   `yaml:"health_check_method" env:"HEALTH_CHECK_METHOD" default:"OPTIONS"`                    // 健康检查方法：OPTIONS或PROPFIND
+	UnhealthyThreshold          int                      `yaml:"unhealthy_threshold" env:"UNHEALTHY_THRESHOLD" default:"3"`                          // 连续失败多少次后标记后端不可用
+	HealthyThreshold            int                      `yaml:"healthy_threshold" env:"HEALTHY_THRESHOLD" default:"1"`                              // 连续成功多少次后恢复后端可用
+	Timeout                     time.Duration            `yaml:"timeout" env:"TIMEOUT" default:"300s"`                                               // 请求超时时间
+	MaxIdleConns                int                      `yaml:"max_idle_conns" env:"MAX_IDLE_CONNS" default:"100"`                                  // 最大空闲连接数
+	MaxIdleConnsPerHost         int                      `yaml:"max_idle_conns_per_host" env:"MAX_IDLE_CONNS_PER_HOST" default:"10"`                 // 每个主机的最大空闲连接数
+	IdleConnTimeout             time.Duration            `yaml:"idle_conn_timeout" env:"IDLE_CONN_TIMEOUT" default:"90s"`                            // 空闲连接超时时间
+	ExpectContinueTimeout       time.Duration            `yaml:"expect_continue_timeout" env:"EXPECT_CONTINUE_TIMEOUT" default:"500ms"`              // 带Expect: 100-continue的上传等待后端响应的时间
+	DnsServers                  []string                 `yaml:"dns_servers" env:"DNS_SERVERS" default:"8.8.8.8:53,8.8.4.4:53"`                      // 公共DNS服务器列表，格式为：IP:端口
+	Mounts                      []MountConfig            `yaml:"mounts"`                                                                             // 虚拟挂载点，每个路径前缀对应独立的后端
+	Users                       []UserConfig             `yaml:"users"`                                                                              // 多租户用户，每个代理用户对应独立的后端和加密密码
+	ConfigFile                  string                   `yaml:"-" env:"CONFIG_FILE" default:""`                                                     // 配置文件路径
+
+	sources map[string]string // 每个配置项的来源，没有记录的配置项使用默认值
+
+	autoAlgorithm string // algorithm: auto自动选择的算法
 }
 
-// Load 加载配置，支持从环境变量和配置文件
+// Load 加载并验证配置，优先级从高到低为：环境变量、配置文件、默认值
 func Load() (*Config, error) {
+	cfg, err := LoadWithFlags(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证配置
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadWithFlags 加载配置，优先级从高到低为：命令行参数、环境变量、配置文件、默认值。
+// flags只包含用户显式指定的命令行参数，键为参数名，未指定的参数不会覆盖其他来源的值。
+// 返回的配置还没有验证，调用方需要调用Validate
+func LoadWithFlags(flags map[string]string) (*Config, error) {
 	// 创建默认配置
-	cfg := &Config{}
+	cfg := &Config{sources: make(map[string]string)}
 	if err := loadDefaults(cfg); err != nil {
 		return nil, err
 	}
 
-	// 加载配置文件
-	if cfgFile := os.Getenv("CONFIG_FILE"); cfgFile != "" {
-		if err := loadFromFile(cfgFile, cfg); err != nil {
+	// 加载配置文件，命令行参数指定的文件优先于CONFIG_FILE环境变量
+	cfg.ConfigFile = os.Getenv("CONFIG_FILE")
+	for _, name := range []string{"config", "c"} {
+		if file, ok := flags[name]; ok {
+			cfg.ConfigFile = file
+		}
+	}
+	if cfg.ConfigFile != "" {
+		if err := loadFromFile(cfg.ConfigFile, cfg); err != nil {
 			return nil, err
 		}
 	}
@@ -54,37 +200,315 @@ func Load() (*Config, error) {
 	if err := loadFromEnv(cfg); err != nil {
 		return nil, err
 	}
+	cfg.recordEnvSources()
 
-	// 验证配置
-	if err := cfg.Validate(); err != nil {
+	// 应用命令行参数，覆盖环境变量
+	if err := cfg.applyFlags(flags); err != nil {
+		return nil, err
+	}
+
+	// 解密以enc:v1:开头的密码、密钥和令牌，需要在根据凭据决定认证方式前完成
+	if err := cfg.decryptSecrets(); err != nil {
+		return nil, err
+	}
+
+	// 没有直接提供加密密码时从age加密文件中解密
+	if err := cfg.unwrapAgePassword(); err != nil {
 		return nil, err
 	}
 
+	cfg.resolveAuth()
+
+	// 加载加密器插件，插件注册的算法需要在验证配置前可用
+	for _, pluginPath := range cfg.EncryptorPlugins {
+		if err := encryption.LoadPlugin(pluginPath); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.resolveAutoAlgorithm()
+
 	return cfg, nil
 }
 
+// EncryptionRuleConfig 按路径前缀指定的加密参数，未设置的加密参数使用全局配置或挂载点、用户的配置
+type EncryptionRuleConfig struct {
+	Prefix    string `yaml:"prefix"`    // 路径前缀，如 /photos
+	Algorithm string `yaml:"algorithm"` // 加密算法，为空时使用全局algorithm
+	Password  string `yaml:"password"`  // 加密密码，为空时使用全局password
+}
+
+// CacheControlRuleConfig 按路径指定的Cache-Control
+type CacheControlRuleConfig struct {
+	Path  string `yaml:"path"`  // 路径规则，语法与exclude_paths相同
+	Value string `yaml:"value"` // Cache-Control的值，为空时保留后端返回的值
+}
+
+// HeaderRuleConfig 修改请求头或响应头的规则
+type HeaderRuleConfig struct {
+	Name   string `yaml:"name"`   // 头名称
+	Value  string `yaml:"value"`  // 头的值，支持{client_ip}、{host}、{scheme}、{user}占位符
+	Action string `yaml:"action"` // set、add或remove，默认set
+}
+
+// MountConfig 虚拟挂载点配置，未设置的加密参数使用全局配置
+type MountConfig struct {
+	Prefix      string `yaml:"prefix"`       // 路径前缀，如 /dropbox
+	BackendURL  string `yaml:"backend_url"`  // 后端WebDAV服务器URL
+	BackendUser string `yaml:"backend_user"` // 后端WebDAV用户名
+	BackendPass string `yaml:"backend_pass"` // 后端WebDAV密码
+	Algorithm   string `yaml:"algorithm"`    // 加密算法，为空时使用全局algorithm
+	Password    string `yaml:"password"`     // 加密密码，为空时使用全局password
+}
+
+// UserConfig 多租户用户配置，未设置的加密参数使用全局配置
+type UserConfig struct {
+	Username           string `yaml:"username"`            // 代理登录用户名
+	Password           string `yaml:"password"`            // 代理登录密码
+	BackendURL         string `yaml:"backend_url"`         // 该用户的后端WebDAV服务器URL
+	BackendUser        string `yaml:"backend_user"`        // 后端WebDAV用户名
+	BackendPass        string `yaml:"backend_pass"`        // 后端WebDAV密码
+	Algorithm          string `yaml:"algorithm"`           // 加密算法，为空时使用全局algorithm
+	EncryptionPassword string `yaml:"encryption_password"` // 加密密码，为空时使用全局password
+}
+
+// isValidAlgorithm 检查加密算法是否受支持，包括插件注册的算法，插件需要在验证配置前加载
+func isValidAlgorithm(algorithm string) bool {
+	return encryption.HasEncryptor(algorithm)
+}
+
+// resolveAutoAlgorithm 把全局、加密规则、挂载点和用户中的algorithm: auto替换为本机最快的安全算法
+func (c *Config) resolveAutoAlgorithm() {
+	selected := encryption.SelectAlgorithm()
+	resolve := func(algorithm *string) {
+		if *algorithm == encryption.AutoAlgorithm {
+			*algorithm = selected
+			c.autoAlgorithm = selected
+		}
+	}
+
+	resolve(&c.Algorithm)
+	for i := range c.EncryptionRules {
+		resolve(&c.EncryptionRules[i].Algorithm)
+	}
+	for i := range c.Mounts {
+		resolve(&c.Mounts[i].Algorithm)
+	}
+	for i := range c.Users {
+		resolve(&c.Users[i].Algorithm)
+	}
+}
+
+// Algorithms 返回全局、加密规则、挂载点和用户使用的所有加密算法，不重复
+func (c *Config) Algorithms() []string {
+	seen := make(map[string]bool)
+	var algorithms []string
+	add := func(algorithm string) {
+		if algorithm != "" && !seen[algorithm] {
+			seen[algorithm] = true
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+
+	add(c.Algorithm)
+	for _, rule := range c.EncryptionRules {
+		add(rule.Algorithm)
+	}
+	for _, mount := range c.Mounts {
+		add(mount.Algorithm)
+	}
+	for _, user := range c.Users {
+		add(user.Algorithm)
+	}
+	return algorithms
+}
+
+// AutoSelectedAlgorithm 配置中使用了algorithm: auto时返回自动选择的算法，否则返回空字符串
+func (c *Config) AutoSelectedAlgorithm() string {
+	return c.autoAlgorithm
+}
+
 // Validate 验证配置的有效性
 func (c *Config) Validate() error {
-	// 检查必要的配置项
-	if c.BackendURL == "" {
+	// 检查必要的配置项，使用虚拟挂载点或多租户时由各挂载点或用户提供后端
+	if c.BackendURL == "" && c.LocalDir == "" && len(c.Mounts) == 0 && len(c.Users) == 0 {
 		return fmt.Errorf("backend URL is required")
 	}
 
 	if c.Password == "" {
-		return fmt.Errorf("encryption password is required")
+		needPassword := (len(c.Mounts) == 0 && len(c.Users) == 0) || (len(c.Users) > 0 && c.BackendURL != "")
+		for _, mount := range c.Mounts {
+			if mount.Password == "" {
+				needPassword = true
+			}
+		}
+		for _, user := range c.Users {
+			if user.EncryptionPassword == "" {
+				needPassword = true
+			}
+		}
+		if needPassword {
+			return fmt.Errorf("encryption password is required")
+		}
 	}
 
 	// 验证算法
-	validAlgorithms := []string{"mix", "rc4", "aesctr"}
-	valid := false
-	for _, alg := range validAlgorithms {
-		if c.Algorithm == alg {
-			valid = true
-			break
+	if !isValidAlgorithm(c.Algorithm) {
+		return fmt.Errorf("invalid algorithm: %s, supported: %v", c.Algorithm, encryption.EncryptorTypes())
+	}
+
+	// 验证按路径指定的加密参数
+	rulePrefixes := make(map[string]bool)
+	for _, rule := range c.EncryptionRules {
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			return fmt.Errorf("encryption rule prefix must start with /: %s", rule.Prefix)
+		}
+		prefix := path.Clean(rule.Prefix)
+		if rulePrefixes[prefix] {
+			return fmt.Errorf("duplicate encryption rule prefix: %s", prefix)
+		}
+		rulePrefixes[prefix] = true
+		if rule.Algorithm != "" && !isValidAlgorithm(rule.Algorithm) {
+			return fmt.Errorf("invalid algorithm for encryption rule %s: %s, supported: %v", prefix, rule.Algorithm, encryption.EncryptorTypes())
+		}
+	}
+
+	// 验证虚拟挂载点
+	prefixes := make(map[string]bool)
+	for _, mount := range c.Mounts {
+		prefix := "/" + strings.Trim(mount.Prefix, "/")
+		if prefix == "/" {
+			return fmt.Errorf("mount prefix must not be empty or /")
+		}
+		if prefixes[prefix] {
+			return fmt.Errorf("duplicate mount prefix: %s", prefix)
+		}
+		prefixes[prefix] = true
+		if mount.BackendURL == "" {
+			return fmt.Errorf("backend URL is required for mount %s", prefix)
+		}
+		if mount.Algorithm != "" && !isValidAlgorithm(mount.Algorithm) {
+			return fmt.Errorf("invalid algorithm for mount %s: %s, supported: %v", prefix, mount.Algorithm, encryption.EncryptorTypes())
+		}
+	}
+
+	// 验证本地目录模式
+	if c.LocalDir != "" && (len(c.Mounts) > 0 || len(c.Users) > 0) {
+		return fmt.Errorf("local_dir cannot be combined with mounts or users")
+	}
+
+	// 验证后端认证方式，透传模式下由后端负责认证，不能同时启用代理认证
+	if c.BackendAuth != "" && c.BackendAuth != "static" && c.BackendAuth != "passthrough" {
+		return fmt.Errorf("invalid backend auth mode: %s, supported: [static passthrough]", c.BackendAuth)
+	}
+	if c.BackendAuth == "passthrough" && (c.AuthUser != "" || len(c.AuthTokens) > 0 || c.OIDCIssuer != "" || len(c.Users) > 0) {
+		return fmt.Errorf("backend_auth passthrough cannot be combined with proxy authentication")
+	}
+	// 分享链接的请求没有客户端凭据，只能使用固定的后端认证
+	if c.ShareSecret != "" && c.BackendAuth == "passthrough" {
+		return fmt.Errorf("share_secret cannot be combined with backend_auth passthrough")
+	}
+	if c.ShareMaxExpiry < 0 {
+		return fmt.Errorf("share max expiry must not be negative")
+	}
+
+	// 验证多租户用户
+	if len(c.Users) > 0 && len(c.Mounts) > 0 {
+		return fmt.Errorf("users and mounts cannot be used together")
+	}
+	usernames := make(map[string]bool)
+	for _, user := range c.Users {
+		if user.Username == "" || user.Password == "" {
+			return fmt.Errorf("username and password are required for every user")
+		}
+		if usernames[user.Username] {
+			return fmt.Errorf("duplicate user: %s", user.Username)
+		}
+		usernames[user.Username] = true
+		if user.BackendURL == "" {
+			return fmt.Errorf("backend URL is required for user %s", user.Username)
+		}
+		if user.Algorithm != "" && !isValidAlgorithm(user.Algorithm) {
+			return fmt.Errorf("invalid algorithm for user %s: %s, supported: %v", user.Username, user.Algorithm, encryption.EncryptorTypes())
+		}
+	}
+
+	// 验证负载均衡策略
+	if c.LoadBalance != "" && c.LoadBalance != "round_robin" && c.LoadBalance != "least_latency" {
+		return fmt.Errorf("invalid load balance strategy: %s, supported: [round_robin least_latency]", c.LoadBalance)
+	}
+
+	// 验证备用后端配置
+	if c.FailoverWrites != "" && c.FailoverWrites != "block" && c.FailoverWrites != "fallback" {
+		return fmt.Errorf("invalid failover writes mode: %s, supported: [block fallback]", c.FailoverWrites)
+	}
+	if c.FallbackBackendURL != "" && c.HealthCheckInterval <= 0 {
+		return fmt.Errorf("fallback_backend_url requires health_check_interval to be set")
+	}
+
+	// 验证文件判断规则
+	if c.MinEncryptSize < 0 {
+		return fmt.Errorf("min encrypt size must not be negative")
+	}
+	if c.MinEncryptSize > 64<<20 {
+		return fmt.Errorf("min encrypt size must not exceed 64MiB")
+	}
+
+	// 验证压缩配置
+	switch c.Compress {
+	case "", "gzip":
+	case "zstd":
+		return fmt.Errorf("zstd compression is not available in this build, supported: [gzip]")
+	default:
+		return fmt.Errorf("invalid compress: %s, supported: [gzip]", c.Compress)
+	}
+	if c.Compress != "" && c.SplitUploadSize > 0 {
+		return fmt.Errorf("compress cannot be combined with split_upload_size")
+	}
+	if c.Compress != "" && c.LocalDir != "" {
+		return fmt.Errorf("compress cannot be combined with local_dir")
+	}
+
+	// 验证重定向配置
+	if c.RedirectMode != "" && c.RedirectMode != "follow" && c.RedirectMode != "rewrite" {
+		return fmt.Errorf("invalid redirect mode: %s, supported: [follow rewrite]", c.RedirectMode)
+	}
+	if c.RedirectMaxHops < 0 {
+		return fmt.Errorf("redirect max hops must not be negative")
+	}
+
+	// 验证不加密的路径规则
+	for _, rule := range c.ExcludePaths {
+		if rule == "" {
+			return fmt.Errorf("exclude_paths must not contain empty rules")
+		}
+		if expr, ok := strings.CutPrefix(rule, "re:"); ok {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("invalid exclude path %q: %w", rule, err)
+			}
+		}
+	}
+
+	// 验证Cache-Control规则
+	for _, rule := range c.CacheControlRules {
+		if rule.Path == "" {
+			return fmt.Errorf("cache_control_rules must not contain empty paths")
+		}
+		if expr, ok := strings.CutPrefix(rule.Path, "re:"); ok {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("invalid cache control path %q: %w", rule.Path, err)
+			}
 		}
 	}
-	if !valid {
-		return fmt.Errorf("invalid algorithm: %s, supported: %v", c.Algorithm, validAlgorithms)
+
+	// 验证请求头和响应头规则
+	for _, rule := range append(append([]HeaderRuleConfig{}, c.RequestHeaders...), c.ResponseHeaders...) {
+		if rule.Name == "" {
+			return fmt.Errorf("header rules must have a name")
+		}
+		if rule.Action != "" && rule.Action != "set" && rule.Action != "add" && rule.Action != "remove" {
+			return fmt.Errorf("invalid header rule action: %s, supported: [set add remove]", rule.Action)
+		}
 	}
 
 	// 验证分块大小
@@ -92,12 +516,194 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("chunk size must be positive")
 	}
 
+	// 验证允许的方法
+	for _, method := range c.AllowedMethods {
+		if !isSupportedMethod(method) {
+			return fmt.Errorf("invalid allowed method: %s, supported: %v", method, supportedMethods)
+		}
+	}
+
+	// 验证CORS配置
+	for _, method := range c.CORSAllowedMethods {
+		if !isSupportedMethod(method) && !strings.EqualFold(method, "OPTIONS") {
+			return fmt.Errorf("invalid CORS allowed method: %s, supported: %v", method, supportedMethods)
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		return fmt.Errorf("CORS max age must not be negative")
+	}
+	if c.CORSAllowCredentials {
+		for _, origin := range c.CORSAllowedOrigins {
+			if strings.TrimSpace(origin) == "*" {
+				return fmt.Errorf("cors_allowed_origins \"*\" cannot be combined with cors_allow_credentials, list the allowed origins instead")
+			}
+		}
+	}
+	if c.HSTSMaxAge < 0 {
+		return fmt.Errorf("HSTS max age must not be negative")
+	}
+
+	// 验证限流配置
+	if c.RateLimitKey != "" && c.RateLimitKey != "ip" && c.RateLimitKey != "user" {
+		return fmt.Errorf("invalid rate limit key: %s, supported: [ip user]", c.RateLimitKey)
+	}
+	if c.TraceBodyBytes < 0 || c.TraceBodyBytes > 64<<10 {
+		return fmt.Errorf("trace body bytes must be between 0 and 64KiB")
+	}
+	if c.QuotaBytes < 0 {
+		return fmt.Errorf("quota bytes must not be negative")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		return fmt.Errorf("server timeouts must not be negative")
+	}
+	if c.MetadataTimeout < 0 || c.DataTimeout < 0 {
+		return fmt.Errorf("request timeouts must not be negative")
+	}
+	for method, timeout := range c.MethodTimeouts {
+		if !isSupportedMethod(method) {
+			return fmt.Errorf("invalid method in method timeouts: %s", method)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("request timeouts must not be negative")
+		}
+	}
+	if c.RetryCount < 0 || c.RetryBackoff < 0 || c.RetryMaxBackoff < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	if c.HealthCheckMethod != "" && !strings.EqualFold(c.HealthCheckMethod, "OPTIONS") && !strings.EqualFold(c.HealthCheckMethod, "PROPFIND") {
+		return fmt.Errorf("invalid health check method: %s, supported: [OPTIONS PROPFIND]", c.HealthCheckMethod)
+	}
+	if c.HealthCheckInterval < 0 {
+		return fmt.Errorf("health check interval must not be negative")
+	}
+	if c.MaxConcurrentTransfers < 0 {
+		return fmt.Errorf("max concurrent transfers must not be negative")
+	}
+	if c.KeyCacheSize < 0 || c.KeyCacheTTL < 0 {
+		return fmt.Errorf("key cache settings must not be negative")
+	}
+	if c.PropfindCacheTTL < 0 {
+		return fmt.Errorf("propfind cache ttl must not be negative")
+	}
+	if c.ReadAheadChunks < 0 || c.ReadAheadChunkSize < 0 {
+		return fmt.Errorf("read ahead settings must not be negative")
+	}
+	if c.ParallelDownloadThreshold < 0 {
+		return fmt.Errorf("parallel download threshold must not be negative")
+	}
+	if c.ParallelDownloadThreshold > 0 && (c.ParallelDownloadConnections < 2 || c.ParallelDownloadSegmentSize <= 0) {
+		return fmt.Errorf("parallel download requires at least 2 connections and a positive segment size")
+	}
+	if c.OCChecksum != "" && c.OCChecksum != "strip" && c.OCChecksum != "passthrough" {
+		return fmt.Errorf("invalid oc checksum mode: %s, supported: [strip passthrough]", c.OCChecksum)
+	}
+	if c.TusPath != "" && c.TusDir == "" {
+		return fmt.Errorf("tus_dir is required when tus_path is set")
+	}
+	if err := c.validateStatusPath(); err != nil {
+		return err
+	}
+	if c.TusMaxSize < 0 || c.TusExpiration < 0 {
+		return fmt.Errorf("tus settings must not be negative")
+	}
+	if c.SFTPListen != "" {
+		if c.SFTPHostKey == "" {
+			return fmt.Errorf("sftp_host_key is required when sftp_listen is set")
+		}
+		if !c.EnableAuth && c.SFTPAuthorizedKeys == "" {
+			return fmt.Errorf("sftp_listen requires proxy authentication or sftp_authorized_keys")
+		}
+		if c.SFTPAuthorizedKeys != "" && !strings.Contains(c.SFTPAuthorizedKeys, "%u") {
+			return fmt.Errorf("sftp_authorized_keys must contain %%u")
+		}
+	}
+	if c.TrashRetention < 0 {
+		return fmt.Errorf("trash retention must not be negative")
+	}
+	if c.TrashDir != "" && strings.Trim(c.TrashDir, "/") == "" {
+		return fmt.Errorf("trash_dir must not be the root directory")
+	}
+	if c.VersionsDir != "" && strings.Trim(c.VersionsDir, "/") == "" {
+		return fmt.Errorf("versions_dir must not be the root directory")
+	}
+	if c.VersionsDir != "" && c.VersionsKeep < 1 {
+		return fmt.Errorf("versions_keep must be at least 1")
+	}
+	if c.WebhookURL != "" {
+		if !strings.HasPrefix(c.WebhookURL, "http://") && !strings.HasPrefix(c.WebhookURL, "https://") {
+			return fmt.Errorf("invalid webhook url: %s", c.WebhookURL)
+		}
+	}
+	if c.WebhookRetries < 0 || c.WebhookTimeout < 0 {
+		return fmt.Errorf("webhook settings must not be negative")
+	}
+	if c.LockMode != "" && c.LockMode != "passthrough" && c.LockMode != "local" {
+		return fmt.Errorf("invalid lock mode: %s, supported: [passthrough local]", c.LockMode)
+	}
+	if c.LockMode == "local" && c.LockTimeout <= 0 {
+		return fmt.Errorf("lock_timeout must be positive when lock_mode is local")
+	}
+	if c.SplitUploadSize != 0 && c.SplitUploadSize < 1<<20 {
+		return fmt.Errorf("split upload size must be 0 or at least 1MiB")
+	}
+	if c.BlockCacheDir != "" && (c.BlockCacheSize <= 0 || c.BlockCacheBlockSize <= 0) {
+		return fmt.Errorf("block cache size and block size must be positive")
+	}
+	if c.MaxUploadRate < 0 || c.MaxDownloadRate < 0 || c.MaxTransferRate < 0 {
+		return fmt.Errorf("bandwidth limits must not be negative")
+	}
+	if c.RateLimitRequests < 0 || c.RateLimitBurst < 0 || c.RateLimitBandwidth < 0 {
+		return fmt.Errorf("rate limit values must not be negative")
+	}
+
 	// 验证认证配置
 	// 这里不再强制要求auth user和pass，因为已经在main.go中处理了auth逻辑
 
 	return nil
 }
 
+// supportedMethods 代理支持转发的HTTP方法
+var supportedMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+// validateStatusPath 检查传输状态端点的路径。该路径上的GET返回传输列表而不是后端的文件，
+// 不能是根目录，也不能与健康检查、TUS端点或虚拟挂载点重叠
+func (c *Config) validateStatusPath() error {
+	if c.StatusPath == "" {
+		return nil
+	}
+	status := "/" + strings.Trim(c.StatusPath, "/")
+	if !strings.HasPrefix(c.StatusPath, "/") || status == "/" {
+		return fmt.Errorf("status_path must be an absolute path other than /: %s", c.StatusPath)
+	}
+	for name, other := range map[string]string{"health_path": c.HealthPath, "tus_path": c.TusPath} {
+		if other != "" && pathsOverlap(status, other) {
+			return fmt.Errorf("status_path %s overlaps %s %s", c.StatusPath, name, other)
+		}
+	}
+	for _, mount := range c.Mounts {
+		if pathsOverlap(status, mount.Prefix) {
+			return fmt.Errorf("status_path %s overlaps mount %s", c.StatusPath, mount.Prefix)
+		}
+	}
+	return nil
+}
+
+// pathsOverlap 检查两个路径是否相同或一个在另一个之下
+func pathsOverlap(a, b string) bool {
+	a, b = "/"+strings.Trim(a, "/"), "/"+strings.Trim(b, "/")
+	return a == b || strings.HasPrefix(a, strings.TrimSuffix(b, "/")+"/") || strings.HasPrefix(b, strings.TrimSuffix(a, "/")+"/")
+}
+
+// isSupportedMethod 检查方法是否是代理支持的方法
+func isSupportedMethod(method string) bool {
+	for _, m := range supportedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetLogLevel 获取日志级别
 func (c *Config) GetLogLevel() utils.LogLevel {
 	// 如果Debug为true，则使用Debug级别（向后兼容）
@@ -113,35 +719,163 @@ func loadDefaults(cfg *Config) error {
 	// 使用默认值初始化
 	cfg.ListenAddr = ":8080"
 	cfg.Algorithm = "aesctr"
+	cfg.LoadBalance = "round_robin"
+	cfg.BackendAuth = "static"
+	cfg.FailoverWrites = "block"
 	cfg.ChunkSize = 8192
 	cfg.Debug = false
 	cfg.LogLevel = "info"
 	cfg.EnableAuth = false
+	cfg.AuthMaxFailures = 10
+	cfg.ShareMaxExpiry = 7 * 24 * time.Hour
+	cfg.AuthFailureWindow = 5 * time.Minute
+	cfg.AuthBanDuration = 15 * time.Minute
+	cfg.QuotaStateFile = "quota.json"
+	cfg.TusDir = "tus-uploads"
+	cfg.NextcloudChunking = true
+	cfg.RestoreContentType = true
+	cfg.RedirectMode = "follow"
+	cfg.RedirectMaxHops = 10
+	cfg.CacheControl = "no-cache, no-store, must-revalidate"
+	cfg.OCChecksum = "strip"
+	cfg.TusExpiration = 24 * time.Hour
+	cfg.SFTPHostKey = "sftp_host_ed25519_key"
+	cfg.TrashRetention = 30 * 24 * time.Hour
+	cfg.VersionsKeep = 10
+	cfg.WebhookRetries = 3
+	cfg.WebhookTimeout = 10 * time.Second
+	cfg.LockMode = "passthrough"
+	cfg.LockTimeout = time.Hour
+	cfg.BlockCacheSize = 1 << 30
+	cfg.BlockCacheBlockSize = 1 << 20
+	cfg.ReadAheadChunkSize = 256 << 10
+	cfg.KeyCacheSize = 1000
+	cfg.KeyCacheTTL = time.Hour
+	cfg.ParallelDownloadConnections = 4
+	cfg.ParallelDownloadSegmentSize = 8 << 20
+	cfg.RateLimitKey = "ip"
+	cfg.ReadTimeout = 300 * time.Second
+	cfg.WriteTimeout = 300 * time.Second
+	cfg.IdleTimeout = 60 * time.Second
+	cfg.ShutdownTimeout = 60 * time.Second
+	cfg.CORSMaxAge = 10 * time.Minute
+	cfg.MaxHeaderBytes = 1 << 20
+	cfg.MetadataTimeout = 300 * time.Second
+	cfg.DataTimeout = 300 * time.Second
+	cfg.RetryCount = 2
+	cfg.RetryBackoff = 500 * time.Millisecond
+	cfg.RetryMaxBackoff = 10 * time.Second
+	cfg.RetryStatusCodes = []int{502, 503, 504}
+	cfg.HealthPath = "/health"
+	cfg.HealthCheckTimeout = 5 * time.Second
+	cfg.HealthCheckMethod = "OPTIONS"
+	cfg.UnhealthyThreshold = 3
+	cfg.HealthyThreshold = 1
 	cfg.Timeout = 30 * time.Second
 	cfg.MaxIdleConns = 100
 	cfg.MaxIdleConnsPerHost = 10
 	cfg.IdleConnTimeout = 90 * time.Second
+	cfg.ExpectContinueTimeout = 500 * time.Millisecond
 	// 设置默认公共DNS服务器（Google DNS）
 	cfg.DnsServers = []string{"8.8.8.8:53", "8.8.4.4:53"}
 	return nil
 }
 
-// 从配置文件加载
+// 从配置文件加载，先按顺序加载include列出的文件，再用本文件的值覆盖
 func loadFromFile(filePath string, cfg *Config) error {
-	data, err := os.ReadFile(filePath)
+	return loadConfigFile(filePath, cfg, nil)
+}
+
+// loadConfigFile 加载一个配置文件及其包含的文件，chain为正在加载的文件链，用于检查循环包含
+func loadConfigFile(filePath string, cfg *Config, chain []string) error {
+	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return fmt.Errorf("read config file: %w", err)
 	}
+	for _, loading := range chain {
+		if loading == absPath {
+			return fmt.Errorf("config include cycle: %s -> %s", strings.Join(chain, " -> "), absPath)
+		}
+	}
+	chain = append(chain, absPath)
+
+	data, err := readConfigFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	var includes struct {
+		Include []string `yaml:"include"`
+	}
+	if err := yaml.Unmarshal(data, &includes); err != nil {
+		return fmt.Errorf("parse config file %s: %w", filePath, err)
+	}
+	for _, pattern := range includes.Include {
+		// 相对路径相对于包含它的文件所在的目录
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(absPath), pattern)
+		}
+		files := []string{pattern}
+		// 通配符没有匹配到文件时忽略，不带通配符的文件必须存在
+		if strings.ContainsAny(pattern, "*?[") {
+			if files, err = filepath.Glob(pattern); err != nil {
+				return fmt.Errorf("invalid include pattern in %s: %w", filePath, err)
+			}
+		}
+		for _, file := range files {
+			if err := loadConfigFile(file, cfg, chain); err != nil {
+				return err
+			}
+		}
+	}
 
 	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return fmt.Errorf("parse config file: %w", err)
+		return fmt.Errorf("parse config file %s: %w", filePath, err)
 	}
+	cfg.recordFileSources(data, filePath)
 
 	return nil
 }
 
+// readConfigFile 读取配置文件并统一转换为YAML，按扩展名识别TOML和JSON格式，其他扩展名按YAML解析
+func readConfigFile(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".toml":
+		data, err = tomlToYAML(data)
+	case ".json":
+		// JSON是YAML的子集，检查格式后直接按YAML解析
+		if !json.Valid(data) {
+			var v any
+			err = json.Unmarshal(data, &v)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", filePath, err)
+	}
+	return data, nil
+}
+
+// tomlToYAML 把TOML配置转换为YAML，使各种格式共用yaml标签和自定义的解析方法
+func tomlToYAML(data []byte) ([]byte, error) {
+	var values map[string]any
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(values)
+}
+
 // GenerateDefaultConfig 生成默认的YAML配置文件，包含中文解释
 func GenerateDefaultConfig(filePath string) error {
+	// 只能生成YAML格式的配置文件
+	if ext := strings.ToLower(filepath.Ext(filePath)); ext == ".toml" || ext == ".json" {
+		return fmt.Errorf("default config can only be generated in YAML format, not %s", ext)
+	}
+
 	// 创建配置文件目录
 	dir := filepath.Dir(filePath)
 	if dir != "." {
@@ -153,20 +887,116 @@ func GenerateDefaultConfig(filePath string) error {
 	// 使用硬编码的YAML内容，包含示例值和清晰的注释
 	content := `# WebDAV Proxy 配置文件
 
+# 包含的其他配置文件 (可选，按顺序加载后再应用本文件中的值，本文件优先；相对路径相对于本文件所在目录，支持通配符，例如: ["base.yaml", "secrets/*.yaml"])
+include: []
+
 ## 服务端设置
 # 后端WebDAV服务器URL (必填项，必须修改为实际的WebDAV服务器地址)
 backend_url: "http://10.10.2.140:5244/dav"
+# 本地目录模式 (可选，设置后不再代理到backend_url，而是直接把该目录作为加密WebDAV服务器，文件内容加密后保存在磁盘上)
+local_dir: ""
 # 后端WebDAV用户名 (可选，如果后端服务器需要认证)
 backend_user: ""
 # 后端WebDAV密码 (可选，如果后端服务器需要认证)
 backend_pass: ""
+# 后端认证方式 (可选，默认: static，可选项: static使用上面的后端用户名和密码, passthrough将客户端的认证信息原样转发给后端)
+backend_auth: "static"
+# 发往后端的请求使用的User-Agent (可选，默认为空表示保留客户端的User-Agent)
+# 部分服务商会限制或拒绝不认识的客户端，可以填写完整的User-Agent，或使用预设名称模仿常见的WebDAV客户端:
+# windows, finder, davfs2, rclone, cyberduck, winscp
+backend_user_agent: ""
+# 其他等价后端URL列表 (可选，这些后端必须与backend_url保存完全相同的数据，例如同步复制的WebDAV集群)
+backend_urls: []
+# 多后端选择策略 (可选，默认: round_robin，可选项: round_robin, least_latency。least_latency需要启用健康检查)
+load_balance: "round_robin"
+# 备用后端URL (可选，所有主后端不可用时读请求切换到该后端，需要设置health_check_interval)
+fallback_backend_url: ""
+# 切换到备用后端后写请求的处理方式 (可选，默认: block，可选项: block拒绝写请求并返回503, fallback写入备用后端)
+failover_writes: "block"
 
 
 ## 加密设置
-# 加密算法 (可选，默认: aesctr，可选项: mix, rc4, aesctr)
+# 加密算法 (可选，默认: aesctr，可选项: aesctr, chacha20, rc4, mix，以及插件注册的算法)
+# auto在有AES硬件指令的CPU上选择aesctr，否则选择chacha20。不同算法加密的文件互不兼容，已有数据时请固定算法
 algorithm: aesctr
+# 启动时对使用的每种算法做加密→解密往返自检，失败时拒绝启动 (可选，默认: false)
+self_test: false
+# 加密器插件文件列表 (可选，需要使用 -tags plugins 构建代理，例如: ["/opt/webdav-proxy/plugins/chacha.so"])
+encryptor_plugins: []
+# 加解密所有非集合路径的内容，不再根据Content-Type和扩展名判断是否为文件 (可选，默认: false)
+# 默认情况下没有扩展名、Content-Type为text/html、application/json等的上传不会加密
+encrypt_all: false
+# 判断请求内容是否为文件的规则，只有文件才会加解密，encrypt_all为true时不使用
+# 额外视为文件的扩展名 (可选，默认为空，例如: [".md", ".epub"])
+file_extensions: []
+# 额外视为文件的Content-Type前缀，优先于非文件类型 (可选，默认为空，例如: ["application/json"])
+file_content_types: []
+# 额外视为非文件的Content-Type前缀 (可选，默认为空，例如: ["text/markdown"])
+non_file_content_types: []
+# 使用上面三个列表替换内置列表，而不是追加到内置列表之后 (可选，默认: false)
+replace_file_detection: false
+# 小于该大小的文件不加密，修改后之前上传的小文件需要重新上传 (可选，默认: 0 表示不限制，例如: 4KB)
+min_encrypt_size: 0
+# 按路径前缀指定加密算法和密码 (可选)，多条规则匹配时最长的前缀优先，未匹配的路径使用上面的algorithm和password
+# 使用虚拟挂载点时前缀为挂载点内的路径；修改规则后已上传的文件需要用原来的参数下载后重新上传
+# encryption_rules:
+#   - prefix: /photos
+#     algorithm: aesctr
+#     password: "photos-password"
+#   - prefix: /docs
+#     algorithm: rc4
+encryption_rules: []
+# 加密前的压缩算法 (可选，默认为空表示不压缩，可选项: gzip)
+# 明文按256KiB分块压缩后再加密，后端额外保存一个 文件名.zindex 索引文件，Range请求只读取需要的数据块
+compress: ""
+# 后端返回application/octet-stream等通用类型时，按扩展名或解密后开头的明文恢复Content-Type (可选，默认: true)
+restore_content_type: true
+# 下载时后端返回301/302/303/307/308重定向的处理方式 (可选，默认: follow，可选项: follow, rewrite)
+# follow由代理跟随重定向并解密；rewrite把Location改写为带签名的代理地址，由客户端重新通过代理请求
+redirect_mode: follow
+# 最多跟随的重定向次数 (可选，默认: 10)
+redirect_max_hops: 10
+# 允许重定向到的主机，支持*通配符，例如 ["*.cdn.example.com"] (可选，默认为空表示允许所有主机)
+redirect_allow_hosts: []
+# 解密后的文件下载响应的Cache-Control (可选，默认: "no-cache, no-store, must-revalidate"，设置为空表示保留后端返回的值)
+cache_control: "no-cache, no-store, must-revalidate"
+# 按路径指定Cache-Control，使用第一条匹配的规则，路径语法与exclude_paths相同 (可选)
+# 例如不会修改的媒体文件允许客户端缓存一年:
+# cache_control_rules:
+#   - path: "/media/**"
+#     value: "private, max-age=31536000, immutable"
+cache_control_rules: []
+# 修改发往后端的请求头 (可选)，按顺序应用，action可选项: set(默认), add, remove
+# value中可以使用占位符: {client_ip}客户端IP, {host}客户端请求的Host, {scheme}客户端使用的协议, {user}认证用户名
+# request_headers:
+#   - name: X-Provider-Token
+#     value: "token"
+#   - name: X-Forwarded-Host
+#     value: "{host}"
+#   - name: X-Forwarded-For
+#     action: remove
+request_headers: []
+# 修改后端返回的响应头 (可选)，格式与request_headers相同，例如去掉后端的Server头:
+# response_headers:
+#   - name: Server
+#     action: remove
+response_headers: []
+# 不加密的路径规则，命中的文件原样上传和下载 (可选，默认为空表示全部加密)
+# 以 / 开头的规则匹配完整路径，否则只匹配文件名；* 不跨越目录，** 匹配任意多级目录，re: 前缀表示正则表达式
+# 例如: ["/public/**", "*.nfo", "re:^/media/.*\\.srt$"]
+exclude_paths: []
 # 加密密码 (可选，如果不设置则不进行加密)
+# 密码、密钥和令牌可以用 webdav-encrypt config encrypt-secrets 加密为 enc:v1: 开头的值，
+# 启动时使用CONFIG_MASTER_KEY环境变量或标准输入提供的主密钥解密
 password: "123456"
+# age加密保存的加密密码文件 (可选，默认为空)，password为空时启动时用age_identity_file解密得到加密密码，
+# 使用 webdav-encrypt config age-wrap 为age_recipients中的每个运维人员生成
+password_age_file: ""
+# 解密password_age_file的age身份文件，age-keygen生成的密钥或未设置口令的SSH私钥 (可选，默认为空)
+age_identity_file: ""
+# config age-wrap加密密码时的接收者 (可选，默认为空)，每一项是age公钥、SSH公钥或每行一个公钥的文件
+# 例如: ["age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", "/etc/webdav-encrypt/recipients.txt"]
+age_recipients: []
 
 
 ## 代理端设置
@@ -179,29 +1009,250 @@ enable_auth: false
 auth_user: ""
 # 代理认证密码 (可选，当启用代理端认证时使用)
 auth_pass: ""
+# 代理认证令牌列表 (可选，客户端可通过 "Authorization: Bearer <令牌>" 或 "X-Api-Key: <令牌>" 认证)
+auth_tokens: []
+
+# 认证失败封禁阈值 (可选，默认: 10，同一IP在计数窗口内认证失败达到该次数后临时封禁，0表示不封禁)
+auth_max_failures: 10
+# 认证失败计数窗口 (可选，默认: 5m)
+auth_failure_window: 5m
+# 封禁时长 (可选，默认: 15m)
+auth_ban_duration: 15m
+
+# OIDC令牌签发者 (可选，设置后接受该签发者颁发的JWT访问令牌，例如: "https://sso.example.com/realms/main")
+oidc_issuer: ""
+# OIDC令牌受众 (可选，设置后要求令牌的aud包含该值)
+oidc_audience: ""
+# OIDC JWKS地址 (可选，为空时通过签发者的 /.well-known/openid-configuration 自动获取)
+oidc_jwks_url: ""
+
+# 分享链接的签名密钥 (可选，设置后已认证的用户可以生成免登录的限时下载链接，请使用足够长的随机字符串)
+share_secret: ""
+# 分享链接的最长有效期 (可选，默认: 168h，0 表示不限制)
+share_max_expiry: 168h
+
+# 允许转发的HTTP方法 (可选，默认为空表示允许所有WebDAV方法，例如禁止删除和移动: ["GET", "HEAD", "PUT", "PROPFIND", "MKCOL"]，OPTIONS总是允许)
+allowed_methods: []
+
+# 允许浏览器跨域访问代理的来源 (可选，默认为空表示不启用CORS，例如: ["https://app.example.com", "https://*.example.com"]，"*"表示允许所有来源，不能与cors_allow_credentials同时使用)
+cors_allowed_origins: []
+# 允许跨域使用的方法 (可选，默认为空表示允许所有WebDAV方法，包括PROPFIND、MKCOL等)
+cors_allowed_methods: []
+# 允许跨域携带的请求头 (可选，默认为空表示使用内置列表: Authorization, Depth, Destination, Overwrite, If, Lock-Token, Range等)
+cors_allowed_headers: []
+# 允许网页读取的响应头 (可选，默认为空表示使用内置列表: DAV, ETag, Content-Range, Lock-Token, Location等)
+cors_exposed_headers: []
+# 允许跨域请求携带Cookie和认证信息 (可选，默认: false，启用后响应中的来源为请求的Origin而不是*)
+cors_allow_credentials: false
+# 浏览器缓存预检请求结果的时间 (可选，默认: 10m)
+cors_max_age: 10m
+
+# 通过HTTPS访问代理时发送Strict-Transport-Security的有效期 (可选，默认: 0s 表示不发送，例如: 8760h)
+hsts_max_age: 0s
+# HSTS是否包含子域名 (可选，默认: false)
+hsts_include_subdomains: false
+# 发送X-Content-Type-Options: nosniff，禁止浏览器猜测内容类型 (可选，默认: false)
+content_type_nosniff: false
+
+
+## 限流与配额设置
+# 限流维度 (可选，默认: ip，可选项: ip, user。user表示按认证用户限流，未认证时按IP)
+rate_limit_key: "ip"
+# 每个客户端每秒请求数上限 (可选，默认: 0 表示不限制，超出时返回429)
+rate_limit_requests: 0
+# 请求突发上限 (可选，默认: 0 表示与每秒请求数相同)
+rate_limit_burst: 0
+# 每个客户端带宽上限，单位字节/秒，支持 KiB、MiB 等单位 (可选，默认: 0 表示不限制)
+rate_limit_bandwidth: 0
+
+# 每个用户的上传配额，单位字节，支持 MiB、GiB 等单位 (可选，默认: 0 表示不限制，超出时PUT返回507)
+quota_bytes: 0
+# 已用配额的持久化文件 (可选，默认: quota.json)
+quota_state_file: "quota.json"
+
+# TUS断点续传上传端点路径 (可选，默认为空表示不启用，如 /.tus)
+tus_path: ""
+# 暂存未完成上传的本地目录 (可选，默认: tus-uploads，暂存的是未加密的数据，请放在可信的磁盘上)
+tus_dir: "tus-uploads"
+# 单个上传的大小上限 (可选，默认: 0 表示不限制)
+tus_max_size: 0
+# 未完成的上传超过该时间没有新数据时删除 (可选，默认: 24h)
+tus_expiration: 24h
+
+# SFTP监听地址，设置后同时通过SFTP提供相同的加密存储 (可选，默认为空表示不启用，如 :2022)
+sftp_listen: ""
+# SFTP服务器的主机私钥文件，不存在时自动生成ed25519密钥 (可选，默认: sftp_host_ed25519_key)
+sftp_host_key: "sftp_host_ed25519_key"
+# 允许公钥登录的authorized_keys文件，路径中必须包含%u，替换为登录的用户名 (可选，默认为空表示只允许使用代理认证的密码登录)
+sftp_authorized_keys: ""
+
+# 回收站目录，设置后DELETE会把文件移动到该目录而不是直接删除 (可选，默认为空表示直接删除，如 /.trash)
+trash_dir: ""
+# 回收站中文件的保留时间，超过后自动清除 (可选，默认: 720h，0 表示不自动清除)
+trash_retention: 720h
+
+# 历史版本目录，设置后覆盖上传前会把旧文件复制到该目录 (可选，默认为空表示不保留历史版本，如 /.versions)
+versions_dir: ""
+# 每个文件保留的历史版本数量 (可选，默认: 10)
+versions_keep: 10
+
+# 事件通知地址，上传、删除、移动等写操作成功后POST一个JSON事件 (可选，默认为空表示不启用，如 "https://example.com/hooks/webdav")
+webhook_url: ""
+# 事件通知的签名密钥，设置后在 X-Webhook-Signature 头中携带 sha256=<HMAC-SHA256> (可选)
+webhook_secret: ""
+# 事件通知发送失败后的重试次数 (可选，默认: 3)
+webhook_retries: 3
+# 单次发送事件通知的超时时间 (可选，默认: 10s)
+webhook_timeout: 10s
+
+# 锁处理方式 (可选，默认: passthrough，支持: passthrough, local)
+# local: 由代理在内存中应答LOCK/UNLOCK，适用于不支持锁的后端，Windows资源管理器和Office需要锁才能保存
+lock_mode: "passthrough"
+# 内置锁管理器中锁的最长有效期，客户端请求更长或无限期的锁时使用该值 (可选，默认: 1h)
+lock_timeout: 1h
 
 
 ## 日志设置
 # 日志级别 (可选，默认: info，可选项: trace, debug, info, warn, error, fatal)
 log_level: "info"
+# 排查文件内容损坏时，在TRACE级别日志中以十六进制和ASCII记录每个上传下载加解密前后开头的字节 (可选，默认: 0 表示不记录，最大: 64KB，例如: 256)
+# 需要同时把log_level设置为trace，日志中会包含文件内容，排查完毕后应关闭
+trace_body_bytes: 0
 
 
 ## 性能设置
 # 块大小(字节) (可选，默认: 8192)
 chunk_size: 8192
+# 代理服务器读取请求超时时间 (可选，默认: 300s，0 表示不限制)
+read_timeout: 300s
+# 代理服务器写入响应超时时间 (可选，默认: 300s，0 表示不限制，下载超大文件时建议设置为 0)
+write_timeout: 300s
+# 代理服务器空闲连接超时时间 (可选，默认: 60s)
+idle_timeout: 60s
+# 关闭服务时等待进行中的上传下载完成的时间，超时后中止剩余的传输 (可选，默认: 60s，0 表示不等待)
+shutdown_timeout: 60s
+# 请求头最大字节数 (可选，默认: 1MiB)
+max_header_bytes: 1MiB
+# 元数据请求(PROPFIND、MKCOL、DELETE、MOVE等)的超时时间 (可选，默认: 300s，0 表示不限制，建议设置为较短的值如 30s)
+metadata_timeout: 300s
+# 数据传输请求(GET、PUT、POST)的超时时间 (可选，默认: 300s，0 表示不限制，传输数GB的大文件时建议设置为 0)
+data_timeout: 300s
+# 按方法单独指定超时时间 (可选，优先级高于上面两项，例如: {PROPFIND: 10s, GET: 0s})
+method_timeouts: {}
+# GET、HEAD、PROPFIND请求失败时的重试次数 (可选，默认: 2，0 表示不重试)
+retry_count: 2
+# 首次重试前的等待时间，之后每次翻倍 (可选，默认: 500ms)
+retry_backoff: 500ms
+# 单次重试等待时间上限 (可选，默认: 10s)
+retry_max_backoff: 10s
+# 需要重试的后端响应状态码 (可选，默认: [502, 503, 504])
+retry_status_codes: [502, 503, 504]
 # 请求超时时间 (可选，默认: 30s)
 timeout: 30s
+# 全局上传带宽上限，单位字节/秒，支持 KiB、MiB 等单位 (可选，默认: 0 表示不限制，例如: 10MiB)
+max_upload_rate: 0
+# 全局下载带宽上限 (可选，默认: 0 表示不限制)
+max_download_rate: 0
+# 单个传输的带宽上限 (可选，默认: 0 表示不限制)
+max_transfer_rate: 0
+# 同时进行的GET/PUT传输上限 (可选，默认: 0 表示不限制，小内存ARM设备建议设置为 4~8)
+max_concurrent_transfers: 0
+# 超出并发上限时的排队时间 (可选，默认: 0s 表示直接返回503)
+transfer_queue_timeout: 0s
+# 解密数据块缓存目录 (可选，默认为空表示不启用，启动时会清空该目录。缓存中保存的是解密后的明文，请放在可信的磁盘上)
+block_cache_dir: ""
+# 解密数据块缓存总大小上限 (可选，默认: 1GiB，超出时淘汰最久未使用的块)
+block_cache_size: 1GiB
+# 缓存块大小 (可选，默认: 1MiB)
+block_cache_block_size: 1MiB
+# 派生密钥缓存的最大项数，每个加密算法和密码的组合占一项 (可选，默认: 1000，超过时淘汰最近最少使用的项)
+key_cache_size: 1000
+# 派生密钥多长时间未使用后从缓存中清理 (可选，默认: 1h)
+key_cache_ttl: 1h
+# PROPFIND目录列表缓存时间 (可选，默认: 0s 表示不缓存，建议设置为 10s~60s)
+# 通过代理的PUT、DELETE、MOVE、COPY等写操作会立即使相关目录的缓存失效，直接修改后端的变化最多延迟该时间可见
+propfind_cache_ttl: 0s
+# 顺序下载(如媒体播放)时在内存中预读的块数 (可选，默认: 0 表示不启用，高延迟后端建议设置为 4~16)
+# 每个下载最多额外占用 read_ahead_chunks * read_ahead_chunk_size 内存
+read_ahead_chunks: 0
+# 预读块大小 (可选，默认: 256KiB)
+read_ahead_chunk_size: 256KiB
+# 下载范围达到该大小时从后端并行分段下载 (可选，默认: 0 表示不启用，后端单连接限速时建议设置为 64MiB 左右)
+# 后端需要支持Range请求，每个下载最多额外占用 parallel_download_connections * parallel_download_segment_size 内存
+parallel_download_threshold: 0
+# 并行下载的连接数 (可选，默认: 4)
+parallel_download_connections: 4
+# 并行下载的分段大小 (可选，默认: 8MiB)
+parallel_download_segment_size: 8MiB
+# 上传文件超过该大小时拆分为多个后端文件 (可选，默认: 0 表示不拆分，最小 1MiB)
+# 适用于限制单文件大小或会中断长时间上传的后端，分片保存为 文件名.part0001、文件名.part0002……，原路径保存清单
+split_upload_size: 0
+# 由代理合并Nextcloud/ownCloud客户端的分块上传 (可选，默认: true)
+# 分块按各自的大小加密，后端直接合并会得到无法解密的文件，启用后合并时由代理解密各分块并重新加密
+nextcloud_chunking: true
+# OC-Checksum处理方式 (可选，默认: strip，可选项: strip, passthrough)
+# 代理总是按客户端的OC-Checksum校验上传的明文，不一致时上传失败
+# strip: 不把校验和发给后端，并从GET响应头和PROPFIND中去掉后端的校验和（后端按密文计算的校验和会让客户端误认为文件损坏）
+# passthrough: 原样转发，适用于只保存客户端校验和、不自行计算的后端
+oc_checksum: "strip"
+# 把后端ETag转换为与明文内容对应、在GET/HEAD/PUT/PROPFIND中保持一致的ETag (可选，默认: false)
+# 首次启用或关闭时所有ETag都会变化，同步客户端可能会重新检查所有文件
+stable_etags: false
 # 最大空闲连接数 (可选，默认: 100)
 max_idle_conns: 100
 # 每个主机的最大空闲连接数 (可选，默认: 10)
 max_idle_conns_per_host: 10
 # 空闲连接超时时间 (可选，默认: 1m30s)
 idle_conn_timeout: 1m30s
+# 带 Expect: 100-continue 的上传等待后端响应的时间，超时后开始发送请求体 (可选，默认: 500ms)
+expect_continue_timeout: 500ms
+
+## 健康检查设置
+# 健康检查端点路径 (可选，默认: /health，不需要认证，后端不可用时返回503，设置为空字符串表示不启用)
+health_path: "/health"
+# 传输状态端点路径，返回当前用户进行中的上传下载列表，路径加/events推送实时进度 (可选，默认: 空表示不启用，如: /.status，启用代理认证时需要认证，该路径下不能再存放文件)
+status_path: ""
+# 后端健康检查间隔 (可选，默认: 0s 表示不启用主动检查)
+health_check_interval: 0s
+# 单次健康检查超时时间 (可选，默认: 5s)
+health_check_timeout: 5s
+# 健康检查方法 (可选，默认: OPTIONS，可选项: OPTIONS, PROPFIND)
+health_check_method: "OPTIONS"
+# 连续失败多少次后标记后端不可用 (可选，默认: 3)
+unhealthy_threshold: 3
+# 连续成功多少次后恢复后端可用 (可选，默认: 1)
+healthy_threshold: 1
 
 ## DNS设置
 # 公共DNS服务器列表 (可选，默认: Google DNS)
 # 格式为：IP:端口,多个服务器用逗号分隔
 dns_servers: ["8.8.8.8:53", "8.8.4.4:53"]
+
+## 虚拟挂载点
+# 将不同的路径前缀映射到不同的后端 (可选)，设置后根目录由代理生成，只列出各挂载点，backend_url不再使用
+# 每个挂载点可以单独设置后端认证、加密算法和加密密码，未设置时使用上面的全局配置
+# mounts:
+#   - prefix: /dropbox
+#     backend_url: "https://dav.example.com/dropbox"
+#     backend_user: ""
+#     backend_pass: ""
+#     algorithm: aesctr
+#     password: ""
+#   - prefix: /nas
+#     backend_url: "http://10.10.2.140:5244/dav"
+mounts: []
+
+## 多租户用户
+# 每个代理用户使用独立的后端和加密密码 (可选)，用户之间的数据互相隔离
+# 未在此列出的用户（如auth_user）访问backend_url，未设置backend_url时返回403
+# users:
+#   - username: alice
+#     password: "alice-login-password"
+#     backend_url: "http://10.10.2.140:5244/dav/alice"
+#     backend_user: ""
+#     backend_pass: ""
+#     encryption_password: "alice-encryption-password"
+users: []
 `
 
 	// 写入文件
@@ -222,10 +1273,42 @@ func loadFromEnv(cfg *Config) error {
 		cfg.BackendURL = url
 	}
 
+	if localDir := os.Getenv("LOCAL_DIR"); localDir != "" {
+		cfg.LocalDir = localDir
+	}
+
+	if urls := os.Getenv("BACKEND_URLS"); urls != "" {
+		cfg.BackendURLs = ParseList(urls)
+	}
+
+	if fallbackURL := os.Getenv("FALLBACK_BACKEND_URL"); fallbackURL != "" {
+		cfg.FallbackBackendURL = fallbackURL
+	}
+
+	if failoverWrites := os.Getenv("FAILOVER_WRITES"); failoverWrites != "" {
+		cfg.FailoverWrites = failoverWrites
+	}
+
+	if loadBalance := os.Getenv("LOAD_BALANCE"); loadBalance != "" {
+		cfg.LoadBalance = loadBalance
+	}
+
 	if password := os.Getenv("PASSWORD"); password != "" {
 		cfg.Password = password
 	}
 
+	if file := os.Getenv("PASSWORD_AGE_FILE"); file != "" {
+		cfg.PasswordAgeFile = file
+	}
+
+	if file := os.Getenv("AGE_IDENTITY_FILE"); file != "" {
+		cfg.AgeIdentityFile = file
+	}
+
+	if recipients := os.Getenv("AGE_RECIPIENTS"); recipients != "" {
+		cfg.AgeRecipients = ParseList(recipients)
+	}
+
 	if alg := os.Getenv("ALGORITHM"); alg != "" {
 		cfg.Algorithm = alg
 	}
@@ -246,6 +1329,14 @@ func loadFromEnv(cfg *Config) error {
 		cfg.LogLevel = logLevel
 	}
 
+	if traceBytes := os.Getenv("TRACE_BODY_BYTES"); traceBytes != "" {
+		if val, err := ParseByteSize(traceBytes); err == nil {
+			cfg.TraceBodyBytes = val
+		} else {
+			return fmt.Errorf("invalid TRACE_BODY_BYTES: %w", err)
+		}
+	}
+
 	if user := os.Getenv("BACKEND_USER"); user != "" {
 		cfg.BackendUser = user
 	}
@@ -254,7 +1345,15 @@ func loadFromEnv(cfg *Config) error {
 		cfg.BackendPass = pass
 	}
 
-	if enableAuth := os.Getenv("ENABLE_AUTH"); enableAuth != "" {
+	if backendAuth := os.Getenv("BACKEND_AUTH"); backendAuth != "" {
+		cfg.BackendAuth = backendAuth
+	}
+
+	if userAgent := os.Getenv("BACKEND_USER_AGENT"); userAgent != "" {
+		cfg.BackendUserAgent = userAgent
+	}
+
+	if enableAuth := os.Getenv("ENABLE_AUTH"); enableAuth != "" {
 		cfg.EnableAuth = enableAuth == "true" || enableAuth == "1" || enableAuth == "yes" || enableAuth == "on"
 	}
 
@@ -266,6 +1365,605 @@ func loadFromEnv(cfg *Config) error {
 		cfg.AuthPass = pass
 	}
 
+	if tokens := os.Getenv("AUTH_TOKENS"); tokens != "" {
+		cfg.AuthTokens = ParseList(tokens)
+	}
+
+	if plugins := os.Getenv("ENCRYPTOR_PLUGINS"); plugins != "" {
+		cfg.EncryptorPlugins = ParseList(plugins)
+	}
+
+	if selfTest := os.Getenv("SELF_TEST"); selfTest != "" {
+		cfg.SelfTest = selfTest == "true" || selfTest == "1" || selfTest == "yes" || selfTest == "on"
+	}
+
+	if encryptAll := os.Getenv("ENCRYPT_ALL"); encryptAll != "" {
+		cfg.EncryptAll = encryptAll == "true" || encryptAll == "1" || encryptAll == "yes" || encryptAll == "on"
+	}
+
+	if extensions := os.Getenv("FILE_EXTENSIONS"); extensions != "" {
+		cfg.FileExtensions = ParseList(extensions)
+	}
+
+	if types := os.Getenv("FILE_CONTENT_TYPES"); types != "" {
+		cfg.FileContentTypes = ParseList(types)
+	}
+
+	if types := os.Getenv("NON_FILE_CONTENT_TYPES"); types != "" {
+		cfg.NonFileContentTypes = ParseList(types)
+	}
+
+	if replace := os.Getenv("REPLACE_FILE_DETECTION"); replace != "" {
+		cfg.ReplaceFileDetection = replace == "true" || replace == "1" || replace == "yes" || replace == "on"
+	}
+
+	if minSize := os.Getenv("MIN_ENCRYPT_SIZE"); minSize != "" {
+		if val, err := ParseByteSize(minSize); err == nil {
+			cfg.MinEncryptSize = val
+		} else {
+			return fmt.Errorf("invalid MIN_ENCRYPT_SIZE: %w", err)
+		}
+	}
+
+	if restore := os.Getenv("RESTORE_CONTENT_TYPE"); restore != "" {
+		cfg.RestoreContentType = restore == "true" || restore == "1" || restore == "yes" || restore == "on"
+	}
+
+	if redirectMode := os.Getenv("REDIRECT_MODE"); redirectMode != "" {
+		cfg.RedirectMode = redirectMode
+	}
+
+	if hops := os.Getenv("REDIRECT_MAX_HOPS"); hops != "" {
+		if n, err := strconv.Atoi(hops); err == nil {
+			cfg.RedirectMaxHops = n
+		} else {
+			return fmt.Errorf("invalid REDIRECT_MAX_HOPS: %w", err)
+		}
+	}
+
+	if allowHosts := os.Getenv("REDIRECT_ALLOW_HOSTS"); allowHosts != "" {
+		cfg.RedirectAllowHosts = ParseList(allowHosts)
+	}
+
+	if cacheControl, ok := os.LookupEnv("CACHE_CONTROL"); ok {
+		cfg.CacheControl = cacheControl
+	}
+
+	if compress := os.Getenv("COMPRESS"); compress != "" {
+		cfg.Compress = compress
+	}
+
+	if excludePaths := os.Getenv("EXCLUDE_PATHS"); excludePaths != "" {
+		cfg.ExcludePaths = ParseList(excludePaths)
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		cfg.OIDCIssuer = issuer
+	}
+
+	if audience := os.Getenv("OIDC_AUDIENCE"); audience != "" {
+		cfg.OIDCAudience = audience
+	}
+
+	if jwksURL := os.Getenv("OIDC_JWKS_URL"); jwksURL != "" {
+		cfg.OIDCJWKSURL = jwksURL
+	}
+
+	if shareSecret := os.Getenv("SHARE_SECRET"); shareSecret != "" {
+		cfg.ShareSecret = shareSecret
+	}
+
+	if maxExpiry := os.Getenv("SHARE_MAX_EXPIRY"); maxExpiry != "" {
+		if t, err := time.ParseDuration(maxExpiry); err == nil {
+			cfg.ShareMaxExpiry = t
+		} else {
+			return fmt.Errorf("invalid SHARE_MAX_EXPIRY: %w", err)
+		}
+	}
+
+	if maxFailures := os.Getenv("AUTH_MAX_FAILURES"); maxFailures != "" {
+		if val, err := strconv.Atoi(maxFailures); err == nil {
+			cfg.AuthMaxFailures = val
+		} else {
+			return fmt.Errorf("invalid AUTH_MAX_FAILURES: %w", err)
+		}
+	}
+
+	if window := os.Getenv("AUTH_FAILURE_WINDOW"); window != "" {
+		if t, err := time.ParseDuration(window); err == nil {
+			cfg.AuthFailureWindow = t
+		} else {
+			return fmt.Errorf("invalid AUTH_FAILURE_WINDOW: %w", err)
+		}
+	}
+
+	if ban := os.Getenv("AUTH_BAN_DURATION"); ban != "" {
+		if t, err := time.ParseDuration(ban); err == nil {
+			cfg.AuthBanDuration = t
+		} else {
+			return fmt.Errorf("invalid AUTH_BAN_DURATION: %w", err)
+		}
+	}
+
+	if methods := os.Getenv("ALLOWED_METHODS"); methods != "" {
+		cfg.AllowedMethods = ParseList(methods)
+	}
+
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		cfg.CORSAllowedOrigins = ParseList(origins)
+	}
+
+	if methods := os.Getenv("CORS_ALLOWED_METHODS"); methods != "" {
+		cfg.CORSAllowedMethods = ParseList(methods)
+	}
+
+	if headers := os.Getenv("CORS_ALLOWED_HEADERS"); headers != "" {
+		cfg.CORSAllowedHeaders = ParseList(headers)
+	}
+
+	if headers := os.Getenv("CORS_EXPOSED_HEADERS"); headers != "" {
+		cfg.CORSExposedHeaders = ParseList(headers)
+	}
+
+	if credentials := os.Getenv("CORS_ALLOW_CREDENTIALS"); credentials != "" {
+		cfg.CORSAllowCredentials = credentials == "true" || credentials == "1" || credentials == "yes" || credentials == "on"
+	}
+
+	if maxAge := os.Getenv("CORS_MAX_AGE"); maxAge != "" {
+		if t, err := time.ParseDuration(maxAge); err == nil {
+			cfg.CORSMaxAge = t
+		} else {
+			return fmt.Errorf("invalid CORS_MAX_AGE: %w", err)
+		}
+	}
+
+	if maxAge := os.Getenv("HSTS_MAX_AGE"); maxAge != "" {
+		if t, err := time.ParseDuration(maxAge); err == nil {
+			cfg.HSTSMaxAge = t
+		} else {
+			return fmt.Errorf("invalid HSTS_MAX_AGE: %w", err)
+		}
+	}
+
+	if subdomains := os.Getenv("HSTS_INCLUDE_SUBDOMAINS"); subdomains != "" {
+		cfg.HSTSIncludeSubdomains = subdomains == "true" || subdomains == "1" || subdomains == "yes" || subdomains == "on"
+	}
+
+	if nosniff := os.Getenv("CONTENT_TYPE_NOSNIFF"); nosniff != "" {
+		cfg.ContentTypeNosniff = nosniff == "true" || nosniff == "1" || nosniff == "yes" || nosniff == "on"
+	}
+
+	if quota := os.Getenv("QUOTA_BYTES"); quota != "" {
+		if val, err := ParseByteSize(quota); err == nil {
+			cfg.QuotaBytes = val
+		} else {
+			return fmt.Errorf("invalid QUOTA_BYTES: %w", err)
+		}
+	}
+
+	if stateFile := os.Getenv("QUOTA_STATE_FILE"); stateFile != "" {
+		cfg.QuotaStateFile = stateFile
+	}
+
+	if chunking := os.Getenv("NEXTCLOUD_CHUNKING"); chunking != "" {
+		cfg.NextcloudChunking = chunking == "true" || chunking == "1" || chunking == "yes" || chunking == "on"
+	}
+
+	if checksum := os.Getenv("OC_CHECKSUM"); checksum != "" {
+		cfg.OCChecksum = checksum
+	}
+
+	if stableETags := os.Getenv("STABLE_ETAGS"); stableETags != "" {
+		cfg.StableETags = stableETags == "true" || stableETags == "1" || stableETags == "yes" || stableETags == "on"
+	}
+
+	if tusPath := os.Getenv("TUS_PATH"); tusPath != "" {
+		cfg.TusPath = tusPath
+	}
+
+	if tusDir := os.Getenv("TUS_DIR"); tusDir != "" {
+		cfg.TusDir = tusDir
+	}
+
+	if maxSize := os.Getenv("TUS_MAX_SIZE"); maxSize != "" {
+		if val, err := ParseByteSize(maxSize); err == nil {
+			cfg.TusMaxSize = val
+		} else {
+			return fmt.Errorf("invalid TUS_MAX_SIZE: %w", err)
+		}
+	}
+
+	if expiration := os.Getenv("TUS_EXPIRATION"); expiration != "" {
+		if t, err := time.ParseDuration(expiration); err == nil {
+			cfg.TusExpiration = t
+		} else {
+			return fmt.Errorf("invalid TUS_EXPIRATION: %w", err)
+		}
+	}
+
+	if sftpListen := os.Getenv("SFTP_LISTEN"); sftpListen != "" {
+		cfg.SFTPListen = sftpListen
+	}
+
+	if hostKey := os.Getenv("SFTP_HOST_KEY"); hostKey != "" {
+		cfg.SFTPHostKey = hostKey
+	}
+
+	if authorizedKeys := os.Getenv("SFTP_AUTHORIZED_KEYS"); authorizedKeys != "" {
+		cfg.SFTPAuthorizedKeys = authorizedKeys
+	}
+
+	if trashDir := os.Getenv("TRASH_DIR"); trashDir != "" {
+		cfg.TrashDir = trashDir
+	}
+
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		if t, err := time.ParseDuration(retention); err == nil {
+			cfg.TrashRetention = t
+		} else {
+			return fmt.Errorf("invalid TRASH_RETENTION: %w", err)
+		}
+	}
+
+	if versionsDir := os.Getenv("VERSIONS_DIR"); versionsDir != "" {
+		cfg.VersionsDir = versionsDir
+	}
+
+	if keep := os.Getenv("VERSIONS_KEEP"); keep != "" {
+		if n, err := strconv.Atoi(keep); err == nil {
+			cfg.VersionsKeep = n
+		} else {
+			return fmt.Errorf("invalid VERSIONS_KEEP: %w", err)
+		}
+	}
+
+	if webhookURL := os.Getenv("WEBHOOK_URL"); webhookURL != "" {
+		cfg.WebhookURL = webhookURL
+	}
+
+	if webhookSecret := os.Getenv("WEBHOOK_SECRET"); webhookSecret != "" {
+		cfg.WebhookSecret = webhookSecret
+	}
+
+	if retries := os.Getenv("WEBHOOK_RETRIES"); retries != "" {
+		if n, err := strconv.Atoi(retries); err == nil {
+			cfg.WebhookRetries = n
+		} else {
+			return fmt.Errorf("invalid WEBHOOK_RETRIES: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("WEBHOOK_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.WebhookTimeout = t
+		} else {
+			return fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+		}
+	}
+
+	if lockMode := os.Getenv("LOCK_MODE"); lockMode != "" {
+		cfg.LockMode = lockMode
+	}
+
+	if lockTimeout := os.Getenv("LOCK_TIMEOUT"); lockTimeout != "" {
+		if t, err := time.ParseDuration(lockTimeout); err == nil {
+			cfg.LockTimeout = t
+		} else {
+			return fmt.Errorf("invalid LOCK_TIMEOUT: %w", err)
+		}
+	}
+
+	if key := os.Getenv("RATE_LIMIT_KEY"); key != "" {
+		cfg.RateLimitKey = key
+	}
+
+	if rps := os.Getenv("RATE_LIMIT_REQUESTS"); rps != "" {
+		if val, err := strconv.ParseFloat(rps, 64); err == nil {
+			cfg.RateLimitRequests = val
+		} else {
+			return fmt.Errorf("invalid RATE_LIMIT_REQUESTS: %w", err)
+		}
+	}
+
+	if burst := os.Getenv("RATE_LIMIT_BURST"); burst != "" {
+		if val, err := strconv.Atoi(burst); err == nil {
+			cfg.RateLimitBurst = val
+		} else {
+			return fmt.Errorf("invalid RATE_LIMIT_BURST: %w", err)
+		}
+	}
+
+	if bandwidth := os.Getenv("RATE_LIMIT_BANDWIDTH"); bandwidth != "" {
+		if val, err := ParseByteSize(bandwidth); err == nil {
+			cfg.RateLimitBandwidth = val
+		} else {
+			return fmt.Errorf("invalid RATE_LIMIT_BANDWIDTH: %w", err)
+		}
+	}
+
+	if rate := os.Getenv("MAX_UPLOAD_RATE"); rate != "" {
+		if val, err := ParseByteSize(rate); err == nil {
+			cfg.MaxUploadRate = val
+		} else {
+			return fmt.Errorf("invalid MAX_UPLOAD_RATE: %w", err)
+		}
+	}
+
+	if rate := os.Getenv("MAX_DOWNLOAD_RATE"); rate != "" {
+		if val, err := ParseByteSize(rate); err == nil {
+			cfg.MaxDownloadRate = val
+		} else {
+			return fmt.Errorf("invalid MAX_DOWNLOAD_RATE: %w", err)
+		}
+	}
+
+	if rate := os.Getenv("MAX_TRANSFER_RATE"); rate != "" {
+		if val, err := ParseByteSize(rate); err == nil {
+			cfg.MaxTransferRate = val
+		} else {
+			return fmt.Errorf("invalid MAX_TRANSFER_RATE: %w", err)
+		}
+	}
+
+	if maxTransfers := os.Getenv("MAX_CONCURRENT_TRANSFERS"); maxTransfers != "" {
+		if val, err := strconv.Atoi(maxTransfers); err == nil {
+			cfg.MaxConcurrentTransfers = val
+		} else {
+			return fmt.Errorf("invalid MAX_CONCURRENT_TRANSFERS: %w", err)
+		}
+	}
+
+	if queueTimeout := os.Getenv("TRANSFER_QUEUE_TIMEOUT"); queueTimeout != "" {
+		if t, err := time.ParseDuration(queueTimeout); err == nil {
+			cfg.TransferQueueTimeout = t
+		} else {
+			return fmt.Errorf("invalid TRANSFER_QUEUE_TIMEOUT: %w", err)
+		}
+	}
+
+	if cacheDir := os.Getenv("BLOCK_CACHE_DIR"); cacheDir != "" {
+		cfg.BlockCacheDir = cacheDir
+	}
+
+	if cacheSize := os.Getenv("BLOCK_CACHE_SIZE"); cacheSize != "" {
+		if val, err := ParseByteSize(cacheSize); err == nil {
+			cfg.BlockCacheSize = val
+		} else {
+			return fmt.Errorf("invalid BLOCK_CACHE_SIZE: %w", err)
+		}
+	}
+
+	if blockSize := os.Getenv("BLOCK_CACHE_BLOCK_SIZE"); blockSize != "" {
+		if val, err := ParseByteSize(blockSize); err == nil {
+			cfg.BlockCacheBlockSize = val
+		} else {
+			return fmt.Errorf("invalid BLOCK_CACHE_BLOCK_SIZE: %w", err)
+		}
+	}
+
+	if size := os.Getenv("KEY_CACHE_SIZE"); size != "" {
+		if val, err := strconv.Atoi(size); err == nil {
+			cfg.KeyCacheSize = val
+		} else {
+			return fmt.Errorf("invalid KEY_CACHE_SIZE: %w", err)
+		}
+	}
+
+	if ttl := os.Getenv("KEY_CACHE_TTL"); ttl != "" {
+		if t, err := time.ParseDuration(ttl); err == nil {
+			cfg.KeyCacheTTL = t
+		} else {
+			return fmt.Errorf("invalid KEY_CACHE_TTL: %w", err)
+		}
+	}
+
+	if ttl := os.Getenv("PROPFIND_CACHE_TTL"); ttl != "" {
+		if t, err := time.ParseDuration(ttl); err == nil {
+			cfg.PropfindCacheTTL = t
+		} else {
+			return fmt.Errorf("invalid PROPFIND_CACHE_TTL: %w", err)
+		}
+	}
+
+	if chunks := os.Getenv("READ_AHEAD_CHUNKS"); chunks != "" {
+		if val, err := strconv.Atoi(chunks); err == nil {
+			cfg.ReadAheadChunks = val
+		} else {
+			return fmt.Errorf("invalid READ_AHEAD_CHUNKS: %w", err)
+		}
+	}
+
+	if chunkSize := os.Getenv("READ_AHEAD_CHUNK_SIZE"); chunkSize != "" {
+		if val, err := ParseByteSize(chunkSize); err == nil {
+			cfg.ReadAheadChunkSize = val
+		} else {
+			return fmt.Errorf("invalid READ_AHEAD_CHUNK_SIZE: %w", err)
+		}
+	}
+
+	if threshold := os.Getenv("PARALLEL_DOWNLOAD_THRESHOLD"); threshold != "" {
+		if val, err := ParseByteSize(threshold); err == nil {
+			cfg.ParallelDownloadThreshold = val
+		} else {
+			return fmt.Errorf("invalid PARALLEL_DOWNLOAD_THRESHOLD: %w", err)
+		}
+	}
+
+	if connections := os.Getenv("PARALLEL_DOWNLOAD_CONNECTIONS"); connections != "" {
+		if val, err := strconv.Atoi(connections); err == nil {
+			cfg.ParallelDownloadConnections = val
+		} else {
+			return fmt.Errorf("invalid PARALLEL_DOWNLOAD_CONNECTIONS: %w", err)
+		}
+	}
+
+	if segmentSize := os.Getenv("PARALLEL_DOWNLOAD_SEGMENT_SIZE"); segmentSize != "" {
+		if val, err := ParseByteSize(segmentSize); err == nil {
+			cfg.ParallelDownloadSegmentSize = val
+		} else {
+			return fmt.Errorf("invalid PARALLEL_DOWNLOAD_SEGMENT_SIZE: %w", err)
+		}
+	}
+
+	if splitSize := os.Getenv("SPLIT_UPLOAD_SIZE"); splitSize != "" {
+		if val, err := ParseByteSize(splitSize); err == nil {
+			cfg.SplitUploadSize = val
+		} else {
+			return fmt.Errorf("invalid SPLIT_UPLOAD_SIZE: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("READ_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.ReadTimeout = t
+		} else {
+			return fmt.Errorf("invalid READ_TIMEOUT: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("WRITE_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.WriteTimeout = t
+		} else {
+			return fmt.Errorf("invalid WRITE_TIMEOUT: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("IDLE_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.IdleTimeout = t
+		} else {
+			return fmt.Errorf("invalid IDLE_TIMEOUT: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("SHUTDOWN_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.ShutdownTimeout = t
+		} else {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		}
+	}
+
+	if headerBytes := os.Getenv("MAX_HEADER_BYTES"); headerBytes != "" {
+		if val, err := ParseByteSize(headerBytes); err == nil {
+			cfg.MaxHeaderBytes = val
+		} else {
+			return fmt.Errorf("invalid MAX_HEADER_BYTES: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("METADATA_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.MetadataTimeout = t
+		} else {
+			return fmt.Errorf("invalid METADATA_TIMEOUT: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("DATA_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.DataTimeout = t
+		} else {
+			return fmt.Errorf("invalid DATA_TIMEOUT: %w", err)
+		}
+	}
+
+	if methodTimeouts := os.Getenv("METHOD_TIMEOUTS"); methodTimeouts != "" {
+		// 解析方法超时列表，格式为：方法=时长,方法=时长
+		cfg.MethodTimeouts = make(map[string]time.Duration)
+		for _, item := range ParseList(methodTimeouts) {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid METHOD_TIMEOUTS: %s", item)
+			}
+			t, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return fmt.Errorf("invalid METHOD_TIMEOUTS: %w", err)
+			}
+			cfg.MethodTimeouts[strings.ToUpper(strings.TrimSpace(parts[0]))] = t
+		}
+	}
+
+	if retryCount := os.Getenv("RETRY_COUNT"); retryCount != "" {
+		if val, err := strconv.Atoi(retryCount); err == nil {
+			cfg.RetryCount = val
+		} else {
+			return fmt.Errorf("invalid RETRY_COUNT: %w", err)
+		}
+	}
+
+	if backoff := os.Getenv("RETRY_BACKOFF"); backoff != "" {
+		if t, err := time.ParseDuration(backoff); err == nil {
+			cfg.RetryBackoff = t
+		} else {
+			return fmt.Errorf("invalid RETRY_BACKOFF: %w", err)
+		}
+	}
+
+	if maxBackoff := os.Getenv("RETRY_MAX_BACKOFF"); maxBackoff != "" {
+		if t, err := time.ParseDuration(maxBackoff); err == nil {
+			cfg.RetryMaxBackoff = t
+		} else {
+			return fmt.Errorf("invalid RETRY_MAX_BACKOFF: %w", err)
+		}
+	}
+
+	if codes := os.Getenv("RETRY_STATUS_CODES"); codes != "" {
+		cfg.RetryStatusCodes = []int{}
+		for _, code := range ParseList(codes) {
+			val, err := strconv.Atoi(code)
+			if err != nil {
+				return fmt.Errorf("invalid RETRY_STATUS_CODES: %w", err)
+			}
+			cfg.RetryStatusCodes = append(cfg.RetryStatusCodes, val)
+		}
+	}
+
+	if healthPath, ok := os.LookupEnv("HEALTH_PATH"); ok {
+		cfg.HealthPath = healthPath
+	}
+
+	if statusPath := os.Getenv("STATUS_PATH"); statusPath != "" {
+		cfg.StatusPath = statusPath
+	}
+
+	if interval := os.Getenv("HEALTH_CHECK_INTERVAL"); interval != "" {
+		if t, err := time.ParseDuration(interval); err == nil {
+			cfg.HealthCheckInterval = t
+		} else {
+			return fmt.Errorf("invalid HEALTH_CHECK_INTERVAL: %w", err)
+		}
+	}
+
+	if timeout := os.Getenv("HEALTH_CHECK_TIMEOUT"); timeout != "" {
+		if t, err := time.ParseDuration(timeout); err == nil {
+			cfg.HealthCheckTimeout = t
+		} else {
+			return fmt.Errorf("invalid HEALTH_CHECK_TIMEOUT: %w", err)
+		}
+	}
+
+	if method := os.Getenv("HEALTH_CHECK_METHOD"); method != "" {
+		cfg.HealthCheckMethod = method
+	}
+
+	if threshold := os.Getenv("UNHEALTHY_THRESHOLD"); threshold != "" {
+		if val, err := strconv.Atoi(threshold); err == nil {
+			cfg.UnhealthyThreshold = val
+		} else {
+			return fmt.Errorf("invalid UNHEALTHY_THRESHOLD: %w", err)
+		}
+	}
+
+	if threshold := os.Getenv("HEALTHY_THRESHOLD"); threshold != "" {
+		if val, err := strconv.Atoi(threshold); err == nil {
+			cfg.HealthyThreshold = val
+		} else {
+			return fmt.Errorf("invalid HEALTHY_THRESHOLD: %w", err)
+		}
+	}
+
 	if timeout := os.Getenv("TIMEOUT"); timeout != "" {
 		if t, err := time.ParseDuration(timeout); err == nil {
 			cfg.Timeout = t
@@ -298,14 +1996,17 @@ func loadFromEnv(cfg *Config) error {
 		}
 	}
 
+	if expectTimeout := os.Getenv("EXPECT_CONTINUE_TIMEOUT"); expectTimeout != "" {
+		if t, err := time.ParseDuration(expectTimeout); err == nil {
+			cfg.ExpectContinueTimeout = t
+		} else {
+			return fmt.Errorf("invalid EXPECT_CONTINUE_TIMEOUT: %w", err)
+		}
+	}
+
 	if dnsServers := os.Getenv("DNS_SERVERS"); dnsServers != "" {
 		// 解析DNS服务器列表，格式为：IP:端口,IP:端口
-		cfg.DnsServers = []string{}
-		for _, server := range strings.Split(dnsServers, ",") {
-			if server = strings.TrimSpace(server); server != "" {
-				cfg.DnsServers = append(cfg.DnsServers, server)
-			}
-		}
+		cfg.DnsServers = ParseList(dnsServers)
 		// 如果解析结果为空，使用默认值
 		if len(cfg.DnsServers) == 0 {
 			cfg.DnsServers = []string{"8.8.8.8:53", "8.8.4.4:53"}
@@ -314,3 +2015,14 @@ func loadFromEnv(cfg *Config) error {
 
 	return nil
 }
+
+// ParseList 解析逗号分隔的列表，忽略空白项
+func ParseList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maskedValue 替换敏感配置项的占位符
+const maskedValue = "******"
+
+// Dump 以YAML格式输出配置，不是默认值的配置项后面以注释注明来源。
+// 密码、密钥、令牌和URL中的密码会被屏蔽，输出结果可以作为配置文件使用
+func (c *Config) Dump(w io.Writer) error {
+	masked := *c
+	masked.Password = maskSecret(c.Password)
+	masked.BackendPass = maskSecret(c.BackendPass)
+	masked.AuthPass = maskSecret(c.AuthPass)
+	masked.ShareSecret = maskSecret(c.ShareSecret)
+	masked.WebhookSecret = maskSecret(c.WebhookSecret)
+	masked.AuthTokens = make([]string, len(c.AuthTokens))
+	for i, token := range c.AuthTokens {
+		masked.AuthTokens[i] = maskSecret(token)
+	}
+
+	masked.BackendURL = maskURL(c.BackendURL)
+	masked.FallbackBackendURL = maskURL(c.FallbackBackendURL)
+	masked.WebhookURL = maskURL(c.WebhookURL)
+	masked.BackendURLs = make([]string, len(c.BackendURLs))
+	for i, backendURL := range c.BackendURLs {
+		masked.BackendURLs[i] = maskURL(backendURL)
+	}
+
+	masked.EncryptionRules = make([]EncryptionRuleConfig, len(c.EncryptionRules))
+	for i, rule := range c.EncryptionRules {
+		rule.Password = maskSecret(rule.Password)
+		masked.EncryptionRules[i] = rule
+	}
+	masked.Mounts = make([]MountConfig, len(c.Mounts))
+	for i, mount := range c.Mounts {
+		mount.BackendURL = maskURL(mount.BackendURL)
+		mount.BackendPass = maskSecret(mount.BackendPass)
+		mount.Password = maskSecret(mount.Password)
+		masked.Mounts[i] = mount
+	}
+	masked.Users = make([]UserConfig, len(c.Users))
+	for i, user := range c.Users {
+		user.Password = maskSecret(user.Password)
+		user.BackendURL = maskURL(user.BackendURL)
+		user.BackendPass = maskSecret(user.BackendPass)
+		user.EncryptionPassword = maskSecret(user.EncryptionPassword)
+		masked.Users[i] = user
+	}
+
+	// 在不是默认值的配置项后面注明来源
+	var doc yaml.Node
+	if err := doc.Encode(&masked); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if source := c.Source(doc.Content[i].Value); source != "" {
+			doc.Content[i].LineComment = source
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// maskSecret 屏蔽非空的敏感值，空值保持为空以便区分是否设置
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return maskedValue
+}
+
+// maskURL 屏蔽URL中的密码
+func maskURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
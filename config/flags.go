@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source 返回配置项的来源描述，如"命令行参数 --listen"、"环境变量 BACKEND_URL"、"配置文件 config.yaml"，
+// 使用默认值时返回空字符串。key为配置文件中的键名
+func (c *Config) Source(key string) string {
+	return c.sources[key]
+}
+
+// setSource 记录配置项的来源
+func (c *Config) setSource(key, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = source
+}
+
+// recordFileSources 记录配置文件中出现的配置项
+func (c *Config) recordFileSources(data []byte, filePath string) {
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return
+	}
+	for key := range values {
+		if key != "include" {
+			c.setSource(key, "配置文件 "+filePath)
+		}
+	}
+}
+
+// recordEnvSources 根据env标签记录由环境变量设置的配置项
+func (c *Config) recordEnvSources() {
+	t := reflect.TypeOf(*c)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		env := field.Tag.Get("env")
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if env == "" || key == "" || key == "-" {
+			continue
+		}
+		if os.Getenv(env) != "" {
+			c.setSource(key, "环境变量 "+env)
+		}
+	}
+}
+
+// applyFlags 应用用户显式指定的命令行参数，参数的缩写与完整参数名等价
+func (c *Config) applyFlags(flags map[string]string) error {
+	for name, value := range flags {
+		var key string
+		switch name {
+		case "listen":
+			key = "listen_addr"
+			c.ListenAddr = value
+		case "backend":
+			key = "backend_url"
+			c.BackendURL = value
+		case "password", "p":
+			key = "password"
+			c.Password = value
+			if value == PasswordFromStdin {
+				password, err := readPassword(false)
+				if err != nil {
+					return err
+				}
+				c.Password = password
+			}
+		case "password-prompt":
+			if prompt, _ := strconv.ParseBool(value); !prompt {
+				continue
+			}
+			password, err := readPassword(true)
+			if err != nil {
+				return err
+			}
+			key = "password"
+			c.Password = password
+		case "algorithm", "t":
+			key = "algorithm"
+			c.Algorithm = value
+		case "chunk-size":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid --chunk-size: %w", err)
+			}
+			key = "chunk_size"
+			c.ChunkSize = size
+		case "debug":
+			debug, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid --debug: %w", err)
+			}
+			key = "debug"
+			c.Debug = debug
+		case "backend-user":
+			key = "backend_user"
+			c.BackendUser = value
+		case "backend-pass":
+			key = "backend_pass"
+			c.BackendPass = value
+		case "auth-user":
+			key = "auth_user"
+			c.AuthUser = value
+		case "auth-pass":
+			key = "auth_pass"
+			c.AuthPass = value
+		case "auth-tokens":
+			key = "auth_tokens"
+			c.AuthTokens = ParseList(value)
+		default:
+			// --config等不对应配置项的参数
+			continue
+		}
+		prefix := "--"
+		if len(name) == 1 {
+			prefix = "-"
+		}
+		c.setSource(key, "命令行参数 "+prefix+name)
+	}
+	return nil
+}
+
+// resolveAuth 根据认证相关的配置决定是否启用代理端认证，配置文件和环境变量中的enable_auth不会直接生效：
+//  1. 设置了auth_user和auth_pass时，启用认证并使用这些凭据
+//  2. 否则设置了backend_user和backend_pass时，同步启用认证并使用后端的凭据；
+//     透传后端认证时由后端校验客户端凭据，不再同步启用
+//  3. 其他情况禁用认证
+//
+// 设置了令牌、OIDC或多租户用户时，无论是否有基本认证凭据都启用认证
+func (c *Config) resolveAuth() {
+	switch {
+	case c.AuthUser != "" && c.AuthPass != "":
+		c.EnableAuth = true
+	case c.BackendAuth != "passthrough" && c.BackendUser != "" && c.BackendPass != "":
+		c.EnableAuth = true
+		c.AuthUser = c.BackendUser
+		c.AuthPass = c.BackendPass
+	default:
+		c.EnableAuth = false
+		c.AuthUser = ""
+		c.AuthPass = ""
+	}
+	if len(c.AuthTokens) > 0 || c.OIDCIssuer != "" || len(c.Users) > 0 {
+		c.EnableAuth = true
+	}
+}
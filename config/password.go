@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// PasswordFromStdin --password的值为-时从标准输入读取加密密码
+const PasswordFromStdin = "-"
+
+// SecretsFDEnv 平滑升级时旧进程通过该环境变量告诉新进程传递密钥的管道描述符。
+// 密钥本身不放在环境变量中，环境变量会出现在/proc/<pid>/environ中并被所有子进程继承
+const SecretsFDEnv = "WEBDAV_PROXY_SECRETS_FD"
+
+// 从标准输入或终端读取的密钥在交接数据中的名称
+const (
+	inputSecretPassword  = "password"
+	inputSecretMasterKey = "master_key"
+)
+
+// inputSecrets 本进程从标准输入或终端读取的密钥，平滑升级时交给新进程，新进程不再重复读取
+var (
+	inputSecretsMu sync.Mutex
+	inputSecrets   = map[string]string{}
+)
+
+// inheritedSecrets 旧进程通过管道传入的密钥，只读取一次
+var inheritedSecrets = sync.OnceValues(loadInheritedSecrets)
+
+// loadInheritedSecrets 读取旧进程通过管道传入的密钥，不是由平滑升级启动时返回空
+func loadInheritedSecrets() (map[string]string, error) {
+	fd := os.Getenv(SecretsFDEnv)
+	if fd == "" {
+		return nil, nil
+	}
+	os.Unsetenv(SecretsFDEnv)
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SecretsFDEnv, err)
+	}
+	f := os.NewFile(uintptr(n), "secrets")
+	defer f.Close()
+	var secrets map[string]string
+	if err := json.NewDecoder(f).Decode(&secrets); err != nil {
+		return nil, fmt.Errorf("read inherited secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// inputSecret 返回name对应的已输入密钥：先查找本进程读取过的，再查找旧进程传入的
+func inputSecret(name string) (string, error) {
+	inputSecretsMu.Lock()
+	value := inputSecrets[name]
+	inputSecretsMu.Unlock()
+	if value != "" {
+		return value, nil
+	}
+	secrets, err := inheritedSecrets()
+	if err != nil {
+		return "", err
+	}
+	if value := secrets[name]; value != "" {
+		setInputSecret(name, value)
+		return value, nil
+	}
+	return "", nil
+}
+
+// setInputSecret 记录从标准输入或终端读取的密钥
+func setInputSecret(name, value string) {
+	inputSecretsMu.Lock()
+	inputSecrets[name] = value
+	inputSecretsMu.Unlock()
+}
+
+// InputSecrets 返回本进程从标准输入或终端读取的全部密钥，平滑升级时写入管道交给新进程
+func InputSecrets() ([]byte, error) {
+	inputSecretsMu.Lock()
+	defer inputSecretsMu.Unlock()
+	return json.Marshal(inputSecrets)
+}
+
+// stdin 读取主密钥和加密密码共用的标准输入，两者都从管道读取时按行依次读取
+var stdin = bufio.NewReader(os.Stdin)
+
+// readStdinLine 从标准输入读取一行，去掉行尾的换行符
+func readStdinLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword 读取加密密码，prompt为true时在终端上提示输入并隐藏输入的内容，需要输入两次确认，
+// 否则从标准输入读取一行。密码不会出现在命令行参数、shell历史和ps的输出中
+func readPassword(prompt bool) (string, error) {
+	password, err := inputSecret(inputSecretPassword)
+	if err != nil || password != "" {
+		return password, err
+	}
+
+	if prompt {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return "", fmt.Errorf("--password-prompt requires a terminal, use --password - to read the password from a pipe")
+		}
+		fmt.Fprint(os.Stderr, "请输入加密密码: ")
+		first, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		// 输错的密码会让之后上传的文件无法用正确的密码解密，需要确认
+		fmt.Fprint(os.Stderr, "请再次输入加密密码: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		if string(first) != string(second) {
+			return "", fmt.Errorf("passwords do not match")
+		}
+		password = string(first)
+	} else {
+		line, err := readStdinLine()
+		if err != nil {
+			return "", fmt.Errorf("read password from stdin: %w", err)
+		}
+		password = line
+	}
+
+	if password == "" {
+		return "", fmt.Errorf("password is empty")
+	}
+	setInputSecret(inputSecretPassword, password)
+	return password, nil
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package config
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestReadPasswordFromInheritedPipe(t *testing.T) {
+	// 标准输入为空且不是终端，只能使用旧进程传入的密码
+	resetInputSecrets(t, "")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.Write([]byte(`{"password":"inherited-secret"}`))
+	w.Close()
+	// 读取后描述符会被关闭，传入复制的描述符
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(SecretsFDEnv, strconv.Itoa(fd))
+
+	password, err := readPassword(true)
+	if err != nil || password != "inherited-secret" {
+		t.Fatalf("期望使用旧进程传入的密码，实际为%q, %v", password, err)
+	}
+	if os.Getenv(SecretsFDEnv) != "" {
+		t.Errorf("读取后应清除%s，避免传给子进程", SecretsFDEnv)
+	}
+	// 新进程再次升级时继续交接同一密码
+	if password, err := readPassword(false); err != nil || password != "inherited-secret" {
+		t.Errorf("期望继续使用旧进程传入的密码，实际为%q, %v", password, err)
+	}
+}
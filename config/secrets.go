@@ -0,0 +1,252 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MasterKeyEnv 提供主密钥的环境变量，未设置时从标准输入读取
+const MasterKeyEnv = "CONFIG_MASTER_KEY"
+
+// 加密后的配置值格式为 enc:v1:<base64(盐|随机数|密文)>，
+// 使用PBKDF2-SHA256从主密钥派生AES-256-GCM密钥，每个值使用独立的盐
+const (
+	secretPrefix     = "enc:v1:"
+	secretSaltSize   = 16
+	secretIterations = 600000
+)
+
+// secretKeys 配置文件中需要加密保存的键名，出现在顶层、mounts、users和encryption_rules中
+var secretKeys = map[string]bool{
+	"password":            true,
+	"backend_pass":        true,
+	"auth_pass":           true,
+	"auth_tokens":         true,
+	"share_secret":        true,
+	"webhook_secret":      true,
+	"encryption_password": true,
+}
+
+// IsEncryptedSecret 判断配置值是否为加密后的格式
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// EncryptSecret 使用主密钥加密配置值
+func EncryptSecret(plaintext, masterKey string) (string, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := secretCipher(masterKey, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := append(salt, nonce...)
+	data = aead.Seal(data, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptSecret 使用主密钥解密EncryptSecret加密的配置值
+func DecryptSecret(value, masterKey string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	if len(data) < secretSaltSize {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	aead, err := secretCipher(masterKey, data[:secretSaltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[secretSaltSize:]
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("wrong master key or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+// secretCipher 从主密钥和盐派生AES-GCM加密器
+func secretCipher(masterKey string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, masterKey, salt, secretIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadMasterKey 读取主密钥，优先使用CONFIG_MASTER_KEY环境变量，否则从标准输入读取一行。
+// 从标准输入读取的主密钥与加密密码一样，平滑升级时通过管道交给新进程
+func ReadMasterKey() (string, error) {
+	if key := os.Getenv(MasterKeyEnv); key != "" {
+		return key, nil
+	}
+	key, err := inputSecret(inputSecretMasterKey)
+	if err != nil || key != "" {
+		return key, err
+	}
+	key, err = readStdinLine()
+	if err != nil {
+		return "", fmt.Errorf("read master key from stdin: %w", err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("master key is empty, set %s or write it to stdin", MasterKeyEnv)
+	}
+	setInputSecret(inputSecretMasterKey, key)
+	return key, nil
+}
+
+// secretField 需要解密的配置项
+type secretField struct {
+	name  string
+	value *string
+}
+
+// secretFields 返回所有敏感配置项，名称用于错误信息
+func (c *Config) secretFields() []secretField {
+	fields := []secretField{
+		{"password", &c.Password},
+		{"backend_pass", &c.BackendPass},
+		{"auth_pass", &c.AuthPass},
+		{"share_secret", &c.ShareSecret},
+		{"webhook_secret", &c.WebhookSecret},
+	}
+	for i := range c.AuthTokens {
+		fields = append(fields, secretField{fmt.Sprintf("auth_tokens[%d]", i), &c.AuthTokens[i]})
+	}
+	for i := range c.EncryptionRules {
+		fields = append(fields, secretField{fmt.Sprintf("encryption_rules[%d].password", i), &c.EncryptionRules[i].Password})
+	}
+	for i := range c.Mounts {
+		fields = append(fields,
+			secretField{fmt.Sprintf("mounts[%d].backend_pass", i), &c.Mounts[i].BackendPass},
+			secretField{fmt.Sprintf("mounts[%d].password", i), &c.Mounts[i].Password})
+	}
+	for i := range c.Users {
+		fields = append(fields,
+			secretField{fmt.Sprintf("users[%d].password", i), &c.Users[i].Password},
+			secretField{fmt.Sprintf("users[%d].backend_pass", i), &c.Users[i].BackendPass},
+			secretField{fmt.Sprintf("users[%d].encryption_password", i), &c.Users[i].EncryptionPassword})
+	}
+	return fields
+}
+
+// decryptSecrets 解密加密保存的配置项，没有加密的配置项时不读取主密钥
+func (c *Config) decryptSecrets() error {
+	var masterKey string
+	for _, field := range c.secretFields() {
+		if !IsEncryptedSecret(*field.value) {
+			continue
+		}
+		if masterKey == "" {
+			key, err := ReadMasterKey()
+			if err != nil {
+				return err
+			}
+			masterKey = key
+		}
+		plaintext, err := DecryptSecret(*field.value, masterKey)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", field.name, err)
+		}
+		*field.value = plaintext
+	}
+	return nil
+}
+
+// EncryptSecretsFile 加密YAML配置文件中明文保存的密码、密钥和令牌并写回原文件，
+// 已加密的值和include的文件不做处理，返回加密的配置项数量
+func EncryptSecretsFile(filePath, masterKey string) (int, error) {
+	if ext := strings.ToLower(filepath.Ext(filePath)); ext == ".toml" || ext == ".json" {
+		return 0, fmt.Errorf("encrypting secrets in %s config files is not supported, use YAML", ext)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("parse %s: %w", filePath, err)
+	}
+	count, err := encryptSecretNodes(&doc, masterKey)
+	if err != nil || count == 0 {
+		return count, err
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return 0, err
+	}
+	if err := encoder.Close(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+	return count, os.WriteFile(filePath, []byte(buf.String()), info.Mode().Perm())
+}
+
+// encryptSecretNodes 递归加密YAML节点中敏感键对应的值
+func encryptSecretNodes(node *yaml.Node, masterKey string) (int, error) {
+	count := 0
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := node.Content[i+1]
+			if !secretKeys[node.Content[i].Value] {
+				continue
+			}
+			values := []*yaml.Node{value}
+			if value.Kind == yaml.SequenceNode {
+				values = value.Content
+			}
+			for _, v := range values {
+				if v.Kind != yaml.ScalarNode || v.Tag == "!!null" || v.Value == "" || IsEncryptedSecret(v.Value) {
+					continue
+				}
+				encrypted, err := EncryptSecret(v.Value, masterKey)
+				if err != nil {
+					return count, err
+				}
+				v.Value = encrypted
+				v.Tag = "!!str"
+				v.Style = 0
+				count++
+			}
+		}
+	}
+	for _, child := range node.Content {
+		n, err := encryptSecretNodes(child, masterKey)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
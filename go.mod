@@ -5,6 +5,18 @@ go 1.24.0
 toolchain go1.24.11
 
 require (
+	filippo.io/age v1.2.1
+	github.com/BurntSushi/toml v1.6.0
+	github.com/hanwen/go-fuse/v2 v2.11.0
+	github.com/pkg/sftp v1.13.7
+	golang.org/x/crypto v0.44.0
 	golang.org/x/net v0.47.0
+	golang.org/x/sys v0.38.0
+	golang.org/x/term v0.37.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+)
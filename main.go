@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"webdav-proxy/config"
-	"webdav-proxy/proxy"
+	"webdav-proxy/pkg/davclient"
+	"webdav-proxy/pkg/dirsync"
+	"webdav-proxy/pkg/encryption"
+	"webdav-proxy/pkg/fusefs"
+	"webdav-proxy/pkg/proxy"
+	"webdav-proxy/pkg/sftpd"
 	"webdav-proxy/utils"
 )
 
@@ -24,6 +30,15 @@ const (
 	Version = "v20251208"
 )
 
+// 监听socket的名称，平滑升级时按名称把监听交给新进程，也用作systemd socket单元的FileDescriptorName
+const (
+	listenerHTTP = "http"
+	listenerSFTP = "sftp"
+)
+
+// listenerNames 所有监听socket的名称
+var listenerNames = []string{listenerHTTP, listenerSFTP}
+
 func main() {
 	// 添加版本参数
 	showVersion := flag.Bool("version", false, "显示版本信息")
@@ -33,46 +48,68 @@ func main() {
 		fmt.Println("WebDAV加密代理使用方法:")
 		fmt.Println()
 		fmt.Println("  webdav-encrypt [OPTIONS]")
+		fmt.Println("  webdav-encrypt config dump [OPTIONS]    打印合并后最终生效的配置（屏蔽密码）")
+		fmt.Println("  webdav-encrypt config encrypt-secrets -c FILE    用主密钥加密配置文件中明文保存的密码、密钥和令牌")
+		fmt.Println("  webdav-encrypt config age-wrap -c FILE [-p - | --password-prompt]    为age_recipients加密密码，写入password_age_file")
+		fmt.Println("  webdav-encrypt compat-test    用原Node.js版本的参考向量检查aesctr、rc4和mix算法的兼容性")
+		fmt.Println("  webdav-encrypt mount MOUNTPOINT [OPTIONS]    把解密后的后端挂载为本地只读文件系统（FUSE）")
+		fmt.Println("  webdav-encrypt sync LOCALDIR [REMOTEDIR] [OPTIONS]    把本地目录中新增和修改过的文件加密上传到后端")
+		fmt.Println("  webdav-encrypt fetch REMOTEDIR LOCALDIR [OPTIONS]    把后端目录解密下载到本地，支持断点续传")
 		fmt.Println()
 		fmt.Println("配置选项:")
 		// 自定义参数列表，将缩写和长参数合并显示，移除重复的默认值描述
 		fmt.Printf("  --listen             监听地址，默认: :8080\n")
-		fmt.Printf("  -p, --password       加密密码 (必填)\n")
-		fmt.Printf("  -t, --algorithm      加密算法，可选值: mix, rc4, aesctr (默认: aesctr)\n")
+		fmt.Printf("  -p, --password       加密密码 (必填)，为-时从标准输入读取一行\n")
+		fmt.Printf("  --password-prompt    在终端上提示输入加密密码，输入的内容不显示\n")
+		fmt.Printf("  -t, --algorithm      加密算法，可选值: aesctr, chacha20, rc4, mix, auto (默认: aesctr)\n")
 		fmt.Printf("  --backend            后端WebDAV服务器URL (必填)\n")
 		fmt.Printf("  --backend-user       后端WebDAV用户名\n")
 		fmt.Printf("  --backend-pass       后端WebDAV密码\n")
 		fmt.Printf("  --auth-user          代理认证用户名\n")
 		fmt.Printf("  --auth-pass          代理认证密码\n")
-		fmt.Printf("  -c, --config         配置文件路径 (YAML格式)\n")
+		fmt.Printf("  --auth-tokens        代理认证令牌列表，逗号分隔 (Bearer或X-Api-Key)\n")
+		fmt.Printf("  -c, --config         配置文件路径 (YAML、TOML或JSON格式)\n")
 		fmt.Printf("  --chunk-size         块大小(字节)，默认: 8192\n")
 		fmt.Printf("  --debug              启用调试模式，默认: false\n")
 		fmt.Printf("  --version            显示版本信息\n")
+		fmt.Printf("  --parallel           sync和fetch同时传输的文件数，默认: 4\n")
+		fmt.Printf("  --retries            sync和fetch传输失败后的重试次数，默认: 3\n")
+		fmt.Printf("  --interval           sync每隔多长时间重新同步一次（如5m），默认只同步一次\n")
+		fmt.Printf("  --include            sync和fetch只传输匹配的文件，逗号分隔，语法与exclude_paths相同\n")
+		fmt.Printf("  --exclude            sync和fetch不传输匹配的文件和目录，逗号分隔\n")
+		fmt.Printf("  --dry-run            sync和fetch只列出需要传输的文件，不实际传输\n")
+		fmt.Printf("  --state              sync保存上传记录的文件，记录本地文件和后端ETag以准确判断文件是否变化\n")
 		fmt.Printf("  -h, --help           显示帮助信息\n")
 
 		fmt.Println()
 		fmt.Println("注意事项:")
-		fmt.Println("  - 只有明确指定-c或--config参数时，才会使用配置文件")
-		fmt.Println("  - 同时提供命令行参数和配置文件时，命令行参数优先级更高")
+		fmt.Println("  - 通过-c/--config参数或CONFIG_FILE环境变量指定配置文件，都没有时不使用配置文件")
+		fmt.Println("  - 优先级从高到低为：命令行参数、环境变量、配置文件、默认值，没有显式指定的命令行参数不会覆盖其他来源的值")
+		fmt.Println("  - 使用config dump查看最终生效的配置及每一项的来源")
+		fmt.Println("  - 配置中有enc:v1:开头的加密值时，启动时从CONFIG_MASTER_KEY环境变量或标准输入读取主密钥")
+		fmt.Println("  - 使用--password -或--password-prompt时密码不会出现在shell历史和ps的输出中，与主密钥都从标准输入读取时先读取加密密码")
 		fmt.Println("  - 必须提供--backend和--password参数，或在配置文件中配置")
 		fmt.Println("  - 如果传入了--backend-user和--backend-pass，将自动启用代理端基本认证")
 		fmt.Println("  - 如果传入了--auth-user和--auth-pass，将启用代理端基本认证并使用这些凭据")
+		fmt.Println("  - 如果传入了--auth-tokens，将启用代理端令牌认证，可与基本认证同时使用")
 		fmt.Println()
 	}
 
-	// 命令行参数
+	// 命令行参数，解析后只有用户显式指定的参数会交给config包覆盖其他来源的值
+	flag.String("listen", ":8080", "监听地址，默认: :8080")
+	flag.String("backend", "", "后端WebDAV服务器URL (必填)")
+	flag.String("chunk-size", "8192", "块大小(字节)，默认: 8192")
+	flag.Bool("debug", false, "启用调试模式，默认: false")
+	flag.String("backend-user", "", "后端WebDAV用户名")
+	flag.String("backend-pass", "", "后端WebDAV密码")
+	flag.String("auth-user", "", "代理认证用户名")
+	flag.String("auth-pass", "", "代理认证密码")
+	flag.String("auth-tokens", "", "代理认证令牌列表，逗号分隔 (Bearer或X-Api-Key)")
+	flag.Bool("password-prompt", false, "在终端上提示输入加密密码，输入的内容不显示")
 	var (
-		listenAddr   = flag.String("listen", ":8080", "监听地址，默认: :8080")
-		backendURL   = flag.String("backend", "", "后端WebDAV服务器URL (必填)")
-		password     = flag.String("password", "", "加密密码 (必填) (简写: -p)")
-		algorithm    = flag.String("algorithm", "aesctr", "加密算法，可选值: mix, rc4, aesctr (默认: aesctr) (简写: -t)")
-		chunkSizeStr = flag.String("chunk-size", "8192", "块大小(字节)，默认: 8192")
-		debug        = flag.Bool("debug", false, "启用调试模式，默认: false")
-		backendUser  = flag.String("backend-user", "", "后端WebDAV用户名")
-		backendPass  = flag.String("backend-pass", "", "后端WebDAV密码")
-		authUser     = flag.String("auth-user", "", "代理认证用户名")
-		authPass     = flag.String("auth-pass", "", "代理认证密码")
-		configFile   = flag.String("config", "", "配置文件路径 (YAML格式) (简写: -c)")
+		password   = flag.String("password", "", "加密密码 (必填)，为-时从标准输入读取 (简写: -p)")
+		algorithm  = flag.String("algorithm", "aesctr", "加密算法，可选值: aesctr, chacha20, rc4, mix, auto (默认: aesctr) (简写: -t)")
+		configFile = flag.String("config", "", "配置文件路径 (YAML、TOML或JSON格式) (简写: -c)")
 	)
 	// 只添加缩写的变量映射，不显示在帮助信息中
 	flag.Bool("h", false, "显示帮助信息 (简写: -h)")
@@ -80,22 +117,57 @@ func main() {
 	flag.StringVar(password, "p", *password, "")
 	flag.StringVar(algorithm, "t", *algorithm, "")
 
+	// sync和fetch子命令的参数，不属于代理配置
+	var (
+		parallel = flag.Int("parallel", 4, "sync和fetch同时传输的文件数")
+		retries  = flag.Int("retries", 3, "sync和fetch传输失败后的重试次数")
+		interval = flag.Duration("interval", 0, "sync每隔多长时间重新同步一次，默认只同步一次")
+		include  = flag.String("include", "", "sync和fetch只传输匹配的文件，逗号分隔")
+		exclude  = flag.String("exclude", "", "sync和fetch不传输匹配的文件和目录，逗号分隔")
+		dryRun   = flag.Bool("dry-run", false, "sync和fetch只列出需要传输的文件，不实际传输")
+		state    = flag.String("state", "", "sync保存上传记录的文件")
+	)
+
 	// 解析命令行参数
 	flag.Parse()
 
+	// 子命令，前后都可以带参数：
+	//   config dump：合并默认值、配置文件、环境变量和命令行参数后打印最终生效的配置
+	//   config encrypt-secrets：加密配置文件中明文保存的密码、密钥和令牌
+	//   config age-wrap：为age_recipients加密密码，写入password_age_file
+	//   compat-test：检查内置算法与原Node.js版本的兼容性
+	//   mount MOUNTPOINT：把解密后的后端挂载为本地只读文件系统
+	//   sync LOCALDIR [REMOTEDIR]：把本地目录中新增和修改过的文件加密上传到后端
+	//   fetch REMOTEDIR LOCALDIR：把后端目录解密下载到本地
+	var subcommand, mountpoint, localDir, remoteDir string
+	if flag.NArg() >= 2 && flag.Arg(0) == "config" && (flag.Arg(1) == "dump" || flag.Arg(1) == "encrypt-secrets" || flag.Arg(1) == "age-wrap") {
+		subcommand = flag.Arg(1)
+		flag.CommandLine.Parse(flag.Args()[2:])
+	} else if flag.NArg() >= 1 && flag.Arg(0) == "compat-test" {
+		subcommand = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	} else if flag.NArg() >= 2 && flag.Arg(0) == "mount" {
+		subcommand, mountpoint = flag.Arg(0), flag.Arg(1)
+		flag.CommandLine.Parse(flag.Args()[2:])
+	} else if flag.NArg() >= 2 && flag.Arg(0) == "sync" {
+		subcommand, localDir, remoteDir = flag.Arg(0), flag.Arg(1), "/"
+		args := flag.Args()[2:]
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			remoteDir, args = args[0], args[1:]
+		}
+		flag.CommandLine.Parse(args)
+	} else if flag.NArg() >= 3 && flag.Arg(0) == "fetch" {
+		subcommand, remoteDir, localDir = flag.Arg(0), flag.Arg(1), flag.Arg(2)
+		flag.CommandLine.Parse(flag.Args()[3:])
+	}
+	dumpConfig := subcommand == "dump"
+
 	// 如果请求显示版本信息，则输出并退出
 	if *showVersion {
 		fmt.Printf("%s", Version)
 		return
 	}
 
-	// 保存默认值，用于判断参数是否被用户显式指定
-	defaultListenAddr := ":8080"
-	defaultChunkSize := "8192"
-	defaultDebug := false
-	// 解析命令行参数
-	flag.Parse()
-
 	// 检查是否请求了帮助信息
 	for _, arg := range os.Args[1:] {
 		if arg == "-h" || arg == "--help" {
@@ -104,123 +176,55 @@ func main() {
 		}
 	}
 
-	// 检查哪些参数被用户显式指定了
-	listenAddrSpecified := *listenAddr != defaultListenAddr
-	chunkSizeSpecified := *chunkSizeStr != defaultChunkSize
-	debugSpecified := *debug != defaultDebug
+	// 记录用户显式指定的命令行参数，未指定的参数不会覆盖环境变量和配置文件中的值
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	if subcommand == "encrypt-secrets" {
+		encryptConfigSecrets(*configFile)
+		return
+	}
+
+	if subcommand == "compat-test" {
+		compatTest()
+		return
+	}
 
-	// 如果指定了配置文件，设置环境变量
+	// 指定的配置文件不存在时生成默认配置，执行子命令时不生成
 	if *configFile != "" {
-		os.Setenv("CONFIG_FILE", *configFile)
-		// 检查配置文件是否存在，如果不存在则生成默认配置
-		if _, err := os.Stat(*configFile); os.IsNotExist(err) {
+		if _, err := os.Stat(*configFile); os.IsNotExist(err) && subcommand == "" {
 			log.Printf("配置文件 %s 不存在，正在生成默认配置...", *configFile)
 			if err := config.GenerateDefaultConfig(*configFile); err != nil {
 				log.Printf("生成默认配置文件失败: %v", err)
-			} else {
-				// 检查是否只有配置文件参数被指定，没有其他必填参数
-				// 如果是，生成配置后直接退出
-				if *backendURL == "" && *password == "" && *listenAddr == ":8080" && *algorithm == "aesctr" && *chunkSizeStr == "8192" && *debug == false && *backendUser == "" && *backendPass == "" && *authUser == "" && *authPass == "" {
-					log.Printf("默认配置文件已生成，请根据需要修改配置后重新启动程序")
-					os.Exit(0)
-				}
+			} else if len(flags) == 1 {
+				// 只指定了配置文件参数时，生成配置后直接退出
+				log.Printf("默认配置文件已生成，请根据需要修改配置后重新启动程序")
+				os.Exit(0)
 			}
 		}
-	} else {
-		// 如果没有指定配置文件，取消环境变量，确保不加载默认配置文件
-		os.Unsetenv("CONFIG_FILE")
 	}
 
-	// 加载配置
-	cfg, err := config.Load()
-	// 如果配置加载失败，创建一个新的配置对象
+	// 加载配置，优先级从高到低为：命令行参数、环境变量、配置文件、默认值
+	cfg, err := config.LoadWithFlags(flags)
 	if err != nil {
-		if !strings.Contains(err.Error(), "backend URL is required") && !strings.Contains(err.Error(), "encryption password is required") {
-			log.Fatal(err)
-		}
-		// 创建一个新的配置对象
-		cfg = &config.Config{}
-		// 设置默认值
-		cfg.ListenAddr = ":8080"
-		cfg.Algorithm = "aesctr"
-		cfg.ChunkSize = 8192
-		cfg.Debug = false
-		cfg.Timeout = 30 * time.Second
-		cfg.MaxIdleConns = 100
-		cfg.MaxIdleConnsPerHost = 10
-		cfg.IdleConnTimeout = 90 * time.Second
-		// 清空默认的auth配置
-		cfg.AuthUser = ""
-		cfg.AuthPass = ""
-		cfg.EnableAuth = false
-	} else {
-		// 如果配置加载成功，保留配置文件中的auth设置
-		// 但如果命令行参数提供了auth信息，则会在后面的逻辑中优先使用命令行参数
-		// 这里只需要确保EnableAuth的默认值为false，避免配置文件中的enable_auth影响认证逻辑
-		cfg.EnableAuth = false
+		log.Fatal(err)
 	}
 
-	// 命令行参数覆盖 - 只有当用户显式指定了参数时才覆盖配置文件的值
-	if listenAddrSpecified {
-		cfg.ListenAddr = *listenAddr
-	}
-	if *backendURL != "" {
-		cfg.BackendURL = *backendURL
-	}
-	if *password != "" {
-		cfg.Password = *password
-	}
-	// 加密算法参数总是覆盖配置文件，因为有缩写 -t
-	cfg.Algorithm = *algorithm
-	if chunkSizeSpecified {
-		if size, err := strconv.Atoi(*chunkSizeStr); err == nil {
-			cfg.ChunkSize = size
-		} else {
-			log.Printf("无效的块大小，使用默认值: %d", cfg.ChunkSize)
-		}
-	}
-	if debugSpecified {
-		cfg.Debug = *debug
-	}
-	if *backendUser != "" {
-		cfg.BackendUser = *backendUser
-	}
-	if *backendPass != "" {
-		cfg.BackendPass = *backendPass
-	}
-	if *authUser != "" {
-		cfg.AuthUser = *authUser
-	}
-	if *authPass != "" {
-		cfg.AuthPass = *authPass
+	if subcommand == "age-wrap" {
+		wrapPasswordFile(cfg)
+		return
 	}
 
-	// 处理auth逻辑：
-	// 1. 如果提供了auth-user和auth-pass（命令行或配置文件），则启用auth并使用这些凭据
-	// 2. 如果没有提供auth-user和auth-pass，但提供了backend-user和backend-pass（命令行或配置文件），则同步启用auth并使用backend的凭据
-	// 3. 其他情况，禁用auth
-	if (*authUser != "" && *authPass != "") || (cfg.AuthUser != "" && cfg.AuthPass != "") {
-		// 有明确的auth参数（命令行或配置文件），启用auth
-		cfg.EnableAuth = true
-		// 如果命令行参数提供了auth信息，则优先使用命令行参数
-		if *authUser != "" && *authPass != "" {
-			cfg.AuthUser = *authUser
-			cfg.AuthPass = *authPass
+	if dumpConfig {
+		if err := cfg.Dump(os.Stdout); err != nil {
+			log.Fatal(err)
 		}
-	} else if (*backendUser != "" && *backendPass != "") || (cfg.BackendUser != "" && cfg.BackendPass != "") {
-		// 没有明确的auth参数，但有backend认证参数（命令行或配置文件），同步启用auth并使用backend的凭据
-		cfg.EnableAuth = true
-		cfg.AuthUser = cfg.BackendUser
-		cfg.AuthPass = cfg.BackendPass
-	} else {
-		// 没有auth相关参数，禁用auth
-		cfg.EnableAuth = false
-		cfg.AuthUser = ""
-		cfg.AuthPass = ""
-	}
-
-	if *configFile != "" {
-		cfg.ConfigFile = *configFile
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("配置无效: %v", err)
+		}
+		return
 	}
 
 	// 验证配置，确保所有必要的配置项都已设置
@@ -233,6 +237,18 @@ func main() {
 	logger := utils.NewLogger(logLevel)
 	logger.Info("正在启动WebDAV加密代理...")
 
+	// 在接收请求前检查加密算法，避免有问题的构建把数据加密成无法解密的内容
+	if cfg.SelfTest {
+		start := time.Now()
+		for _, algorithm := range cfg.Algorithms() {
+			if err := encryption.SelfTest(algorithm); err != nil {
+				logger.Error("加密算法自检失败，拒绝启动: %v", err)
+				os.Exit(1)
+			}
+		}
+		logger.Info("加密算法自检通过: %s，耗时: %v", strings.Join(cfg.Algorithms(), ", "), time.Since(start))
+	}
+
 	// 解析后端URL
 	backend, err := url.Parse(cfg.BackendURL)
 	if err != nil {
@@ -240,6 +256,27 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 解析其他等价后端URL
+	var replicas []*url.URL
+	for _, replicaURL := range cfg.BackendURLs {
+		replica, err := url.Parse(replicaURL)
+		if err != nil {
+			logger.Error("无效的后端URL: %v", err)
+			os.Exit(1)
+		}
+		replicas = append(replicas, replica)
+	}
+
+	// 解析备用后端URL
+	var fallback *url.URL
+	if cfg.FallbackBackendURL != "" {
+		fallback, err = url.Parse(cfg.FallbackBackendURL)
+		if err != nil {
+			logger.Error("无效的备用后端URL: %v", err)
+			os.Exit(1)
+		}
+	}
+
 	// 处理监听地址，如果只输入了端口号，自动添加冒号前缀
 	if cfg.ListenAddr != "" && cfg.ListenAddr[0] != ':' && !strings.Contains(cfg.ListenAddr, ":") {
 		cfg.ListenAddr = ":" + cfg.ListenAddr
@@ -247,8 +284,9 @@ func main() {
 
 	// 创建后端认证配置
 	backendAuthConfig := &proxy.BackendAuthConfig{
-		Username: cfg.BackendUser,
-		Password: cfg.BackendPass,
+		Username:    cfg.BackendUser,
+		Password:    cfg.BackendPass,
+		Passthrough: cfg.BackendAuth == "passthrough",
 	}
 
 	// 创建代理端认证配置
@@ -258,76 +296,774 @@ func main() {
 			Enabled:  true,
 			Username: cfg.AuthUser,
 			Password: cfg.AuthPass,
+			Tokens:   cfg.AuthTokens,
+			Users:    make(map[string]string, len(cfg.Users)),
+
+			MaxFailures:   cfg.AuthMaxFailures,
+			FailureWindow: cfg.AuthFailureWindow,
+			BanDuration:   cfg.AuthBanDuration,
+		}
+		for _, userCfg := range cfg.Users {
+			proxyAuthConfig.Users[userCfg.Username] = userCfg.Password
+		}
+		if cfg.OIDCIssuer != "" {
+			proxyAuthConfig.OIDC = &proxy.OIDCConfig{
+				Issuer:   cfg.OIDCIssuer,
+				Audience: cfg.OIDCAudience,
+				JWKSURL:  cfg.OIDCJWKSURL,
+			}
+		}
+		if cfg.ShareSecret != "" {
+			proxyAuthConfig.Share = &proxy.ShareConfig{
+				Secret:    cfg.ShareSecret,
+				MaxExpiry: cfg.ShareMaxExpiry,
+			}
 		}
 	}
 
-	// 创建代理处理器
-	proxyHandler, err := proxy.NewProxyHandler(
-		backend,
-		cfg.Password,
-		cfg.Algorithm,
-		cfg.ChunkSize,
-		backendAuthConfig,
-		proxyAuthConfig,
-		logger,
-		cfg.Timeout,
-		cfg.MaxIdleConns,
-		cfg.MaxIdleConnsPerHost,
-		cfg.IdleConnTimeout,
-		cfg.DnsServers,
-	)
+	// 创建解密数据块缓存，所有挂载点和租户共享
+	blockCache, err := proxy.NewBlockCache(&proxy.BlockCacheConfig{
+		Dir:       cfg.BlockCacheDir,
+		MaxSize:   int64(cfg.BlockCacheSize),
+		BlockSize: int64(cfg.BlockCacheBlockSize),
+	}, logger)
+	if err != nil {
+		logger.Error("创建块缓存失败: %v", err)
+		os.Exit(1)
+	}
+
+	// 回收站，每个挂载点和租户的后端各自有回收站目录
+	var trashConfig *proxy.TrashConfig
+	if cfg.TrashDir != "" {
+		trashConfig = &proxy.TrashConfig{
+			Dir:       cfg.TrashDir,
+			Retention: cfg.TrashRetention,
+		}
+	}
+	var encryptionRules []proxy.EncryptionRule
+	for _, rule := range cfg.EncryptionRules {
+		encryptionRules = append(encryptionRules, proxy.EncryptionRule{
+			Prefix:    rule.Prefix,
+			Algorithm: rule.Algorithm,
+			Password:  rule.Password,
+		})
+	}
+	cacheControl := &proxy.CacheControlConfig{Default: cfg.CacheControl}
+	for _, rule := range cfg.CacheControlRules {
+		cacheControl.Rules = append(cacheControl.Rules, proxy.CacheControlRule{
+			Path:  rule.Path,
+			Value: rule.Value,
+		})
+	}
+	headerRules := &proxy.HeaderRulesConfig{}
+	for _, rule := range cfg.RequestHeaders {
+		headerRules.Request = append(headerRules.Request, proxy.HeaderRule{Name: rule.Name, Value: rule.Value, Action: rule.Action})
+	}
+	for _, rule := range cfg.ResponseHeaders {
+		headerRules.Response = append(headerRules.Response, proxy.HeaderRule{Name: rule.Name, Value: rule.Value, Action: rule.Action})
+	}
+	var versionConfig *proxy.VersionConfig
+	if cfg.VersionsDir != "" {
+		versionConfig = &proxy.VersionConfig{
+			Dir:  cfg.VersionsDir,
+			Keep: cfg.VersionsKeep,
+		}
+	}
+
+	// 创建代理处理器，除后端和加密参数外其他配置在所有挂载点之间共享
+	newProxyHandler := func(backend *url.URL, password, algorithm string, backendAuth *proxy.BackendAuthConfig,
+		loadBalance *proxy.LoadBalanceConfig) (*proxy.ProxyHandler, error) {
+		return proxy.New(proxy.Options{
+			Backend:               backend,
+			Password:              password,
+			Algorithm:             algorithm,
+			ChunkSize:             cfg.ChunkSize,
+			BackendAuth:           backendAuth,
+			ProxyAuth:             proxyAuthConfig,
+			Logger:                logger,
+			Timeout:               cfg.Timeout,
+			MaxIdleConns:          cfg.MaxIdleConns,
+			MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+			IdleConnTimeout:       cfg.IdleConnTimeout,
+			ExpectContinueTimeout: cfg.ExpectContinueTimeout,
+			DNSServers:            cfg.DnsServers,
+			AllowedMethods:        cfg.AllowedMethods,
+			Bandwidth: &proxy.BandwidthConfig{
+				UploadRate:   int64(cfg.MaxUploadRate),
+				DownloadRate: int64(cfg.MaxDownloadRate),
+				TransferRate: int64(cfg.MaxTransferRate),
+			},
+			TransferLimit: &proxy.TransferLimitConfig{
+				MaxConcurrent: cfg.MaxConcurrentTransfers,
+				QueueTimeout:  cfg.TransferQueueTimeout,
+			},
+			MethodTimeouts: &proxy.MethodTimeoutConfig{
+				Metadata:  cfg.MetadataTimeout,
+				Data:      cfg.DataTimeout,
+				PerMethod: upperKeys(cfg.MethodTimeouts),
+			},
+			Retry: &proxy.RetryConfig{
+				Count:       cfg.RetryCount,
+				Backoff:     cfg.RetryBackoff,
+				MaxBackoff:  cfg.RetryMaxBackoff,
+				StatusCodes: cfg.RetryStatusCodes,
+			},
+			HealthCheck: &proxy.HealthCheckConfig{
+				Interval:           cfg.HealthCheckInterval,
+				Timeout:            cfg.HealthCheckTimeout,
+				Method:             cfg.HealthCheckMethod,
+				UnhealthyThreshold: cfg.UnhealthyThreshold,
+				HealthyThreshold:   cfg.HealthyThreshold,
+			},
+			LoadBalance: loadBalance,
+			BlockCache:  blockCache,
+			ReadAhead: &proxy.ReadAheadConfig{
+				Chunks:    cfg.ReadAheadChunks,
+				ChunkSize: int(cfg.ReadAheadChunkSize),
+			},
+			KeyCache: &proxy.KeyCacheConfig{
+				Size: cfg.KeyCacheSize,
+				TTL:  cfg.KeyCacheTTL,
+			},
+			PropfindCacheTTL: cfg.PropfindCacheTTL,
+			ParallelDownload: &proxy.ParallelDownloadConfig{
+				Threshold:   int64(cfg.ParallelDownloadThreshold),
+				Connections: cfg.ParallelDownloadConnections,
+				SegmentSize: int64(cfg.ParallelDownloadSegmentSize),
+			},
+			SplitSize:          int64(cfg.SplitUploadSize),
+			NextcloudChunking:  cfg.NextcloudChunking,
+			OCChecksum:         cfg.OCChecksum,
+			StableETags:        cfg.StableETags,
+			Trash:              trashConfig,
+			Versions:           versionConfig,
+			ExcludePaths:       cfg.ExcludePaths,
+			EncryptAll:         cfg.EncryptAll,
+			EncryptionRules:    encryptionRules,
+			Compression:        cfg.Compress,
+			RestoreContentType: cfg.RestoreContentType,
+			CacheControl:       cacheControl,
+			HeaderRules:        headerRules,
+			TraceBodyBytes:     int(cfg.TraceBodyBytes),
+			BackendUserAgent:   cfg.BackendUserAgent,
+			Redirect: &proxy.RedirectConfig{
+				Mode:       cfg.RedirectMode,
+				MaxHops:    cfg.RedirectMaxHops,
+				AllowHosts: cfg.RedirectAllowHosts,
+			},
+			FileDetection: &proxy.FileDetectionConfig{
+				Extensions:      cfg.FileExtensions,
+				FileTypes:       cfg.FileContentTypes,
+				NonFileTypes:    cfg.NonFileContentTypes,
+				ReplaceDefaults: cfg.ReplaceFileDetection,
+				MinSize:         int64(cfg.MinEncryptSize),
+			},
+		})
+	}
+
+	var handler http.Handler
+	var proxyHandlers []*proxy.ProxyHandler
+	if cfg.LocalDir != "" {
+		// 本地目录模式：直接作为加密WebDAV服务器
+		handler, err = proxy.NewLocalHandler(&proxy.LocalConfig{
+			Dir:       cfg.LocalDir,
+			Password:  cfg.Password,
+			Algorithm: cfg.Algorithm,
+
+			ExcludePaths:    cfg.ExcludePaths,
+			EncryptionRules: encryptionRules,
+		}, logger)
+		if err != nil {
+			logger.Error("创建本地目录处理器失败: %v", err)
+			os.Exit(1)
+		}
+	} else if len(cfg.Mounts) > 0 {
+		// 虚拟挂载点：每个路径前缀使用独立的后端、认证和加密配置
+		var mounts []proxy.Mount
+		for _, mountCfg := range cfg.Mounts {
+			mountBackend, err := url.Parse(mountCfg.BackendURL)
+			if err != nil {
+				logger.Error("挂载点 %s 的后端URL无效: %v", mountCfg.Prefix, err)
+				os.Exit(1)
+			}
+			mountPassword := mountCfg.Password
+			if mountPassword == "" {
+				mountPassword = cfg.Password
+			}
+			mountAlgorithm := mountCfg.Algorithm
+			if mountAlgorithm == "" {
+				mountAlgorithm = cfg.Algorithm
+			}
+			mountHandler, err := newProxyHandler(mountBackend, mountPassword, mountAlgorithm, &proxy.BackendAuthConfig{
+				Username:    mountCfg.BackendUser,
+				Password:    mountCfg.BackendPass,
+				Passthrough: cfg.BackendAuth == "passthrough",
+			}, nil)
+			if err != nil {
+				logger.Error("创建挂载点 %s 的代理处理器失败: %v", mountCfg.Prefix, err)
+				os.Exit(1)
+			}
+			mounts = append(mounts, proxy.Mount{Prefix: mountCfg.Prefix, Handler: mountHandler})
+			proxyHandlers = append(proxyHandlers, mountHandler)
+		}
+		handler = proxy.NewMountRouter(mounts, logger)
+	} else {
+		// 多租户模式下未设置backend_url时，只有users中的用户可以访问
+		if cfg.BackendURL != "" || len(cfg.Users) == 0 {
+			proxyHandler, err := newProxyHandler(backend, cfg.Password, cfg.Algorithm, backendAuthConfig, &proxy.LoadBalanceConfig{
+				Replicas:       replicas,
+				Strategy:       cfg.LoadBalance,
+				Fallback:       fallback,
+				FallbackWrites: cfg.FailoverWrites,
+			})
+			if err != nil {
+				logger.Error("创建代理处理器失败: %v", err)
+				os.Exit(1)
+			}
+			handler = proxyHandler
+			proxyHandlers = append(proxyHandlers, proxyHandler)
+		}
+
+		// 多租户：每个代理用户使用独立的后端和加密密码
+		if len(cfg.Users) > 0 {
+			users := make(map[string]*proxy.ProxyHandler, len(cfg.Users))
+			for _, userCfg := range cfg.Users {
+				userBackend, err := url.Parse(userCfg.BackendURL)
+				if err != nil {
+					logger.Error("用户 %s 的后端URL无效: %v", userCfg.Username, err)
+					os.Exit(1)
+				}
+				userPassword := userCfg.EncryptionPassword
+				if userPassword == "" {
+					userPassword = cfg.Password
+				}
+				userAlgorithm := userCfg.Algorithm
+				if userAlgorithm == "" {
+					userAlgorithm = cfg.Algorithm
+				}
+				userHandler, err := newProxyHandler(userBackend, userPassword, userAlgorithm, &proxy.BackendAuthConfig{
+					Username: userCfg.BackendUser,
+					Password: userCfg.BackendPass,
+				}, nil)
+				if err != nil {
+					logger.Error("创建用户 %s 的代理处理器失败: %v", userCfg.Username, err)
+					os.Exit(1)
+				}
+				users[userCfg.Username] = userHandler
+				proxyHandlers = append(proxyHandlers, userHandler)
+			}
+			handler = proxy.NewUserRouter(users, handler, logger)
+		}
+	}
+
+	// 挂载为本地文件系统时直接使用代理处理器，不需要认证、配额等中间件
+	if subcommand == "mount" {
+		if len(cfg.Users) > 0 {
+			logger.Error("mount不支持多租户配置users，请使用backend_url或mounts")
+			os.Exit(1)
+		}
+		mountFilesystem(handler, mountpoint, logger)
+		return
+	}
+
+	// 同步和下载目录时同样直接使用代理处理器
+	if subcommand == "sync" || subcommand == "fetch" {
+		if len(cfg.Users) > 0 {
+			logger.Error("%s不支持多租户配置users，请使用backend_url或mounts", subcommand)
+			os.Exit(1)
+		}
+		includeRules, excludeRules := pathRules(*include, *exclude, logger)
+		if subcommand == "fetch" {
+			fetchDirectory(handler, &dirsync.FetchConfig{
+				RemoteDir: remoteDir,
+				LocalDir:  localDir,
+				Include:   includeRules,
+				Exclude:   excludeRules,
+				Parallel:  *parallel,
+				Retries:   *retries,
+				DryRun:    *dryRun,
+				Logger:    logger,
+			})
+			return
+		}
+		syncDirectory(handler, &dirsync.SyncConfig{
+			LocalDir:  localDir,
+			RemoteDir: remoteDir,
+			Include:   includeRules,
+			Exclude:   excludeRules,
+			Parallel:  *parallel,
+			Retries:   *retries,
+			DryRun:    *dryRun,
+			Logger:    logger,
+		}, *state, *interval)
+		return
+	}
+
+	// 应用配额中间件
+	handler, err = proxy.NewQuotaMiddleware(handler, &proxy.QuotaConfig{
+		Limit:     int64(cfg.QuotaBytes),
+		StateFile: cfg.QuotaStateFile,
+	})
 	if err != nil {
-		logger.Error("创建代理处理器失败: %v", err)
+		logger.Error("加载配额状态失败: %v", err)
 		os.Exit(1)
 	}
 
-	// 应用代理认证中间件
-	var handler http.Handler = proxyHandler
+	// 应用内置锁管理器，多租户中使用独立后端的用户各自拥有锁命名空间
+	handler = proxy.NewLockMiddleware(handler, &proxy.LockConfig{
+		Mode:       cfg.LockMode,
+		MaxTimeout: cfg.LockTimeout,
+		Namespace: func(r *http.Request) string {
+			user := proxy.UserFromRequest(r)
+			for _, userCfg := range cfg.Users {
+				if userCfg.Username == user {
+					return user
+				}
+			}
+			return ""
+		},
+	})
+
+	// 应用事件通知中间件，放在TUS内层使完成的TUS上传也作为PUT事件通知
+	handler = proxy.NewWebhookMiddleware(handler, &proxy.WebhookConfig{
+		URL:     cfg.WebhookURL,
+		Secret:  cfg.WebhookSecret,
+		Retries: cfg.WebhookRetries,
+		Timeout: cfg.WebhookTimeout,
+	})
+
+	// 应用TUS断点续传中间件，完成的上传作为PUT请求经过配额检查
+	handler, err = proxy.NewTusMiddleware(handler, &proxy.TusConfig{
+		Path:       cfg.TusPath,
+		Dir:        cfg.TusDir,
+		MaxSize:    int64(cfg.TusMaxSize),
+		Expiration: cfg.TusExpiration,
+	})
+	if err != nil {
+		logger.Error("创建TUS暂存目录失败: %v", err)
+		os.Exit(1)
+	}
+
+	// 应用限流中间件，限流和配额都需要在认证之后执行才能按用户统计
+	handler = proxy.NewRateLimitMiddleware(handler, &proxy.RateLimitConfig{
+		KeyBy:             cfg.RateLimitKey,
+		RequestsPerSecond: cfg.RateLimitRequests,
+		Burst:             cfg.RateLimitBurst,
+		BytesPerSecond:    int64(cfg.RateLimitBandwidth),
+	})
+
+	// 应用传输状态中间件，放在认证内层使查看传输列表需要认证，并能记录发起传输的用户
+	handler = proxy.NewTransferStatusMiddleware(handler, cfg.StatusPath, proxyHandlers...)
+
+	// 应用代理认证中间件，分享链接由已认证的用户生成，校验由认证中间件完成
 	if cfg.EnableAuth {
+		handler = proxy.NewShareMiddleware(handler, proxyAuthConfig.Share)
 		handler = proxy.NewProxyAuthMiddleware(handler, proxyAuthConfig)
 	}
 
+	// 应用跨域资源共享中间件，放在认证外层使浏览器的预检请求不需要认证，认证失败的响应也带有跨域响应头
+	handler, err = proxy.NewCORSMiddleware(handler, &proxy.CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+	})
+	if err != nil {
+		logger.Error("创建CORS中间件失败: %v", err)
+		os.Exit(1)
+	}
+
+	// 健康检查端点放在最外层，不需要认证
+	handler = proxy.NewHealthMiddleware(handler, cfg.HealthPath, proxyHandlers...)
+
+	// 安全响应头附加在包括健康检查在内的所有响应上
+	handler = proxy.NewSecurityHeadersMiddleware(handler, &proxy.SecurityHeadersConfig{
+		HSTSMaxAge:            cfg.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.HSTSIncludeSubdomains,
+		NoSniff:               cfg.ContentTypeNosniff,
+	})
+
+	// 记录进行中的请求，关闭服务时等待上传下载完成
+	drain := proxy.NewDrainMiddleware(handler)
+	handler = drain
+
 	// 设置优雅关闭
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// 创建监听，平滑升级启动时继承旧进程的监听socket
+	ln, err := listen(listenerHTTP, cfg.ListenAddr)
+	if err != nil {
+		logger.Error("服务器启动失败: %v", err)
+		os.Exit(1)
+	}
+	listeners := map[string]net.Listener{listenerHTTP: ln}
+
+	// 通过SFTP提供相同的加密存储，请求经过包括认证在内的完整处理链
+	var sftpServer *sftpd.Server
+	if cfg.SFTPListen != "" {
+		sftpServer, err = sftpd.NewServer(&sftpd.Config{
+			Handler:        handler,
+			HostKeyFile:    cfg.SFTPHostKey,
+			AuthorizedKeys: cfg.SFTPAuthorizedKeys,
+			PasswordAuth:   cfg.EnableAuth,
+			Logger:         logger,
+		})
+		if err != nil {
+			logger.Error("创建SFTP服务器失败: %v", err)
+			os.Exit(1)
+		}
+		sftpListener, err := listen(listenerSFTP, cfg.SFTPListen)
+		if err != nil {
+			logger.Error("SFTP服务器启动失败: %v", err)
+			os.Exit(1)
+		}
+		listeners[listenerSFTP] = sftpListener
+		logger.Info("SFTP监听地址: %s", cfg.SFTPListen)
+		go func() {
+			if err := sftpServer.Serve(sftpListener); err != nil {
+				logger.Error("SFTP服务器出错: %v", err)
+			}
+		}()
+	}
+	// 新的配置中不再使用的监听socket随之关闭，收到SIGUSR2时把全部监听交给新进程
+	closeInheritedListeners()
+	upgraded := watchUpgrade(listeners, logger)
+
 	// 启动服务器
 	server := &http.Server{
-		Addr:         cfg.ListenAddr,
-		Handler:      handler,
-		ReadTimeout:  300 * time.Second,
-		WriteTimeout: 300 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:           cfg.ListenAddr,
+		Handler:        handler,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: int(cfg.MaxHeaderBytes),
+		ConnState:      drain.ConnState,
 	}
 
+	serveDone := make(chan struct{})
 	go func() {
+		defer close(serveDone)
 		logger.Info("启动WebDAV加密代理")
 		logger.Info("监听地址: %s", cfg.ListenAddr)
-		logger.Info("后端服务器: %s", backend.String())
-		logger.Info("后端用户名: %s", cfg.BackendUser)
+		if cfg.LocalDir != "" {
+			logger.Info("本地目录模式: %s", cfg.LocalDir)
+		} else if len(cfg.Mounts) > 0 {
+			for _, mountCfg := range cfg.Mounts {
+				logger.Info("挂载点: %s -> %s", mountCfg.Prefix, mountCfg.BackendURL)
+			}
+		} else if cfg.BackendURL != "" {
+			logger.Info("后端服务器: %s", backend.String())
+		}
+		for _, userCfg := range cfg.Users {
+			logger.Info("租户用户: %s -> %s", userCfg.Username, userCfg.BackendURL)
+		}
+		if len(replicas) > 0 {
+			logger.Info("其他等价后端: %v，选择策略: %s", cfg.BackendURLs, cfg.LoadBalance)
+		}
+		if fallback != nil {
+			logger.Info("备用后端: %s，故障期间写请求: %s", fallback.String(), cfg.FailoverWrites)
+		}
+		if cfg.BackendAuth == "passthrough" {
+			logger.Info("后端认证: 透传客户端认证信息")
+		} else {
+			logger.Info("后端用户名: %s", cfg.BackendUser)
+		}
 		logger.Info("加密算法: %s", cfg.Algorithm)
+		if selected := cfg.AutoSelectedAlgorithm(); selected != "" {
+			logger.Warn("algorithm: auto 选择了 %s，不同算法加密的文件互不兼容，更换机器前请在配置中固定该算法", selected)
+		}
+		if features := encryption.CPUFeatures(); len(features) > 0 {
+			logger.Info("CPU加密相关特性: %s", strings.Join(features, ", "))
+		}
+		if !encryption.HasAESHardware() {
+			logger.Info("CPU不支持AES硬件指令，aesctr使用较慢的软件实现，新部署建议使用chacha20")
+		}
+		var speeds []string
+		for _, result := range encryption.MeasureThroughput(4 << 20) {
+			speeds = append(speeds, fmt.Sprintf("%s %.0f MiB/s", result.Algorithm, result.BytesPerSecond/(1<<20)))
+		}
+		logger.Info("本机加密速度: %s", strings.Join(speeds, ", "))
 		logger.Info("块大小: %d 字节", cfg.ChunkSize)
+		if cfg.EncryptAll {
+			logger.Info("加密所有文件内容，不再根据类型判断")
+		}
+		for _, rule := range cfg.EncryptionRules {
+			algorithm := rule.Algorithm
+			if algorithm == "" {
+				algorithm = cfg.Algorithm
+			}
+			logger.Info("路径 %s 使用加密算法: %s", rule.Prefix, algorithm)
+		}
+		if cfg.RedirectMode == "rewrite" || len(cfg.RedirectAllowHosts) > 0 {
+			logger.Info("后端重定向: %s, 允许的主机: %v", cfg.RedirectMode, cfg.RedirectAllowHosts)
+		}
+		if cfg.Compress != "" {
+			logger.Info("加密前压缩: %s", cfg.Compress)
+		}
+		if len(cfg.ExcludePaths) > 0 {
+			logger.Info("不加密的路径: %v", cfg.ExcludePaths)
+		}
+		if len(cfg.AllowedMethods) > 0 {
+			logger.Info("允许的方法: %v", cfg.AllowedMethods)
+		}
+		if cfg.CacheControl != proxy.DefaultCacheControl || len(cfg.CacheControlRules) > 0 {
+			logger.Info("文件缓存策略: %q, 按路径指定的规则: %d 条", cfg.CacheControl, len(cfg.CacheControlRules))
+		}
+		if cfg.TraceBodyBytes > 0 {
+			logger.Warn("已启用内容记录，TRACE级别日志中会包含每个上传下载开头的 %d 字节", cfg.TraceBodyBytes)
+		}
+		if cfg.StatusPath != "" {
+			logger.Info("传输状态端点: %s", cfg.StatusPath)
+		}
+		if cfg.BackendUserAgent != "" {
+			logger.Info("后端User-Agent: %s", cfg.BackendUserAgent)
+		}
+		if len(cfg.RequestHeaders) > 0 || len(cfg.ResponseHeaders) > 0 {
+			logger.Info("请求头规则: %d 条，响应头规则: %d 条", len(cfg.RequestHeaders), len(cfg.ResponseHeaders))
+		}
+		if len(cfg.CORSAllowedOrigins) > 0 {
+			logger.Info("CORS已启用，允许的来源: %v", cfg.CORSAllowedOrigins)
+		}
+		if cfg.RateLimitRequests > 0 || cfg.RateLimitBandwidth > 0 {
+			logger.Info("客户端限流已启用，维度: %s，请求: %.2f/秒，带宽: %d字节/秒", cfg.RateLimitKey, cfg.RateLimitRequests, cfg.RateLimitBandwidth)
+		}
+		if cfg.MaxUploadRate > 0 || cfg.MaxDownloadRate > 0 || cfg.MaxTransferRate > 0 {
+			logger.Info("带宽限制: 上传 %d 字节/秒，下载 %d 字节/秒，单个传输 %d 字节/秒", cfg.MaxUploadRate, cfg.MaxDownloadRate, cfg.MaxTransferRate)
+		}
+		if cfg.MaxConcurrentTransfers > 0 {
+			logger.Info("并发传输上限: %d，排队时间: %v", cfg.MaxConcurrentTransfers, cfg.TransferQueueTimeout)
+		}
+		if cfg.PropfindCacheTTL > 0 {
+			logger.Info("PROPFIND缓存已启用，有效期: %v", cfg.PropfindCacheTTL)
+		}
+		if cfg.ReadAheadChunks > 0 {
+			logger.Info("顺序下载预读: %d 块 x %d 字节", cfg.ReadAheadChunks, cfg.ReadAheadChunkSize)
+		}
+		if cfg.ParallelDownloadThreshold > 0 {
+			logger.Info("并行分段下载: 超过 %d 字节时使用 %d 个连接，分段 %d 字节", cfg.ParallelDownloadThreshold, cfg.ParallelDownloadConnections, cfg.ParallelDownloadSegmentSize)
+		}
+		if cfg.SplitUploadSize > 0 {
+			logger.Info("大文件拆分上传: 超过 %d 字节的文件拆分为多个后端文件", cfg.SplitUploadSize)
+		}
+		if cfg.TusPath != "" {
+			logger.Info("TUS断点续传上传已启用: %s，暂存目录: %s", cfg.TusPath, cfg.TusDir)
+		}
+		if blockCache != nil {
+			logger.Info("解密数据块缓存已启用: %s，上限: %d 字节", cfg.BlockCacheDir, cfg.BlockCacheSize)
+		}
+		if cfg.QuotaBytes > 0 {
+			logger.Info("用户配额已启用: %d 字节", cfg.QuotaBytes)
+		}
+		if cfg.OIDCIssuer != "" {
+			logger.Info("OIDC令牌认证已启用，签发者: %s", cfg.OIDCIssuer)
+		}
 		if cfg.EnableAuth {
-			logger.Info("代理认证已启用，用户: %s", cfg.AuthUser)
+			logger.Info("代理认证已启用，用户: %s，令牌数: %d", cfg.AuthUser, len(cfg.AuthTokens))
 		}
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		notifyReady()
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
 			logger.Error("服务器启动失败: %v", err)
 			os.Exit(1)
 		}
 	}()
 
 	// 等待关闭信号
-	sig := <-sigChan
-	logger.Info("接收到信号: %v，正在关闭服务器...", sig)
+	select {
+	case sig := <-sigChan:
+		logger.Info("接收到信号: %v，停止接收新请求，等待 %d 个进行中的请求完成（最多 %v）...", sig, drain.Active(), cfg.ShutdownTimeout)
+	case <-upgraded:
+		logger.Info("新进程已接管监听端口，停止接收新请求，等待 %d 个进行中的请求完成（最多 %v）...", drain.Active(), cfg.ShutdownTimeout)
+	}
 
-	// 优雅关闭
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// 优雅关闭，再次收到信号时不再等待
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
+	go func() {
+		select {
+		case sig := <-sigChan:
+			logger.Warn("再次接收到信号: %v，立即中止进行中的请求", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if sftpServer != nil {
+		sftpServer.Close()
+	}
+
+	// 先关闭监听，让已经接受的连接读到请求后再开始Shutdown，平滑升级时这些连接不会被断开
+	server.SetKeepAlivesEnabled(false)
+	ln.Close()
+	<-serveDone
+	drain.WaitPending(min(cfg.ShutdownTimeout, 5*time.Second))
 
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Error("服务器关闭失败: %v", err)
+		// 取消剩余的请求，发往后端的上传会被中断而不是以不完整的内容完成
+		aborted := drain.Abort()
+		for _, desc := range aborted {
+			logger.Warn("中止未完成的请求: %s", desc)
+		}
+		if len(aborted) > 0 {
+			logger.Warn("已中止 %d 个请求，被中止的上传需要客户端重新上传", len(aborted))
+		}
+		if !drain.Wait(5 * time.Second) {
+			logger.Error("仍有 %d 个请求未结束，强制关闭连接", drain.Active())
+		}
+		server.Close()
 	}
 
 	logger.Info("服务器已关闭")
 }
+
+// encryptConfigSecrets 用主密钥加密配置文件中明文保存的密码、密钥和令牌，没有指定文件时使用CONFIG_FILE环境变量
+func encryptConfigSecrets(configFile string) {
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+	if configFile == "" {
+		log.Fatal("请使用-c参数或CONFIG_FILE环境变量指定要加密的配置文件")
+	}
+	masterKey, err := config.ReadMasterKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	count, err := config.EncryptSecretsFile(configFile, masterKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("已加密配置文件 %s 中的 %d 个配置项", configFile, count)
+}
+
+// compatTest 用原Node.js版本的参考向量检查内置算法，有不一致时以非零状态退出
+func compatTest() {
+	var failed int
+	for _, result := range encryption.CompatTest() {
+		status := "OK"
+		if result.Err != nil {
+			status = "FAIL: " + result.Err.Error()
+			failed++
+		}
+		fmt.Printf("%-8s password=%-34q position=%-9d length=%-9d %s\n", result.Algorithm, result.Password, result.Position, result.Length, status)
+	}
+	if failed > 0 {
+		fmt.Printf("%d 项与原Node.js版本不一致，请不要使用这个构建加密数据\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("所有参考向量都与原Node.js版本一致")
+}
+
+// mountFilesystem 把代理处理器挂载到mountpoint，收到SIGINT或SIGTERM时卸载
+func mountFilesystem(handler http.Handler, mountpoint string, logger utils.Logger) {
+	stop := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("收到信号 %v，正在卸载 %s...", sig, mountpoint)
+		close(stop)
+	}()
+
+	if err := fusefs.Serve(&fusefs.Config{
+		Handler:    handler,
+		Mountpoint: mountpoint,
+		Logger:     logger,
+	}, stop); err != nil {
+		logger.Error("挂载 %s 失败: %v", mountpoint, err)
+		os.Exit(1)
+	}
+	logger.Info("已卸载 %s", mountpoint)
+}
+
+// syncDirectory 把本地目录同步到后端。interval大于0时每隔interval同步一次，直到收到SIGINT或SIGTERM；
+// 否则只同步一次，有文件失败时以状态码1退出
+func syncDirectory(handler http.Handler, syncCfg *dirsync.SyncConfig, stateFile string, interval time.Duration) {
+	logger := syncCfg.Logger
+	var err error
+	// 没有指定状态文件时，定期同步的状态保存在内存中
+	if syncCfg.State, err = dirsync.LoadState(stateFile); err != nil {
+		logger.Error("加载同步状态 %s 失败: %v", stateFile, err)
+		os.Exit(1)
+	}
+	syncCfg.Client = davclient.New(handler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	for {
+		start := time.Now()
+		stats, err := dirsync.Sync(ctx, syncCfg)
+		if stats != nil {
+			logger.Info("同步 %s -> %s 完成: %s，耗时 %v", syncCfg.LocalDir, syncCfg.RemoteDir, stats, time.Since(start).Round(time.Millisecond))
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Error("同步失败: %v", err)
+			if interval <= 0 {
+				os.Exit(1)
+			}
+		}
+		if interval <= 0 {
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			logger.Info("已停止同步")
+			return
+		}
+	}
+}
+
+// fetchDirectory 把后端目录下载到本地，有文件失败时以状态码1退出，再次运行时继续下载
+func fetchDirectory(handler http.Handler, fetchCfg *dirsync.FetchConfig) {
+	logger := fetchCfg.Logger
+	fetchCfg.Client = davclient.New(handler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	stats, err := dirsync.Fetch(ctx, fetchCfg)
+	if stats != nil {
+		logger.Info("下载 %s -> %s 完成: %s，耗时 %v", fetchCfg.RemoteDir, fetchCfg.LocalDir, stats, time.Since(start).Round(time.Millisecond))
+	}
+	if err != nil {
+		logger.Error("下载失败: %v，再次运行时从中断的位置继续", err)
+		os.Exit(1)
+	}
+}
+
+// pathRules 编译--include和--exclude参数
+func pathRules(include, exclude string, logger utils.Logger) (*proxy.PathRules, *proxy.PathRules) {
+	includeRules, err := proxy.NewPathRules(config.ParseList(include))
+	if err != nil {
+		logger.Error("--include无效: %v", err)
+		os.Exit(1)
+	}
+	excludeRules, err := proxy.NewPathRules(config.ParseList(exclude))
+	if err != nil {
+		logger.Error("--exclude无效: %v", err)
+		os.Exit(1)
+	}
+	return includeRules, excludeRules
+}
+
+// wrapPasswordFile 为配置中的age接收者加密密码并写入password_age_file。没有提供密码时使用
+// 现有的password_age_file解密出的密码，增减运维人员时不需要再次输入密码
+func wrapPasswordFile(cfg *config.Config) {
+	count, err := cfg.WrapPasswordFile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("已为 %d 个接收者加密密码，写入 %s", count, cfg.PasswordAgeFile)
+}
+
+// upperKeys 将方法名统一转换为大写
+func upperKeys(m map[string]time.Duration) map[string]time.Duration {
+	result := make(map[string]time.Duration, len(m))
+	for k, v := range m {
+		result[strings.ToUpper(k)] = v
+	}
+	return result
+}
@@ -0,0 +1,380 @@
+// Package davclient 在进程内向代理处理器发送WebDAV请求，不经过网络。
+//
+// 请求直接交给代理处理器（通常是不带认证等中间件的ProxyHandler、挂载点路由或本地目录处理器），
+// 加解密、Range定位、挂载点、不加密的路径和分片存储等处理与通过网络访问代理时完全相同。
+// mount、sync和fetch子命令都使用这个客户端访问后端。
+package davclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxListingSize PROPFIND响应的最大长度，超过时列目录失败
+const maxListingSize = 64 << 20
+
+// errResponseLimit 响应体超过需要保存的长度
+var errResponseLimit = errors.New("response body limit reached")
+
+// propfindBody 列目录时请求的属性
+const propfindBody = `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/><d:getlastmodified/><d:getetag/><d:resourcetype/></d:prop></d:propfind>`
+
+// multistatus PROPFIND响应中列目录需要的部分
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength string    `xml:"getcontentlength"`
+				LastModified  string    `xml:"getlastmodified"`
+				ETag          string    `xml:"getetag"`
+				ResourceType  *struct{} `xml:"resourcetype>collection"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// Entry 目录中的一项
+type Entry struct {
+	Name    string
+	Size    int64 // 目录或后端没有返回大小时为-1
+	ModTime time.Time
+	ETag    string
+	Dir     bool
+}
+
+// StatusError 代理返回了非预期的状态码
+type StatusError struct {
+	Method string
+	Path   string
+	Status int
+}
+
+// Error 实现error接口
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.Status, http.StatusText(e.Status))
+}
+
+// IsNotFound 判断错误是否为目标不存在
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound
+}
+
+// Client 进程内的WebDAV客户端
+type Client struct {
+	handler    http.Handler
+	remoteAddr string
+}
+
+// New 创建向handler发送请求的客户端
+func New(handler http.Handler) *Client {
+	return &Client{handler: handler, remoteAddr: "127.0.0.1:0"}
+}
+
+// WithRemoteAddr 返回以addr作为请求来源地址的客户端，按IP限流和封禁时使用真实的客户端地址
+func (c *Client) WithRemoteAddr(addr string) *Client {
+	return &Client{handler: c.handler, remoteAddr: addr}
+}
+
+// do 发送请求，响应写入rec
+func (c *Client) do(ctx context.Context, method, p string, header http.Header, body io.Reader, size int64, rec *recorder) error {
+	if body == nil {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost/", body)
+	if err != nil {
+		return err
+	}
+	req.URL.Path = p
+	req.RequestURI = req.URL.RequestURI()
+	req.RemoteAddr = c.remoteAddr
+	if body != http.NoBody {
+		req.ContentLength = size
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec.header = make(http.Header)
+	c.handler.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// propfind 发送PROPFIND请求，返回响应中的各项，self为请求的目录或文件本身
+func (c *Client) propfind(ctx context.Context, p, depth string) (self *Entry, entries []Entry, err error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml"}}
+	rec := &recorder{limit: maxListingSize}
+	if err := c.do(ctx, "PROPFIND", p, header, strings.NewReader(propfindBody), int64(len(propfindBody)), rec); err != nil {
+		return nil, nil, err
+	}
+	if rec.status != http.StatusMultiStatus {
+		return nil, nil, &StatusError{Method: "PROPFIND", Path: p, Status: rec.status}
+	}
+	if rec.overflow {
+		return nil, nil, fmt.Errorf("PROPFIND %s: response larger than %d bytes", p, maxListingSize)
+	}
+
+	var ms multistatus
+	if err := xml.Unmarshal(rec.buf.Bytes(), &ms); err != nil {
+		return nil, nil, fmt.Errorf("PROPFIND %s: %w", p, err)
+	}
+	selfPath := strings.TrimSuffix(p, "/")
+	for _, response := range ms.Responses {
+		href, err := url.Parse(strings.TrimSpace(response.Href))
+		if err != nil {
+			continue
+		}
+		hrefPath := strings.TrimSuffix(href.Path, "/")
+		e := Entry{Name: path.Base(hrefPath), Size: -1}
+		for _, propstat := range response.Propstat {
+			if propstat.Prop.ContentLength != "" {
+				e.Size, _ = strconv.ParseInt(propstat.Prop.ContentLength, 10, 64)
+			}
+			if propstat.Prop.LastModified != "" {
+				e.ModTime, _ = http.ParseTime(propstat.Prop.LastModified)
+			}
+			if propstat.Prop.ETag != "" {
+				e.ETag = propstat.Prop.ETag
+			}
+			if propstat.Prop.ResourceType != nil {
+				e.Dir = true
+			}
+		}
+		if hrefPath == selfPath || hrefPath == "" {
+			self = &e
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return self, entries, nil
+}
+
+// List 用Depth 1的PROPFIND列出目录中的直接子项，不包括目录本身
+func (c *Client) List(ctx context.Context, dir string) ([]Entry, error) {
+	_, entries, err := c.propfind(ctx, strings.TrimSuffix(dir, "/")+"/", "1")
+	return entries, err
+}
+
+// Stat 用Depth 0的PROPFIND获取文件或目录的信息，根目录的Name为/
+func (c *Client) Stat(ctx context.Context, p string) (Entry, error) {
+	self, entries, err := c.propfind(ctx, p, "0")
+	if err != nil {
+		return Entry{}, err
+	}
+	if self == nil && len(entries) == 1 {
+		// 后端返回的href与请求的路径编码不同时，唯一的一项就是请求的目标
+		self = &entries[0]
+	}
+	if self == nil {
+		return Entry{}, fmt.Errorf("PROPFIND %s: target missing from response", p)
+	}
+	return *self, nil
+}
+
+// ReadRange 读取文件从offset开始的最多length字节，文件结束时返回的数据较短
+func (c *Client) ReadRange(ctx context.Context, p string, offset, length int64) ([]byte, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+	// 不支持Range时返回完整内容，跳过offset之前的部分，读到需要的长度后停止
+	rec := &recorder{skip: offset, limit: length}
+	if err := c.do(ctx, http.MethodGet, p, header, nil, 0, rec); err != nil {
+		return nil, err
+	}
+	switch rec.status {
+	case http.StatusOK, http.StatusPartialContent:
+		return rec.buf.Bytes(), nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, nil
+	}
+	return nil, &StatusError{Method: http.MethodGet, Path: p, Status: rec.status}
+}
+
+// Response 下载的结果
+type Response struct {
+	Start   int64       // 写入的第一个字节在文件中的位置
+	Written int64       // 写入的字节数
+	Header  http.Header // 代理的响应头
+}
+
+// Get 下载文件从offset开始的内容。ifRange不为空时带上If-Range（ETag或HTTP日期），文件已经变化时
+// 代理返回完整内容，从文件开头下载。代理返回成功的状态码后调用open获取写入内容的位置，
+// start为第一个字节在文件中的位置，header为响应头；offset已经到达文件末尾时不调用open
+func (c *Client) Get(ctx context.Context, p string, offset int64, ifRange string, open func(start int64, header http.Header) (io.Writer, error)) (*Response, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if ifRange != "" {
+			header.Set("If-Range", ifRange)
+		}
+	}
+	rec := &recorder{skip: offset, restart: offset > 0 && ifRange != "", open: open}
+	if err := c.do(ctx, http.MethodGet, p, header, nil, 0, rec); err != nil {
+		return nil, err
+	}
+	resp := &Response{Start: rec.start, Written: rec.written, Header: rec.header}
+	if rec.err != nil {
+		return resp, rec.err
+	}
+	switch rec.status {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		resp.Start = offset
+		return resp, nil
+	}
+	return nil, &StatusError{Method: http.MethodGet, Path: p, Status: rec.status}
+}
+
+// Put 上传size字节的文件内容，modTime不为零时通过X-OC-MTime请求后端保留修改时间（Nextcloud等支持）。
+// 返回后端响应中新文件的ETag，后端没有返回时为空
+func (c *Client) Put(ctx context.Context, p string, body io.Reader, size int64, modTime time.Time) (string, error) {
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	if !modTime.IsZero() {
+		header.Set("X-OC-MTime", strconv.FormatInt(modTime.Unix(), 10))
+	}
+	rec := &recorder{limit: 4096}
+	if err := c.do(ctx, http.MethodPut, p, header, body, size, rec); err != nil {
+		return "", err
+	}
+	if rec.status < 200 || rec.status > 299 {
+		return "", &StatusError{Method: http.MethodPut, Path: p, Status: rec.status}
+	}
+	return rec.header.Get("ETag"), nil
+}
+
+// Mkcol 创建目录，目录已经存在时不返回错误
+func (c *Client) Mkcol(ctx context.Context, p string) error {
+	rec := &recorder{limit: 4096}
+	if err := c.do(ctx, "MKCOL", strings.TrimSuffix(p, "/")+"/", nil, nil, 0, rec); err != nil {
+		return err
+	}
+	if rec.status == http.StatusCreated || rec.status == http.StatusMethodNotAllowed {
+		return nil
+	}
+	return &StatusError{Method: "MKCOL", Path: p, Status: rec.status}
+}
+
+// Delete 删除文件或目录
+func (c *Client) Delete(ctx context.Context, p string) error {
+	rec := &recorder{limit: 4096}
+	if err := c.do(ctx, http.MethodDelete, p, nil, nil, 0, rec); err != nil {
+		return err
+	}
+	if rec.status < 200 || rec.status > 299 {
+		return &StatusError{Method: http.MethodDelete, Path: p, Status: rec.status}
+	}
+	return nil
+}
+
+// Move 把src移动到dst，overwrite为false时dst已经存在会失败
+func (c *Client) Move(ctx context.Context, src, dst string, overwrite bool) error {
+	destination := &url.URL{Scheme: "http", Host: "localhost", Path: dst}
+	header := http.Header{"Destination": {destination.String()}, "Overwrite": {"F"}}
+	if overwrite {
+		header.Set("Overwrite", "T")
+	}
+	rec := &recorder{limit: 4096}
+	if err := c.do(ctx, "MOVE", src, header, nil, 0, rec); err != nil {
+		return err
+	}
+	if rec.status < 200 || rec.status > 299 {
+		return &StatusError{Method: "MOVE", Path: src, Status: rec.status}
+	}
+	return nil
+}
+
+// recorder 保存处理器的响应，响应体只保留需要的部分，或者写入open返回的sink
+type recorder struct {
+	header   http.Header
+	status   int
+	buf      bytes.Buffer
+	skip     int64 // 状态码为200时跳过的字节数
+	restart  bool  // 状态码为200时说明If-Range不满足，不跳过，从文件开头写入
+	limit    int64 // 保存到buf的最大长度，写入sink时不限制
+	overflow bool
+
+	open    func(start int64, header http.Header) (io.Writer, error)
+	sink    io.Writer
+	start   int64
+	written int64
+	err     error // 打开或写入sink的错误
+}
+
+// Header 实现http.ResponseWriter接口
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader 记录最终的状态码，忽略1xx临时响应。成功响应的内容写入open返回的sink
+func (r *recorder) WriteHeader(code int) {
+	if r.status != 0 || code < http.StatusOK {
+		return
+	}
+	r.status = code
+	r.start = r.skip
+	if code != http.StatusOK || r.restart {
+		r.skip = 0
+	}
+	if code == http.StatusOK && r.restart {
+		r.start = 0
+	}
+	if r.open != nil && (code == http.StatusOK || code == http.StatusPartialContent) {
+		r.sink, r.err = r.open(r.start, r.header)
+	}
+}
+
+// Write 按skip和limit保存响应体
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	n := len(p)
+	if r.skip > 0 {
+		if int64(len(p)) <= r.skip {
+			r.skip -= int64(len(p))
+			return n, nil
+		}
+		p = p[r.skip:]
+		r.skip = 0
+	}
+	if r.open != nil {
+		// 只写入成功响应的内容，错误响应的内容不是文件数据
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.sink == nil {
+			return n, nil
+		}
+		written, err := r.sink.Write(p)
+		r.written += int64(written)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		return n, nil
+	}
+	if remaining := r.limit - int64(r.buf.Len()); int64(len(p)) > remaining {
+		// 需要的部分已经读完，返回错误让处理器停止读取后端的其余内容
+		r.buf.Write(p[:remaining])
+		r.overflow = true
+		return 0, errResponseLimit
+	}
+	r.buf.Write(p)
+	return n, nil
+}
+
+// Flush 实现http.Flusher接口，响应已经在内存中
+func (r *recorder) Flush() {}
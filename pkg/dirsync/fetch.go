@@ -0,0 +1,287 @@
+package dirsync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webdav-proxy/pkg/davclient"
+	"webdav-proxy/pkg/proxy"
+	"webdav-proxy/utils"
+)
+
+// 下载中的文件的后缀，下载完成并校验后重命名为原文件名。.part.etag文件保存.part文件对应的
+// 后端版本（ETag或修改时间），继续下载时用作If-Range
+const (
+	partialSuffix   = ".part"
+	validatorSuffix = ".part.etag"
+)
+
+// FetchConfig 下载配置
+type FetchConfig struct {
+	Client       *davclient.Client
+	RemoteDir    string // 后端目录，默认/
+	LocalDir     string
+	Include      *proxy.PathRules // 设置时只下载匹配的文件，路径为相对于RemoteDir、以/开头的路径
+	Exclude      *proxy.PathRules // 不下载匹配的文件和目录
+	Parallel     int              // 同时下载的文件数，默认4
+	Retries      int              // 下载失败后的重试次数，为0时不重试
+	RetryBackoff time.Duration    // 第一次重试前的等待时间，之后每次翻倍，默认1秒
+	DryRun       bool             // 只输出需要下载的文件，不实际下载
+	Logger       utils.Logger
+}
+
+// withDefaults 补充未设置的参数
+func (c FetchConfig) withDefaults() FetchConfig {
+	if c.RemoteDir == "" {
+		c.RemoteDir = "/"
+	}
+	if c.Parallel <= 0 {
+		c.Parallel = defaultParallel
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultRetryBackoff
+	}
+	return c
+}
+
+// downloadTask 需要下载的文件
+type downloadTask struct {
+	remotePath string
+	localPath  string
+	entry      davclient.Entry
+}
+
+// Fetch 递归下载并解密后端目录到本地。本地已有大小相同、修改时间不早于后端的文件时跳过；
+// 下载先写入.part文件，中断后再次运行时用If-Range从已下载的位置继续，文件在此期间变化时从头下载。
+// 下载完成后检查大小与后端一致，后端返回OC-Checksum时还会校验整个文件，通过后才重命名为原文件名
+// 并设置为后端的修改时间。单个文件失败不会中止下载，返回的错误汇总失败的文件数
+func Fetch(ctx context.Context, config *FetchConfig) (*Stats, error) {
+	cfg := config.withDefaults()
+	if !cfg.DryRun {
+		if err := os.MkdirAll(cfg.LocalDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := &Stats{}
+	tasks := make(chan downloadTask)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if err := cfg.download(ctx, task, stats); err != nil {
+					atomic.AddInt64(&stats.Failed, 1)
+					cfg.Logger.Error("[FETCH] 下载 %s 失败: %v", task.remotePath, err)
+				}
+			}
+		}()
+	}
+
+	walkErr := cfg.walk(ctx, "/", tasks, stats)
+	close(tasks)
+	wg.Wait()
+
+	if walkErr != nil {
+		return stats, walkErr
+	}
+	if stats.Failed > 0 {
+		return stats, fmt.Errorf("%d files failed to download", stats.Failed)
+	}
+	return stats, nil
+}
+
+// walk 列出后端目录rel，把需要下载的文件交给下载协程，然后递归处理子目录
+func (c *FetchConfig) walk(ctx context.Context, rel string, tasks chan<- downloadTask, stats *Stats) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	remoteDir := path.Join(c.RemoteDir, rel)
+	localDir := filepath.Join(c.LocalDir, filepath.FromSlash(rel))
+
+	entries, err := c.Client.List(ctx, remoteDir)
+	if err != nil {
+		return err
+	}
+	if !c.DryRun {
+		if err := os.MkdirAll(localDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	var subdirs []string
+	for _, e := range entries {
+		// 后端返回的名称不能离开目标目录
+		if e.Name == "." || e.Name == ".." || strings.ContainsAny(e.Name, `/\`) {
+			c.Logger.Warn("[FETCH] 跳过无效的文件名 %q", e.Name)
+			continue
+		}
+		relPath := path.Join(rel, e.Name)
+		if c.Exclude.Match(relPath) {
+			continue
+		}
+		if e.Dir {
+			subdirs = append(subdirs, relPath)
+			continue
+		}
+		if !c.Include.Empty() && !c.Include.Match(relPath) {
+			continue
+		}
+
+		atomic.AddInt64(&stats.Files, 1)
+		localPath := filepath.Join(localDir, e.Name)
+		if info, err := os.Stat(localPath); err == nil && info.Mode().IsRegular() && e.Size >= 0 &&
+			info.Size() == e.Size && !e.ModTime.After(info.ModTime().Truncate(time.Second)) {
+			atomic.AddInt64(&stats.Skipped, 1)
+			continue
+		}
+		task := downloadTask{remotePath: path.Join(remoteDir, e.Name), localPath: localPath, entry: e}
+		select {
+		case tasks <- task:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, subdir := range subdirs {
+		if err := c.walk(ctx, subdir, tasks, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download 下载一个文件，失败时按指数退避重试，重试时从已下载的位置继续
+func (c *FetchConfig) download(ctx context.Context, task downloadTask, stats *Stats) error {
+	if c.DryRun {
+		c.Logger.Info("[FETCH] 下载 %s (%d 字节)", task.remotePath, task.entry.Size)
+		atomic.AddInt64(&stats.Transferred, 1)
+		if task.entry.Size > 0 {
+			atomic.AddInt64(&stats.Bytes, task.entry.Size)
+		}
+		return nil
+	}
+
+	return retry(ctx, c.Retries, c.RetryBackoff, c.Logger, "[FETCH] 下载 "+task.remotePath, func() error {
+		written, err := c.get(ctx, task)
+		atomic.AddInt64(&stats.Bytes, written)
+		if err != nil {
+			return err
+		}
+		c.Logger.Info("[FETCH] 已下载 %s (%d 字节)", task.remotePath, task.entry.Size)
+		atomic.AddInt64(&stats.Transferred, 1)
+		return nil
+	})
+}
+
+// get 下载到.part文件，校验后重命名，返回本次写入的字节数
+func (c *FetchConfig) get(ctx context.Context, task downloadTask) (int64, error) {
+	partial := task.localPath + partialSuffix
+	validatorFile := task.localPath + validatorSuffix
+	e := task.entry
+
+	// 只有记录了.part文件对应的版本时才继续下载
+	var offset int64
+	var ifRange string
+	if data, err := os.ReadFile(validatorFile); err == nil {
+		if info, err := os.Stat(partial); err == nil && (e.Size < 0 || info.Size() <= e.Size) {
+			offset, ifRange = info.Size(), strings.TrimSpace(string(data))
+		}
+	}
+
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	resp, err := c.Client.Get(ctx, task.remotePath, offset, ifRange, func(start int64, header http.Header) (io.Writer, error) {
+		if start != offset {
+			c.Logger.Info("[FETCH] %s 已经变化，重新下载", task.remotePath)
+		} else if start > 0 {
+			c.Logger.Info("[FETCH] 从 %d 字节处继续下载 %s", start, task.remotePath)
+		}
+		if start == 0 {
+			// 记录正在下载的版本，没有ETag时使用修改时间
+			validator := header.Get("ETag")
+			if validator == "" {
+				validator = header.Get("Last-Modified")
+			}
+			if validator == "" {
+				os.Remove(validatorFile)
+			} else if err := os.WriteFile(validatorFile, []byte(validator+"\n"), 0644); err != nil {
+				return nil, err
+			}
+		}
+		if err := f.Truncate(start); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return f, nil
+	})
+	if err != nil {
+		if resp != nil {
+			return resp.Written, err
+		}
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return resp.Written, err
+	}
+
+	// 下载不完整时保留.part文件，重试时继续下载；比后端的文件长时从头下载
+	size := resp.Start + resp.Written
+	if e.Size >= 0 && size != e.Size {
+		if size > e.Size {
+			os.Remove(partial)
+			os.Remove(validatorFile)
+		}
+		return resp.Written, fmt.Errorf("size mismatch: got %d bytes, expected %d", size, e.Size)
+	}
+	if checksum := resp.Header.Get("OC-Checksum"); checksum != "" {
+		if err := verifyFile(partial, checksum); err != nil {
+			os.Remove(partial)
+			os.Remove(validatorFile)
+			return resp.Written, err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return resp.Written, err
+	}
+	if err := os.Rename(partial, task.localPath); err != nil {
+		return resp.Written, err
+	}
+	os.Remove(validatorFile)
+	if !e.ModTime.IsZero() {
+		if err := os.Chtimes(task.localPath, e.ModTime, e.ModTime); err != nil {
+			return resp.Written, err
+		}
+	}
+	return resp.Written, nil
+}
+
+// verifyFile 按OC-Checksum校验下载的文件，算法不支持时跳过
+func verifyFile(name, checksum string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := proxy.VerifyChecksum(checksum, f); err != nil {
+		return fmt.Errorf("verify %s: %w", checksum, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package dirsync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileState 上次上传时本地文件的大小、修改时间和后端返回的ETag
+type fileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	ETag    string    `json:"etag,omitempty"`
+}
+
+// State 记录已经上传的文件，键为后端路径。本地文件的大小和修改时间没有变化、后端的ETag
+// 也与上传时相同时可以确定文件不需要再次上传，不依赖后端是否保留修改时间
+type State struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]fileState
+}
+
+// LoadState 从path加载同步状态，文件不存在时返回空的状态。path为空时状态只保存在内存中
+func LoadState(path string) (*State, error) {
+	s := &State{path: path, files: make(map[string]fileState)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.files); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// unchanged 检查上次上传后本地文件和后端文件是否都没有变化
+func (s *State) unchanged(remotePath string, size int64, modTime time.Time, etag string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[remotePath]
+	return ok && f.ETag != "" && f.ETag == etag && f.Size == size && f.ModTime.Equal(modTime)
+}
+
+// record 记录上传完成的文件
+func (s *State) record(remotePath string, size int64, modTime time.Time, etag string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[remotePath] = fileState{Size: size, ModTime: modTime, ETag: etag}
+}
+
+// Save 将同步状态写入状态文件
+func (s *State) Save() error {
+	if s == nil || s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.files, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免写入中断导致状态文件损坏
+	tmpFile := s.path + ".tmp"
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, s.path)
+}
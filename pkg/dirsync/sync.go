@@ -0,0 +1,276 @@
+// Package dirsync 通过代理的加解密管道在本地目录和后端之间批量传输文件。
+//
+// Sync把本地目录加密上传到后端，只上传新增和修改过的文件；Fetch把后端目录解密下载到本地。
+// 两者都使用davclient在进程内调用代理处理器，加密规则、挂载点、分片存储等与通过代理上传下载完全相同。
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webdav-proxy/pkg/davclient"
+	"webdav-proxy/pkg/proxy"
+	"webdav-proxy/utils"
+)
+
+// 默认的并发数和重试间隔
+const (
+	defaultParallel     = 4
+	defaultRetryBackoff = time.Second
+)
+
+// SyncConfig 上传同步配置
+type SyncConfig struct {
+	Client       *davclient.Client
+	LocalDir     string
+	RemoteDir    string           // 后端目录，默认/
+	Include      *proxy.PathRules // 设置时只同步匹配的文件，路径为相对于LocalDir、以/开头的路径
+	Exclude      *proxy.PathRules // 不同步匹配的文件和目录
+	Parallel     int              // 同时上传的文件数，默认4
+	Retries      int              // 上传失败后的重试次数，为0时不重试
+	RetryBackoff time.Duration    // 第一次重试前的等待时间，之后每次翻倍，默认1秒
+	DryRun       bool             // 只输出需要上传的文件，不实际上传
+	State        *State           // 上次上传的记录，为nil时只比较大小和修改时间
+	Logger       utils.Logger
+}
+
+// Stats 一次同步或下载的统计
+type Stats struct {
+	Files       int64 // 检查的文件数
+	Transferred int64 // 传输的文件数
+	Skipped     int64 // 没有变化而跳过的文件数
+	Failed      int64 // 重试后仍然失败的文件数
+	Bytes       int64 // 传输的字节数
+}
+
+// String 返回统计的摘要
+func (s *Stats) String() string {
+	return fmt.Sprintf("检查 %d 个文件，传输 %d 个（%d 字节），跳过 %d 个，失败 %d 个",
+		s.Files, s.Transferred, s.Bytes, s.Skipped, s.Failed)
+}
+
+// withDefaults 补充未设置的参数
+func (c SyncConfig) withDefaults() SyncConfig {
+	if c.RemoteDir == "" {
+		c.RemoteDir = "/"
+	}
+	if c.Parallel <= 0 {
+		c.Parallel = defaultParallel
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = defaultRetryBackoff
+	}
+	return c
+}
+
+// uploadTask 需要上传的文件
+type uploadTask struct {
+	localPath  string
+	remotePath string
+	size       int64
+	modTime    time.Time
+}
+
+// Sync 遍历本地目录，与后端比较后上传新增和修改过的文件：State中记录的本地大小、修改时间和后端ETag
+// 都没有变化时跳过，否则在后端没有该文件、大小不同，或者本地的修改时间晚于后端的修改时间时上传。
+// 不会删除后端多出的文件。单个文件失败不会中止同步，返回的错误汇总失败的文件数
+func Sync(ctx context.Context, config *SyncConfig) (*Stats, error) {
+	cfg := config.withDefaults()
+	info, err := os.Stat(cfg.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", cfg.LocalDir)
+	}
+
+	stats := &Stats{}
+	tasks := make(chan uploadTask)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if err := cfg.upload(ctx, task, stats); err != nil {
+					atomic.AddInt64(&stats.Failed, 1)
+					cfg.Logger.Error("[SYNC] 上传 %s 失败: %v", task.remotePath, err)
+				}
+			}
+		}()
+	}
+
+	walkErr := cfg.walk(ctx, "/", tasks, stats)
+	close(tasks)
+	wg.Wait()
+
+	if err := cfg.State.Save(); err != nil {
+		cfg.Logger.Error("[SYNC] 保存同步状态失败: %v", err)
+	}
+	if walkErr != nil {
+		return stats, walkErr
+	}
+	if stats.Failed > 0 {
+		return stats, fmt.Errorf("%d files failed to upload", stats.Failed)
+	}
+	return stats, nil
+}
+
+// walk 比较本地目录rel与后端对应目录，把需要上传的文件交给上传协程，然后递归处理子目录。
+// 后端目录在遍历时按顺序创建，保证上传文件时父目录已经存在
+func (c *SyncConfig) walk(ctx context.Context, rel string, tasks chan<- uploadTask, stats *Stats) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	localDir := filepath.Join(c.LocalDir, filepath.FromSlash(rel))
+	remoteDir := path.Join(c.RemoteDir, rel)
+
+	dirEntries, err := os.ReadDir(localDir)
+	if err != nil {
+		return err
+	}
+	remote := make(map[string]davclient.Entry)
+	entries, err := c.Client.List(ctx, remoteDir)
+	switch {
+	case err == nil:
+		for _, e := range entries {
+			remote[e.Name] = e
+		}
+	case davclient.IsNotFound(err):
+		if c.DryRun {
+			c.Logger.Info("[SYNC] 创建目录 %s", remoteDir)
+		} else if err := c.Client.Mkcol(ctx, remoteDir); err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	var subdirs []string
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		relPath := path.Join(rel, name)
+		if c.Exclude.Match(relPath) {
+			continue
+		}
+
+		// 跟随指向文件的符号链接，不跟随指向目录的符号链接，避免循环
+		fileInfo, err := os.Stat(filepath.Join(localDir, name))
+		if err != nil {
+			c.Logger.Warn("[SYNC] 跳过 %s: %v", relPath, err)
+			continue
+		}
+		if fileInfo.IsDir() {
+			if dirEntry.Type()&fs.ModeSymlink != 0 {
+				c.Logger.Warn("[SYNC] 跳过指向目录的符号链接 %s", relPath)
+				continue
+			}
+			subdirs = append(subdirs, relPath)
+			continue
+		}
+		if !fileInfo.Mode().IsRegular() || (!c.Include.Empty() && !c.Include.Match(relPath)) {
+			continue
+		}
+
+		atomic.AddInt64(&stats.Files, 1)
+		remotePath := path.Join(remoteDir, name)
+		if e, ok := remote[name]; ok && !c.changed(remotePath, fileInfo, e) {
+			atomic.AddInt64(&stats.Skipped, 1)
+			continue
+		}
+		task := uploadTask{
+			localPath:  filepath.Join(localDir, name),
+			remotePath: remotePath,
+			size:       fileInfo.Size(),
+			modTime:    fileInfo.ModTime(),
+		}
+		select {
+		case tasks <- task:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, subdir := range subdirs {
+		if err := c.walk(ctx, subdir, tasks, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changed 判断本地文件相对后端的文件e是否有变化
+func (c *SyncConfig) changed(remotePath string, info os.FileInfo, e davclient.Entry) bool {
+	if e.Dir {
+		return true
+	}
+	if c.State.unchanged(remotePath, info.Size(), info.ModTime(), e.ETag) {
+		return false
+	}
+	// 后端的修改时间只精确到秒
+	return e.Size != info.Size() || info.ModTime().Truncate(time.Second).After(e.ModTime)
+}
+
+// upload 上传一个文件，失败时按指数退避重试
+func (c *SyncConfig) upload(ctx context.Context, task uploadTask, stats *Stats) error {
+	if c.DryRun {
+		c.Logger.Info("[SYNC] 上传 %s (%d 字节)", task.remotePath, task.size)
+		atomic.AddInt64(&stats.Transferred, 1)
+		atomic.AddInt64(&stats.Bytes, task.size)
+		return nil
+	}
+
+	return retry(ctx, c.Retries, c.RetryBackoff, c.Logger, "[SYNC] 上传 "+task.remotePath, func() error {
+		if err := c.put(ctx, task); err != nil {
+			return err
+		}
+		c.Logger.Info("[SYNC] 已上传 %s (%d 字节)", task.remotePath, task.size)
+		atomic.AddInt64(&stats.Transferred, 1)
+		atomic.AddInt64(&stats.Bytes, task.size)
+		return nil
+	})
+}
+
+// retry 调用fn，失败时按指数退避最多重试retries次，what用于日志
+func retry(ctx context.Context, retries int, backoff time.Duration, logger utils.Logger, what string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || errors.Is(err, context.Canceled) {
+			return err
+		}
+		logger.Warn("%s 失败，%v 后重试: %v", what, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// put 打开本地文件并上传，文件在遍历后被修改时按当前的大小上传
+func (c *SyncConfig) put(ctx context.Context, task uploadTask) error {
+	f, err := os.Open(task.localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	etag, err := c.Client.Put(ctx, task.remotePath, f, info.Size(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	c.State.record(task.remotePath, info.Size(), info.ModTime(), etag)
+	return nil
+}
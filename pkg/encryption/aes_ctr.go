@@ -80,8 +80,7 @@ func NewAesCTR(password string, fileSize int64, debugPrint DebugPrint) (*AesCTR,
 
 // SetPosition 设置加密/解密位置
 func (ac *AesCTR) SetPosition(position int64) {
-	// 重置IV
-	ac.iv = make([]byte, len(ac.sourceIV))
+	// 重置IV，复用已有的切片
 	copy(ac.iv, ac.sourceIV)
 
 	increment := position / 16
@@ -93,8 +92,8 @@ func (ac *AesCTR) SetPosition(position int64) {
 	// 跳过偏移量
 	offset := position % 16
 	if offset > 0 {
-		dummy := make([]byte, offset)
-		ac.stream.XORKeyStream(dummy, dummy)
+		var dummy [16]byte
+		ac.stream.XORKeyStream(dummy[:offset], dummy[:offset])
 	}
 }
 
@@ -140,4 +139,14 @@ func (ac *AesCTR) EncryptData(data []byte) []byte {
 func (ac *AesCTR) DecryptData(data []byte) []byte {
 	// AES-CTR模式下，加密和解密使用相同的操作
 	return ac.EncryptData(data)
+}
+
+// EncryptInPlace 原地加密数据
+func (ac *AesCTR) EncryptInPlace(data []byte) {
+	ac.stream.XORKeyStream(data, data)
+}
+
+// DecryptInPlace 原地解密数据
+func (ac *AesCTR) DecryptInPlace(data []byte) {
+	ac.stream.XORKeyStream(data, data)
 }
\ No newline at end of file
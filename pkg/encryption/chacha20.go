@@ -0,0 +1,105 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// chachaSegmentSize ChaCha20的32位块计数器最多覆盖256GiB，超过后换用下一段的nonce
+const chachaSegmentSize = 64 << 32
+
+// ChaCha20 ChaCha20流加密算法实现，没有AES硬件指令的CPU上比AES-CTR快得多
+type ChaCha20 struct {
+	key        []byte
+	nonce      []byte
+	position   int64
+	stream     *chacha20.Cipher
+	debugPrint DebugPrint
+}
+
+// NewChaCha20 创建新的ChaCha20实例，与AES-CTR一样由密码和文件大小确定密钥和nonce
+func NewChaCha20(password string, fileSize int64, debugPrint DebugPrint) (*ChaCha20, error) {
+	passwdOutward := password
+	if len(password) != 32 {
+		passwdOutward = hex.EncodeToString(pbkdf2(password, []byte("CHACHA20"), 1000, 16))
+	}
+
+	size := strconv.FormatInt(fileSize, 10)
+	key := sha256.Sum256([]byte(passwdOutward + size))
+	nonce := sha256.Sum256([]byte(size))
+
+	cc := &ChaCha20{
+		key:        key[:],
+		nonce:      nonce[:chacha20.NonceSize],
+		debugPrint: debugPrint,
+	}
+	if err := cc.resetStream(); err != nil {
+		return nil, err
+	}
+	return cc, nil
+}
+
+// resetStream 按当前位置所在的段创建密钥流，并定位到段内的块
+func (cc *ChaCha20) resetStream() error {
+	nonce := make([]byte, len(cc.nonce))
+	copy(nonce, cc.nonce)
+	segment := uint32(cc.position / chachaSegmentSize)
+	binary.BigEndian.PutUint32(nonce, binary.BigEndian.Uint32(nonce)^segment)
+
+	stream, err := chacha20.NewUnauthenticatedCipher(cc.key, nonce)
+	if err != nil {
+		return err
+	}
+	offset := cc.position % chachaSegmentSize
+	stream.SetCounter(uint32(offset / 64))
+	if skip := offset % 64; skip > 0 {
+		var dummy [64]byte
+		stream.XORKeyStream(dummy[:skip], dummy[:skip])
+	}
+	cc.stream = stream
+	return nil
+}
+
+// SetPosition 设置加密/解密位置
+func (cc *ChaCha20) SetPosition(position int64) {
+	cc.position = position
+	cc.resetStream()
+}
+
+// EncryptData 加密数据
+func (cc *ChaCha20) EncryptData(data []byte) []byte {
+	result := make([]byte, len(data))
+	copy(result, data)
+	cc.EncryptInPlace(result)
+	return result
+}
+
+// DecryptData 解密数据
+func (cc *ChaCha20) DecryptData(data []byte) []byte {
+	return cc.EncryptData(data)
+}
+
+// EncryptInPlace 原地加密数据，跨越段边界时换用下一段的密钥流
+func (cc *ChaCha20) EncryptInPlace(data []byte) {
+	for len(data) > 0 {
+		n := int64(len(data))
+		if remaining := chachaSegmentSize - cc.position%chachaSegmentSize; n > remaining {
+			n = remaining
+		}
+		cc.stream.XORKeyStream(data[:n], data[:n])
+		cc.position += n
+		data = data[n:]
+		if cc.position%chachaSegmentSize == 0 {
+			cc.resetStream()
+		}
+	}
+}
+
+// DecryptInPlace 原地解密数据
+func (cc *ChaCha20) DecryptInPlace(data []byte) {
+	cc.EncryptInPlace(data)
+}
@@ -0,0 +1,174 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// CompatResult 一条兼容性参考向量的检查结果
+type CompatResult struct {
+	Algorithm string
+	Password  string
+	Position  int64
+	Length    int64
+	Err       error // 为nil时加密和解密结果都与参考向量一致
+}
+
+// compatVector 原Node.js版本对合成数据加密和解密的结果，由testdata/compat_vectors.js生成
+type compatVector struct {
+	algorithm string
+	password  string
+	fileSize  int64
+	position  int64
+	encrypted string
+	decrypted string
+}
+
+// compatVectorLength 每条参考向量的数据长度
+const compatVectorLength = 32
+
+// compatVectors 覆盖派生密码和32位密码、AES块内偏移、计数器进位以及RC4每100万字节的分段边界
+var compatVectors = []compatVector{
+	{"aesctr", "123456", 3000000, 0, "92fa357485bdc402e218bb61501daa8e3dc68d204d7b17fe5be1e8a56507f7c3", "92fa357485bdc402e218bb61501daa8e3dc68d204d7b17fe5be1e8a56507f7c3"},
+	{"aesctr", "123456", 3000000, 15, "8e3dc68d204d7b17fe5be1e8a56507f7c3eb18ebdd03ccfa8389a993ca004a7f", "8e3dc68d204d7b17fe5be1e8a56507f7c3eb18ebdd03ccfa8389a993ca004a7f"},
+	{"aesctr", "123456", 3000000, 4095, "9795c2e246ed3d5afc8b05f04fc104feb4892c94df00b27720c70c2e93c0b6c7", "9795c2e246ed3d5afc8b05f04fc104feb4892c94df00b27720c70c2e93c0b6c7"},
+	{"aesctr", "123456", 3000000, 999990, "792eaa0567f8c932da8982d23a1ce4f7c235204cc380d9a5fd12bed2e7424fb8", "792eaa0567f8c932da8982d23a1ce4f7c235204cc380d9a5fd12bed2e7424fb8"},
+	{"aesctr", "123456", 3000000, 2000000, "63e78280b9526bfbaea644dbdfaf7c91a85ea9bf7bbad3c5d5be4a584c232ec9", "63e78280b9526bfbaea644dbdfaf7c91a85ea9bf7bbad3c5d5be4a584c232ec9"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 0, "d4a939494b1310fa5cdefb011c367da7de2579cc6f40a2c663ce315467954c15", "d4a939494b1310fa5cdefb011c367da7de2579cc6f40a2c663ce315467954c15"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 15, "a7de2579cc6f40a2c663ce315467954c15400c96a39d4b352a5849ff9fd9114a", "a7de2579cc6f40a2c663ce315467954c15400c96a39d4b352a5849ff9fd9114a"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 4095, "20017fa307e5a06ac3307e1c367a6c4b5b8fbacddaa411145b4e27cc1d725455", "20017fa307e5a06ac3307e1c367a6c4b5b8fbacddaa411145b4e27cc1d725455"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 999990, "2b621344bb9a392d2cdff45b7c8fc2a7e4caab5d8c978dc08cfe50554f88266d", "2b621344bb9a392d2cdff45b7c8fc2a7e4caab5d8c978dc08cfe50554f88266d"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 2000000, "1324c2450bb7e73cf1d4c15e90d7f6815af7a249bd78b759ef9bd6bb7d2709c5", "1324c2450bb7e73cf1d4c15e90d7f6815af7a249bd78b759ef9bd6bb7d2709c5"},
+	{"rc4", "123456", 3000000, 0, "dfc516b0df3422a4f9bed292e90400d2aede6285963e43fedb6fd4436d063174", "dfc516b0df3422a4f9bed292e90400d2aede6285963e43fedb6fd4436d063174"},
+	{"rc4", "123456", 3000000, 15, "d2aede6285963e43fedb6fd4436d063174e7eb2ef174becf941ba06fa5fa64cb", "d2aede6285963e43fedb6fd4436d063174e7eb2ef174becf941ba06fa5fa64cb"},
+	{"rc4", "123456", 3000000, 4095, "8150cee9d19ca19fed91cf674fbbe571e9a3b0d61497063288e160a12914e883", "8150cee9d19ca19fed91cf674fbbe571e9a3b0d61497063288e160a12914e883"},
+	{"rc4", "123456", 3000000, 999990, "1168c364a5c1391b527e9c751b39d527cbc67531d55101c31bc9c8d65c7b7e50", "1168c364a5c1391b527e9c751b39d527cbc67531d55101c31bc9c8d65c7b7e50"},
+	{"rc4", "123456", 3000000, 2000000, "58266e47b569ff543b2259d7c3c573670965436a49526d7780b9ed959f9afa45", "58266e47b569ff543b2259d7c3c573670965436a49526d7780b9ed959f9afa45"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 0, "0805e503fdef1adefad5e7cac61a505aa95a5788c6b7ba91ce49c0aca4567eef", "0805e503fdef1adefad5e7cac61a505aa95a5788c6b7ba91ce49c0aca4567eef"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 15, "5aa95a5788c6b7ba91ce49c0aca4567eef512880a837b3a31e83914b9b768a9e", "5aa95a5788c6b7ba91ce49c0aca4567eef512880a837b3a31e83914b9b768a9e"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 4095, "90b0700c18c0c5fc473e2e76cea9a551e2c0b3588e6940edb5b437eb52ba0a0a", "90b0700c18c0c5fc473e2e76cea9a551e2c0b3588e6940edb5b437eb52ba0a0a"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 999990, "d21915ea98b9a48eb1f6b33bafa60b0720dc50426df23c8507d25a260d77168b", "d21915ea98b9a48eb1f6b33bafa60b0720dc50426df23c8507d25a260d77168b"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 2000000, "d478320d4795aeea81772bb5a952254e27e08c1b6c0c10dbb88b10f63470cc52", "d478320d4795aeea81772bb5a952254e27e08c1b6c0c10dbb88b10f63470cc52"},
+	{"mix", "123456", 3000000, 0, "c2be60bbd31a77b4df3d3c784ead8ccbe908d08a1276a5c4c34f396627d5b1c1", "4b0c5170af67c8c5df861e5da422adfc41f26a0023f3a935ae3b1a797854b7d6"},
+	{"mix", "123456", 3000000, 15, "cbe908d08a1276a5c4c34f396627d5b1c1229e009b333a1794ffdd1c186e4dac", "fc41f26a0023f3a935ae3b1a797854b7d6ab2c31504f47a8e5ff663e3d84c28d"},
+	{"mix", "123456", 3000000, 4095, "e1c2be60bbd31a77b4df3d3c784ead8ccbe908d08a1276a5c4c34f396627d5b1", "f64b0c5170af67c8c5df861e5da422adfc41f26a0023f3a935ae3b1a797854b7"},
+	{"mix", "123456", 3000000, 999990, "85a4e3af1906073591a1027e20fb13da37f49ffdfc380e6d4c8ba9c810ca52b6", "89558edb3a1958b497b68bcc11306fa788859f46de1de4e26dbc0132aa406333"},
+	{"mix", "123456", 3000000, 2000000, "423ee03b539af7345fbdbcf8ce2d0c4b6988500a92f6254443cfb9e6a7553141", "cb8cd1f02fe748455f069edd24a22d7cc172ea80a37329b52ebb9af9f8d43756"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 0, "71cd02fdc01f70deda391453528c8a1c6b09757bf888a71776ee2645446fa3e1", "112d4c4b89e5e8a34220a49854bf9e53308f757d7cbbc7610aeec65af7b9b6d2"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 15, "1c6b09757bf888a71776ee2645446fa3e191ed62dd203f10fefad93433726caa", "53308f757d7cbbc7610aeec65af7b9b6d2f10d2c6b69c5888362c084f8745fbe"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 4095, "c171cd02fdc01f70deda391453528c8a1c6b09757bf888a71776ee2645446fa3", "f2112d4c4b89e5e8a34220a49854bf9e53308f757d7cbbc7610aeec65af7b9b6"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 999990, "8777560e0625648f8381b10d42bd00df309e9af9d413124c4a5c2bc9b53bb848", "e7012a0ee63ad75996b2d1ed0c0b4925a8e302e064d8147f5e13704fb53d3c7b"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 2000000, "f14d827d409ff05e5ab994d3d20c0a9ceb89f5fb78082797f66ea6c5c4ef2361", "91adcccb09656823c2a02418d43f1ed3b00ff5fdfc3b47e18a6e46da77393652"},
+}
+
+// compatStreamVector 原Node.js版本从position开始连续加密length字节合成数据的结果（密文的SHA-256），
+// 由testdata/compat_vectors.js生成
+type compatStreamVector struct {
+	algorithm string
+	password  string
+	fileSize  int64
+	position  int64
+	length    int64
+	encrypted string
+}
+
+// compatStreamChunk 连续加密时每次写入的数据长度，与上传时按块加密的用法相同
+const compatStreamChunk = 65536
+
+// compatStreamVectors 从文件开头和第一个分段边界前开始，连续跨越RC4在1000000和2000000字节处的分段边界。
+// 32字节的向量每次都从SetPosition开始，只能检查定位；这里检查的是连续加密时分段重置发生的位置
+var compatStreamVectors = []compatStreamVector{
+	{"aesctr", "123456", 3000000, 0, 2000010, "4c43f62ac28da826b4a334b35ecb0fca3f679c1d211bad857b514912a0054a4d"},
+	{"aesctr", "123456", 3000000, 999990, 2000010, "a34a1150dc0754c2c68850caf2148592d327b3fdcfb60649227246124c0a4160"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 0, 2000010, "8464313e653e713baa4455f769f617f7479070e7f286c0fdcfea04903809b8ba"},
+	{"aesctr", "0123456789abcdef0123456789abcdef", 3000000, 999990, 2000010, "822aef4bf8232111109c04a0d6a6548f9f1c97a6c4372ecaac63b8c13388e5a6"},
+	{"rc4", "123456", 3000000, 0, 2000010, "579b265d60c77b5ebfa8669e0897b831cb8aeaf3f47cfe47538b0d5eb80a3803"},
+	{"rc4", "123456", 3000000, 999990, 2000010, "fa4f4a808079691a8fd2c9045af3afae5570256a44477f27e22d2d5a285ff081"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 0, 2000010, "c6d0d3e7bf2a95080fea91bfb4819b34f5b0fa24728166ee4dded865c581d31d"},
+	{"rc4", "0123456789abcdef0123456789abcdef", 3000000, 999990, 2000010, "64fbc9c135eedcb94e9eeb077ec41bb36114b239b6b3df6f719ba8bb666e248f"},
+	{"mix", "123456", 3000000, 0, 2000010, "117f2ef3b7dd823f87c83def390072827c6a43dc58ced000c52e9d101ccae5be"},
+	{"mix", "123456", 3000000, 999990, 2000010, "537d4d295211c3f6ad394afa93f1763c3506bb55a649d819bd4b73deaa39f426"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 0, 2000010, "f7a5119fd3a386a3edb4e70a8bb70829e9a01f8161294cd063127e6bd4108f16"},
+	{"mix", "0123456789abcdef0123456789abcdef", 3000000, 999990, 2000010, "7e850938919d57484c89b5d2747041484db7f3cdfbc331e65de4af793f618c67"},
+}
+
+// compatPlaintext 生成position处的合成明文，与testdata/compat_vectors.js中的plaintext相同
+func compatPlaintext(position int64, length int) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = byte((position+int64(i))*31 + 7)
+	}
+	return data
+}
+
+// CompatTest 用内置算法加解密参考向量的明文，与原Node.js版本的结果比较，确认两者加密的文件可以互相解密
+func CompatTest() []CompatResult {
+	results := make([]CompatResult, 0, len(compatVectors)+len(compatStreamVectors))
+	for _, v := range compatVectors {
+		results = append(results, CompatResult{
+			Algorithm: v.algorithm,
+			Password:  v.password,
+			Position:  v.position,
+			Length:    compatVectorLength,
+			Err:       checkCompatVector(v),
+		})
+	}
+	for _, v := range compatStreamVectors {
+		results = append(results, CompatResult{
+			Algorithm: v.algorithm,
+			Password:  v.password,
+			Position:  v.position,
+			Length:    v.length,
+			Err:       checkCompatStreamVector(v),
+		})
+	}
+	return results
+}
+
+// checkCompatVector 检查一条参考向量，加密器从文件中间定位，与Range下载时的用法相同
+func checkCompatVector(v compatVector) error {
+	plain := compatPlaintext(v.position, compatVectorLength)
+	for _, check := range []struct {
+		name     string
+		expected string
+		apply    func(Encryptor, []byte) []byte
+	}{
+		{"encrypt", v.encrypted, Encryptor.EncryptData},
+		{"decrypt", v.decrypted, Encryptor.DecryptData},
+	} {
+		enc, err := NewEncryptor(v.password, v.algorithm, v.fileSize, func(string) {})
+		if err != nil {
+			return err
+		}
+		enc.SetPosition(v.position)
+		expected, err := hex.DecodeString(check.expected)
+		if err != nil {
+			return fmt.Errorf("invalid reference vector: %w", err)
+		}
+		if actual := check.apply(enc, plain); !bytes.Equal(actual, expected) {
+			return fmt.Errorf("%s mismatch: got %x, want %x", check.name, actual, expected)
+		}
+	}
+	return nil
+}
+
+// checkCompatStreamVector 检查一条连续加密的参考向量，按compatStreamChunk分块原地加密
+func checkCompatStreamVector(v compatStreamVector) error {
+	enc, err := NewEncryptor(v.password, v.algorithm, v.fileSize, func(string) {})
+	if err != nil {
+		return err
+	}
+	enc.SetPosition(v.position)
+	hash := sha256.New()
+	for offset := int64(0); offset < v.length; offset += compatStreamChunk {
+		chunk := compatPlaintext(v.position+offset, int(min(compatStreamChunk, v.length-offset)))
+		EncryptInPlace(enc, chunk)
+		hash.Write(chunk)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != v.encrypted {
+		return fmt.Errorf("stream encrypt mismatch: got sha256 %s, want %s", actual, v.encrypted)
+	}
+	return nil
+}
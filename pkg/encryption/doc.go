@@ -0,0 +1,6 @@
+// Package encryption 提供代理使用的流式加密算法。
+//
+// 所有算法都实现Encryptor接口，支持通过SetPosition随机定位，因此可以只加解密文件的一部分（如Range下载）。
+// 加密后的数据与明文长度相同，算法通过名称注册到全局注册表（RegisterEncryptorFactory），
+// 使用NewEncryptor按名称创建。内置算法为aesctr、rc4和mix，第三方算法可以直接注册或通过插件加载（LoadPlugin）。
+package encryption
@@ -1,6 +1,10 @@
 package encryption
 
-import "fmt"
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
 
 // Encryptor 加密接口
 type Encryptor interface {
@@ -38,6 +42,22 @@ func RegisterEncryptorFactoryFunc(encryptType string, factoryFunc func(password
 	encryptorFactories[encryptType] = EncryptorFactoryFunc(factoryFunc)
 }
 
+// HasEncryptor 检查加密类型是否已注册
+func HasEncryptor(encryptType string) bool {
+	_, ok := encryptorFactories[encryptType]
+	return ok
+}
+
+// EncryptorTypes 返回已注册的加密类型，按名称排序
+func EncryptorTypes() []string {
+	types := make([]string, 0, len(encryptorFactories))
+	for encryptType := range encryptorFactories {
+		types = append(types, encryptType)
+	}
+	sort.Strings(types)
+	return types
+}
+
 // NewEncryptor 创建加密器
 func NewEncryptor(password, encryptType string, fileSize int64, debugPrint DebugPrint) (Encryptor, error) {
 	factory, ok := encryptorFactories[encryptType]
@@ -51,3 +71,24 @@ func NewEncryptor(password, encryptType string, fileSize int64, debugPrint Debug
 func NewFlowEnc(password, encryptType string, fileSize int64, debugPrint DebugPrint) (Encryptor, error) {
 	return NewEncryptor(password, encryptType, fileSize, debugPrint)
 }
+
+// derivedKeySalts 内置算法派生密钥使用的盐
+var derivedKeySalts = map[string]string{
+	"aesctr":   "AES-CTR",
+	"chacha20": "CHACHA20",
+	"rc4":      "RC4",
+	"mix":      "MIX",
+}
+
+// DeriveKey 用PBKDF2从密码派生内置算法使用的32位十六进制密钥，这是创建内置加密器时唯一耗时的步骤。
+// 用派生的密钥代替密码创建加密器结果相同，但跳过了派生。插件注册的算法不支持派生，返回false
+func DeriveKey(password, encryptType string) (string, bool) {
+	salt, ok := derivedKeySalts[encryptType]
+	if !ok {
+		return "", false
+	}
+	if len(password) == 32 {
+		return password, true
+	}
+	return hex.EncodeToString(pbkdf2(password, []byte(salt), 1000, 16)), true
+}
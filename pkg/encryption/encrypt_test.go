@@ -0,0 +1,152 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// encryptTypes 内置的加密算法
+var encryptTypes = []string{"aesctr", "chacha20", "rc4", "mix"}
+
+func noDebug(string) {}
+
+func newTestEncryptor(t testing.TB, encryptType string, size int64) Encryptor {
+	enc, err := NewEncryptor("test-password", encryptType, size, noDebug)
+	if err != nil {
+		t.Fatalf("创建加密器失败: %v", err)
+	}
+	return enc
+}
+
+func TestInPlaceMatchesEncryptData(t *testing.T) {
+	// 跨越RC4的100万字节重置点，并从非块边界的位置开始
+	const size = 3 << 20
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	for _, encryptType := range encryptTypes {
+		t.Run(encryptType, func(t *testing.T) {
+			for _, position := range []int64{0, 13, SEGMENT_POSITION - 5} {
+				plain := data[position:]
+
+				expected := newTestEncryptor(t, encryptType, size)
+				expected.SetPosition(position)
+				encrypted := expected.EncryptData(plain)
+
+				actual := newTestEncryptor(t, encryptType, size)
+				actual.SetPosition(position)
+				buf := append([]byte(nil), plain...)
+				for offset := 0; offset < len(buf); offset += 8192 {
+					EncryptInPlace(actual, buf[offset:min(offset+8192, len(buf))])
+				}
+				if !bytes.Equal(buf, encrypted) {
+					t.Fatalf("位置 %d 原地加密结果与EncryptData不一致", position)
+				}
+
+				actual.SetPosition(position)
+				DecryptInPlace(actual, buf)
+				if !bytes.Equal(buf, plain) {
+					t.Fatalf("位置 %d 原地解密结果与明文不一致", position)
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveKeyMatchesPassword(t *testing.T) {
+	data := []byte("derived keys must produce the same ciphertext as the password")
+	for _, encryptType := range encryptTypes {
+		t.Run(encryptType, func(t *testing.T) {
+			key, ok := DeriveKey("test-password", encryptType)
+			if !ok || len(key) != 32 {
+				t.Fatalf("派生密钥失败: %q, %v", key, ok)
+			}
+			derived, err := NewEncryptor(key, encryptType, int64(len(data)), noDebug)
+			if err != nil {
+				t.Fatalf("创建加密器失败: %v", err)
+			}
+			expected := newTestEncryptor(t, encryptType, int64(len(data))).EncryptData(data)
+			if !bytes.Equal(derived.EncryptData(data), expected) {
+				t.Fatal("用派生密钥创建的加密器结果与密码不一致")
+			}
+		})
+	}
+	if _, ok := DeriveKey("test-password", "unknown"); ok {
+		t.Fatal("未知算法不应该支持派生")
+	}
+}
+
+func TestChaCha20SegmentBoundary(t *testing.T) {
+	// 跨越256GiB段边界时的密钥流与从边界处重新定位的结果一致
+	data := make([]byte, 200)
+	enc := newTestEncryptor(t, "chacha20", 1<<40)
+	enc.SetPosition(chachaSegmentSize - 100)
+	across := enc.EncryptData(data)
+
+	enc.SetPosition(chachaSegmentSize)
+	if !bytes.Equal(across[100:], enc.EncryptData(data[100:])) {
+		t.Fatal("跨越段边界的密钥流不连续")
+	}
+	if bytes.Equal(across[:100], across[100:]) {
+		t.Fatal("相邻段使用了相同的密钥流")
+	}
+}
+
+func benchmarkEncrypt(b *testing.B, inPlace bool) {
+	for _, encryptType := range encryptTypes {
+		for _, chunkSize := range []int{8192, 64 * 1024} {
+			b.Run(fmt.Sprintf("%s/%d", encryptType, chunkSize), func(b *testing.B) {
+				enc := newTestEncryptor(b, encryptType, 1<<30)
+				buf := make([]byte, chunkSize)
+				b.SetBytes(int64(chunkSize))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if inPlace {
+						EncryptInPlace(enc, buf)
+					} else {
+						copy(buf, enc.EncryptData(buf))
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkEncryptData(b *testing.B) {
+	benchmarkEncrypt(b, false)
+}
+
+func BenchmarkEncryptInPlace(b *testing.B) {
+	benchmarkEncrypt(b, true)
+}
+
+func BenchmarkSetPosition(b *testing.B) {
+	for _, encryptType := range encryptTypes {
+		b.Run(encryptType, func(b *testing.B) {
+			enc := newTestEncryptor(b, encryptType, 1<<30)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				enc.SetPosition(int64(i) * 8192 % (1 << 30))
+			}
+		})
+	}
+}
+
+func TestCompatVectors(t *testing.T) {
+	for _, result := range CompatTest() {
+		if result.Err != nil {
+			t.Errorf("%s 密码%q 位置%d 与原Node.js版本不一致: %v", result.Algorithm, result.Password, result.Position, result.Err)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	for _, encryptType := range encryptTypes {
+		if err := SelfTest(encryptType); err != nil {
+			t.Errorf("自检失败: %v", err)
+		}
+	}
+}
@@ -69,4 +69,14 @@ func (fe *FlowEnc) EncryptData(data []byte) []byte {
 // DecryptData 解密数据
 func (fe *FlowEnc) DecryptData(data []byte) []byte {
 	return fe.encryptFlow.DecryptData(data)
+}
+
+// EncryptInPlace 原地加密数据
+func (fe *FlowEnc) EncryptInPlace(data []byte) {
+	EncryptInPlace(fe.encryptFlow, data)
+}
+
+// DecryptInPlace 原地解密数据
+func (fe *FlowEnc) DecryptInPlace(data []byte) {
+	DecryptInPlace(fe.encryptFlow, data)
 }
\ No newline at end of file
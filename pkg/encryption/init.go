@@ -15,6 +15,16 @@ func init() {
 		return aesCtr, nil
 	})
 
+	// 注册ChaCha20加密器
+	RegisterEncryptorFactoryFunc("chacha20", func(password string, fileSize int64, debugPrint DebugPrint) (Encryptor, error) {
+		chacha, err := NewChaCha20(password, fileSize, debugPrint)
+		if err != nil {
+			return nil, err
+		}
+		debugPrint(fmt.Sprintf("@@chacha20 chacha20 %d", fileSize))
+		return chacha, nil
+	})
+
 	// 注册RC4-MD5加密器
 	RegisterEncryptorFactoryFunc("rc4", func(password string, fileSize int64, debugPrint DebugPrint) (Encryptor, error) {
 		rc4 := NewRc4Md5(password, fileSize, debugPrint)
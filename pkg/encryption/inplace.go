@@ -0,0 +1,27 @@
+package encryption
+
+// InPlaceEncryptor 可以原地加解密的加密器。EncryptData/DecryptData每次都会分配新的切片，
+// 流式传输时改用原地加解密可以避免为每个数据块分配内存
+type InPlaceEncryptor interface {
+	Encryptor
+	EncryptInPlace(data []byte)
+	DecryptInPlace(data []byte)
+}
+
+// EncryptInPlace 原地加密data，加密器不支持原地加密时退回EncryptData并复制结果
+func EncryptInPlace(enc Encryptor, data []byte) {
+	if inPlace, ok := enc.(InPlaceEncryptor); ok {
+		inPlace.EncryptInPlace(data)
+		return
+	}
+	copy(data, enc.EncryptData(data))
+}
+
+// DecryptInPlace 原地解密data，加密器不支持原地解密时退回DecryptData并复制结果
+func DecryptInPlace(enc Encryptor, data []byte) {
+	if inPlace, ok := enc.(InPlaceEncryptor); ok {
+		inPlace.DecryptInPlace(data)
+		return
+	}
+	copy(data, enc.DecryptData(data))
+}
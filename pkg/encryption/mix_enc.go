@@ -85,4 +85,18 @@ func (me *MixEnc) DecryptData(data []byte) []byte {
 		result[i] = data[i] ^ me.decode[data[i]%32]
 	}
 	return result
+}
+
+// EncryptInPlace 原地加密数据，每个字节只依赖自身，可以直接覆盖
+func (me *MixEnc) EncryptInPlace(data []byte) {
+	for i := range data {
+		data[i] ^= me.encode[data[i]%32]
+	}
+}
+
+// DecryptInPlace 原地解密数据
+func (me *MixEnc) DecryptInPlace(data []byte) {
+	for i := range data {
+		data[i] ^= me.decode[data[i]%32]
+	}
 }
\ No newline at end of file
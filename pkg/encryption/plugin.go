@@ -0,0 +1,42 @@
+//go:build plugins
+
+package encryption
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginsSupported 当前构建是否支持加载加密器插件
+const PluginsSupported = true
+
+// LoadPlugin 加载加密器插件。插件用 go build -buildmode=plugin 构建，需要导出
+// func RegisterEncryptors(register func(name string, factory encryption.EncryptorFactory))，
+// 在其中注册自己的加密器。插件必须与代理使用同一版本的Go和本模块构建
+func LoadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("open encryptor plugin %s: %w", path, err)
+	}
+	symbol, err := p.Lookup("RegisterEncryptors")
+	if err != nil {
+		return fmt.Errorf("encryptor plugin %s: %w", path, err)
+	}
+	registerEncryptors, ok := symbol.(func(func(string, EncryptorFactory)))
+	if !ok {
+		return fmt.Errorf("encryptor plugin %s: RegisterEncryptors has wrong signature %T", path, symbol)
+	}
+
+	var registerErr error
+	registerEncryptors(func(name string, factory EncryptorFactory) {
+		// 插件不能覆盖内置或其他插件已注册的加密器，避免同名算法被替换后无法解密已有文件
+		if _, exists := encryptorFactories[name]; exists {
+			if registerErr == nil {
+				registerErr = fmt.Errorf("encryptor plugin %s: encrypt type %s already registered", path, name)
+			}
+			return
+		}
+		RegisterEncryptorFactory(name, factory)
+	})
+	return registerErr
+}
@@ -0,0 +1,13 @@
+//go:build !plugins
+
+package encryption
+
+import "fmt"
+
+// PluginsSupported 当前构建是否支持加载加密器插件
+const PluginsSupported = false
+
+// LoadPlugin 未使用plugins构建标签时不支持加载插件
+func LoadPlugin(path string) error {
+	return fmt.Errorf("encryptor plugin %s: plugin support not compiled in, rebuild with -tags plugins", path)
+}
@@ -78,23 +78,34 @@ func (rc *Rc4Md5) SetPosition(position int64) {
 
 // EncryptData 加密数据
 func (rc *Rc4Md5) EncryptData(data []byte) []byte {
-	return rc.prgaExecute(data)
+	result := make([]byte, len(data))
+	copy(result, data)
+	rc.prgaExecute(result)
+	return result
 }
 
 // DecryptData 解密数据
 func (rc *Rc4Md5) DecryptData(data []byte) []byte {
 	// RC4加密和解密使用相同的方法
-	return rc.prgaExecute(data)
+	return rc.EncryptData(data)
 }
 
-// prgaExecute 执行PRGA算法
-func (rc *Rc4Md5) prgaExecute(buffer []byte) []byte {
-	S := make([]int, len(rc.sbox))
-	copy(S, rc.sbox)
-	i, j := rc.i, rc.j
+// EncryptInPlace 原地加密数据
+func (rc *Rc4Md5) EncryptInPlace(data []byte) {
+	rc.prgaExecute(data)
+}
+
+// DecryptInPlace 原地解密数据
+func (rc *Rc4Md5) DecryptInPlace(data []byte) {
+	rc.prgaExecute(data)
+}
 
-	result := make([]byte, len(buffer))
-	copy(result, buffer)
+// prgaExecute 执行PRGA算法，原地异或result
+func (rc *Rc4Md5) prgaExecute(result []byte) {
+	// 直接在sbox上置换，不再复制
+	S := rc.sbox
+	i, j := rc.i, rc.j
+	position := rc.position
 
 	for k := range result {
 		i = (i + 1) % 256
@@ -103,32 +114,26 @@ func (rc *Rc4Md5) prgaExecute(buffer []byte) []byte {
 		S[i], S[j] = S[j], S[i]
 		result[k] ^= byte(S[(S[i]+S[j])%256])
 
-		// 检查是否需要重置sbox
-		if (rc.position+int64(k)+1)%SEGMENT_POSITION == 0 {
-			// 重置状态
-			tempPos := rc.position + int64(k) + 1
-			rc.position = tempPos
+		// 每个字节推进一次位置，到达分段边界时重置sbox，与SetPosition的定位方式一致
+		position++
+		if position%SEGMENT_POSITION == 0 {
+			rc.position = position
 			rc.ResetKSA()
-			copy(S, rc.sbox)
 			i, j = rc.i, rc.j
 		}
 	}
 
 	// 保存状态
 	rc.i, rc.j = i, j
-	rc.position += int64(len(buffer))
-	copy(rc.sbox, S)
-
-	return result
+	rc.position = position
 }
 
 // prgaExecPosition 执行PRGA算法到指定位置
 func (rc *Rc4Md5) prgaExecPosition(plainLen int64) {
-	S := make([]int, len(rc.sbox))
-	copy(S, rc.sbox)
+	S := rc.sbox
 	i, j := rc.i, rc.j
 
-	for _ = range make([]struct{}, plainLen) {
+	for k := int64(0); k < plainLen; k++ {
 		i = (i + 1) % 256
 		j = (j + S[i]) % 256
 		// 交换S[i]和S[j]
@@ -137,19 +142,20 @@ func (rc *Rc4Md5) prgaExecPosition(plainLen int64) {
 
 	// 保存状态
 	rc.i, rc.j = i, j
-	copy(rc.sbox, S)
 }
 
 // initKSA 初始化KSA（密钥调度算法）
 func (rc *Rc4Md5) initKSA(key []byte) {
-	// 初始化S盒
-	rc.sbox = make([]int, 256)
+	// 初始化S盒，复用已有的S盒
+	if rc.sbox == nil {
+		rc.sbox = make([]int, 256)
+	}
 	for i := range rc.sbox {
 		rc.sbox[i] = i
 	}
 
 	// 用种子密钥填充K表
-	K := make([]byte, 256)
+	var K [256]byte
 	keyLen := len(key)
 	for i := range K {
 		K[i] = key[i%keyLen]
@@ -0,0 +1,59 @@
+package encryption
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// 自检使用的合成文件大小和数据长度，文件不需要真实存在
+const (
+	selfTestFileSize = 1 << 37
+	selfTestLength   = 4096
+)
+
+// selfTestPositions 自检的起始位置：文件开头、AES块内偏移、RC4分段边界，以及IV计数器跨越32位的位置
+var selfTestPositions = []int64{
+	0,
+	15,
+	SEGMENT_POSITION - selfTestLength/2,
+	3*SEGMENT_POSITION - selfTestLength/2,
+	1<<32 + 7,
+	1<<36 - selfTestLength/2,
+}
+
+// SelfTest 在合成文件的多个位置做加密→解密往返检查，解密分两段进行，第二段从数据中间重新定位，
+// 与Range下载的用法相同。编译或配置有问题的算法可能把数据加密成无法解密的内容，启动时检查可以在存入数据前发现
+func SelfTest(encryptType string) error {
+	for _, position := range selfTestPositions {
+		plain := make([]byte, selfTestLength)
+		for i := range plain {
+			plain[i] = byte((position+int64(i))*131 + 17)
+		}
+
+		enc, err := NewEncryptor("self-test-password", encryptType, selfTestFileSize, func(string) {})
+		if err != nil {
+			return err
+		}
+		enc.SetPosition(position)
+		cipherText := enc.EncryptData(plain)
+		if bytes.Equal(cipherText, plain) {
+			return fmt.Errorf("%s: data at position %d is not encrypted", encryptType, position)
+		}
+
+		// 第二段的起点越过RC4分段边界，并且不在AES块的边界上
+		split := selfTestLength/2 + 7
+		decrypted := make([]byte, 0, selfTestLength)
+		for _, part := range [][2]int{{0, split}, {split, selfTestLength}} {
+			dec, err := NewEncryptor("self-test-password", encryptType, selfTestFileSize, func(string) {})
+			if err != nil {
+				return err
+			}
+			dec.SetPosition(position + int64(part[0]))
+			decrypted = append(decrypted, dec.DecryptData(cipherText[part[0]:part[1]])...)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			return fmt.Errorf("%s: round trip at position %d does not match", encryptType, position)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+// 生成compat.go中的兼容性参考向量：node compat_vectors.js
+// 算法按原Node.js版本（alist-encrypt node-proxy/src/utils下的aesCTR.js、rc4Md5.js、mixEnc.js）实现，
+// 密钥派生、MD5和AES-128-CTR都使用Node.js的crypto模块，与Go实现互相独立
+'use strict'
+const crypto = require('crypto')
+
+const segmentPosition = 100 * 10000
+
+class AesCTR {
+  constructor(password, sizeSalt) {
+    this.passwdOutward = password
+    if (password.length !== 32) {
+      this.passwdOutward = crypto.pbkdf2Sync(password, 'AES-CTR', 1000, 16, 'sha256').toString('hex')
+    }
+    this.key = crypto.createHash('md5').update(this.passwdOutward + sizeSalt).digest()
+    this.sourceIv = crypto.createHash('md5').update(sizeSalt + '').digest()
+    this.iv = Buffer.from(this.sourceIv)
+    this.cipher = crypto.createCipheriv('aes-128-ctr', this.key, this.iv)
+  }
+
+  setPosition(position) {
+    this.iv = Buffer.from(this.sourceIv)
+    this.incrementIV(Math.floor(position / 16))
+    this.cipher = crypto.createCipheriv('aes-128-ctr', this.key, this.iv)
+    this.encrypt(Buffer.alloc(position % 16))
+  }
+
+  incrementIV(increment) {
+    const MAX_UINT32 = 0xffffffff
+    const incrementBig = ~~(increment / MAX_UINT32)
+    const incrementLittle = (increment % MAX_UINT32) - incrementBig
+    let overflow = 0
+    for (let idx = 0; idx < 4; ++idx) {
+      let num = this.iv.readUInt32BE(12 - idx * 4)
+      let inc = overflow
+      if (idx === 0) inc += incrementLittle
+      if (idx === 1) inc += incrementBig
+      num += inc
+      const numBig = ~~(num / MAX_UINT32)
+      const numLittle = (num % MAX_UINT32) - numBig
+      overflow = numBig
+      this.iv.writeUInt32BE(numLittle, 12 - idx * 4)
+    }
+  }
+
+  encrypt(data) {
+    return this.cipher.update(data)
+  }
+
+  decrypt(data) {
+    return this.cipher.update(data)
+  }
+}
+
+class Rc4Md5 {
+  constructor(password, sizeSalt) {
+    this.position = 0
+    this.passwdOutward = password
+    if (password.length !== 32) {
+      this.passwdOutward = crypto.pbkdf2Sync(password, 'RC4', 1000, 16, 'sha256').toString('hex')
+    }
+    this.fileHexKey = crypto.createHash('md5').update(this.passwdOutward + sizeSalt).digest('hex')
+    this.resetKSA()
+  }
+
+  resetKSA() {
+    const offset = Math.floor(this.position / segmentPosition) * segmentPosition
+    const buf = Buffer.alloc(4)
+    buf.writeInt32BE(offset)
+    const rc4Key = Buffer.from(this.fileHexKey, 'hex')
+    let j = rc4Key.length - buf.length
+    for (let i = 0; i < buf.length; i++, j++) {
+      rc4Key[j] = rc4Key[j] ^ buf[i]
+    }
+    this.initKSA(rc4Key)
+  }
+
+  setPosition(position) {
+    this.position = position
+    this.resetKSA()
+    this.prgaExecPosition(position % segmentPosition)
+  }
+
+  encrypt(data) {
+    const out = Buffer.from(data)
+    this.prgaExecute(out)
+    return out
+  }
+
+  decrypt(data) {
+    return this.encrypt(data)
+  }
+
+  prgaExecute(plainBuffer) {
+    let { sbox: S, i, j } = this
+    for (let k = 0; k < plainBuffer.length; k++) {
+      i = (i + 1) % 256
+      j = (j + S[i]) % 256
+      ;[S[i], S[j]] = [S[j], S[i]]
+      plainBuffer[k] ^= S[(S[i] + S[j]) % 256]
+      if (++this.position % segmentPosition === 0) {
+        this.resetKSA()
+        S = this.sbox
+        i = this.i
+        j = this.j
+      }
+    }
+    this.i = i
+    this.j = j
+  }
+
+  prgaExecPosition(plainLen) {
+    let { sbox: S, i, j } = this
+    for (let k = 0; k < plainLen; k++) {
+      i = (i + 1) % 256
+      j = (j + S[i]) % 256
+      ;[S[i], S[j]] = [S[j], S[i]]
+    }
+    this.i = i
+    this.j = j
+  }
+
+  initKSA(key) {
+    const K = []
+    const S = []
+    for (let i = 0; i < 256; i++) {
+      S[i] = i
+      K[i] = key[i % key.length]
+    }
+    let j = 0
+    for (let i = 0; i < 256; i++) {
+      j = (j + S[i] + K[i]) % 256
+      ;[S[i], S[j]] = [S[j], S[i]]
+    }
+    this.sbox = S
+    this.i = 0
+    this.j = 0
+  }
+}
+
+class MixEnc {
+  constructor(password) {
+    this.passwdOutward = password
+    if (password.length !== 32) {
+      this.passwdOutward = crypto.pbkdf2Sync(password, 'MIX', 1000, 16, 'sha256').toString('hex')
+    }
+    const encode = crypto.createHash('sha256').update(this.passwdOutward).digest()
+    const length = encode.length
+    const decode = Buffer.alloc(length)
+    const decodeCheck = {}
+    for (let i = 0; i < length; i++) {
+      const enc = encode[i] ^ i
+      if (!decodeCheck[enc % length]) {
+        decode[enc % length] = encode[i] & 0xff
+        decodeCheck[enc % length] = true
+      } else {
+        for (let j = 0; j < length; j++) {
+          if (!decodeCheck[j]) {
+            encode[i] = (encode[i] & length) | (j ^ i)
+            decode[j] = encode[i] & 0xff
+            decodeCheck[j] = true
+            break
+          }
+        }
+      }
+    }
+    this.encodeTable = encode
+    this.decodeTable = decode
+  }
+
+  setPosition() {}
+
+  encrypt(data) {
+    const out = Buffer.from(data)
+    for (let i = out.length; i--; ) {
+      out[i] ^= this.encodeTable[out[i] % 32]
+    }
+    return out
+  }
+
+  decrypt(data) {
+    const out = Buffer.from(data)
+    for (let i = out.length; i--; ) {
+      out[i] ^= this.decodeTable[out[i] % 32]
+    }
+    return out
+  }
+}
+
+// 与compat.go中的compatPlaintext相同
+function plaintext(position, length) {
+  const buf = Buffer.alloc(length)
+  for (let i = 0; i < length; i++) {
+    buf[i] = ((position + i) * 31 + 7) & 0xff
+  }
+  return buf
+}
+
+const algorithms = { aesctr: AesCTR, rc4: Rc4Md5, mix: MixEnc }
+const passwords = ['123456', '0123456789abcdef0123456789abcdef']
+const fileSize = 3000000
+// 覆盖AES块内偏移、计数器进位和RC4每100万字节的分段边界
+const positions = [0, 15, 4095, 999990, 2000000]
+const length = 32
+
+console.log('// compatVectors')
+for (const [name, Algorithm] of Object.entries(algorithms)) {
+  for (const password of passwords) {
+    for (const position of positions) {
+      const plain = plaintext(position, length)
+      const enc = new Algorithm(password, fileSize + '')
+      enc.setPosition(position)
+      const encrypted = enc.encrypt(plain)
+      const dec = new Algorithm(password, fileSize + '')
+      dec.setPosition(position)
+      const decrypted = dec.decrypt(plain)
+      console.log(`\t{"${name}", "${password}", ${fileSize}, ${position}, "${encrypted.toString('hex')}", "${decrypted.toString('hex')}"},`)
+    }
+  }
+}
+
+// 连续加密跨越RC4分段边界的长数据，按streamChunk分块写入，与上传时的用法相同，输出密文的SHA-256
+const streamPositions = [0, 999990]
+const streamLength = 2000010
+const streamChunk = 65536
+
+console.log('// compatStreamVectors')
+for (const [name, Algorithm] of Object.entries(algorithms)) {
+  for (const password of passwords) {
+    for (const position of streamPositions) {
+      const enc = new Algorithm(password, fileSize + '')
+      enc.setPosition(position)
+      const hash = crypto.createHash('sha256')
+      for (let offset = 0; offset < streamLength; offset += streamChunk) {
+        const n = Math.min(streamChunk, streamLength - offset)
+        hash.update(enc.encrypt(plaintext(position + offset, n)))
+      }
+      console.log(`\t{"${name}", "${password}", ${fileSize}, ${position}, ${streamLength}, "${hash.digest('hex')}"},`)
+    }
+  }
+}
@@ -0,0 +1,20 @@
+// Package fusefs 把代理处理器挂载为本地只读文件系统（FUSE），不需要WebDAV客户端就能像普通目录一样浏览加密的后端。
+//
+// 文件系统通过davclient在进程内直接调用代理处理器，列目录使用PROPFIND，读取文件使用带Range的GET。
+package fusefs
+
+import (
+	"net/http"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// Config 挂载配置
+type Config struct {
+	Handler    http.Handler  // 代理处理器，不包含认证等中间件
+	Mountpoint string        // 挂载点目录
+	CacheTTL   time.Duration // 目录列表和文件属性的缓存时间，默认1秒
+	AllowOther bool          // 允许其他用户访问挂载点，需要在/etc/fuse.conf中启用user_allow_other
+	Logger     utils.Logger
+}
@@ -0,0 +1,283 @@
+//go:build linux || darwin
+
+package fusefs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"webdav-proxy/pkg/davclient"
+	"webdav-proxy/utils"
+)
+
+// readBlockSize 每次从代理读取的数据长度，同一个打开的文件缓存最近读取的一块，顺序读取时不必每次都请求后端
+const readBlockSize = 1 << 20
+
+// defaultCacheTTL 目录列表和文件属性的默认缓存时间
+const defaultCacheTTL = time.Second
+
+// Serve 挂载文件系统并处理请求，直到stop关闭或文件系统被外部卸载（如fusermount -u）
+func Serve(config *Config, stop <-chan struct{}) error {
+	ttl := config.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	fsys := &filesystem{
+		client:   davclient.New(config.Handler),
+		ttl:      ttl,
+		logger:   config.Logger,
+		listings: make(map[string]*listing),
+	}
+	root := &node{fsys: fsys, path: "/", dir: true}
+
+	server, err := fs.Mount(config.Mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			AllowOther:   config.AllowOther,
+			FsName:       "webdav-encrypt",
+			Name:         "webdav-encrypt",
+			Options:      []string{"ro"},
+			MaxReadAhead: readBlockSize,
+			// 有权限时直接调用mount，否则使用fusermount
+			DirectMount: true,
+		},
+		EntryTimeout: &ttl,
+		AttrTimeout:  &ttl,
+		UID:          uint32(os.Getuid()),
+		GID:          uint32(os.Getgid()),
+	})
+	if err != nil {
+		return err
+	}
+	fsys.logger.Info("[MOUNT] 已挂载到 %s（只读），按Ctrl+C或使用fusermount -u卸载", config.Mountpoint)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			if err := server.Unmount(); err != nil {
+				fsys.logger.Error("[MOUNT] 卸载 %s 失败: %v", config.Mountpoint, err)
+			}
+		case <-done:
+		}
+	}()
+	server.Wait()
+	close(done)
+	return nil
+}
+
+// filesystem 挂载的文件系统，缓存目录列表
+type filesystem struct {
+	client *davclient.Client
+	ttl    time.Duration
+	logger utils.Logger
+
+	mu       sync.Mutex
+	listings map[string]*listing
+}
+
+// listing 缓存的目录列表
+type listing struct {
+	entries []davclient.Entry
+	expires time.Time
+}
+
+// list 返回目录中的子项，缓存ttl时间
+func (f *filesystem) list(ctx context.Context, dir string) ([]davclient.Entry, error) {
+	f.mu.Lock()
+	cached, ok := f.listings[dir]
+	f.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.entries, nil
+	}
+
+	entries, err := f.client.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.listings[dir] = &listing{entries: entries, expires: time.Now().Add(f.ttl)}
+	// 顺便清理过期的列表，避免浏览大量目录后一直占用内存
+	now := time.Now()
+	for p, l := range f.listings {
+		if now.After(l.expires) {
+			delete(f.listings, p)
+		}
+	}
+	f.mu.Unlock()
+	return entries, nil
+}
+
+// stat 在父目录的列表中查找p
+func (f *filesystem) stat(ctx context.Context, p string) (davclient.Entry, error) {
+	entries, err := f.list(ctx, path.Dir(p))
+	if err != nil {
+		return davclient.Entry{}, err
+	}
+	name := path.Base(p)
+	for _, e := range entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	return davclient.Entry{}, &davclient.StatusError{Method: "PROPFIND", Path: p, Status: http.StatusNotFound}
+}
+
+// errno 把请求错误转换为文件系统错误码
+func (f *filesystem) errno(err error) syscall.Errno {
+	var statusErr *davclient.StatusError
+	switch {
+	case davclient.IsNotFound(err):
+		return syscall.ENOENT
+	case errors.As(err, &statusErr) && (statusErr.Status == http.StatusUnauthorized || statusErr.Status == http.StatusForbidden):
+		return syscall.EACCES
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR
+	}
+	f.logger.Warn("[MOUNT] %v", err)
+	return syscall.EIO
+}
+
+// node 文件或目录
+type node struct {
+	fs.Inode
+	fsys *filesystem
+	path string // 在代理上的路径，根目录为/
+	dir  bool
+}
+
+var (
+	_ fs.NodeGetattrer = (*node)(nil)
+	_ fs.NodeLookuper  = (*node)(nil)
+	_ fs.NodeReaddirer = (*node)(nil)
+	_ fs.NodeOpener    = (*node)(nil)
+	_ fs.NodeReader    = (*node)(nil)
+)
+
+// fillAttr 根据目录列表中的信息填写属性
+func fillAttr(e davclient.Entry, out *fuse.Attr) {
+	if e.Dir {
+		out.Mode = fuse.S_IFDIR | 0555
+	} else {
+		out.Mode = fuse.S_IFREG | 0444
+		if e.Size > 0 {
+			out.Size = uint64(e.Size)
+		}
+		out.Blocks = (out.Size + 511) / 512
+	}
+	out.Nlink = 1
+	if !e.ModTime.IsZero() {
+		out.SetTimes(nil, &e.ModTime, &e.ModTime)
+	}
+}
+
+// Getattr 实现fs.NodeGetattrer接口
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if n.path == "/" {
+		fillAttr(davclient.Entry{Dir: true}, &out.Attr)
+		return 0
+	}
+	e, err := n.fsys.stat(ctx, n.path)
+	if err != nil {
+		return n.fsys.errno(err)
+	}
+	fillAttr(e, &out.Attr)
+	return 0
+}
+
+// Lookup 实现fs.NodeLookuper接口
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	e, err := n.fsys.stat(ctx, path.Join(n.path, name))
+	if err != nil {
+		return nil, n.fsys.errno(err)
+	}
+	fillAttr(e, &out.Attr)
+	mode := uint32(fuse.S_IFREG)
+	if e.Dir {
+		mode = fuse.S_IFDIR
+	}
+	child := &node{fsys: n.fsys, path: path.Join(n.path, name), dir: e.Dir}
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: mode}), 0
+}
+
+// Readdir 实现fs.NodeReaddirer接口
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries, err := n.fsys.list(ctx, n.path)
+	if err != nil {
+		return nil, n.fsys.errno(err)
+	}
+	dirEntries := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		mode := uint32(fuse.S_IFREG)
+		if e.Dir {
+			mode = fuse.S_IFDIR
+		}
+		dirEntries = append(dirEntries, fuse.DirEntry{Name: e.Name, Mode: mode})
+	}
+	return fs.NewListDirStream(dirEntries), 0
+}
+
+// Open 实现fs.NodeOpener接口，文件系统是只读的
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if n.dir {
+		return nil, 0, syscall.EISDIR
+	}
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return &handle{node: n}, 0, 0
+}
+
+// Read 实现fs.NodeReader接口
+func (n *node) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h, ok := f.(*handle)
+	if !ok {
+		h = &handle{node: n}
+	}
+	return h.read(ctx, dest, off)
+}
+
+// handle 打开的文件，缓存最近读取的一块数据
+type handle struct {
+	node *node
+
+	mu          sync.Mutex
+	block       []byte
+	blockOffset int64
+}
+
+// read 读取off开始的数据，需要时按块从代理读取
+func (h *handle) read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := 0
+	for n < len(dest) {
+		pos := off + int64(n)
+		if h.block == nil || pos < h.blockOffset || pos >= h.blockOffset+readBlockSize {
+			blockOffset := pos - pos%readBlockSize
+			data, err := h.node.fsys.client.ReadRange(ctx, h.node.path, blockOffset, readBlockSize)
+			if err != nil {
+				return nil, h.node.fsys.errno(err)
+			}
+			h.block, h.blockOffset = data, blockOffset
+		}
+		if pos >= h.blockOffset+int64(len(h.block)) {
+			// 文件结束
+			break
+		}
+		n += copy(dest[n:], h.block[pos-h.blockOffset:])
+		if len(h.block) < readBlockSize {
+			break
+		}
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
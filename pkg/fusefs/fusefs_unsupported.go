@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package fusefs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Serve 当前平台不支持FUSE
+func Serve(config *Config, stop <-chan struct{}) error {
+	return fmt.Errorf("mount is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,224 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"webdav-proxy/utils"
+)
+
+// authUserKey 请求上下文中保存认证用户名的键
+type authUserKey struct{}
+
+// UserFromRequest 获取请求的认证用户名，未认证时返回空字符串
+func UserFromRequest(r *http.Request) string {
+	user, _ := r.Context().Value(authUserKey{}).(string)
+	return user
+}
+
+// ContextWithUser 返回带有认证用户名的上下文。SFTP等在进程内调用处理器的前端自行完成认证后使用，
+// 认证中间件不再检查这类请求的凭据；外部的HTTP请求无法设置上下文
+func ContextWithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, authUserKey{}, user)
+}
+
+// loggerProvider 可以提供日志器的处理器
+type loggerProvider interface {
+	getLogger() utils.Logger
+}
+
+// handlerLogger 从handler中获取logger，无法获取时创建默认logger
+func handlerLogger(handler http.Handler) utils.Logger {
+	if provider, ok := handler.(loggerProvider); ok {
+		return provider.getLogger()
+	}
+	return utils.NewDefaultLogger(false)
+}
+
+// proxyAuthMiddleware 代理端认证中间件
+type proxyAuthMiddleware struct {
+	handler    http.Handler
+	authConfig *ProxyAuthConfig
+	logger     utils.Logger
+	oidc       *oidcVerifier
+	lockout    *authLockout
+}
+
+// NewProxyAuthMiddleware 创建代理端认证中间件
+func NewProxyAuthMiddleware(handler http.Handler, authConfig *ProxyAuthConfig) http.Handler {
+	if authConfig == nil || !authConfig.Enabled {
+		return handler
+	}
+	
+	// 从handler中获取logger
+	logger := handlerLogger(handler)
+	
+	m := &proxyAuthMiddleware{
+		handler:    handler,
+		authConfig: authConfig,
+		logger:     logger,
+	}
+	if authConfig.OIDC != nil && authConfig.OIDC.Issuer != "" {
+		m.oidc = newOIDCVerifier(authConfig.OIDC, logger)
+	}
+	m.lockout = newAuthLockout(authConfig.MaxFailures, authConfig.FailureWindow, authConfig.BanDuration)
+	return m
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *proxyAuthMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.logger.Debug("[AUTH] 收到请求: %s %s", r.Method, r.URL.Path)
+	m.logger.Debug("[AUTH] 客户端地址: %s", r.RemoteAddr)
+	m.logger.Debug("[AUTH] 请求头: %v", r.Header)
+
+	if UserFromRequest(r) != "" {
+		m.logger.Debug("[AUTH] 进程内前端已认证用户: %s", UserFromRequest(r))
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+	
+	ip := clientIP(r)
+	if m.lockout != nil {
+		if banned, remaining := m.lockout.banned(ip); banned {
+			m.logger.Debug("[AUTH] 客户端已被临时封禁: %s，剩余: %v", ip, remaining)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// 分享链接使用签名代替凭据，签名无效或已过期时返回403，不提示客户端输入密码
+	if m.authConfig.Share != nil && isShareRequest(r) {
+		user, ok := m.authConfig.Share.verify(r)
+		if !ok {
+			m.logger.Warn("[SHARE] 分享链接无效或已过期: ip=%s method=%s path=%q", ip, r.Method, r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		m.logger.Debug("[SHARE] 分享链接校验成功: %s, 用户: %s", r.URL.Path, user)
+		r = stripShareParams(r)
+		m.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, user)))
+		return
+	}
+
+	user, ok := m.checkAuth(r)
+	if !ok {
+		m.logger.Error("[AUTH] 认证失败: %s %s", r.Method, r.URL.Path)
+		m.recordFailure(r, ip)
+		if m.authConfig.Username != "" || len(m.authConfig.Users) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="WebDAV Proxy"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="WebDAV Proxy"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	
+	m.logger.Debug("[AUTH] 认证成功: %s %s", r.Method, r.URL.Path)
+	if m.lockout != nil {
+		m.lockout.reset(ip)
+	}
+	m.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, user)))
+}
+
+// recordFailure 记录携带了凭据但认证失败的请求
+// 每次失败输出一行固定格式的日志，便于fail2ban匹配，例如：
+// [AUTH-FAIL] ip=1.2.3.4 user="admin" method=PROPFIND path="/" failures=3
+func (m *proxyAuthMiddleware) recordFailure(r *http.Request, ip string) {
+	// 客户端首次请求通常不带凭据，收到401后才会发送，这类请求不计入失败
+	user, _, hasBasic := r.BasicAuth()
+	if !hasBasic && requestToken(r) == "" {
+		return
+	}
+
+	failures, banned := 0, false
+	if m.lockout != nil {
+		failures, banned = m.lockout.recordFailure(ip)
+	}
+	m.logger.Warn("[AUTH-FAIL] ip=%s user=%q method=%s path=%q failures=%d", ip, user, r.Method, r.URL.Path, failures)
+	if banned {
+		m.logger.Warn("[AUTH-BAN] ip=%s duration=%s", ip, m.authConfig.BanDuration)
+	}
+}
+
+// getLogger 实现loggerProvider接口
+func (m *proxyAuthMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// checkAuth 检查认证信息，优先检查令牌，其次检查基本认证，成功时返回用户名
+func (m *proxyAuthMiddleware) checkAuth(r *http.Request) (string, bool) {
+	if token := requestToken(r); token != "" {
+		if m.checkToken(token) {
+			// 静态令牌没有对应的用户名，使用令牌的摘要作为标识
+			return "token:" + tokenID(token), true
+		}
+		if m.oidc != nil {
+			user, err := m.oidc.Verify(token)
+			if err == nil {
+				m.logger.Debug("[AUTH] OIDC令牌认证成功: %s", user)
+				return user, true
+			}
+			m.logger.Debug("[AUTH] OIDC令牌校验失败: %v", err)
+			return "", false
+		}
+		m.logger.Debug("[AUTH] 令牌不正确")
+		return "", false
+	}
+
+	if m.authConfig.Username == "" && len(m.authConfig.Users) == 0 {
+		m.logger.Debug("[AUTH] 未提供令牌")
+		return "", false
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		m.logger.Debug("[AUTH] 无法解析认证信息")
+		return "", false
+	}
+	
+	m.logger.Debug("[AUTH] 尝试认证用户: %s", username)
+	var isValid bool
+	if userPassword, exists := m.authConfig.Users[username]; exists {
+		isValid = subtle.ConstantTimeCompare([]byte(password), []byte(userPassword)) == 1
+	} else {
+		isValid = m.authConfig.Username != "" && username == m.authConfig.Username &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(m.authConfig.Password)) == 1
+	}
+	if !isValid {
+		m.logger.Debug("[AUTH] 用户名或密码不正确: %s", username)
+	}
+	return username, isValid
+}
+
+// checkToken 检查令牌是否在配置的令牌列表中
+func (m *proxyAuthMiddleware) checkToken(token string) bool {
+	valid := false
+	for _, t := range m.authConfig.Tokens {
+		// 使用常量时间比较，避免时序攻击
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// tokenID 返回完整令牌SHA-256摘要的前16位十六进制字符，作为配额、限流和锁的用户标识，
+// 不同的令牌不会因为前缀相同而共用标识，日志中也不会出现令牌本身
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// requestToken 从Authorization: Bearer或X-Api-Key头中提取令牌
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return strings.TrimSpace(r.Header.Get("X-Api-Key"))
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newAuthTestServer 返回认证中间件，认证成功时响应体为请求的用户名
+func newAuthTestServer(authConfig *ProxyAuthConfig) http.Handler {
+	authConfig.Enabled = true
+	return NewProxyAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(UserFromRequest(r)))
+	}), authConfig)
+}
+
+func TestProxyAuthBasicAndTokens(t *testing.T) {
+	h := newAuthTestServer(&ProxyAuthConfig{
+		Username: "alice",
+		Password: "secret",
+		Tokens:   []string{"abcdef-first-token", "abcdef-second-token"},
+		Users:    map[string]string{"bob": "hunter2"},
+	})
+
+	tests := []struct {
+		name     string
+		setup    func(r *http.Request)
+		wantCode int
+		wantUser string
+	}{
+		{"单用户", func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, http.StatusOK, "alice"},
+		{"单用户密码错误", func(r *http.Request) { r.SetBasicAuth("alice", "secreT") }, http.StatusUnauthorized, ""},
+		{"多租户用户", func(r *http.Request) { r.SetBasicAuth("bob", "hunter2") }, http.StatusOK, "bob"},
+		{"未知用户", func(r *http.Request) { r.SetBasicAuth("mallory", "secret") }, http.StatusUnauthorized, ""},
+		{"Bearer令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer abcdef-first-token") }, http.StatusOK, "token:" + tokenID("abcdef-first-token")},
+		{"X-Api-Key", func(r *http.Request) { r.Header.Set("X-Api-Key", "abcdef-second-token") }, http.StatusOK, "token:" + tokenID("abcdef-second-token")},
+		{"错误的令牌", func(r *http.Request) { r.Header.Set("Authorization", "Bearer abcdef") }, http.StatusUnauthorized, ""},
+		{"没有凭据", func(r *http.Request) {}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PROPFIND", "/", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("状态码错误: 期望 %d, 实际 %d", tt.wantCode, w.Code)
+			}
+			if tt.wantCode == http.StatusOK && w.Body.String() != tt.wantUser {
+				t.Errorf("用户名错误: 期望 %s, 实际 %s", tt.wantUser, w.Body.String())
+			}
+			if tt.wantCode == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401响应缺少WWW-Authenticate头")
+			}
+		})
+	}
+}
+
+func TestTokenIDDistinguishesSharedPrefix(t *testing.T) {
+	a, b := tokenID("abcdef-first-token"), tokenID("abcdef-second-token")
+	if a == b {
+		t.Fatalf("前缀相同的令牌得到了相同的标识: %s", a)
+	}
+	if a != tokenID("abcdef-first-token") {
+		t.Error("同一令牌的标识不稳定")
+	}
+	if len(a) != 16 {
+		t.Errorf("标识长度错误: %s", a)
+	}
+}
+
+func TestProxyAuthTrustsInProcessUser(t *testing.T) {
+	h := newAuthTestServer(&ProxyAuthConfig{Username: "alice", Password: "secret"})
+	req := httptest.NewRequest("GET", "/a.txt", nil)
+	req = req.WithContext(ContextWithUser(req.Context(), "carol"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "carol" {
+		t.Errorf("进程内前端认证的用户应直接通过: %d %s", w.Code, w.Body.String())
+	}
+}
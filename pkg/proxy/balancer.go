@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// 负载均衡策略
+const (
+	LoadBalanceRoundRobin   = "round_robin"
+	LoadBalanceLeastLatency = "least_latency"
+)
+
+// 主后端不可用时写请求的处理方式
+const (
+	FailoverWritesBlock    = "block"    // 拒绝写请求，返回503
+	FailoverWritesFallback = "fallback" // 写请求也转发到备用后端
+)
+
+// LoadBalanceConfig 多后端负载均衡配置，所有后端需要保存相同的数据
+type LoadBalanceConfig struct {
+	Replicas       []*url.URL // 除主后端外的其他等价后端
+	Strategy       string     // 选择策略：round_robin或least_latency
+	Fallback       *url.URL   // 备用后端，所有主后端不可用时切换
+	FallbackWrites string     // 切换到备用后端后写请求的处理方式：block或fallback
+}
+
+// selectBackend 为请求选择一个后端，优先选择健康的后端
+func (h *ProxyHandler) selectBackend() *url.URL {
+	if len(h.backends) == 1 && h.fallback == nil {
+		return h.backends[0]
+	}
+
+	candidates := h.healthyBackends()
+	if len(candidates) == 0 && h.fallbackAvailable() {
+		return h.fallback
+	}
+	if len(candidates) == 0 {
+		// 所有后端都不可用时仍然尝试全部后端，而不是直接拒绝请求
+		candidates = make([]int, len(h.backends))
+		for i := range h.backends {
+			candidates[i] = i
+		}
+	}
+
+	if h.loadBalance == LoadBalanceLeastLatency && h.healthCheckers != nil {
+		best := candidates[0]
+		bestLatency := h.healthCheckers[best].Status().Latency
+		for _, i := range candidates[1:] {
+			if latency := h.healthCheckers[i].Status().Latency; latency < bestLatency {
+				best, bestLatency = i, latency
+			}
+		}
+		return h.backends[best]
+	}
+
+	n := h.roundRobin.Add(1)
+	return h.backends[candidates[int(n%uint64(len(candidates)))]]
+}
+
+// healthyBackends 返回健康后端的下标，未启用健康检查时所有后端都视为健康
+func (h *ProxyHandler) healthyBackends() []int {
+	indexes := make([]int, 0, len(h.backends))
+	for i := range h.backends {
+		if h.healthCheckers == nil || h.healthCheckers[i].Status().Healthy {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// fallbackAvailable 检查备用后端是否可用，需要启用健康检查
+func (h *ProxyHandler) fallbackAvailable() bool {
+	return h.fallbackChecker != nil && h.fallbackChecker.Status().Healthy
+}
+
+// failedOver 检查是否所有主后端都不可用且已切换到备用后端
+func (h *ProxyHandler) failedOver() bool {
+	return h.fallback != nil && len(h.healthyBackends()) == 0 && h.fallbackAvailable()
+}
+
+// isWriteMethod 检查方法是否会修改后端数据
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPost, http.MethodDelete,
+		"PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK":
+		return true
+	}
+	return false
+}
+
+// isBackendHost 检查主机是否属于已配置的后端
+func (h *ProxyHandler) isBackendHost(host string) bool {
+	return h.backendForHost(host) != nil
+}
+
+// backendForHost 根据主机查找对应的后端，不属于任何后端时返回nil
+func (h *ProxyHandler) backendForHost(host string) *url.URL {
+	for _, backend := range h.backends {
+		if backend.Host == host {
+			return backend
+		}
+	}
+	if h.fallback != nil && h.fallback.Host == host {
+		return h.fallback
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"webdav-proxy/utils"
+)
+
+// BlockCacheConfig 解密数据块磁盘缓存配置
+type BlockCacheConfig struct {
+	Dir       string // 缓存目录，启动时会清空
+	MaxSize   int64  // 缓存总大小上限，超过时按LRU淘汰
+	BlockSize int64  // 缓存块大小
+}
+
+// BlockCache 按文件路径和ETag缓存解密后的数据块，多个代理处理器可以共享同一个缓存
+type BlockCache struct {
+	config *BlockCacheConfig
+	logger utils.Logger
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // 最近使用的在前
+	size    int64
+}
+
+// blockCacheEntry 缓存块索引项
+type blockCacheEntry struct {
+	key  string
+	size int64
+}
+
+// NewBlockCache 创建解密数据块缓存，未设置目录时返回nil
+func NewBlockCache(config *BlockCacheConfig, logger utils.Logger) (*BlockCache, error) {
+	if config == nil || config.Dir == "" || config.MaxSize <= 0 {
+		return nil, nil
+	}
+	if config.BlockSize <= 0 {
+		config.BlockSize = 1 << 20
+	}
+	// 缓存索引只保存在内存中，启动时清空旧的缓存文件
+	if err := os.RemoveAll(config.Dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+	return &BlockCache{
+		config:  config,
+		logger:  logger,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// blockKey 计算缓存块的键，后端URL区分不同后端上的同名文件
+func blockKey(file, version string, index int64) string {
+	sum := sha256.Sum256([]byte(file + "\x00" + version + "\x00" + strconv.FormatInt(index, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+// path 返回缓存块的文件路径
+func (c *BlockCache) path(key string) string {
+	return filepath.Join(c.config.Dir, key[:2], key)
+}
+
+// has 检查缓存块是否存在，并更新最近使用时间
+func (c *BlockCache) has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return true
+	}
+	return false
+}
+
+// put 写入缓存块，超出大小上限时淘汰最久未使用的块
+func (c *BlockCache) put(key string, data []byte) {
+	if c.has(key) {
+		return
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		c.logger.Warn("[CACHE] 创建缓存目录失败: %v", err)
+		return
+	}
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		c.logger.Warn("[CACHE] 写入缓存块失败: %v", err)
+		os.Remove(tmpFile)
+		return
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		c.logger.Warn("[CACHE] 写入缓存块失败: %v", err)
+		os.Remove(tmpFile)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&blockCacheEntry{key: key, size: int64(len(data))})
+	c.size += int64(len(data))
+	for c.size > c.config.MaxSize && c.lru.Len() > 0 {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*blockCacheEntry)
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		os.Remove(c.path(entry.key))
+	}
+}
+
+// fileVersion 根据响应头生成文件版本标识，无法确定版本时返回空字符串
+func fileVersion(header http.Header, size int64) string {
+	if etag := header.Get("ETag"); etag != "" {
+		return etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		return lastModified + "|" + strconv.FormatInt(size, 10)
+	}
+	return ""
+}
+
+// serveFromCache 尝试直接用缓存的解密数据响应GET请求，缓存不完整时返回nil
+func (t *proxyTransport) serveFromCache(req *http.Request) *http.Response {
+	cache := t.handler.blockCache
+
+	// 通过HEAD请求获取文件的当前版本，确保不会返回过期数据
+	headReq := req.Clone(req.Context())
+	headReq.Method = http.MethodHead
+	headReq.Body = nil
+	headReq.ContentLength = 0
+	headReq.Header.Del("Range")
+	headResp, err := t.baseTransport().RoundTrip(headReq)
+	if err != nil {
+		return nil
+	}
+	headResp.Body.Close()
+	if headResp.StatusCode != http.StatusOK || headResp.ContentLength <= 0 {
+		return nil
+	}
+	contentType := headResp.Header.Get("Content-Type")
+	if !t.handler.isFileContent(req.URL.Path, contentType, "", headResp.ContentLength) {
+		return nil
+	}
+
+	size := headResp.ContentLength
+	version := fileVersion(headResp.Header, size)
+	if version == "" {
+		return nil
+	}
+	// If-Range与当前版本不一致时应返回完整文件，交给后端处理
+	if ifRange := req.Header.Get("If-Range"); ifRange != "" && ifRange != headResp.Header.Get("ETag") && ifRange != headResp.Header.Get("Last-Modified") {
+		return nil
+	}
+	start, end, ok := parseSingleRange(req.Header.Get("Range"), size)
+	if !ok {
+		return nil
+	}
+
+	file := req.URL.String()
+	for index := start / cache.config.BlockSize; index <= end/cache.config.BlockSize; index++ {
+		if !cache.has(blockKey(file, version, index)) {
+			return nil
+		}
+	}
+	t.handler.logger.Debug("[CACHE] 命中缓存: %s, 范围: %d-%d", req.URL.Path, start, end)
+
+	resp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		ContentLength: end - start + 1,
+		Request:       req,
+		Body: t.handler.throttle(req.Context(), &blockCacheReader{
+			cache:   cache,
+			file:    file,
+			version: version,
+			pos:     start,
+			end:     end,
+		}, false),
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Last-Modified"} {
+		if value := headResp.Header.Get(name); value != "" {
+			resp.Header.Set(name, value)
+		}
+	}
+	resp.Header.Set("Accept-Ranges", "bytes")
+	resp.Header.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	if req.Header.Get("Range") != "" {
+		resp.Status = "206 Partial Content"
+		resp.StatusCode = http.StatusPartialContent
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+	return resp
+}
+
+// blockCacheReader 从缓存块中读取指定范围的数据
+type blockCacheReader struct {
+	cache   *BlockCache
+	file    string
+	version string
+	pos     int64
+	end     int64 // 结束位置（包含）
+	current *os.File
+	index   int64
+}
+
+// Read 实现io.Reader接口
+func (r *blockCacheReader) Read(p []byte) (int, error) {
+	if r.pos > r.end {
+		return 0, io.EOF
+	}
+	blockSize := r.cache.config.BlockSize
+	index := r.pos / blockSize
+	if r.current == nil || r.index != index {
+		if r.current != nil {
+			r.current.Close()
+		}
+		f, err := os.Open(r.cache.path(blockKey(r.file, r.version, index)))
+		if err != nil {
+			// 缓存块在读取过程中被淘汰
+			return 0, err
+		}
+		r.current, r.index = f, index
+	}
+
+	if remaining := r.end - r.pos + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.current.ReadAt(p, r.pos-index*blockSize)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Close 实现io.Closer接口
+func (r *blockCacheReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// blockCacheFiller 在解密数据流经时按块写入缓存，只缓存完整对齐的块
+type blockCacheFiller struct {
+	io.ReadCloser
+	cache   *BlockCache
+	file    string
+	version string
+	size    int64 // 文件总大小
+	pos     int64
+	buf     []byte
+	filling bool // 当前块是否从块起始位置开始收集
+}
+
+// Read 实现io.Reader接口
+func (f *blockCacheFiller) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	if n > 0 {
+		f.feed(p[:n])
+	}
+	return n, err
+}
+
+// feed 收集数据，块收集完整后写入缓存
+func (f *blockCacheFiller) feed(data []byte) {
+	blockSize := f.cache.config.BlockSize
+	for len(data) > 0 {
+		offset := f.pos % blockSize
+		if offset == 0 {
+			f.buf = f.buf[:0]
+			f.filling = true
+		}
+		n := blockSize - offset
+		if int64(len(data)) < n {
+			n = int64(len(data))
+		}
+		if f.filling {
+			f.buf = append(f.buf, data[:n]...)
+		}
+		f.pos += n
+		data = data[n:]
+
+		if f.filling && (f.pos%blockSize == 0 || f.pos == f.size) {
+			f.cache.put(blockKey(f.file, f.version, (f.pos-1)/blockSize), f.buf)
+			f.filling = false
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"webdav-proxy/utils"
+)
+
+// maxTraceBodyBytes 每个请求记录的内容字节数上限，避免日志过大
+const maxTraceBodyBytes = 64 * 1024
+
+// bodyDump 记录上传下载内容开头的字节，加解密前后各一份，在TRACE级别输出十六进制和ASCII对照，
+// 用于排查文件内容损坏的问题。达到上限或数据流结束时输出一次
+type bodyDump struct {
+	logger utils.Logger
+	prefix string // 日志前缀，包括方向、路径和起始位置
+	limit  int
+	labels [2]string // 加解密前后内容的说明
+	before []byte    // 加解密前
+	after  []byte    // 加解密后
+	logged bool
+}
+
+// newBodyDump 启用了内容记录时创建记录器，否则返回nil。upload区分上传和下载，offset为内容在文件中的起始位置
+func (h *ProxyHandler) newBodyDump(upload bool, req *http.Request, offset int64) *bodyDump {
+	if h.traceBodyBytes <= 0 {
+		return nil
+	}
+	d := &bodyDump{logger: h.logger, limit: h.traceBodyBytes}
+	if upload {
+		d.prefix = fmt.Sprintf("[DUMP] 上传 %s 偏移 %d", req.URL.Path, offset)
+		d.labels = [2]string{"加密前的明文", "加密后的密文"}
+	} else {
+		d.prefix = fmt.Sprintf("[DUMP] 下载 %s 偏移 %d", req.URL.Path, offset)
+		d.labels = [2]string{"解密前的密文", "解密后的明文"}
+	}
+	return d
+}
+
+// captureBefore 记录加解密前的数据，需要在原地加解密之前调用
+func (d *bodyDump) captureBefore(p []byte) {
+	if d == nil || len(d.before) >= d.limit {
+		return
+	}
+	d.before = append(d.before, p[:min(len(p), d.limit-len(d.before))]...)
+}
+
+// captureAfter 记录加解密后的数据，记录满后输出日志
+func (d *bodyDump) captureAfter(p []byte) {
+	if d == nil || len(d.after) >= d.limit {
+		return
+	}
+	d.after = append(d.after, p[:min(len(p), d.limit-len(d.after))]...)
+	if len(d.after) >= d.limit {
+		d.flush()
+	}
+}
+
+// flush 输出记录的内容，只输出一次
+func (d *bodyDump) flush() {
+	if d == nil || d.logged || len(d.before) == 0 {
+		return
+	}
+	d.logged = true
+	d.logger.Trace("%s, %s %d 字节:\n%s", d.prefix, d.labels[0], len(d.before), hex.Dump(d.before))
+	d.logger.Trace("%s, %s %d 字节:\n%s", d.prefix, d.labels[1], len(d.after), hex.Dump(d.after))
+}
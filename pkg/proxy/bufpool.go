@@ -0,0 +1,39 @@
+package proxy
+
+import "sync"
+
+// localBufferSize 本地目录模式读写和重新加密使用的缓冲区大小
+const localBufferSize = 32 * 1024
+
+// localBuffers 本地目录模式共享的缓冲区池
+var localBuffers = newBufferPool(localBufferSize)
+
+// bufferPool 复用固定大小的数据块缓冲区，多路并发传输时减少内存分配和GC压力
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// newBufferPool 创建缓冲区池
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{size: size}
+	p.pool.New = func() any {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+// Get 取出一个缓冲区，保存切片指针避免Put时再次分配
+func (p *bufferPool) Get() *[]byte {
+	return p.pool.Get().(*[]byte)
+}
+
+// Put 归还缓冲区，调用后不能再使用其中的数据
+func (p *bufferPool) Put(buf *[]byte) {
+	if cap(*buf) < p.size {
+		return
+	}
+	*buf = (*buf)[:p.size]
+	p.pool.Put(buf)
+}
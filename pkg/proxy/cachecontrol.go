@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultCacheControl 解密后的文件默认使用的Cache-Control，客户端每次都重新下载
+const DefaultCacheControl = "no-cache, no-store, must-revalidate"
+
+// CacheControlConfig 解密后的文件下载响应的缓存策略
+type CacheControlConfig struct {
+	Default string             // 未匹配规则的文件使用的Cache-Control，为空时保留后端返回的值
+	Rules   []CacheControlRule // 按路径指定的Cache-Control，按顺序使用第一条匹配的规则
+}
+
+// CacheControlRule 按路径指定的Cache-Control
+type CacheControlRule struct {
+	Path  string // 路径规则，语法与ExcludePaths相同
+	Value string // Cache-Control的值，为空时保留后端返回的值
+}
+
+// cacheControlRule 编译后的路径规则
+type cacheControlRule struct {
+	matcher *pathMatcher
+	value   string
+}
+
+// cacheControl 编译后的缓存策略
+type cacheControl struct {
+	defaultValue string
+	rules        []cacheControlRule
+}
+
+// newCacheControl 编译缓存策略，config为nil时所有文件使用DefaultCacheControl
+func newCacheControl(config *CacheControlConfig) (*cacheControl, error) {
+	if config == nil {
+		return &cacheControl{defaultValue: DefaultCacheControl}, nil
+	}
+	c := &cacheControl{defaultValue: config.Default}
+	for _, rule := range config.Rules {
+		matcher, err := newPathMatcher([]string{rule.Path})
+		if err != nil {
+			return nil, err
+		}
+		c.rules = append(c.rules, cacheControlRule{matcher: matcher, value: rule.Value})
+	}
+	return c, nil
+}
+
+// apply 按路径设置响应的Cache-Control。禁止缓存时同时设置HTTP/1.0的Pragma和Expires，
+// 允许缓存时去掉这两个头，避免与Cache-Control冲突。c为nil时使用DefaultCacheControl
+func (c *cacheControl) apply(header http.Header, p string) {
+	if c == nil {
+		c = &cacheControl{defaultValue: DefaultCacheControl}
+	}
+	value := c.defaultValue
+	for _, rule := range c.rules {
+		if rule.matcher.match(p) {
+			value = rule.value
+			break
+		}
+	}
+	if value == "" {
+		return
+	}
+	header.Set("Cache-Control", value)
+	if strings.Contains(value, "no-cache") || strings.Contains(value, "no-store") {
+		header.Set("Pragma", "no-cache")
+		header.Set("Expires", "0")
+	} else {
+		header.Del("Pragma")
+		header.Del("Expires")
+	}
+}
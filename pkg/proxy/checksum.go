@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OC-Checksum处理方式
+const (
+	OCChecksumStrip       = "strip"       // 不把校验和发给后端，并从响应中去掉后端的校验和
+	OCChecksumPassthrough = "passthrough" // 原样转发，适用于只保存客户端校验和、不自行计算的后端
+)
+
+// errChecksumMismatch 上传内容与客户端提供的校验和不一致
+var errChecksumMismatch = errors.New("OC-Checksum mismatch")
+
+// newChecksumHash 根据OC-Checksum头（如 SHA1:abcd...）创建对应的哈希，不支持的算法返回nil
+func newChecksumHash(header string) (hash.Hash, string) {
+	algorithm, expected, ok := strings.Cut(strings.Fields(header + " ")[0], ":")
+	if !ok || expected == "" {
+		return nil, ""
+	}
+	switch strings.ToUpper(algorithm) {
+	case "SHA1":
+		return sha1.New(), expected
+	case "MD5":
+		return md5.New(), expected
+	case "SHA256":
+		return sha256.New(), expected
+	case "ADLER32":
+		return adler32.New(), expected
+	}
+	return nil, ""
+}
+
+// VerifyChecksum 按OC-Checksum头（如 SHA1:abcd...）校验r的内容。算法不支持时返回false，
+// 校验和不一致时返回错误，fetch子命令用来校验下载的文件
+func VerifyChecksum(header string, r io.Reader) (bool, error) {
+	h, expected := newChecksumHash(header)
+	if h == nil {
+		return false, nil
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return true, err
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), expected) {
+		return true, errChecksumMismatch
+	}
+	return true, nil
+}
+
+// checksumReader 计算上传明文的校验和，最后一个字节在校验通过后才交出，
+// 校验失败时后端收到的请求体不完整，上传不会成功
+type checksumReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+	held     []byte
+	buf      []byte
+	eof      bool
+	err      error
+}
+
+// newChecksumReader 为带有OC-Checksum头的上传创建校验读取器，没有可校验的头时返回nil
+func newChecksumReader(req *http.Request) *checksumReader {
+	header := req.Header.Get("OC-Checksum")
+	if header == "" {
+		return nil
+	}
+	h, expected := newChecksumHash(header)
+	if h == nil {
+		return nil
+	}
+	return &checksumReader{ReadCloser: req.Body, hash: h, expected: expected}
+}
+
+// Read 实现io.Reader接口
+func (r *checksumReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if !r.eof {
+			if cap(r.buf) < len(p) {
+				r.buf = make([]byte, len(p))
+			}
+			n, err := r.ReadCloser.Read(r.buf[:len(p)])
+			r.hash.Write(r.buf[:n])
+			r.held = append(r.held, r.buf[:n]...)
+			if err == io.EOF {
+				r.eof = true
+				r.err = io.EOF
+				if !strings.EqualFold(hex.EncodeToString(r.hash.Sum(nil)), r.expected) {
+					r.err = errChecksumMismatch
+					return 0, r.err
+				}
+			} else if err != nil {
+				return 0, err
+			}
+		} else if r.err != io.EOF {
+			return 0, r.err
+		}
+
+		// 未读到结尾前保留最后一个字节
+		releasable := r.held
+		if !r.eof && len(releasable) > 0 {
+			releasable = releasable[:len(releasable)-1]
+		}
+		n := copy(p, releasable)
+		r.held = append(r.held[:0], r.held[n:]...)
+		if n > 0 {
+			return n, nil
+		}
+		if r.eof {
+			return 0, r.err
+		}
+	}
+}
+
+// checksumsPattern 匹配PROPFIND响应中的oc:checksums属性内容
+var checksumsPattern = regexp.MustCompile(`(?s)(<(?:[A-Za-z0-9_.-]+:)?checksums(?:\s[^>]*)?>).*?(</(?:[A-Za-z0-9_.-]+:)?checksums>)`)
+
+// stripChecksums 去掉响应中后端提供的校验和，后端按密文计算的校验和会让客户端误认为文件损坏
+func (h *ProxyHandler) stripChecksums(resp *http.Response) error {
+	resp.Header.Del("OC-Checksum")
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body = checksumsPattern.ReplaceAll(body, []byte("${1}${2}"))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,646 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"webdav-proxy/pkg/encryption"
+)
+
+// 压缩算法
+const (
+	CompressGzip = "gzip" // 每个数据块压缩为一个独立的gzip成员
+)
+
+// 压缩文件的索引标识、文件名后缀和大小限制
+const (
+	compressIndexMagic   = `{"webdav_encrypt_compress":`
+	compressIndexSuffix  = ".zindex"
+	compressFrameSize    = 256 * 1024
+	maxCompressIndexSize = 16 << 20
+	maxCompressIndexes   = 10000
+)
+
+// compressIndex 压缩文件的索引，加密后保存在 文件名.zindex 中。明文按固定大小分块后各自压缩，
+// 压缩后的数据块依次拼接后整体加密保存在原文件路径上，Range请求只需要读取和解压覆盖范围的数据块
+type compressIndex struct {
+	Version     int     `json:"webdav_encrypt_compress"`
+	Algorithm   string  `json:"algorithm"`
+	Size        int64   `json:"size"`       // 明文大小
+	FrameSize   int64   `json:"frame_size"` // 每个数据块的明文大小，最后一块可能较小
+	Frames      []int64 `json:"frames"`     // 每个数据块压缩后的大小
+	KeySize     int64   `json:"key_size,omitempty"`
+	ContentType string  `json:"content_type,omitempty"`
+}
+
+// keySize 创建数据文件加密器时代替文件大小使用的值。流式上传时压缩后的大小事先未知，
+// 每个文件使用随机值；早期版本的索引没有记录，使用压缩后的大小
+func (idx *compressIndex) keySize() int64 {
+	if idx.KeySize > 0 {
+		return idx.KeySize
+	}
+	return idx.storedSize()
+}
+
+// randomKeySize 生成流式压缩上传使用的随机keySize
+func randomKeySize() (int64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b[:])>>1) | 1, nil
+}
+
+// storedSize 压缩后的数据在后端的总大小
+func (idx *compressIndex) storedSize() int64 {
+	return idx.frameOffset(len(idx.Frames))
+}
+
+// frameOffset 第i个数据块在后端文件中的起始位置
+func (idx *compressIndex) frameOffset(i int) int64 {
+	var offset int64
+	for _, size := range idx.Frames[:i] {
+		offset += size
+	}
+	return offset
+}
+
+// parseCompressIndex 解析索引文件内容，不是索引时返回nil
+func parseCompressIndex(data []byte) *compressIndex {
+	if !bytes.HasPrefix(data, []byte(compressIndexMagic)) {
+		return nil
+	}
+	var idx compressIndex
+	if err := json.Unmarshal(data, &idx); err != nil || idx.FrameSize <= 0 || idx.Algorithm != CompressGzip {
+		return nil
+	}
+	if idx.Size != 0 && int64(len(idx.Frames)) != (idx.Size+idx.FrameSize-1)/idx.FrameSize {
+		return nil
+	}
+	return &idx
+}
+
+// compressIndexRequest 基于原请求创建访问索引文件的请求，COPY和MOVE的目标路径同样加上索引后缀
+func compressIndexRequest(req *http.Request, method string) *http.Request {
+	indexReq := req.Clone(req.Context())
+	indexReq.Method = method
+	indexReq.URL.Path += compressIndexSuffix
+	indexReq.URL.RawPath = ""
+	indexReq.Body = nil
+	indexReq.ContentLength = 0
+	indexReq.Header.Del("Range")
+	indexReq.Header.Del("OC-Checksum")
+	removeConditionalHeaders(indexReq.Header)
+	if destination := indexReq.Header.Get("Destination"); destination != "" {
+		indexReq.Header.Set("Destination", destination+compressIndexSuffix)
+	}
+	return indexReq
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write 实现io.Writer接口
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// compressFrames 把明文按块压缩，每压缩完一块记录到索引并调用一次emit，emit返回后缓冲区会被复用
+func compressFrames(r io.Reader, idx *compressIndex, emit func(frame []byte) error) error {
+	var frame bytes.Buffer
+	zw := gzip.NewWriter(&frame)
+	buf := make([]byte, compressFrameSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			frame.Reset()
+			zw.Reset(&frame)
+			if _, err := zw.Write(buf[:n]); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			idx.Frames = append(idx.Frames, int64(frame.Len()))
+			idx.Size += int64(n)
+			if err := emit(frame.Bytes()); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// errCompressBodyUnread 后端没有读取请求体就返回了响应
+var errCompressBodyUnread = errors.New("backend did not read the compressed body")
+
+// handleCompressedUpload 把明文逐块压缩、加密后流式上传，成功后写入加密的索引文件。
+// 压缩后的大小在上传结束前无法确定，发往后端的请求不带Content-Length，
+// 数据文件的加密器使用记录在索引中的随机keySize代替文件大小
+func (t *proxyTransport) handleCompressedUpload(req *http.Request) (*http.Response, error) {
+	params := t.handler.encryptionFor(req)
+	keySize, err := randomKeySize()
+	if err != nil {
+		req.Body.Close()
+		return nil, err
+	}
+	enc, err := t.handler.newEncryptor(params, keySize)
+	if err != nil {
+		req.Body.Close()
+		return nil, err
+	}
+	idx := &compressIndex{
+		Version:     2,
+		Algorithm:   CompressGzip,
+		FrameSize:   compressFrameSize,
+		KeySize:     keySize,
+		ContentType: req.Header.Get("Content-Type"),
+	}
+
+	// 与encryptUpload相同，后端开始读取请求体时才开始读取客户端的数据，Expect: 100-continue仍然有效
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	body := &lazyPipeReader{PipeReader: pr}
+	body.start = func() {
+		go func() { done <- t.compressBody(req, enc, idx, pw) }()
+	}
+
+	dataReq := req.Clone(req.Context())
+	dataReq.Body = t.handler.throttle(req.Context(), body, true)
+	dataReq.ContentLength = -1
+	dataReq.Header.Del("Content-Length")
+	resp, err := t.baseTransport().RoundTrip(dataReq)
+	// 后端没有读取请求体时压缩goroutine不会启动，这里代替它给出结果
+	body.once.Do(func() {
+		req.Body.Close()
+		done <- errCompressBodyUnread
+	})
+	if err != nil {
+		if !errors.Is(err, errClientAborted) {
+			t.handler.logger.Error("[COMPRESS] 上传失败: %s, 错误: %v", req.URL.Path, err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, nil
+	}
+	// 后端返回成功时请求体已经读完，等待压缩goroutine记录最后一块
+	if err := <-done; err != nil {
+		resp.Body.Close()
+		t.handler.logger.Error("[COMPRESS] 压缩上传内容失败: %s, 错误: %v", req.URL.Path, err)
+		return nil, err
+	}
+	t.handler.logger.Debug("[COMPRESS] 压缩完成: %s, %d -> %d 字节, %d 个数据块", req.URL.Path, idx.Size, idx.storedSize(), len(idx.Frames))
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	// 索引中的数据块大小会泄露内容的可压缩程度，和数据文件一样加密保存
+	indexEnc, err := t.handler.newEncryptor(params, int64(len(data)))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	encryption.EncryptInPlace(indexEnc, data)
+	indexReq := compressIndexRequest(req, http.MethodPut)
+	indexReq.Body = io.NopCloser(bytes.NewReader(data))
+	indexReq.ContentLength = int64(len(data))
+	indexReq.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	indexReq.Header.Set("Content-Type", "application/octet-stream")
+	indexResp, err := t.baseTransport().RoundTrip(indexReq)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	io.Copy(io.Discard, indexResp.Body)
+	indexResp.Body.Close()
+	if indexResp.StatusCode < 200 || indexResp.StatusCode >= 300 {
+		resp.Body.Close()
+		t.handler.logger.Error("[COMPRESS] 写入索引失败: %s, 后端响应: %d", indexReq.URL.Path, indexResp.StatusCode)
+		return nil, fmt.Errorf("backend returned %d for %s", indexResp.StatusCode, indexReq.URL.Path)
+	}
+	return resp, nil
+}
+
+// compressBody 读取客户端的请求体，逐块压缩并原地加密后写入管道
+func (t *proxyTransport) compressBody(req *http.Request, enc encryption.Encryptor, idx *compressIndex, pw *io.PipeWriter) error {
+	defer req.Body.Close()
+
+	// 客户端断开或请求超时时立即关闭管道和请求体
+	stop := context.AfterFunc(req.Context(), func() {
+		pw.CloseWithError(req.Context().Err())
+		req.Body.Close()
+	})
+	defer stop()
+
+	err := compressFrames(req.Body, idx, func(frame []byte) error {
+		encryption.EncryptInPlace(enc, frame)
+		_, err := pw.Write(frame)
+		return err
+	})
+	if err != nil && req.Context().Err() != nil {
+		t.handler.logger.Info("[COMPRESS] 客户端已断开，停止上传: %s", req.URL.Path)
+		err = fmt.Errorf("%w: %v", errClientAborted, err)
+	}
+	// err为nil时后端读到EOF，否则让发往后端的请求失败，避免保存不完整的文件
+	pw.CloseWithError(err)
+	return err
+}
+
+// loadCompressIndex 读取后端文件对应的压缩索引并解密，文件没有索引时返回nil。
+// 早期版本保存的明文索引直接解析
+func (h *ProxyHandler) loadCompressIndex(ctx context.Context, dataURL *url.URL, header http.Header) (*compressIndex, error) {
+	u := *dataURL
+	u.Path += compressIndexSuffix
+	u.RawPath = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	h.setUserAgent(req)
+	resp, err := h.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength > maxCompressIndexSize {
+		return nil, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCompressIndexSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if idx := parseCompressIndex(data); idx != nil {
+		return idx, nil
+	}
+	enc, err := h.newEncryptor(h.encryptionFor(&http.Request{URL: dataURL}), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	encryption.DecryptInPlace(enc, data)
+	return parseCompressIndex(data), nil
+}
+
+// handleCompressedDownload 下载压缩保存的文件：只请求覆盖范围的压缩数据块，解密后解压。
+// 文件没有索引或索引与数据不一致时返回false，按普通文件处理
+func (t *proxyTransport) handleCompressedDownload(req *http.Request) (*http.Response, bool, error) {
+	idx, err := t.handler.loadCompressIndex(req.Context(), req.URL, req.Header)
+	if err != nil {
+		t.handler.logger.Error("[COMPRESS] 读取索引失败: %s, 错误: %v", req.URL.Path, err)
+		return nil, false, nil
+	}
+	if idx == nil {
+		return nil, false, nil
+	}
+
+	start, end, ok := parseSingleRange(req.Header.Get("Range"), idx.Size)
+	if !ok {
+		// 不支持的Range格式按完整文件返回
+		start, end = 0, idx.Size-1
+	}
+	partial := ok && req.Header.Get("Range") != ""
+	stored := idx.storedSize()
+
+	// 只请求覆盖范围的数据块
+	first, last := 0, -1
+	var from, to int64
+	if idx.Size > 0 {
+		first, last = int(start/idx.FrameSize), int(end/idx.FrameSize)
+		from, to = idx.frameOffset(first), idx.frameOffset(last+1)-1
+	}
+	dataReq := req.Clone(req.Context())
+	dataReq.Header.Del("If-Range")
+	dataReq.Header.Del("Range")
+	if req.Method == http.MethodGet && idx.Size > 0 {
+		dataReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	}
+	resp, err := t.roundTripWithRetry(dataReq)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		// 304、412等条件请求的结果直接返回
+		return resp, true, nil
+	}
+
+	// 数据文件的大小与索引不一致时说明文件已经被其他方式覆盖，索引已经失效
+	size := resp.ContentLength
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if _, total, ok := strings.Cut(contentRange, "/"); ok {
+			size, _ = strconv.ParseInt(total, 10, 64)
+		}
+	}
+	if size != stored {
+		t.handler.logger.Warn("[COMPRESS] 索引与数据大小不一致，按普通文件处理: %s, %d != %d", req.URL.Path, size, stored)
+		resp.Body.Close()
+		return nil, false, nil
+	}
+	t.handler.logger.Debug("[COMPRESS] 下载压缩文件: %s, 范围: %d-%d, 数据块: %d-%d", req.URL.Path, start, end, first, last)
+
+	header := make(http.Header)
+	for _, name := range []string{"ETag", "Last-Modified", "Date", "Cache-Control"} {
+		if value := resp.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	contentType := idx.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	t.handler.cacheControl.apply(header, t.handler.relativePath(req))
+
+	result := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        header,
+		ContentLength: end - start + 1,
+		Request:       resp.Request,
+		Body:          http.NoBody,
+	}
+	if idx.Size == 0 || req.Method != http.MethodGet {
+		resp.Body.Close()
+		if idx.Size == 0 {
+			result.ContentLength = 0
+			header.Set("Content-Length", "0")
+		}
+		return result, true, nil
+	}
+	if partial || start > 0 {
+		result.Status = "206 Partial Content"
+		result.StatusCode = http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, idx.Size))
+	}
+
+	enc, err := t.handler.newEncryptor(t.handler.encryptionFor(req), idx.keySize())
+	if err != nil {
+		resp.Body.Close()
+		return nil, true, err
+	}
+	enc.SetPosition(from)
+
+	// 后端忽略Range时跳过前面的数据块
+	if resp.StatusCode == http.StatusOK && from > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, from); err != nil {
+			resp.Body.Close()
+			return nil, true, err
+		}
+	}
+	decrypted := &decryptReader{
+		source:     io.NopCloser(io.LimitReader(resp.Body, to-from+1)),
+		encryptor:  enc,
+		position:   from,
+		startPos:   from,
+		endPos:     to,
+		debugPrint: func(msg string) { t.handler.logger.Debug(msg) },
+	}
+	result.Body = t.handler.throttle(req.Context(), &decompressReader{
+		source:    decrypted,
+		closer:    resp.Body,
+		frames:    idx.Frames[first : last+1],
+		skip:      start - int64(first)*idx.FrameSize,
+		remaining: end - start + 1,
+	}, false)
+	return result, true, nil
+}
+
+// decompressReader 依次解压各个数据块，跳过第一块中范围之前的数据，只输出请求的范围
+type decompressReader struct {
+	source    io.Reader
+	closer    io.Closer
+	frames    []int64
+	skip      int64
+	remaining int64
+	frame     *io.LimitedReader
+	gz        *gzip.Reader
+}
+
+// Read 实现io.Reader接口
+func (r *decompressReader) Read(p []byte) (int, error) {
+	for {
+		if r.remaining <= 0 {
+			return 0, io.EOF
+		}
+		if r.frame == nil {
+			if err := r.next(); err != nil {
+				return 0, err
+			}
+		}
+		if int64(len(p)) > r.remaining {
+			p = p[:r.remaining]
+		}
+		n, err := r.gz.Read(p)
+		r.remaining -= int64(n)
+		if err == io.EOF {
+			// 数据块之间没有分隔，读完gzip成员后丢弃剩余的填充数据
+			io.Copy(io.Discard, r.frame)
+			r.frame = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// next 开始解压下一个数据块
+func (r *decompressReader) next() error {
+	if len(r.frames) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	r.frame = &io.LimitedReader{R: r.source, N: r.frames[0]}
+	r.frames = r.frames[1:]
+	var err error
+	if r.gz == nil {
+		r.gz, err = gzip.NewReader(r.frame)
+	} else {
+		err = r.gz.Reset(r.frame)
+	}
+	if err != nil {
+		return err
+	}
+	r.gz.Multistream(false)
+	if r.skip > 0 {
+		if _, err := io.CopyN(io.Discard, r.gz, r.skip); err != nil {
+			return err
+		}
+		r.skip = 0
+	}
+	return nil
+}
+
+// Close 实现io.Closer接口
+func (r *decompressReader) Close() error {
+	return r.closer.Close()
+}
+
+// handleCompressIndex 转发DELETE、COPY、MOVE请求，成功后对索引文件执行同样的操作
+func (t *proxyTransport) handleCompressIndex(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTripWithRetry(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+	indexResp, err := t.baseTransport().RoundTrip(compressIndexRequest(req, req.Method))
+	if err != nil {
+		t.handler.logger.Error("[COMPRESS] %s 索引失败: %s%s, 错误: %v", req.Method, req.URL.Path, compressIndexSuffix, err)
+		return resp, nil
+	}
+	indexResp.Body.Close()
+	return resp, nil
+}
+
+// collectionPattern 匹配PROPFIND响应中表示目录的resourcetype
+var collectionPattern = regexp.MustCompile(`<(?:[A-Za-z0-9_.-]+:)?collection\s*/?>`)
+
+// compressIndexCache 缓存PROPFIND中读取的索引，键包含索引文件的大小和修改时间，索引变化后自动失效
+type compressIndexCache struct {
+	mu      sync.Mutex
+	entries map[string]*compressIndex
+}
+
+// rewriteCompressedListing 从PROPFIND响应中隐藏索引文件，并把压缩文件的大小替换为明文大小
+func (h *ProxyHandler) rewriteCompressedListing(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	// 找出列表中的索引文件，键为对应数据文件的href
+	blocks := responsePattern.FindAll(body, -1)
+	indexes := make(map[string]string)
+	for _, block := range blocks {
+		href := hrefPattern.FindSubmatch(block)
+		if href == nil {
+			continue
+		}
+		p := strings.TrimSpace(string(href[2]))
+		if strings.HasSuffix(p, compressIndexSuffix) {
+			indexes[strings.TrimSuffix(p, compressIndexSuffix)] = cacheKeyOf(p, block)
+		}
+	}
+
+	// Depth为0时列表中没有索引文件，直接尝试读取
+	if len(indexes) == 0 && len(blocks) == 1 && !collectionPattern.Match(blocks[0]) {
+		if href := hrefPattern.FindSubmatch(blocks[0]); href != nil {
+			indexes[strings.TrimSpace(string(href[2]))] = ""
+		}
+	}
+
+	found := make(map[string]*compressIndex)
+	for dataHref, key := range indexes {
+		if idx := h.cachedCompressIndex(resp.Request, dataHref, key); idx != nil {
+			found[dataHref] = idx
+		}
+	}
+
+	body = responsePattern.ReplaceAllFunc(body, func(block []byte) []byte {
+		href := hrefPattern.FindSubmatch(block)
+		if href == nil {
+			return block
+		}
+		p := strings.TrimSpace(string(href[2]))
+		if strings.HasSuffix(p, compressIndexSuffix) {
+			return nil
+		}
+		idx, ok := found[p]
+		if !ok {
+			return block
+		}
+		// 数据文件的大小与索引一致时才替换，被其他方式覆盖的文件保持原样
+		length := contentLengthPattern.FindSubmatch(block)
+		if length == nil {
+			return block
+		}
+		if stored, _ := strconv.ParseInt(string(length[2]), 10, 64); stored != idx.storedSize() {
+			return block
+		}
+		return contentLengthPattern.ReplaceAll(block, []byte("${1}"+strconv.FormatInt(idx.Size, 10)+"${3}"))
+	})
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// cacheKeyOf 用索引文件的href、大小和修改时间生成缓存键
+func cacheKeyOf(href string, block []byte) string {
+	key := href
+	if length := contentLengthPattern.FindSubmatch(block); length != nil {
+		key += "|" + string(length[2])
+	}
+	if modified := lastModifiedPattern.FindSubmatch(block); modified != nil {
+		key += "|" + string(modified[2])
+	}
+	return key
+}
+
+// lastModifiedPattern 匹配getlastmodified元素
+var lastModifiedPattern = regexp.MustCompile(`(<(?:[A-Za-z0-9_.-]+:)?getlastmodified(?:\s[^>]*)?>)([^<]*)(</(?:[A-Za-z0-9_.-]+:)?getlastmodified>)`)
+
+// cachedCompressIndex 读取PROPFIND列表中某个文件的压缩索引，key为空时不使用缓存
+func (h *ProxyHandler) cachedCompressIndex(propfind *http.Request, dataHref, key string) *compressIndex {
+	cache := h.compressIndexes
+	if key != "" {
+		cache.mu.Lock()
+		idx, ok := cache.entries[key]
+		cache.mu.Unlock()
+		if ok {
+			return idx
+		}
+	}
+
+	ref, err := url.Parse(dataHref)
+	if err != nil {
+		return nil
+	}
+	idx, err := h.loadCompressIndex(propfind.Context(), propfind.URL.ResolveReference(ref), propfind.Header)
+	if err != nil {
+		h.logger.Debug("[COMPRESS] 读取索引失败: %s, 错误: %v", dataHref, err)
+		return nil
+	}
+	if key != "" {
+		cache.mu.Lock()
+		if len(cache.entries) >= maxCompressIndexes {
+			cache.entries = make(map[string]*compressIndex)
+		}
+		cache.entries[key] = idx
+		cache.mu.Unlock()
+	}
+	return idx
+}
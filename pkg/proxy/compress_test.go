@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"webdav-proxy/pkg/encryption"
+)
+
+// compressibleData 生成可压缩、跨越多个数据块的内容
+func compressibleData(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		buf.WriteString("line ")
+		buf.WriteString(strings.Repeat(string(rune('a'+i%26)), i%50))
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestCompressUploadRoundTrip(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Compression: CompressGzip})
+	content := compressibleData(3*compressFrameSize + 1000)
+
+	if w := serve(h, "", "PUT", "/a.txt", string(content)); w.Code != http.StatusCreated {
+		t.Fatalf("上传失败: %d %s", w.Code, w.Body.String())
+	}
+	_, stored := backendGet(t, backend.URL, "/a.txt")
+	if len(stored) == 0 || len(stored) >= len(content)/2 {
+		t.Fatalf("后端保存的数据没有压缩: %d 字节", len(stored))
+	}
+
+	// 索引文件加密保存，后端看不到数据块的大小
+	_, index := backendGet(t, backend.URL, "/a.txt"+compressIndexSuffix)
+	if parseCompressIndex(index) != nil || bytes.Contains(index, []byte("frames")) {
+		t.Fatalf("索引文件没有加密: %s", index)
+	}
+
+	w := serve(h, "", "GET", "/a.txt", "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatalf("下载的内容与上传的不一致: %d, %d 字节", w.Code, w.Body.Len())
+	}
+	// 跨越数据块边界的Range请求
+	w = serve(h, "", "GET", "/a.txt", "", "Range", "bytes=262000-524500")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), content[262000:524501]) {
+		t.Fatalf("跨数据块的Range请求错误: %d, %d 字节", w.Code, w.Body.Len())
+	}
+
+	w = serve(h, "", "PROPFIND", "/", "", "Depth", "1")
+	if strings.Contains(w.Body.String(), compressIndexSuffix) {
+		t.Error("列表中不应出现索引文件")
+	}
+	if !strings.Contains(w.Body.String(), ">787432<") {
+		t.Errorf("列表中应显示明文大小: %s", w.Body.String())
+	}
+
+	if w := serve(h, "", "DELETE", "/a.txt", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("删除失败: %d", w.Code)
+	}
+	if status, _ := backendGet(t, backend.URL, "/a.txt"+compressIndexSuffix); status != http.StatusNotFound {
+		t.Errorf("删除时应同时删除索引: %d", status)
+	}
+}
+
+func TestCompressUploadWithoutContentLength(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Compression: CompressGzip})
+	content := compressibleData(compressFrameSize + 10)
+
+	req := httptest.NewRequest("PUT", "/a.txt", io.NopCloser(bytes.NewReader(content)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("上传失败: %d %s", w.Code, w.Body.String())
+	}
+	w = serve(h, "", "GET", "/a.txt", "")
+	if !bytes.Equal(w.Body.Bytes(), content) || w.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("下载的内容错误: %d 字节, Content-Type: %s", w.Body.Len(), w.Header().Get("Content-Type"))
+	}
+}
+
+func TestCompressUploadStreams(t *testing.T) {
+	// 后端收到第一个数据块后通知客户端，客户端在此之前不结束上传；代理先缓存全部内容时会超时
+	received := make(chan struct{})
+	var once sync.Once
+	dav := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/a.txt" {
+			r.Body = &notifyingReader{ReadCloser: r.Body, notify: func() { once.Do(func() { close(received) }) }}
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(backend.Close)
+	h := newTestProxy(t, backend.URL, Options{Compression: CompressGzip})
+
+	content := compressibleData(2*compressFrameSize + 100)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(content[:compressFrameSize+1])
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(io.ErrUnexpectedEOF)
+			return
+		}
+		pw.Write(content[compressFrameSize+1:])
+		pw.Close()
+	}()
+
+	req := httptest.NewRequest("PUT", "/a.txt", pr)
+	req.ContentLength = int64(len(content))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("上传失败，数据没有逐块发送到后端: %d", w.Code)
+	}
+	if w := serve(h, "", "GET", "/a.txt", ""); !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatalf("下载的内容与上传的不一致: %d 字节", w.Body.Len())
+	}
+}
+
+// notifyingReader 第一次读到数据时调用notify
+type notifyingReader struct {
+	io.ReadCloser
+	notify func()
+}
+
+// Read 实现io.Reader接口
+func (r *notifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.notify()
+	}
+	return n, err
+}
+
+func TestCompressReadsLegacyPlaintextIndex(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Compression: CompressGzip})
+	content := compressibleData(compressFrameSize + 500)
+
+	// 早期版本：明文索引，数据文件的加密器使用压缩后的大小
+	idx := &compressIndex{Version: 1, Algorithm: CompressGzip, FrameSize: compressFrameSize}
+	var stored bytes.Buffer
+	if err := compressFrames(bytes.NewReader(content), idx, func(frame []byte) error {
+		stored.Write(frame)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := h.newEncryptor(encryptionParams{algorithm: h.algorithm, password: h.password}, int64(stored.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := stored.Bytes()
+	encryption.EncryptInPlace(enc, data)
+	index, _ := json.Marshal(idx)
+	for p, body := range map[string][]byte{"/a.txt": data, "/a.txt" + compressIndexSuffix: index} {
+		req, _ := http.NewRequest(http.MethodPut, backend.URL+p, bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	w := serve(h, "", "GET", "/a.txt", "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatalf("读取早期版本的压缩文件失败: %d, %d 字节", w.Code, w.Body.Len())
+	}
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// conditionalHeaders 条件请求头
+var conditionalHeaders = []string{"If-Match", "If-None-Match", "If-Range", "If-Modified-Since", "If-Unmodified-Since"}
+
+// hasConditionalHeaders 检查请求是否带有条件请求头
+func hasConditionalHeaders(header http.Header) bool {
+	for _, name := range conditionalHeaders {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// removeConditionalHeaders 删除条件请求头，用于代理内部发出的辅助请求
+func removeConditionalHeaders(header http.Header) {
+	for _, name := range conditionalHeaders {
+		header.Del(name)
+	}
+}
+
+// ifHeaderETagPattern 匹配WebDAV If头中的实体标签，如 (["etag"])
+var ifHeaderETagPattern = regexp.MustCompile(`\[([^\]]+)\]`)
+
+// translateConditionalHeaders 把条件请求头中客户端看到的ETag转换回后端的ETag
+func (h *ProxyHandler) translateConditionalHeaders(req *http.Request) {
+	if h.etags == nil && h.splitSize <= 0 {
+		return
+	}
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Range"} {
+		value := req.Header.Get(name)
+		if value == "" || value == "*" {
+			continue
+		}
+		// If-Range也可以是日期，只转换实体标签
+		if !strings.HasPrefix(value, `"`) && !strings.HasPrefix(value, `W/"`) {
+			continue
+		}
+		etags := strings.Split(value, ",")
+		for i, etag := range etags {
+			etags[i] = h.translateETag(strings.TrimSpace(etag))
+		}
+		req.Header.Set(name, strings.Join(etags, ", "))
+	}
+	if value := req.Header.Get("If"); value != "" {
+		req.Header.Set("If", ifHeaderETagPattern.ReplaceAllStringFunc(value, func(match string) string {
+			return "[" + h.translateETag(match[1:len(match)-1]) + "]"
+		}))
+	}
+}
+
+// translateETag 把单个客户端ETag转换为后端ETag，未知的ETag原样返回
+func (h *ProxyHandler) translateETag(etag string) string {
+	if h.etags != nil {
+		if backend, ok := h.etags.backendETag(etag); ok {
+			return backend
+		}
+	}
+	// 分片文件的ETag带有内部前缀，后端的清单文件没有
+	weak := strings.HasPrefix(etag, "W/")
+	inner := strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+	if h.splitSize > 0 && strings.HasPrefix(inner, splitETagPrefix) {
+		etag = `"` + strings.TrimPrefix(inner, splitETagPrefix) + `"`
+		if weak {
+			etag = "W/" + etag
+		}
+	}
+	return etag
+}
+
+// notModifiedETag 304响应中的ETag来自后端，分片文件需要换回客户端在If-None-Match中发送的ETag。
+// 启用稳定ETag时响应头会统一改写，不需要处理
+func (h *ProxyHandler) notModifiedETag(resp *http.Response, ifNoneMatch string) {
+	etag := resp.Header.Get("ETag")
+	if h.etags != nil || etag == "" || ifNoneMatch == "" {
+		return
+	}
+	for _, clientETag := range strings.Split(ifNoneMatch, ",") {
+		clientETag = strings.TrimSpace(clientETag)
+		if clientETag != etag && normalizeETag(clientETag) == normalizeETag(etag) {
+			resp.Header.Set("ETag", clientETag)
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen 判断内容类型时读取的明文长度，与http.DetectContentType一致
+const sniffLen = 512
+
+// isGenericContentType 检查是否为后端对无法识别的内容使用的通用类型
+func isGenericContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/octet-stream", "binary/octet-stream", "application/binary",
+		"application/x-download", "application/force-download", "application/unknown":
+		return true
+	}
+	return false
+}
+
+// startsAtZero 检查响应内容是否从文件开头开始，只有这时才能读取开头的明文判断类型
+func startsAtZero(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusOK {
+		return true
+	}
+	return strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes 0-")
+}
+
+// sniffedBody 包装已经读取过开头的响应体，关闭时关闭原始响应体
+type sniffedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// restoreContentType 后端对加密文件返回通用类型时，根据文件扩展名或解密后开头的明文恢复正确的Content-Type，
+// 并给没有文件名的attachment补上文件名，便于浏览器和播放器正确处理
+func (h *ProxyHandler) restoreContentType(req *http.Request, resp *http.Response) {
+	if !h.restoreTypes || resp == nil || (resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent) {
+		return
+	}
+	name := path.Base(req.URL.Path)
+	if strings.HasSuffix(req.URL.Path, "/") || name == "/" || name == "." {
+		return
+	}
+
+	if isGenericContentType(resp.Header.Get("Content-Type")) {
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" && req.Method == http.MethodGet && resp.Body != nil && resp.Body != http.NoBody && startsAtZero(resp) {
+			reader := bufio.NewReaderSize(resp.Body, sniffLen)
+			if head, _ := reader.Peek(sniffLen); len(head) > 0 {
+				contentType = http.DetectContentType(head)
+			}
+			resp.Body = &sniffedBody{Reader: reader, Closer: resp.Body}
+		}
+		if contentType != "" && !isGenericContentType(contentType) {
+			h.logger.Debug("[DOWNLOAD] 恢复Content-Type: %s, %s", req.URL.Path, contentType)
+			resp.Header.Set("Content-Type", contentType)
+		}
+	}
+
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+		dispositionType, params, err := mime.ParseMediaType(disposition)
+		if err == nil && dispositionType == "attachment" && params["filename"] == "" {
+			params["filename"] = name
+			if value := mime.FormatMediaType(dispositionType, params); value != "" {
+				resp.Header.Set("Content-Disposition", value)
+			}
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// CORSConfig 跨域资源共享配置，允许浏览器中的网页直接访问代理
+type CORSConfig struct {
+	AllowedOrigins   []string      // 允许的来源，如https://app.example.com、https://*.example.com，*表示所有来源，为空表示不启用
+	AllowedMethods   []string      // 允许的方法，为空时允许所有WebDAV方法
+	AllowedHeaders   []string      // 允许的请求头，为空时使用defaultCORSAllowedHeaders
+	ExposedHeaders   []string      // 允许网页读取的响应头，为空时使用defaultCORSExposedHeaders
+	AllowCredentials bool          // 是否允许携带Cookie和认证信息
+	MaxAge           time.Duration // 浏览器缓存预检结果的时间，0表示不缓存
+}
+
+// defaultCORSAllowedHeaders WebDAV客户端常用的请求头
+var defaultCORSAllowedHeaders = []string{
+	"Authorization", "Content-Type", "Depth", "Destination", "Overwrite", "If", "Lock-Token", "Timeout",
+	"Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "X-Api-Key",
+	"X-Requested-With", "OC-Checksum", "X-OC-MTime", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata",
+}
+
+// defaultCORSExposedHeaders 网页需要读取的WebDAV响应头
+var defaultCORSExposedHeaders = []string{
+	"DAV", "Allow", "ETag", "Last-Modified", "Content-Length", "Content-Range", "Accept-Ranges", "Lock-Token",
+	"Location", "WWW-Authenticate", "OC-ETag", "Tus-Resumable", "Upload-Offset", "Upload-Length", "X-Request-Id",
+}
+
+// corsOrigin 解析后的允许来源，scheme和host分别比较
+type corsOrigin struct {
+	scheme string
+	host   string // 包括端口，以*.开头时匹配任意层级的子域名，不匹配域名本身
+}
+
+// parseCORSOrigin 解析允许来源的配置，必须是scheme://host[:port]的形式
+func parseCORSOrigin(pattern string) (corsOrigin, error) {
+	u, err := url.Parse(strings.ToLower(strings.TrimSpace(pattern)))
+	if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return corsOrigin{}, fmt.Errorf("invalid CORS allowed origin: %q, expected scheme://host[:port] or *", pattern)
+	}
+	host := u.Host
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+		return corsOrigin{}, fmt.Errorf("invalid CORS allowed origin: %q, * is only supported as the leftmost label", pattern)
+	}
+	return corsOrigin{scheme: u.Scheme, host: host}, nil
+}
+
+// match 检查来源是否匹配
+func (o corsOrigin) match(scheme, host string) bool {
+	if scheme != o.scheme {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(o.host, "*"); ok {
+		return len(host) > len(suffix) && strings.HasSuffix(host, suffix)
+	}
+	return host == o.host
+}
+
+// ValidateCORSOrigins 检查允许来源的配置，允许携带凭据时不能使用*，否则任何网站都可以用访问者的凭据读取数据
+func ValidateCORSOrigins(origins []string, allowCredentials bool) error {
+	for _, pattern := range origins {
+		if strings.TrimSpace(pattern) == "*" {
+			if allowCredentials {
+				return fmt.Errorf("CORS allowed origin * cannot be combined with allow credentials")
+			}
+			continue
+		}
+		if _, err := parseCORSOrigin(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// corsMiddleware 跨域资源共享中间件，放在认证外层，预检请求不需要认证
+type corsMiddleware struct {
+	handler   http.Handler
+	config    *CORSConfig
+	logger    utils.Logger
+	origins   []corsOrigin
+	anyOrigin bool
+	methods   string
+	headers   string
+	exposed   string
+}
+
+// NewCORSMiddleware 创建跨域资源共享中间件，没有配置允许的来源时直接返回原处理器
+func NewCORSMiddleware(handler http.Handler, config *CORSConfig) (http.Handler, error) {
+	if config == nil || len(config.AllowedOrigins) == 0 {
+		return handler, nil
+	}
+	if err := ValidateCORSOrigins(config.AllowedOrigins, config.AllowCredentials); err != nil {
+		return nil, err
+	}
+
+	m := &corsMiddleware{
+		handler: handler,
+		config:  config,
+		logger:  handlerLogger(handler),
+		methods: strings.Join(davMethods, ", "),
+		headers: strings.Join(defaultCORSAllowedHeaders, ", "),
+		exposed: strings.Join(defaultCORSExposedHeaders, ", "),
+	}
+	for _, pattern := range config.AllowedOrigins {
+		if strings.TrimSpace(pattern) == "*" {
+			m.anyOrigin = true
+			continue
+		}
+		origin, _ := parseCORSOrigin(pattern)
+		m.origins = append(m.origins, origin)
+	}
+	if len(config.AllowedMethods) > 0 {
+		methods := make([]string, len(config.AllowedMethods))
+		for i, method := range config.AllowedMethods {
+			methods[i] = strings.ToUpper(method)
+		}
+		m.methods = strings.Join(methods, ", ")
+	}
+	if len(config.AllowedHeaders) > 0 {
+		m.headers = strings.Join(config.AllowedHeaders, ", ")
+	}
+	if len(config.ExposedHeaders) > 0 {
+		m.exposed = strings.Join(config.ExposedHeaders, ", ")
+	}
+	return m, nil
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *corsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 响应随Origin变化，避免缓存把一个来源的响应返回给另一个来源
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !m.allowOrigin(origin) {
+		// 不允许的来源同样去掉后端返回的跨域响应头，是否允许跨域只由代理的配置决定
+		m.handler.ServeHTTP(&headerOverrideWriter{ResponseWriter: w, override: removeCORSHeaders}, r)
+		return
+	}
+
+	headers := make(http.Header)
+	if !m.anyOrigin {
+		headers.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		headers.Set("Access-Control-Allow-Origin", "*")
+	}
+	if m.config.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	// 预检请求由代理直接应答，不转发给后端
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		requested := r.Header.Get("Access-Control-Request-Method")
+		if !m.allowMethod(requested) {
+			m.logger.Debug("[CORS] 拒绝来源 %s 的预检请求，方法 %s 不允许", origin, requested)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		for key, values := range headers {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Access-Control-Allow-Methods", m.methods)
+		w.Header().Set("Access-Control-Allow-Headers", m.headers)
+		if m.config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(m.config.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// 去掉后端返回的跨域响应头，避免重复或冲突
+	headers.Set("Access-Control-Expose-Headers", m.exposed)
+	m.handler.ServeHTTP(&headerOverrideWriter{ResponseWriter: w, override: func(header http.Header) {
+		removeCORSHeaders(header)
+		for key, values := range headers {
+			header[key] = values
+		}
+	}}, r)
+}
+
+// removeCORSHeaders 去掉响应中的跨域响应头
+func removeCORSHeaders(header http.Header) {
+	for key := range header {
+		if strings.HasPrefix(key, "Access-Control-") {
+			delete(header, key)
+		}
+	}
+}
+
+// getLogger 实现loggerProvider接口
+func (m *corsMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// allowOrigin 检查来源是否在允许的列表中，*匹配任何来源，包括file://页面发出的null
+func (m *corsMiddleware) allowOrigin(origin string) bool {
+	if m.anyOrigin {
+		return true
+	}
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, allowed := range m.origins {
+		if allowed.match(u.Scheme, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMethod 检查预检请求的方法是否允许
+func (m *corsMiddleware) allowMethod(method string) bool {
+	for _, allowed := range strings.Split(m.methods, ", ") {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
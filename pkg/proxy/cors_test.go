@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newCORSTestHandler(t *testing.T, config *CORSConfig) http.Handler {
+	h, err := NewCORSMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 后端自己返回的跨域响应头应被替换
+		w.Header().Set("Access-Control-Allow-Origin", "https://backend.example")
+		w.WriteHeader(http.StatusMultiStatus)
+	}), config)
+	if err != nil {
+		t.Fatalf("创建CORS中间件失败: %v", err)
+	}
+	return h
+}
+
+func TestCORSOriginMatching(t *testing.T) {
+	h := newCORSTestHandler(t, &CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org", "http://localhost:8080"},
+		AllowCredentials: true,
+	})
+
+	tests := []struct {
+		origin string
+		allow  bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://App.Example.com", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://other.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"http://a.example.org", false},
+		{"http://localhost:8080", true},
+		{"http://localhost", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		w := serve(h, "", "PROPFIND", "/", "", "Origin", tt.origin)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if tt.allow {
+			if got != tt.origin || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Errorf("%s 应被允许: %v", tt.origin, w.Header())
+			}
+		} else if got != "" {
+			t.Errorf("%s 不应被允许, Access-Control-Allow-Origin: %s", tt.origin, got)
+		}
+		if w.Code != http.StatusMultiStatus {
+			t.Errorf("%s 的请求应转发给内层处理器: %d", tt.origin, w.Code)
+		}
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := newCORSTestHandler(t, &CORSConfig{AllowedOrigins: []string{"*"}})
+
+	// path.Match中的*不匹配/，单独的*需要匹配任何来源
+	for _, origin := range []string{"https://app.example.com", "http://localhost:3000", "null"} {
+		w := serve(h, "", "GET", "/", "", "Origin", origin)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s 应得到*, 实际 %q", origin, got)
+		}
+		if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Error("允许所有来源时不能允许携带凭据")
+		}
+	}
+	if w := serve(h, "", "GET", "/", ""); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("没有Origin的请求不需要跨域响应头")
+	}
+}
+
+func TestCORSRejectsInvalidConfig(t *testing.T) {
+	for _, config := range []*CORSConfig{
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{AllowedOrigins: []string{"app.example.com"}},
+		{AllowedOrigins: []string{"https://app.example.com/path"}},
+		{AllowedOrigins: []string{"https://app.*.com"}},
+	} {
+		if _, err := NewCORSMiddleware(http.NotFoundHandler(), config); err == nil {
+			t.Errorf("无效的配置应返回错误: %+v", config)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := newCORSTestHandler(t, &CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedMethods: []string{"get", "propfind"},
+		MaxAge:         10 * time.Minute,
+	})
+
+	w := serve(h, "", "OPTIONS", "/dir/", "", "Origin", "https://app.example.com", "Access-Control-Request-Method", "PROPFIND")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("预检请求应由代理直接应答: %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, PROPFIND" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" ||
+		w.Header().Get("Access-Control-Allow-Headers") == "" {
+		t.Errorf("预检响应头错误: %v", w.Header())
+	}
+
+	// 不允许的方法和来源不返回跨域响应头
+	w = serve(h, "", "OPTIONS", "/", "", "Origin", "https://app.example.com", "Access-Control-Request-Method", "DELETE")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("不允许的方法不应返回跨域响应头: %v", w.Header())
+	}
+	w = serve(h, "", "OPTIONS", "/", "", "Origin", "https://app.example.net", "Access-Control-Request-Method", "GET")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Code != http.StatusMultiStatus {
+		t.Errorf("不允许的来源应按普通请求转发: %d %v", w.Code, w.Header())
+	}
+
+	// 实际请求替换后端的跨域响应头
+	w = serve(h, "", "PROPFIND", "/", "", "Origin", "https://app.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("实际请求的跨域响应头错误: %v", w.Header())
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"strings"
+)
+
+// FileDetectionConfig 判断请求内容是否为文件的规则，只有文件才会加解密，encryptAll模式下不使用
+type FileDetectionConfig struct {
+	Extensions      []string // 额外视为文件的扩展名，如 .md
+	FileTypes       []string // 额外视为文件的Content-Type前缀，优先于NonFileTypes
+	NonFileTypes    []string // 额外视为非文件的Content-Type前缀
+	ReplaceDefaults bool     // 使用上面的列表替换内置列表，而不是追加到内置列表之后
+	MinSize         int64    // 小于该大小的内容不加密，0表示不限制
+}
+
+// 常见的文件类型
+var defaultFileTypes = []string{
+	"application/octet-stream",
+	"application/pdf",
+	"image/",
+	"video/",
+	"audio/",
+	"text/plain",
+	"application/msword",
+	"application/vnd.",
+	"application/zip",
+	"application/x-rar-compressed",
+	"application/x-tar",
+	"application/x-gzip",
+}
+
+// 常见的非文件类型
+var defaultNonFileTypes = []string{
+	"text/html",
+	"text/xml",
+	"application/xml",
+	"application/json",
+	"text/css",
+	"application/javascript",
+	"application/x-www-form-urlencoded",
+	"multipart/form-data",
+}
+
+// 常见的文件扩展名
+var defaultFileExtensions = []string{
+	".pdf", ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".svg", ".webp",
+	".mp4", ".avi", ".mov", ".wmv", ".flv", ".mkv", ".webm",
+	".mp3", ".wav", ".flac", ".aac", ".ogg", ".m4a",
+	".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx",
+	".zip", ".rar", ".7z", ".tar", ".gz", ".bz2",
+	".txt", ".log", ".csv", ".json", ".xml", ".yaml", ".yml",
+	".exe", ".dmg", ".pkg", ".deb", ".rpm",
+}
+
+// fileDetector 按Content-Type、扩展名和大小判断内容是否为文件
+type fileDetector struct {
+	fileTypes    []string
+	nonFileTypes []string
+	extensions   []string
+	minSize      int64
+}
+
+// newFileDetector 根据配置创建文件判断规则，config为nil时使用内置列表
+func newFileDetector(config *FileDetectionConfig) *fileDetector {
+	d := &fileDetector{
+		fileTypes:    defaultFileTypes,
+		nonFileTypes: defaultNonFileTypes,
+		extensions:   defaultFileExtensions,
+	}
+	if config == nil {
+		return d
+	}
+	if config.ReplaceDefaults {
+		d.fileTypes, d.nonFileTypes, d.extensions = nil, nil, nil
+	}
+	for _, t := range config.FileTypes {
+		d.fileTypes = append(d.fileTypes, strings.ToLower(t))
+	}
+	for _, t := range config.NonFileTypes {
+		d.nonFileTypes = append(d.nonFileTypes, strings.ToLower(t))
+	}
+	for _, ext := range config.Extensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		d.extensions = append(d.extensions, ext)
+	}
+	d.minSize = config.MinSize
+	return d
+}
+
+// isFileContentType 检查是否为文件类型，文件类型优先于非文件类型，都不匹配时认为是文件
+func (d *fileDetector) isFileContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, t := range d.fileTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	for _, t := range d.nonFileTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+
+	// 默认认为是文件
+	return true
+}
+
+// hasFileExtension 检查路径是否有文件扩展名
+func (d *fileDetector) hasFileExtension(path string) bool {
+	lowerPath := strings.ToLower(path)
+	for _, ext := range d.extensions {
+		if strings.HasSuffix(lowerPath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooSmall 检查内容是否小于加密的最小大小，大小未知时不算
+func (d *fileDetector) tooSmall(size int64) bool {
+	return d.minSize > 0 && size >= 0 && size < d.minSize
+}
+
+// isFileContent 判断请求或响应的内容是否需要加解密，size为完整文件的大小，未知时为-1。
+// encryptAll模式下除集合路径外的内容全部加解密，否则根据大小、Content-Type、文件扩展名和Content-Disposition推断是否为文件
+func (h *ProxyHandler) isFileContent(p, contentType, contentDisposition string, size int64) bool {
+	if h.encryptAll {
+		return !strings.HasSuffix(p, "/")
+	}
+	if h.detector.tooSmall(size) {
+		return false
+	}
+	return h.detector.isFileContentType(contentType) || h.detector.hasFileExtension(p) ||
+		strings.Contains(contentDisposition, "attachment")
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// director 修改请求以指向后端服务器
+func (h *ProxyHandler) director(req *http.Request) {
+	h.logger.Debug("[DIRECTOR] 开始处理请求转发: %s %s", req.Method, req.URL.Path)
+	
+	// 选择后端并设置目标URL
+	backend := h.selectBackend()
+	req.URL.Scheme = backend.Scheme
+	req.URL.Host = backend.Host
+	h.logger.Debug("[DIRECTOR] 后端服务器: %s://%s", req.URL.Scheme, req.URL.Host)
+	
+	// 去掉虚拟挂载点前缀，拼接后端路径
+	prefix := mountPrefix(req)
+	if prefix != "" {
+		req.URL.RawPath = ""
+		h.logger.Debug("[DIRECTOR] 挂载点: %s", prefix)
+	}
+	req.URL.Path = backendPath(backend, prefix, req.URL.Path)
+	h.logger.Debug("[DIRECTOR] 后端请求路径: %s", req.URL.Path)
+
+	// COPY和MOVE的目标地址同样转换为后端地址
+	if destination := req.Header.Get("Destination"); destination != "" {
+		if rewritten, ok := destinationToBackend(destination, backend, prefix); ok {
+			req.Header.Set("Destination", rewritten)
+			h.logger.Debug("[DIRECTOR] 目标地址: %s -> %s", destination, rewritten)
+		} else {
+			h.logger.Warn("[DIRECTOR] 无法解析目标地址: %s", destination)
+		}
+	}
+
+	// 保留查询参数
+	if backend.RawQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = backend.RawQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = backend.RawQuery + "&" + req.URL.RawQuery
+	}
+	h.logger.Debug("[DIRECTOR] 完整URL: %s", req.URL.String())
+	
+	// 修改Host头
+	req.Host = backend.Host
+	h.logger.Debug("[DIRECTOR] 设置Host头: %s", req.Host)
+	
+	// 添加后端认证头
+	if h.setBackendAuth(req) {
+		h.logger.Debug("[DIRECTOR] 添加后端认证头")
+	} else {
+		h.logger.Debug("[DIRECTOR] 未设置后端认证")
+	}
+	
+	// 替换客户端的User-Agent
+	h.setUserAgent(req)
+
+	// 移除Hop-by-hop头部
+	removeHopHeaders(req.Header)
+
+	// 应用配置的请求头规则，可以覆盖上面设置的请求头
+	if h.headerRules != nil {
+		applyHeaderRules(req.Header, h.headerRules.Request, req)
+	}
+	h.logger.Debug("[DIRECTOR] 请求头: %v", req.Header)
+}
+
+// setBackendAuth 为发往后端的请求设置认证头，返回是否设置了认证
+func (h *ProxyHandler) setBackendAuth(req *http.Request) bool {
+	if h.backendAuth == nil {
+		return false
+	}
+	if h.backendAuth.Passthrough {
+		// 保留客户端自己的Authorization头，由后端按用户认证
+		return req.Header.Get("Authorization") != ""
+	}
+	auth := h.backendAuth.Username + ":" + h.backendAuth.Password
+	basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+	req.Header.Set("Authorization", basicAuth)
+	return true
+}
+
+// backendPath 把客户端路径转换为后端路径：去掉挂载点前缀，
+// 已经包含后端路径前缀时直接使用，否则拼接后端路径
+func backendPath(backend *url.URL, prefix, clientPath string) string {
+	if prefix != "" {
+		clientPath = strings.TrimPrefix(clientPath, prefix)
+		if clientPath == "" {
+			clientPath = "/"
+		}
+	}
+	if strings.HasPrefix(clientPath, backend.Path) {
+		return clientPath
+	}
+	return singleJoiningSlash(backend.Path, clientPath)
+}
+
+// destinationToBackend 把Destination头中的代理地址转换为后端地址，
+// 客户端发送的是代理的主机和路径，很多后端会拒绝指向其他主机的目标
+func destinationToBackend(destination string, backend *url.URL, prefix string) (string, bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Path == "" {
+		return "", false
+	}
+	rewritten := url.URL{
+		Scheme: backend.Scheme,
+		Host:   backend.Host,
+		Path:   backendPath(backend, prefix, u.Path),
+	}
+	return rewritten.String(), true
+}
+
+// inMount 检查Destination是否位于请求所属的挂载点内，不同挂载点可能对应不同的后端，无法直接复制或移动
+func inMount(destination, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	return u.Path == prefix || strings.HasPrefix(u.Path, prefix+"/")
+}
+
+// locationToClient 把响应中指向后端的Location转换为客户端可以访问的路径
+func (h *ProxyHandler) locationToClient(location, prefix string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	backend := h.backendForHost(u.Host)
+	if u.IsAbs() && backend == nil {
+		// 指向其他服务器的地址保持不变
+		return location
+	}
+	if backend == nil {
+		backend = h.backend
+	}
+	p := u.Path
+	if prefix != "" {
+		base := strings.TrimSuffix(backend.Path, "/")
+		if p != base && !strings.HasPrefix(p, base+"/") {
+			return location
+		}
+		p = prefix + p[len(base):]
+	}
+	rewritten := url.URL{Path: p, RawQuery: u.RawQuery, Fragment: u.Fragment}
+	return rewritten.String()
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"webdav-proxy/utils"
+)
+
+func newTestHandler(t *testing.T, backendURL string) *ProxyHandler {
+	backend, err := url.Parse(backendURL)
+	if err != nil {
+		t.Fatalf("解析后端地址失败: %v", err)
+	}
+	return &ProxyHandler{
+		backend:  backend,
+		backends: []*url.URL{backend},
+		logger:   utils.NewLogger(utils.LogLevelError),
+	}
+}
+
+func TestDirectorRewritesDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		backend     string
+		prefix      string
+		path        string
+		destination string
+		wantPath    string
+		wantDest    string
+	}{
+		{
+			name:        "同一目录下移动",
+			backend:     "http://backend:8080/dav/",
+			path:        "/a.txt",
+			destination: "http://proxy.example.com/b.txt",
+			wantPath:    "/dav/a.txt",
+			wantDest:    "http://backend:8080/dav/b.txt",
+		},
+		{
+			name:        "移动到其他目录",
+			backend:     "http://backend:8080/dav",
+			path:        "/photos/2024/a.jpg",
+			destination: "https://proxy.example.com/archive/a.jpg",
+			wantPath:    "/dav/photos/2024/a.jpg",
+			wantDest:    "http://backend:8080/dav/archive/a.jpg",
+		},
+		{
+			name:        "目标已包含后端路径",
+			backend:     "http://backend:8080/dav/",
+			path:        "/dav/a.txt",
+			destination: "http://proxy.example.com/dav/sub/a.txt",
+			wantPath:    "/dav/a.txt",
+			wantDest:    "http://backend:8080/dav/sub/a.txt",
+		},
+		{
+			name:        "只有路径的目标",
+			backend:     "https://backend/remote.php/webdav/",
+			path:        "/a.txt",
+			destination: "/docs/a.txt",
+			wantPath:    "/remote.php/webdav/a.txt",
+			wantDest:    "https://backend/remote.php/webdav/docs/a.txt",
+		},
+		{
+			name:        "编码的路径",
+			backend:     "http://backend/dav/",
+			path:        "/a b.txt",
+			destination: "http://proxy/%E6%96%87%E4%BB%B6/c%20d.txt",
+			wantPath:    "/dav/a b.txt",
+			wantDest:    "http://backend/dav/%E6%96%87%E4%BB%B6/c%20d.txt",
+		},
+		{
+			name:        "挂载点内移动",
+			backend:     "http://backend/dav/",
+			prefix:      "/nas",
+			path:        "/nas/a.txt",
+			destination: "http://proxy/nas/old/a.txt",
+			wantPath:    "/dav/a.txt",
+			wantDest:    "http://backend/dav/old/a.txt",
+		},
+		{
+			name:        "后端为根路径",
+			backend:     "http://backend",
+			prefix:      "/nas",
+			path:        "/nas/dir/",
+			destination: "http://proxy/nas/renamed/",
+			wantPath:    "/dir/",
+			wantDest:    "http://backend/renamed/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, tt.backend)
+			req := httptest.NewRequest("MOVE", "http://proxy"+(&url.URL{Path: tt.path}).EscapedPath(), nil)
+			req.Header.Set("Destination", tt.destination)
+			if tt.prefix != "" {
+				req = req.WithContext(context.WithValue(req.Context(), mountPrefixKey{}, tt.prefix))
+			}
+
+			h.director(req)
+
+			if req.URL.Path != tt.wantPath {
+				t.Errorf("请求路径错误: 期望 %s, 实际 %s", tt.wantPath, req.URL.Path)
+			}
+			if got := req.Header.Get("Destination"); got != tt.wantDest {
+				t.Errorf("目标地址错误: 期望 %s, 实际 %s", tt.wantDest, got)
+			}
+		})
+	}
+}
+
+func TestServeHTTPRejectsCrossMountMove(t *testing.T) {
+	h := newTestHandler(t, "http://backend/dav/")
+	req := httptest.NewRequest("MOVE", "http://proxy/nas/a.txt", nil)
+	req.Header.Set("Destination", "http://proxy/photos/a.txt")
+	req = req.WithContext(context.WithValue(req.Context(), mountPrefixKey{}, "/nas"))
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("跨挂载点移动应返回502, 实际 %d", w.Code)
+	}
+}
+
+func TestLocationToClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		location string
+		want     string
+	}{
+		{"后端地址", "", "http://backend/dav/new.txt", "/dav/new.txt"},
+		{"挂载点", "/nas", "http://backend/dav/dir/new%20file.txt", "/nas/dir/new%20file.txt"},
+		{"相对路径", "/nas", "/dav/dir/", "/nas/dir/"},
+		{"其他服务器", "/nas", "https://cdn.example.com/dav/x", "https://cdn.example.com/dav/x"},
+		{"挂载点外的路径", "/nas", "http://backend/other/x", "http://backend/other/x"},
+	}
+
+	h := newTestHandler(t, "http://backend/dav/")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.locationToClient(tt.location, tt.prefix); got != tt.want {
+				t.Errorf("期望 %s, 实际 %s", tt.want, got)
+			}
+		})
+	}
+}
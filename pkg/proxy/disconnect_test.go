@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+func newDisconnectTestProxy(t *testing.T, backendURL string) *httptest.Server {
+	backend, err := url.Parse(backendURL)
+	if err != nil {
+		t.Fatalf("解析后端地址失败: %v", err)
+	}
+	h, err := New(Options{
+		Backend:  backend,
+		Password: "test",
+		Logger:   utils.NewLogger(utils.LogLevelError),
+	})
+	if err != nil {
+		t.Fatalf("创建代理失败: %v", err)
+	}
+	t.Cleanup(h.Close)
+	proxy := httptest.NewServer(h)
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestClientDisconnectAbortsUpload(t *testing.T) {
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 32*1024)
+		first := true
+		for {
+			_, err := r.Body.Read(buf)
+			if first {
+				close(started)
+				first = false
+			}
+			if err != nil {
+				if err != io.EOF {
+					close(aborted)
+				}
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+	proxy := newDisconnectTestProxy(t, backend.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, proxy.URL+"/big.bin", pr)
+	req.ContentLength = 1 << 30
+	req.Header.Set("Content-Type", "application/octet-stream")
+	go func() {
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	go pw.Write(make([]byte, 256*1024))
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("后端没有收到上传数据")
+	}
+	cancel()
+	pw.CloseWithError(context.Canceled)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("客户端断开后发往后端的上传没有被取消")
+	}
+}
+
+func TestClientDisconnectAbortsDownload(t *testing.T) {
+	aborted := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(1<<30))
+		chunk := make([]byte, 64*1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				break
+			}
+			w.(http.Flusher).Flush()
+			if r.Context().Err() != nil {
+				break
+			}
+		}
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer backend.Close()
+	proxy := newDisconnectTestProxy(t, backend.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, proxy.URL+"/big.bin", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("下载请求失败: %v", err)
+	}
+	if _, err := io.ReadFull(resp.Body, make([]byte, 256*1024)); err != nil {
+		t.Fatalf("读取下载数据失败: %v", err)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("客户端断开后发往后端的下载没有被取消")
+	}
+}
@@ -0,0 +1,9 @@
+// Package proxy 实现WebDAV加密反向代理。
+//
+// ProxyHandler是核心处理器，作为http.Handler对外提供WebDAV服务：上传时加密文件内容后转发给后端，
+// 下载时解密后端返回的数据，并处理Range、分片存储、条件请求、锁等WebDAV细节。
+// 认证、限流、配额、TUS断点续传等功能以中间件的形式提供（NewXxxMiddleware），按需包裹在处理器外层。
+//
+// 只需要加解密而不需要完整代理的程序，可以通过ProxyHandler.Transport获取加解密传输层，
+// 作为http.Client的Transport直接访问后端。
+package proxy
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// activeRequest 正在处理的请求，关闭服务时用于等待、取消和记录日志
+type activeRequest struct {
+	method   string
+	path     string
+	start    time.Time
+	cancel   context.CancelFunc
+	received atomic.Int64 // 已从客户端读取的字节数
+	sent     atomic.Int64 // 已写给客户端的字节数
+}
+
+// String 返回用于日志的请求描述
+func (a *activeRequest) String() string {
+	return fmt.Sprintf("%s %s (已进行 %v, 上传 %d 字节, 下载 %d 字节)",
+		a.method, a.path, time.Since(a.start).Truncate(time.Second), a.received.Load(), a.sent.Load())
+}
+
+// DrainMiddleware 记录正在处理的请求，关闭服务时等待进行中的上传下载完成，
+// 超过等待时间后取消剩余的请求，让发往后端的请求中止而不是保存不完整的内容
+type DrainMiddleware struct {
+	handler http.Handler
+	logger  utils.Logger
+	mu      sync.Mutex
+	active  map[*activeRequest]struct{}
+	idle    *sync.Cond
+	pending map[net.Conn]struct{} // 已接受但还没有读到请求的连接
+}
+
+// NewDrainMiddleware 创建请求跟踪中间件，需要放在最外层以覆盖所有请求
+func NewDrainMiddleware(handler http.Handler) *DrainMiddleware {
+	m := &DrainMiddleware{
+		handler: handler,
+		logger:  handlerLogger(handler),
+		active:  make(map[*activeRequest]struct{}),
+		pending: make(map[net.Conn]struct{}),
+	}
+	m.idle = sync.NewCond(&m.mu)
+	return m
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *DrainMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	req := &activeRequest{method: r.Method, path: r.URL.Path, start: time.Now(), cancel: cancel}
+
+	m.mu.Lock()
+	m.active[req] = struct{}{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.active, req)
+		if len(m.active) == 0 {
+			m.idle.Broadcast()
+		}
+		m.mu.Unlock()
+	}()
+
+	r = r.WithContext(ctx)
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &drainBody{ReadCloser: r.Body, n: &req.received}
+	}
+	m.handler.ServeHTTP(&drainResponseWriter{ResponseWriter: w, n: &req.sent}, r)
+}
+
+// getLogger 实现loggerProvider接口
+func (m *DrainMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// ConnState 用作http.Server.ConnState，记录已接受但还没有读到请求的连接
+func (m *DrainMiddleware) ConnState(conn net.Conn, state http.ConnState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state == http.StateNew {
+		m.pending[conn] = struct{}{}
+	} else {
+		delete(m.pending, conn)
+	}
+}
+
+// WaitPending 等待已接受的连接读到请求，超时返回false。
+// http.Server.Shutdown开始后才读到的请求会被直接断开，关闭监听后应先等待这些连接
+func (m *DrainMiddleware) WaitPending(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		m.mu.Lock()
+		pending := len(m.pending)
+		m.mu.Unlock()
+		if pending == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Active 返回正在处理的请求数
+func (m *DrainMiddleware) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.active)
+}
+
+// Wait 等待所有请求处理完毕，超时返回false
+func (m *DrainMiddleware) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		m.mu.Lock()
+		for len(m.active) > 0 {
+			m.idle.Wait()
+		}
+		m.mu.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Abort 取消所有仍在处理的请求，返回它们的描述，按开始时间排序
+func (m *DrainMiddleware) Abort() []string {
+	m.mu.Lock()
+	requests := make([]*activeRequest, 0, len(m.active))
+	for req := range m.active {
+		requests = append(requests, req)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(requests, func(i, j int) bool { return requests[i].start.Before(requests[j].start) })
+	aborted := make([]string, 0, len(requests))
+	for _, req := range requests {
+		aborted = append(aborted, req.String())
+		req.cancel()
+	}
+	return aborted
+}
+
+// drainBody 统计从客户端读取的字节数
+type drainBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+// Read 实现io.Reader接口
+func (b *drainBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// drainResponseWriter 统计写给客户端的字节数
+type drainResponseWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+// Write 实现io.Writer接口
+func (w *drainResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// Flush 实现http.Flusher接口
+func (w *drainResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供http.ResponseController获取原始ResponseWriter
+func (w *drainResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
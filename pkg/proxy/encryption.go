@@ -0,0 +1,658 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"webdav-proxy/pkg/encryption"
+)
+
+// proxyTransport 自定义传输层，处理加解密
+type proxyTransport struct {
+	handler       *ProxyHandler
+	base          *http.Transport
+	originalPaths map[*http.Request]string // 保存原始请求路径
+}
+
+// RoundTrip 执行HTTP请求
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	originalPath := req.URL.Path // 保存原始请求路径
+	t.handler.logger.Info("[TRANSPORT] 开始处理请求: %s %s", req.Method, originalPath)
+
+	// 条件请求头中客户端看到的ETag要转换回后端的ETag
+	ifNoneMatch := req.Header.Get("If-None-Match")
+	t.handler.translateConditionalHeaders(req)
+
+	// 根据请求方法处理加解密
+	switch req.Method {
+	case http.MethodPut, http.MethodPost:
+		// 上传文件 - 需要加密
+		return t.handleUpload(req)
+	case http.MethodGet, http.MethodHead:
+		// 下载文件 - 需要解密，HEAD只修正响应头
+		var resp *http.Response
+		var err error
+		if req.Method == http.MethodHead {
+			resp, err = t.handleHead(req)
+		} else {
+			resp, err = t.handleDownload(req)
+		}
+		if err == nil && resp.StatusCode == http.StatusNotModified {
+			t.handler.notModifiedETag(resp, ifNoneMatch)
+		}
+		if err == nil {
+			t.handler.restoreContentType(req, resp)
+		}
+		return resp, err
+	case http.MethodDelete, "COPY", "MOVE":
+		// 分片上传的文件需要同时处理各个分片
+		if t.handler.splitSize > 0 {
+			return t.handleSplitParts(req)
+		}
+		// 压缩保存的文件需要同时处理索引文件
+		if t.handler.compression != "" {
+			return t.handleCompressIndex(req)
+		}
+		return t.roundTripWithRetry(req)
+	default:
+		// 其他方法直接转发
+		t.handler.logger.Debug("[TRANSPORT] 其他方法，直接转发: %s", req.Method)
+		return t.roundTripWithRetry(req)
+	}
+}
+
+// handleUpload 处理文件上传（加密）
+func (t *proxyTransport) handleUpload(req *http.Request) (*http.Response, error) {
+	t.handler.logger.Info("[UPLOAD] 开始处理文件上传: %s %s", req.Method, req.URL.Path)
+
+	if req.Body == nil {
+		t.handler.logger.Debug("[UPLOAD] 请求体为空，直接转发")
+		return t.baseTransport().RoundTrip(req)
+	}
+
+	// 命中不加密规则的文件原样上传
+	if isPlaintext(req) {
+		t.handler.logger.Debug("[UPLOAD] 路径不加密，直接转发: %s", req.URL.Path)
+		return t.baseTransport().RoundTrip(req)
+	}
+
+	// 设置了最小加密大小时，未知大小的上传先读取开头的数据，确定是否小于该大小
+	if t.handler.detector.minSize > 0 && req.ContentLength < 0 && !t.handler.encryptAll {
+		if err := t.peekUploadSize(req); err != nil {
+			return nil, err
+		}
+	}
+
+	// 检查是否为文件（通过大小、Content-Type或路径）
+	contentType := req.Header.Get("Content-Type")
+	if !t.handler.isFileContent(req.URL.Path, contentType, "", req.ContentLength) {
+		// 不是文件类型，直接转发
+		t.handler.logger.Debug("[UPLOAD] 非文件类型，跳过加密: %s, Content-Type: %s", req.URL.Path, contentType)
+		return t.baseTransport().RoundTrip(req)
+	}
+
+	// 按客户端提供的OC-Checksum校验明文，后端只能看到密文，校验和不再发给后端
+	if verifier := newChecksumReader(req); verifier != nil {
+		req.Body = verifier
+	}
+	if t.handler.ocChecksum != OCChecksumPassthrough {
+		req.Header.Del("OC-Checksum")
+	}
+
+	// 先压缩再加密
+	if t.handler.compression != "" {
+		return t.handleCompressedUpload(req)
+	}
+	return t.encryptUpload(req)
+}
+
+// encryptUpload 加密请求体并发送到后端，加密后大小不变
+func (t *proxyTransport) encryptUpload(req *http.Request) (*http.Response, error) {
+	// 获取文件大小
+	contentLength := req.ContentLength
+	params := t.handler.encryptionFor(req)
+	t.handler.logger.Debug("[UPLOAD] 文件大小: %d字节, 算法: %s, 块大小: %d", contentLength, params.algorithm, t.handler.chunkSize)
+
+	// 创建加密器
+	enc, err := t.handler.newEncryptor(params, contentLength)
+	if err != nil {
+		t.handler.logger.Error("[UPLOAD] 创建加密器失败，直接转发: %s, 错误: %v", req.URL.Path, err)
+		return t.baseTransport().RoundTrip(req)
+	}
+
+	// 创建管道：读取原始数据 → 加密 → 发送到后端
+	pr, pw := io.Pipe()
+
+	// 加密goroutine在后端开始接收请求体时才启动，带Expect: 100-continue的请求被后端拒绝时不会读取客户端的数据
+	body := &lazyPipeReader{PipeReader: pr}
+	body.start = func() {
+		go t.encryptBody(req, enc, pw)
+	}
+
+	// 超过分片大小的文件拆分为多个后端文件上传
+	if t.handler.splitSize > 0 && contentLength > t.handler.splitSize {
+		return t.handleSplitUpload(req, body, contentLength)
+	}
+
+	// 复制请求，替换请求体
+	newReq := req.Clone(req.Context())
+	newReq.Body = t.handler.throttle(req.Context(), body, true)
+	newReq.ContentLength = contentLength // 加密后大小不变
+
+	// 发送请求到后端
+	resp, err := t.baseTransport().RoundTrip(newReq)
+	if err != nil {
+		if !errors.Is(err, errClientAborted) {
+			t.handler.logger.Error("[UPLOAD] 请求发送失败: %v", err)
+		}
+		return nil, err
+	}
+
+	t.handler.logger.Debug("[UPLOAD] 上传完成，后端响应: %d %s", resp.StatusCode, resp.Status)
+
+	// 覆盖之前分片上传的文件时删除旧的分片
+	if t.handler.splitSize > 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		t.removeSplitParts(req, 1)
+	}
+	return resp, nil
+}
+
+// errClientAborted 客户端在上传完成前断开连接
+var errClientAborted = errors.New("client aborted upload")
+
+// lazyPipeReader 第一次读取时才调用start开始向管道写入数据
+type lazyPipeReader struct {
+	*io.PipeReader
+	once  sync.Once
+	start func()
+}
+
+// Read 实现io.Reader接口
+func (r *lazyPipeReader) Read(p []byte) (int, error) {
+	r.once.Do(r.start)
+	return r.PipeReader.Read(p)
+}
+
+// encryptBody 读取客户端的请求体，加密后写入管道
+func (t *proxyTransport) encryptBody(req *http.Request, enc encryption.Encryptor, pw *io.PipeWriter) {
+	defer pw.Close()
+	defer req.Body.Close()
+
+	// 客户端断开或请求超时时立即关闭管道和请求体，阻塞在读写上的加密goroutine和发往后端的请求随之结束
+	stop := context.AfterFunc(req.Context(), func() {
+		pw.CloseWithError(req.Context().Err())
+		req.Body.Close()
+	})
+	defer stop()
+
+	// 从缓冲区池取出缓冲区，原地加密后写入管道
+	bufp := t.handler.buffers.Get()
+	defer t.handler.buffers.Put(bufp)
+	buf := *bufp
+	processedBytes := int64(0)
+	dump := t.handler.newBodyDump(true, req, 0)
+	defer dump.flush()
+
+	t.handler.logger.Debug("[UPLOAD] 开始加密数据")
+	for {
+		// 从原始请求体读取
+		n, err := req.Body.Read(buf)
+		if n > 0 {
+			processedBytes += int64(n)
+
+			// 原地加密数据，管道的Write在数据被全部读走后才返回，之后可以安全复用缓冲区
+			dump.captureBefore(buf[:n])
+			encryption.EncryptInPlace(enc, buf[:n])
+			dump.captureAfter(buf[:n])
+
+			// 写入管道
+			if _, err := pw.Write(buf[:n]); err != nil {
+				if req.Context().Err() != nil {
+					t.handler.logger.Info("[UPLOAD] 客户端已断开，停止上传: %s, 已处理 %d 字节", req.URL.Path, processedBytes)
+				} else {
+					t.handler.logger.Error("[UPLOAD] 写入管道失败: %v", err)
+				}
+				return
+			}
+
+			// 每10MB记录一次进度
+			if processedBytes%10*1024*1024 == 0 {
+				t.handler.logger.Debug("[UPLOAD] 加密进度: %d字节已处理", processedBytes)
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) || req.Context().Err() != nil {
+				// 客户端在上传完成前断开，让发往后端的请求失败，避免保存不完整的文件
+				t.handler.logger.Info("[UPLOAD] 客户端已断开，停止上传: %s, 已处理 %d 字节", req.URL.Path, processedBytes)
+				pw.CloseWithError(fmt.Errorf("%w: %v", errClientAborted, err))
+			} else if err != io.EOF {
+				t.handler.logger.Error("[UPLOAD] 读取请求体失败: %v", err)
+				// 让发往后端的请求失败，避免保存不完整的文件
+				pw.CloseWithError(err)
+			} else {
+				t.handler.logger.Debug("[UPLOAD] 加密完成，总处理字节数: %d", processedBytes)
+			}
+			return
+		}
+	}
+}
+
+// decryptReader 流式解密读取器
+type decryptReader struct {
+	source     io.ReadCloser
+	encryptor  encryption.Encryptor
+	position   int64
+	startPos   int64 // 解密起始位置
+	endPos     int64 // 解密结束位置（包含），小于0时读到源数据结束
+	debugPrint func(string)
+	dump       *bodyDump // 记录解密前后的内容，为nil时不记录
+}
+
+// Read 实现io.Reader接口，实现流式解密
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	// 如果已经到达结束位置，返回EOF
+	if dr.endPos >= 0 && dr.position > dr.endPos {
+		return 0, io.EOF
+	}
+
+	// 限制读取的数据长度不超过剩余的范围
+	maxRead := len(p)
+	if dr.endPos >= 0 {
+		remaining := dr.endPos - dr.position + 1
+		if remaining < int64(maxRead) {
+			maxRead = int(remaining)
+		}
+	}
+
+	// 从源Reader读取数据
+	n, err := dr.source.Read(p[:maxRead])
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+
+	if n > 0 {
+		// 设置当前解密位置
+		dr.encryptor.SetPosition(dr.position)
+
+		// 原地解密数据
+		dr.dump.captureBefore(p[:n])
+		encryption.DecryptInPlace(dr.encryptor, p[:n])
+		dr.dump.captureAfter(p[:n])
+
+		// 更新位置
+		dr.position += int64(n)
+
+		//dr.debugPrint(fmt.Sprintf("[DOWNLOAD] 流式解密进度: %d字节已处理", dr.position))
+	}
+
+	return n, err
+}
+
+// Close 实现io.ReadCloser接口
+func (dr *decryptReader) Close() error {
+	dr.dump.flush()
+	return dr.source.Close()
+}
+
+// peekUploadSize 读取未知大小的请求体的前minSize字节，全部读完时设置请求的实际大小，
+// 否则把读出的数据放回请求体之前，大小仍为未知
+func (t *proxyTransport) peekUploadSize(req *http.Request) error {
+	head := make([]byte, t.handler.detector.minSize)
+	n, err := io.ReadFull(req.Body, head)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(head[:n]))
+		req.ContentLength = int64(n)
+		req.TransferEncoding = nil
+		return nil
+	case nil:
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), req.Body), req.Body}
+		return nil
+	default:
+		return err
+	}
+}
+
+// handleDownload 处理文件下载（解密）
+func (t *proxyTransport) handleDownload(req *http.Request) (*http.Response, error) {
+	t.handler.logger.Debug("[DOWNLOAD] 开始处理文件下载: %s %s", req.Method, req.URL.Path)
+
+	// 命中不加密规则的文件原样下载
+	if isPlaintext(req) {
+		t.handler.logger.Debug("[DOWNLOAD] 路径不加密，直接转发: %s", req.URL.Path)
+		return t.roundTripWithRetry(req)
+	}
+
+	// 压缩保存的文件根据索引读取需要的数据块
+	if t.handler.compression != "" {
+		if resp, ok, err := t.handleCompressedDownload(req); ok {
+			return resp, err
+		}
+	}
+
+	// 优先使用缓存的解密数据块
+	if t.handler.blockCache != nil && req.Method == http.MethodGet {
+		if resp := t.serveFromCache(req); resp != nil {
+			return resp, nil
+		}
+	}
+
+	// 多个范围时向后端请求覆盖全部范围的单个范围，解密后再拆分为multipart/byteranges
+	multiRange := ""
+	if req.Method == http.MethodGet && strings.Contains(req.Header.Get("Range"), ",") {
+		if covering, ok := coveringRange(req.Header.Get("Range")); ok {
+			multiRange = req.Header.Get("Range")
+			req = req.Clone(req.Context())
+			req.Header.Set("Range", covering)
+			t.handler.logger.Debug("[DOWNLOAD] 多范围请求: %s, 向后端请求: %s", multiRange, covering)
+		}
+	}
+
+	// 先发送请求到后端
+	resp, redirected, err := t.fetchDownload(req)
+	if err != nil {
+		return nil, err
+	}
+	if isRedirect(resp.StatusCode) {
+		// 改写为代理地址的重定向直接返回给客户端
+		return resp, nil
+	}
+
+	// 分片上传的文件由各分片拼接出完整的密文
+	split := false
+	if t.handler.splitSize > 0 {
+		resp, split = t.resolveSplitFile(req, resp)
+	}
+
+	// 确保响应使用原始请求路径
+	resp.Request.URL.Path = req.URL.Path
+
+	// 检查响应状态码，支持200和206（部分内容）
+	if (resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent) || resp.Body == nil {
+		t.handler.logger.Debug("[DOWNLOAD] 非200/206响应或响应体为空，跳过解密: %d %s", resp.StatusCode, resp.Status)
+		return resp, nil
+	}
+
+	// 获取文件大小
+	contentLength := resp.ContentLength
+	var fullFileSize int64 = contentLength
+
+	// 解析原始请求的Range头
+	var requestRange string
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		requestRange = rangeHeader
+	}
+
+	// 检查是否为部分内容响应
+	isPartial := resp.StatusCode == http.StatusPartialContent
+
+	// 解析Content-Range头获取文件大小和范围信息
+	startPos := int64(0)
+	endPos := int64(-1)
+	skip := int64(0) // 响应体开头需要跳过的字节数
+
+	if rangeHeader := resp.Header.Get("Content-Range"); rangeHeader != "" {
+		// 解析Content-Range: bytes 0-999/1000
+		parts := strings.Split(rangeHeader, "/")
+		if len(parts) == 2 {
+			if parts[1] != "*" {
+				if size, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+					fullFileSize = size
+				}
+			}
+
+			// 解析范围部分：bytes start-end
+			rangePart := strings.TrimPrefix(parts[0], "bytes ")
+			rangeParts := strings.Split(rangePart, "-")
+			if len(rangeParts) == 2 {
+				if start, err := strconv.ParseInt(rangeParts[0], 10, 64); err == nil {
+					startPos = start
+				}
+				if end, err := strconv.ParseInt(rangeParts[1], 10, 64); err == nil {
+					endPos = end
+				} else {
+					// 如果end部分解析失败，使用文件末尾
+					endPos = fullFileSize - 1
+				}
+			}
+		}
+	} else if requestRange != "" && req.Header.Get("If-Range") == "" {
+		// 后端忽略了Range头，返回完整文件，需要自己跳过范围之前的数据。
+		// 带If-Range时返回200说明文件已变化，后端有意返回完整文件
+		if start, end, ok := parseSingleRange(requestRange, fullFileSize); ok {
+			startPos, endPos = start, end
+			skip = start
+			isPartial = true // 标记为部分内容响应
+		}
+	}
+
+	// 设置默认endPos
+	if endPos < 0 && fullFileSize > 0 {
+		endPos = fullFileSize - 1
+	}
+
+	// 检查是否为文件（通过大小、Content-Type或Content-Disposition），大小按完整文件计算，与上传时的判断一致
+	contentType := resp.Header.Get("Content-Type")
+	contentDisposition := resp.Header.Get("Content-Disposition")
+
+	if !t.handler.isFileContent(req.URL.Path, contentType, contentDisposition, fullFileSize) {
+		// 不是文件类型，直接返回
+		t.handler.logger.Debug("[DOWNLOAD] 非文件类型，跳过解密: %s, Content-Type: %s", req.URL.Path, contentType)
+		if multiRange != "" && resp.StatusCode == http.StatusPartialContent {
+			t.handler.splitRanges(resp, multiRange, startPos, fullFileSize)
+		}
+		return resp, nil
+	}
+
+	params := t.handler.encryptionFor(req)
+	t.handler.logger.Info("[DOWNLOAD] 文件大小: %d字节, 范围: %d-%d, 算法: %s, 块大小: %d",
+		fullFileSize, startPos, endPos, params.algorithm, t.handler.chunkSize)
+
+	// 创建解密器
+	enc, err := t.handler.newEncryptor(params, fullFileSize)
+	if err != nil {
+		t.handler.logger.Error("[DOWNLOAD] 创建解密器失败，直接返回原始响应: %s, 错误: %v", req.URL.Path, err)
+		return resp, nil
+	}
+
+	// 设置解密起始位置
+	enc.SetPosition(startPos)
+
+	// 后端返回的是完整文件时跳过范围之前的密文
+	if skip > 0 {
+		if _, err := io.CopyN(io.Discard, resp.Body, skip); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
+	// 大文件并发分段从后端下载，加密后文件大小不变，分段拼接后按原位置解密
+	if !redirected && !split && t.useParallelDownload(req, resp, startPos, endPos) {
+		t.handler.logger.Debug("[DOWNLOAD] 启用并行分段下载: %d 个连接 x %d 字节", t.handler.parallelDownload.Connections, t.handler.parallelDownload.SegmentSize)
+		resp.Body = t.newParallelRangeReader(req, resp, startPos, endPos)
+	}
+
+	t.handler.logger.Debug("[DOWNLOAD] 开始流式解密，起始位置: %d", startPos)
+
+	// 替换响应体为流式解密Reader
+	var body io.ReadCloser = &decryptReader{
+		source:     resp.Body,
+		encryptor:  enc,
+		position:   startPos,
+		startPos:   startPos,
+		endPos:     endPos,
+		debugPrint: func(msg string) { t.handler.logger.Debug(msg) },
+		dump:       t.handler.newBodyDump(false, req, startPos),
+	}
+
+	// 解密后的数据同时写入块缓存
+	if t.handler.blockCache != nil && req.Method == http.MethodGet {
+		if version := fileVersion(resp.Header, fullFileSize); version != "" {
+			body = &blockCacheFiller{
+				ReadCloser: body,
+				cache:      t.handler.blockCache,
+				file:       req.URL.String(),
+				version:    version,
+				size:       fullFileSize,
+				pos:        startPos,
+			}
+		}
+	}
+	resp.Body = t.handler.throttle(req.Context(), body, false)
+
+	// 顺序流式读取时提前从后端读取并解密后续数据
+	if readAhead := t.handler.readAhead; readAhead != nil && readAhead.Chunks > 0 && req.Method == http.MethodGet && isSequentialRead(req) {
+		t.handler.logger.Debug("[DOWNLOAD] 启用预读: %d 块 x %d 字节", readAhead.Chunks, readAhead.ChunkSize)
+		resp.Body = newReadAheadReader(resp.Body, readAhead.Chunks, readAhead.ChunkSize)
+	}
+
+	// 设置Accept-Ranges头，表明支持字节范围请求
+	resp.Header.Set("Accept-Ranges", "bytes")
+
+	// 如果是部分内容响应或有起始位置，确保Content-Range头正确
+	if isPartial || startPos > 0 {
+		// 计算当前部分的长度
+		currentLength := endPos - startPos + 1
+
+		// 设置Content-Length为当前部分的长度
+		resp.Header.Set("Content-Length", strconv.FormatInt(currentLength, 10))
+
+		// 设置Content-Range头
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", startPos, endPos, fullFileSize))
+
+		// 如果响应状态码不是206，设置为206
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.StatusCode = http.StatusPartialContent
+			resp.Status = "206 Partial Content"
+		}
+	} else {
+		// 对于完整响应，设置正确的Content-Length
+		resp.Header.Set("Content-Length", strconv.FormatInt(fullFileSize, 10))
+	}
+
+	// 设置缓存控制头
+	t.handler.cacheControl.apply(resp.Header, t.handler.relativePath(req))
+
+	// 把覆盖全部范围的解密结果拆分为客户端请求的多个范围
+	if multiRange != "" && resp.StatusCode == http.StatusPartialContent {
+		t.handler.splitRanges(resp, multiRange, startPos, fullFileSize)
+	}
+
+	t.handler.logger.Debug("[DOWNLOAD] 下载设置完成，准备返回给客户端")
+	return resp, nil
+}
+
+// fetchDownload 从后端读取文件，客户端通过改写后的重定向地址请求时从重定向目标读取。
+// 后端返回重定向时按配置跟随或改写，redirected表示响应来自重定向目标；改写后的重定向以3xx响应返回
+func (t *proxyTransport) fetchDownload(req *http.Request) (*http.Response, bool, error) {
+	// 客户端通过改写后的重定向地址请求时，直接从重定向目标读取
+	target, viaRedirect, err := t.handler.redirectTarget(req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var resp *http.Response
+	if viaRedirect {
+		t.handler.logger.Debug("[DOWNLOAD] 从重定向目标读取: %s", target)
+		resp, err = t.baseTransport().RoundTrip(t.redirectRequest(req, target))
+	} else {
+		resp, err = t.roundTripWithRetry(req)
+	}
+	if err != nil {
+		t.handler.logger.Error("[DOWNLOAD] 请求发送失败: %v", err)
+		return nil, false, err
+	}
+	redirected := viaRedirect
+	if viaRedirect {
+		resp, err = t.followRedirects(req, resp)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// 后端重定向到其他地址（如对象存储的预签名地址）时，跟随重定向或改写为代理地址
+	if isRedirect(resp.StatusCode) {
+		if t.handler.redirect.Mode == RedirectRewrite {
+			target, err := resp.Location()
+			if err != nil || !t.handler.redirectAllowed(target) {
+				resp.Body.Close()
+				return nil, false, fmt.Errorf("redirect target not allowed: %s", resp.Header.Get("Location"))
+			}
+			t.handler.rewriteRedirect(req, resp, target)
+			return resp, false, nil
+		}
+		redirected = true
+		if resp, err = t.followRedirects(req, resp); err != nil {
+			return nil, false, err
+		}
+	}
+	return resp, redirected, nil
+}
+
+// Transport 返回加解密传输层，供其他程序作为http.Client的Transport使用。
+// 请求的URL需要直接指向后端，不经过挂载点和路径转换；发送前会添加后端认证头，
+// PUT、POST的请求体会被加密，GET、HEAD的响应体会被解密，分片存储等处理与代理相同
+func (h *ProxyHandler) Transport() http.RoundTripper {
+	return &clientTransport{handler: h}
+}
+
+// clientTransport 供外部程序使用的传输层，补充director中添加的后端认证
+type clientTransport struct {
+	handler *ProxyHandler
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	t.handler.setBackendAuth(req)
+	t.handler.setUserAgent(req)
+	// 请求直接指向后端，按去掉后端路径前缀后的相对路径匹配不加密规则
+	if t.handler.excludePaths != nil && !isPlaintext(req) {
+		if t.handler.excludePaths.match(t.handler.relativePath(req)) {
+			req = req.WithContext(context.WithValue(req.Context(), plaintextKey{}, true))
+		}
+	}
+	return t.handler.reverseProxy.Transport.RoundTrip(req)
+}
+
+// baseTransport 获取基础传输层
+func (t *proxyTransport) baseTransport() http.RoundTripper {
+	if t.base != nil {
+		return t.base
+	}
+	return http.DefaultTransport
+}
+
+// isHopByHopHeader 检查是否为Hop-by-hop头
+func isHopByHopHeader(header string) bool {
+	hopByHopHeaders := []string{
+		"Connection",
+		"Keep-Alive",
+		"Proxy-Authenticate",
+		"Proxy-Authorization",
+		"TE",
+		"Trailers",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+
+	// 将头名称转换为小写进行比较
+	headerLower := strings.ToLower(header)
+	for _, h := range hopByHopHeaders {
+		if strings.ToLower(h) == headerLower {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 保存的ETag映射数量上限
+const maxETagMappings = 100000
+
+// etagMapper 把后端的ETag确定性地转换为客户端看到的ETag，并保存反向映射，
+// 同一内容在GET、HEAD、PUT和PROPFIND中的ETag保持一致
+type etagMapper struct {
+	mu      sync.Mutex
+	backend map[string]string // 客户端ETag -> 后端ETag
+}
+
+// newETagMapper 创建ETag映射
+func newETagMapper() *etagMapper {
+	return &etagMapper{backend: make(map[string]string)}
+}
+
+// normalizeETag 去掉弱校验标记、引号和分片文件的内部前缀，同一内容的不同写法得到相同的结果
+func normalizeETag(etag string) string {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	etag = strings.Trim(etag, `"`)
+	return strings.TrimPrefix(etag, splitETagPrefix)
+}
+
+// clientETag 返回后端ETag对应的客户端ETag。解密是确定性的，同一密文总是得到同样的明文，因此可以作为强ETag
+func (m *etagMapper) clientETag(backendETag string) string {
+	normalized := normalizeETag(backendETag)
+	if normalized == "" {
+		return backendETag
+	}
+	sum := sha256.Sum256([]byte("webdav-encrypt-etag\x00" + normalized))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.backend[etag]; !ok && len(m.backend) >= maxETagMappings {
+		// 映射过多时随机淘汰，保证内存有上限
+		for k := range m.backend {
+			delete(m.backend, k)
+			if len(m.backend) < maxETagMappings {
+				break
+			}
+		}
+	}
+	m.backend[etag] = `"` + normalized + `"`
+	return etag
+}
+
+// backendETag 返回客户端ETag对应的后端ETag
+func (m *etagMapper) backendETag(clientETag string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	etag, ok := m.backend[strings.TrimPrefix(strings.TrimSpace(clientETag), "W/")]
+	return etag, ok
+}
+
+// getetagPattern 匹配PROPFIND响应中的getetag元素
+var getetagPattern = regexp.MustCompile(`(<(?:[A-Za-z0-9_.-]+:)?getetag(?:\s[^>]*)?>)([^<]*)(</(?:[A-Za-z0-9_.-]+:)?getetag>)`)
+
+// rewriteETags 把响应头和PROPFIND响应中的后端ETag替换为客户端ETag
+func (h *ProxyHandler) rewriteETags(resp *http.Response) error {
+	for _, name := range []string{"ETag", "OC-ETag"} {
+		if etag := resp.Header.Get(name); etag != "" {
+			resp.Header.Set(name, h.etags.clientETag(etag))
+		}
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body = getetagPattern.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := getetagPattern.FindSubmatch(match)
+		etag := html.UnescapeString(string(parts[2]))
+		if strings.TrimSpace(etag) == "" {
+			return match
+		}
+		return []byte(string(parts[1]) + xmlEscape(h.etags.clientETag(etag)) + string(parts[3]))
+	})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
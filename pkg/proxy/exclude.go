@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RegexPathPrefix 路径规则使用正则表达式时的前缀，例如 re:^/public/.*\.mp4$
+const RegexPathPrefix = "re:"
+
+// pathMatcher 按glob或正则表达式规则匹配客户端路径
+type pathMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+// newPathMatcher 编译路径规则，没有规则时返回nil。
+// 以/开头的glob匹配完整路径，否则只匹配文件名；*不跨越目录，**可以匹配任意多级目录
+func newPathMatcher(rules []string) (*pathMatcher, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	m := &pathMatcher{}
+	for _, rule := range rules {
+		var expr string
+		if strings.HasPrefix(rule, RegexPathPrefix) {
+			expr = strings.TrimPrefix(rule, RegexPathPrefix)
+		} else {
+			expr = globToRegexp(rule)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path rule %q: %w", rule, err)
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m, nil
+}
+
+// globToRegexp 把glob规则转换为正则表达式
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		b.WriteString("^")
+	} else {
+		b.WriteString("(?:^|/)")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// match 检查路径是否匹配任意一条规则
+func (m *pathMatcher) match(p string) bool {
+	if m == nil {
+		return false
+	}
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// PathRules 编译后的路径规则，语法与exclude_paths相同，供sync、fetch子命令过滤文件
+type PathRules struct {
+	matcher *pathMatcher
+}
+
+// NewPathRules 编译路径规则，没有规则时返回的PathRules不匹配任何路径
+func NewPathRules(rules []string) (*PathRules, error) {
+	matcher, err := newPathMatcher(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &PathRules{matcher: matcher}, nil
+}
+
+// Match 检查以/开头的路径是否匹配任意一条规则
+func (r *PathRules) Match(p string) bool {
+	return r != nil && r.matcher.match(p)
+}
+
+// Empty 检查是否没有任何规则
+func (r *PathRules) Empty() bool {
+	return r == nil || r.matcher == nil
+}
+
+// plaintextKey 请求上下文中标记不加密路径的键
+type plaintextKey struct{}
+
+// isPlaintext 检查请求是否命中了不加密规则
+func isPlaintext(r *http.Request) bool {
+	plaintext, _ := r.Context().Value(plaintextKey{}).(bool)
+	return plaintext
+}
+
+// markPlaintext 客户端路径命中不加密规则时在请求上下文中做标记，传输层据此直接转发内容。
+// 路径按挂载点内的相对路径匹配，与后端路径无关
+func (h *ProxyHandler) markPlaintext(r *http.Request) *http.Request {
+	if h.excludePaths == nil {
+		return r
+	}
+	p := strings.TrimPrefix(r.URL.Path, mountPrefix(r))
+	if p == "" {
+		p = "/"
+	}
+	if !h.excludePaths.match(p) {
+		return r
+	}
+	h.logger.Debug("[EXCLUDE] 路径不加密: %s %s", r.Method, r.URL.Path)
+	return r.WithContext(context.WithValue(r.Context(), plaintextKey{}, true))
+}
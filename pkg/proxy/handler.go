@@ -0,0 +1,982 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"webdav-proxy/pkg/encryption"
+	"webdav-proxy/utils"
+)
+
+// BackendAuthConfig 后端认证配置
+type BackendAuthConfig struct {
+	Username    string
+	Password    string
+	Passthrough bool // 转发客户端的Authorization头，而不是使用固定的后端账号
+}
+
+// ProxyAuthConfig 代理端认证配置
+type ProxyAuthConfig struct {
+	Enabled  bool
+	Username string
+	Password string
+	Tokens   []string          // Bearer令牌或API Key列表
+	Users    map[string]string // 多租户用户的登录名和密码
+	OIDC     *OIDCConfig       // OIDC/JWT令牌认证配置，为nil时不启用
+	Share    *ShareConfig      // 分享链接配置，为nil时不接受分享链接
+
+	// 认证失败封禁配置，MaxFailures<=0时不启用
+	MaxFailures   int           // 窗口内允许的最大失败次数
+	FailureWindow time.Duration // 失败计数窗口
+	BanDuration   time.Duration // 封禁时长
+}
+
+// BandwidthConfig 传输带宽限制配置，单位字节/秒，0表示不限制
+type BandwidthConfig struct {
+	UploadRate   int64 // 所有上传共享的带宽上限
+	DownloadRate int64 // 所有下载共享的带宽上限
+	TransferRate int64 // 单个传输的带宽上限
+}
+
+// TransferLimitConfig 并发传输限制配置
+type TransferLimitConfig struct {
+	MaxConcurrent int           // 同时进行的GET/PUT传输上限，0表示不限制
+	QueueTimeout  time.Duration // 超出上限时的排队等待时间，0表示直接拒绝
+}
+
+// MethodTimeoutConfig 按请求方法区分的超时配置，0表示不限制
+type MethodTimeoutConfig struct {
+	Metadata  time.Duration            // PROPFIND、MKCOL等元数据请求的超时时间
+	Data      time.Duration            // GET、PUT、POST等数据传输请求的超时时间
+	PerMethod map[string]time.Duration // 单独指定某些方法的超时时间，优先级最高
+}
+
+// DNS缓存条目
+type dnsCacheEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+// ProxyHandler WebDAV代理处理器
+type ProxyHandler struct {
+	backend     *url.URL
+	backends    []*url.URL // 所有等价后端，第一个为主后端
+	loadBalance string
+	roundRobin  atomic.Uint64
+	password    string
+	algorithm   string
+	chunkSize   int
+	backendAuth *BackendAuthConfig
+	proxyAuth   *ProxyAuthConfig
+	logger      utils.Logger
+
+	// 备用后端，所有主后端不可用时切换
+	fallback       *url.URL
+	fallbackWrites string
+
+	// 性能配置
+	timeout               time.Duration
+	maxIdleConns          int
+	maxIdleConnsPerHost   int
+	idleConnTimeout       time.Duration
+	expectContinueTimeout time.Duration
+
+	// DNS配置
+	dnsServers []string
+
+	// 允许转发的方法，为空时允许所有支持的WebDAV方法
+	allowedMethods map[string]bool
+
+	// 带宽限制
+	uploadBucket   *tokenBucket
+	downloadBucket *tokenBucket
+	transferRate   int64
+
+	// 并发传输限制
+	transferSlots        chan struct{}
+	transferQueueTimeout time.Duration
+
+	// 按方法区分的请求超时
+	methodTimeouts *MethodTimeoutConfig
+
+	// 后端请求重试
+	retry *RetryConfig
+
+	// 解密数据块缓存，可以在多个处理器之间共享
+	blockCache *BlockCache
+
+	// 顺序下载预读
+	readAhead *ReadAheadConfig
+
+	// 大文件并行分段下载
+	parallelDownload *ParallelDownloadConfig
+
+	// 超过该大小的上传拆分为多个后端文件，0表示不拆分
+	splitSize int64
+
+	// 由代理合并Nextcloud/ownCloud分块上传
+	ncChunking bool
+
+	// OC-Checksum处理方式
+	ocChecksum string
+
+	// 稳定ETag映射，为nil时原样返回后端的ETag
+	etags *etagMapper
+
+	// 回收站配置，为nil时DELETE直接删除
+	trash *TrashConfig
+
+	// 历史版本配置，为nil时覆盖上传不保留旧版本
+	versions *VersionConfig
+
+	// 不加密的路径规则，命中的文件原样上传和下载
+	excludePaths *pathMatcher
+
+	// 加解密所有非集合路径的内容，不再根据Content-Type和扩展名判断
+	encryptAll bool
+
+	// 判断内容是否为文件的规则
+	detector *fileDetector
+
+	// 按路径前缀指定的加密算法和密码
+	encryptionRules encryptionRules
+
+	// 加密前的压缩算法，为空时不压缩
+	compression     string
+	compressIndexes *compressIndexCache
+
+	// 后端返回通用类型时恢复解密后文件的Content-Type
+	restoreTypes bool
+
+	// 下载时后端重定向的处理规则
+	redirect *RedirectConfig
+
+	// 解密后的文件的缓存策略
+	cacheControl *cacheControl
+
+	// 修改请求头和响应头的规则
+	headerRules *HeaderRulesConfig
+
+	// 发往后端的请求使用的User-Agent，为空时保留客户端的User-Agent
+	userAgent string
+
+	// TRACE级别日志中记录的上传下载内容字节数，0表示不记录
+	traceBodyBytes int
+
+	// PROPFIND响应缓存
+	propfindCache *propfindCache
+
+	// DNS缓存
+	dnsCache sync.Map
+
+	// DNS缓存TTL
+	dnsCacheTTL time.Duration
+
+	// 反向代理
+	reverseProxy *httputil.ReverseProxy
+
+	// 基础传输层（不含加解密）
+	transport *http.Transport
+
+	// 后端健康检查，与backends一一对应
+	healthCheckers  []*healthChecker
+	fallbackChecker *healthChecker
+
+	// 加解密数据块缓冲区池，大小为chunkSize
+	buffers *bufferPool
+
+	// 派生密钥缓存，每个请求用缓存的密钥创建加密器
+	keys *keyCache
+
+	// 关闭时停止后台清理和健康检查
+	stopCleanupChan chan struct{}
+}
+
+// Options 创建代理处理器的参数。除Backend外都可以省略，零值表示使用默认值或不启用对应功能，
+// 新功能只会增加字段，不会影响已有的调用方
+type Options struct {
+	Backend     *url.URL           // 后端WebDAV地址，必填
+	Password    string             // 加密密码
+	Algorithm   string             // 加密算法，默认aesctr
+	ChunkSize   int                // 加解密块大小，默认8192
+	BackendAuth *BackendAuthConfig // 后端认证
+	ProxyAuth   *ProxyAuthConfig   // 代理端认证，处理器据此去掉后端的WWW-Authenticate头
+	Logger      utils.Logger       // 日志器，默认输出INFO及以上级别
+
+	Timeout               time.Duration // 等待后端响应头的超时时间，0表示不限制
+	MaxIdleConns          int           // 最大空闲连接数，默认100
+	MaxIdleConnsPerHost   int           // 每个主机的最大空闲连接数，默认10
+	IdleConnTimeout       time.Duration // 空闲连接超时时间，默认90s
+	ExpectContinueTimeout time.Duration // 带Expect: 100-continue的上传等待后端响应的时间，超时后开始发送请求体，默认500ms
+	DNSServers            []string      // 公共DNS服务器，为空时使用系统DNS
+
+	AllowedMethods   []string                // 允许转发的方法，为空时允许所有WebDAV方法
+	Bandwidth        *BandwidthConfig        // 传输带宽限制
+	TransferLimit    *TransferLimitConfig    // 并发传输限制
+	MethodTimeouts   *MethodTimeoutConfig    // 按方法区分的请求超时
+	Retry            *RetryConfig            // 后端请求重试
+	HealthCheck      *HealthCheckConfig      // 后端健康检查
+	LoadBalance      *LoadBalanceConfig      // 多后端负载均衡和备用后端
+	BlockCache       *BlockCache             // 解密数据块缓存，可以在多个处理器之间共享
+	ReadAhead        *ReadAheadConfig        // 顺序下载预读
+	PropfindCacheTTL time.Duration           // PROPFIND响应缓存时间，0表示不缓存
+	ParallelDownload *ParallelDownloadConfig // 大文件并行分段下载
+	KeyCache         *KeyCacheConfig         // 派生密钥缓存的容量和有效期，为nil时使用默认值
+
+	SplitSize          int64                // 超过该大小的上传拆分为多个后端文件，0表示不拆分
+	NextcloudChunking  bool                 // 由代理合并Nextcloud/ownCloud分块上传
+	OCChecksum         string               // OC-Checksum处理方式
+	StableETags        bool                 // 返回与加密参数无关的稳定ETag
+	Trash              *TrashConfig         // 回收站，为nil时DELETE直接删除
+	Versions           *VersionConfig       // 历史版本，为nil时覆盖上传不保留旧版本
+	ExcludePaths       []string             // 不加密的路径规则，支持glob和re:前缀的正则表达式
+	EncryptAll         bool                 // 加解密所有非集合路径的内容，不再根据Content-Type和扩展名判断
+	FileDetection      *FileDetectionConfig // 判断内容是否为文件的规则，为nil时使用内置列表
+	EncryptionRules    []EncryptionRule     // 按路径前缀指定加密算法和密码，未匹配的路径使用Algorithm和Password
+	Compression        string               // 加密前的压缩算法，目前支持gzip，为空时不压缩
+	RestoreContentType bool                 // 后端返回application/octet-stream等通用类型时，按扩展名或解密后的内容恢复Content-Type
+	Redirect           *RedirectConfig      // 下载时后端重定向的处理规则，为nil时跟随所有重定向
+	CacheControl       *CacheControlConfig  // 解密后的文件的缓存策略，为nil时使用DefaultCacheControl禁止缓存
+	HeaderRules        *HeaderRulesConfig   // 修改发往后端的请求头和后端响应头的规则，为nil时不修改
+	TraceBodyBytes     int                  // 在TRACE级别日志中记录每个上传下载加解密前后开头的字节数，0表示不记录，最多64KiB
+	BackendUserAgent   string               // 替换发往后端的请求的User-Agent，可以使用windows、finder、davfs2、rclone、cyberduck、winscp等预设名称，为空时保留客户端的User-Agent
+}
+
+// setDefaults 为省略的参数填充默认值
+func (o *Options) setDefaults() {
+	if o.Algorithm == "" {
+		o.Algorithm = "aesctr"
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = 8192
+	}
+	if o.Logger == nil {
+		o.Logger = utils.NewDefaultLogger(false)
+	}
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = 100
+	}
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = 10
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = 90 * time.Second
+	}
+	if o.ExpectContinueTimeout <= 0 {
+		o.ExpectContinueTimeout = 500 * time.Millisecond
+	}
+	if o.Redirect == nil {
+		o.Redirect = &RedirectConfig{}
+	}
+	o.Redirect.setDefaults()
+}
+
+// NewProxyHandler 创建新的代理处理器
+//
+// Deprecated: 参数过多且每增加一个功能都会改变签名，请使用New。
+func NewProxyHandler(backend *url.URL, password, algorithm string, chunkSize int,
+	backendAuth *BackendAuthConfig, proxyAuth *ProxyAuthConfig, logger utils.Logger,
+	timeout time.Duration, maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration,
+	dnsServers []string, allowedMethods []string, bandwidth *BandwidthConfig,
+	transferLimit *TransferLimitConfig, methodTimeouts *MethodTimeoutConfig,
+	retry *RetryConfig, healthCheck *HealthCheckConfig, loadBalance *LoadBalanceConfig,
+	blockCache *BlockCache, readAhead *ReadAheadConfig, propfindCacheTTL time.Duration,
+	parallelDownload *ParallelDownloadConfig, splitSize int64, ncChunking bool,
+	ocChecksum string, stableETags bool, trash *TrashConfig, versions *VersionConfig) (*ProxyHandler, error) {
+	return New(Options{
+		Backend:             backend,
+		Password:            password,
+		Algorithm:           algorithm,
+		ChunkSize:           chunkSize,
+		BackendAuth:         backendAuth,
+		ProxyAuth:           proxyAuth,
+		Logger:              logger,
+		Timeout:             timeout,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		DNSServers:          dnsServers,
+		AllowedMethods:      allowedMethods,
+		Bandwidth:           bandwidth,
+		TransferLimit:       transferLimit,
+		MethodTimeouts:      methodTimeouts,
+		Retry:               retry,
+		HealthCheck:         healthCheck,
+		LoadBalance:         loadBalance,
+		BlockCache:          blockCache,
+		ReadAhead:           readAhead,
+		PropfindCacheTTL:    propfindCacheTTL,
+		ParallelDownload:    parallelDownload,
+		SplitSize:           splitSize,
+		NextcloudChunking:   ncChunking,
+		OCChecksum:          ocChecksum,
+		StableETags:         stableETags,
+		Trash:               trash,
+		Versions:            versions,
+	})
+}
+
+// New 按参数创建代理处理器，省略的参数使用默认值
+func New(opts Options) (*ProxyHandler, error) {
+	if opts.Backend == nil {
+		return nil, fmt.Errorf("backend URL is required")
+	}
+	opts.setDefaults()
+
+	excludePaths, err := newPathMatcher(opts.ExcludePaths)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := newEncryptionRules(opts.EncryptionRules, opts.Algorithm, opts.Password)
+	if err != nil {
+		return nil, err
+	}
+	switch opts.Compression {
+	case "", CompressGzip:
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s, supported: [%s]", opts.Compression, CompressGzip)
+	}
+	if opts.Compression != "" && opts.SplitSize > 0 {
+		return nil, fmt.Errorf("compression cannot be combined with split uploads")
+	}
+	if opts.Redirect.Mode != RedirectFollow && opts.Redirect.Mode != RedirectRewrite {
+		return nil, fmt.Errorf("unsupported redirect mode: %s, supported: [%s %s]", opts.Redirect.Mode, RedirectFollow, RedirectRewrite)
+	}
+	cacheControl, err := newCacheControl(opts.CacheControl)
+	if err != nil {
+		return nil, err
+	}
+	if opts.HeaderRules != nil {
+		if err := opts.HeaderRules.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	h := &ProxyHandler{
+		backend:               opts.Backend,
+		password:              opts.Password,
+		algorithm:             opts.Algorithm,
+		chunkSize:             opts.ChunkSize,
+		backendAuth:           opts.BackendAuth,
+		proxyAuth:             opts.ProxyAuth,
+		logger:                opts.Logger,
+		timeout:               opts.Timeout,
+		maxIdleConns:          opts.MaxIdleConns,
+		maxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		idleConnTimeout:       opts.IdleConnTimeout,
+		expectContinueTimeout: opts.ExpectContinueTimeout,
+		dnsServers:            opts.DNSServers,
+		methodTimeouts:        opts.MethodTimeouts,
+		retry:                 opts.Retry,
+		blockCache:            opts.BlockCache,
+		readAhead:             opts.ReadAhead,
+		parallelDownload:      opts.ParallelDownload,
+		splitSize:             opts.SplitSize,
+		ncChunking:            opts.NextcloudChunking,
+		ocChecksum:            opts.OCChecksum,
+		trash:                 opts.Trash,
+		versions:              opts.Versions,
+		excludePaths:          excludePaths,
+		encryptAll:            opts.EncryptAll,
+		detector:              newFileDetector(opts.FileDetection),
+		encryptionRules:       rules,
+		compression:           opts.Compression,
+		compressIndexes:       &compressIndexCache{entries: make(map[string]*compressIndex)},
+		restoreTypes:          opts.RestoreContentType,
+		redirect:              opts.Redirect,
+		cacheControl:          cacheControl,
+		headerRules:           opts.HeaderRules,
+		userAgent:             resolveUserAgent(opts.BackendUserAgent),
+		traceBodyBytes:        min(opts.TraceBodyBytes, maxTraceBodyBytes),
+		propfindCache:         newPropfindCache(opts.PropfindCacheTTL),
+		buffers:               newBufferPool(opts.ChunkSize),
+		keys:                  newKeyCache(opts.KeyCache),
+		backends:              []*url.URL{opts.Backend},
+		stopCleanupChan:       make(chan struct{}),
+		dnsCacheTTL:           5 * time.Minute, // DNS缓存5分钟
+	}
+
+	if loadBalance := opts.LoadBalance; loadBalance != nil {
+		h.backends = append(h.backends, loadBalance.Replicas...)
+		h.loadBalance = loadBalance.Strategy
+		h.fallback = loadBalance.Fallback
+		h.fallbackWrites = loadBalance.FallbackWrites
+	}
+
+	if len(opts.AllowedMethods) > 0 {
+		h.allowedMethods = make(map[string]bool, len(opts.AllowedMethods))
+		for _, method := range opts.AllowedMethods {
+			h.allowedMethods[strings.ToUpper(method)] = true
+		}
+	}
+
+	if bandwidth := opts.Bandwidth; bandwidth != nil {
+		if bandwidth.UploadRate > 0 {
+			h.uploadBucket = newTokenBucket(float64(bandwidth.UploadRate), throttleChunkSize)
+		}
+		if bandwidth.DownloadRate > 0 {
+			h.downloadBucket = newTokenBucket(float64(bandwidth.DownloadRate), throttleChunkSize)
+		}
+		h.transferRate = bandwidth.TransferRate
+	}
+
+	if opts.ReadAhead != nil && opts.ReadAhead.ChunkSize <= 0 {
+		opts.ReadAhead.ChunkSize = 256 * 1024
+	}
+
+	if opts.StableETags {
+		h.etags = newETagMapper()
+	}
+
+	if opts.ParallelDownload != nil && opts.ParallelDownload.SegmentSize <= 0 {
+		opts.ParallelDownload.SegmentSize = 8 << 20
+	}
+
+	if transferLimit := opts.TransferLimit; transferLimit != nil && transferLimit.MaxConcurrent > 0 {
+		h.transferSlots = make(chan struct{}, transferLimit.MaxConcurrent)
+		h.transferQueueTimeout = transferLimit.QueueTimeout
+	}
+
+	// 创建传输层
+	transport := h.createTransport()
+
+	// 创建反向代理
+	h.reverseProxy = &httputil.ReverseProxy{
+		Director:       h.director,
+		ModifyResponse: h.modifyResponse,
+		ErrorHandler:   h.errorHandler,
+		Transport:      transport,
+	}
+
+	// 预先派生密钥，并启动派生密钥缓存清理协程
+	h.warmKeys()
+	go h.keys.run(h.stopCleanupChan)
+
+	// 启动后端健康检查
+	h.startHealthCheck(opts.HealthCheck)
+
+	// 启动回收站定期清除
+	h.startTrashPurge()
+
+	return h, nil
+}
+
+// ServeHTTP 处理所有HTTP请求
+func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 记录详细请求信息
+	h.logger.Debug("[REQUEST] 收到请求: %s %s", r.Method, r.URL.Path)
+	h.logger.Debug("[REQUEST] 客户端地址: %s", r.RemoteAddr)
+	h.logger.Debug("[REQUEST] 请求头: %v", r.Header)
+
+	// 标记不加密的路径，后续的内部请求和传输层都会沿用该标记
+	r = h.markPlaintext(r)
+	r = h.withClientHost(r)
+
+	// 检查方法是否在允许列表中，OPTIONS用于客户端发现服务器能力，总是允许
+	if h.allowedMethods != nil && !h.allowedMethods[r.Method] && r.Method != http.MethodOptions {
+		h.logger.Info("[REQUEST] 方法未被允许: %s %s", r.Method, r.URL.Path)
+		w.Header().Set("Allow", h.allowHeader())
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 目标地址在其他挂载点时后端无法完成复制或移动
+	if destination := r.Header.Get("Destination"); destination != "" && !inMount(destination, mountPrefix(r)) {
+		h.logger.Info("[REQUEST] 目标地址不在同一挂载点: %s %s -> %s", r.Method, r.URL.Path, destination)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	// 处理WebDAV特殊方法
+	switch r.Method {
+	case http.MethodOptions:
+		// DAV能力由代理根据配置声明，而不是直接透传后端的响应
+		h.serveOptions(w, r)
+	case "GET", "HEAD", "POST", "PUT", "DELETE",
+		"PROPFIND", "PROPPATCH", "MKCOL", "COPY",
+		"MOVE", "LOCK", "UNLOCK":
+		// 主后端故障期间默认拒绝写请求，避免备用后端与主后端数据不一致
+		if isWriteMethod(r.Method) && h.fallbackWrites != FailoverWritesFallback && h.failedOver() {
+			h.logger.Warn("[FAILOVER] 主后端不可用，拒绝写请求: %s %s", r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		// 限制同时进行的文件传输数量
+		if r.Method == http.MethodGet || r.Method == http.MethodPut {
+			if !h.acquireTransfer(r) {
+				h.logger.Warn("[REQUEST] 并发传输已满，拒绝请求: %s %s", r.Method, r.URL.Path)
+				w.Header().Set("Retry-After", "5")
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			defer h.releaseTransfer()
+		}
+		// 设置请求超时，反向代理返回时响应体已经传输完毕，可以安全地取消上下文
+		// 分块上传的合并需要传输整个文件，按数据传输请求计算超时
+		timeoutMethod := r.Method
+		if h.isChunkAssembly(r) {
+			timeoutMethod = http.MethodPut
+		}
+		if timeout := h.requestTimeout(timeoutMethod); timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+			h.logger.Debug("[REQUEST] 设置请求超时: %v", timeout)
+		}
+		// PROPFIND优先使用缓存
+		if h.propfindCache != nil && r.Method == "PROPFIND" {
+			h.servePropfind(w, r)
+			return
+		}
+		// 直接使用反向代理处理请求
+		if h.isVersionRequest(r) {
+			h.serveVersions(w, r)
+			return
+		}
+		if h.shouldVersion(r) {
+			h.versionBeforeUpload(r)
+		}
+		if h.isChunkAssembly(r) {
+			h.assembleChunks(w, r)
+		} else if h.shouldTrash(r) {
+			h.moveToTrash(w, r)
+		} else {
+			h.reverseProxy.ServeHTTP(w, r)
+		}
+		// 写操作完成后使相关目录列表缓存失效
+		if h.propfindCache != nil && isWriteMethod(r.Method) {
+			h.propfindCache.invalidate(writeTargets(r)...)
+		}
+	default:
+		h.logger.Debug("[REQUEST] 不支持的请求方法: %s", r.Method)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// requestTimeout 获取请求方法对应的超时时间，0表示不限制
+func (h *ProxyHandler) requestTimeout(method string) time.Duration {
+	if h.methodTimeouts == nil {
+		return 0
+	}
+	if timeout, ok := h.methodTimeouts.PerMethod[method]; ok {
+		return timeout
+	}
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodPost:
+		return h.methodTimeouts.Data
+	default:
+		return h.methodTimeouts.Metadata
+	}
+}
+
+// acquireTransfer 获取传输名额，超出上限时排队等待，超时或请求取消时返回false
+func (h *ProxyHandler) acquireTransfer(r *http.Request) bool {
+	if h.transferSlots == nil {
+		return true
+	}
+
+	select {
+	case h.transferSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if h.transferQueueTimeout <= 0 {
+		return false
+	}
+
+	h.logger.Debug("[REQUEST] 并发传输已满，排队等待: %s %s", r.Method, r.URL.Path)
+	timer := time.NewTimer(h.transferQueueTimeout)
+	defer timer.Stop()
+	select {
+	case h.transferSlots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// releaseTransfer 释放传输名额
+func (h *ProxyHandler) releaseTransfer() {
+	if h.transferSlots != nil {
+		<-h.transferSlots
+	}
+}
+
+// throttle 为上传或下载的数据流添加带宽限制，未配置限制时原样返回
+func (h *ProxyHandler) throttle(ctx context.Context, body io.ReadCloser, upload bool) io.ReadCloser {
+	var buckets []*tokenBucket
+	if upload && h.uploadBucket != nil {
+		buckets = append(buckets, h.uploadBucket)
+	}
+	if !upload && h.downloadBucket != nil {
+		buckets = append(buckets, h.downloadBucket)
+	}
+	if h.transferRate > 0 {
+		buckets = append(buckets, newTokenBucket(float64(h.transferRate), throttleChunkSize))
+	}
+	if len(buckets) == 0 {
+		return body
+	}
+	return &throttledReader{ReadCloser: body, ctx: ctx, buckets: buckets}
+}
+
+// allowHeader 生成Allow响应头的值
+func (h *ProxyHandler) allowHeader() string {
+	methods := make([]string, 0, len(h.allowedMethods))
+	for method := range h.allowedMethods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// getLogger 实现loggerProvider接口
+func (h *ProxyHandler) getLogger() utils.Logger {
+	return h.logger
+}
+
+// modifyResponse 修改后端响应
+func (h *ProxyHandler) modifyResponse(resp *http.Response) error {
+	// 按配置的规则修改后端响应头，在改写Location、ETag等响应头之前应用
+	if h.headerRules != nil {
+		applyHeaderRules(resp.Header, h.headerRules.Response, resp.Request)
+	}
+
+	// 移除后端认证相关的响应头，避免泄露信息；透传认证时客户端需要根据该头发送凭据
+	if h.backendAuth == nil || !h.backendAuth.Passthrough {
+		resp.Header.Del("WWW-Authenticate")
+	}
+
+	// 指向后端的Location（如COPY、MOVE、MKCOL的201响应）转换为客户端路径
+	for _, name := range []string{"Location", "Content-Location"} {
+		if location := resp.Header.Get(name); location != "" {
+			resp.Header.Set(name, h.locationToClient(location, mountPrefix(resp.Request)))
+		}
+	}
+
+	// 获取响应路径，处理302重定向的情况
+	respPath := resp.Request.URL.Path
+
+	// 检查是否是重定向后的请求（URL与后端地址不同）
+	if !h.isBackendHost(resp.Request.URL.Host) {
+		// 如果是重定向请求，尝试从原始请求上下文中获取原始路径
+		// 我们可以检查是否有自定义头或上下文字段
+		// 这里我们使用一个简单的方法：如果路径不包含后端路径前缀，就显示为原始请求路径
+		if !strings.HasPrefix(respPath, h.backend.Path) {
+			// 这是一个重定向请求，显示为原始请求路径
+			// 由于无法直接获取原始请求，我们使用日志标记
+			respPath = "[REDIRECT] " + respPath
+		}
+	}
+
+	h.logger.Debug("[RESPONSE] %s %d", respPath, resp.StatusCode)
+
+	// 隐藏分片文件并显示原文件的大小
+	if h.splitSize > 0 && resp.StatusCode == http.StatusMultiStatus {
+		if err := h.rewriteSplitListing(resp); err != nil {
+			return err
+		}
+	}
+
+	// 隐藏压缩索引文件并显示原文件的大小
+	if h.compression != "" && resp.StatusCode == http.StatusMultiStatus {
+		if err := h.rewriteCompressedListing(resp); err != nil {
+			return err
+		}
+	}
+
+	// 后端的校验和是按密文计算的，不能交给客户端校验解密后的内容
+	if h.ocChecksum != OCChecksumPassthrough {
+		if err := h.stripChecksums(resp); err != nil {
+			return err
+		}
+	}
+
+	// 客户端看到的ETag与明文内容对应，在各种请求中保持一致
+	if h.etags != nil {
+		if err := h.rewriteETags(resp); err != nil {
+			return err
+		}
+	}
+
+	// 虚拟挂载点下的PROPFIND响应需要把后端路径替换为挂载点路径
+	if prefix := mountPrefix(resp.Request); prefix != "" && resp.StatusCode == http.StatusMultiStatus {
+		return h.rewriteMountHrefs(resp, prefix)
+	}
+	return nil
+}
+
+// errorHandler 错误处理器
+func (h *ProxyHandler) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	// 客户端已经断开，发往后端的请求已随之取消，不需要再返回响应
+	if errors.Is(err, errClientAborted) || (errors.Is(err, context.Canceled) && r.Context().Err() != nil) {
+		h.logger.Info("[REQUEST] 客户端断开连接，已取消后端请求: %s %s", r.Method, r.URL.Path)
+		return
+	}
+
+	h.logger.Error("[ERROR] %s %s: %v", r.Method, r.URL.Path, err)
+
+	// 上传内容与客户端的校验和不一致
+	if errors.Is(err, errChecksumMismatch) {
+		http.Error(w, "OC-Checksum mismatch", http.StatusBadRequest)
+		return
+	}
+
+	// 上传的数据超出了用户的剩余配额
+	if errors.Is(err, errQuotaExceeded) {
+		http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+		return
+	}
+
+	// 改写后的重定向地址签名无效
+	if errors.Is(err, errRedirectSignature) {
+		http.Error(w, "Invalid redirect signature", http.StatusForbidden)
+		return
+	}
+
+	// 如果后端认证失败，返回更友好的错误信息
+	if strings.Contains(err.Error(), "401") {
+		http.Error(w, "Backend authentication failed", http.StatusBadGateway)
+		return
+	}
+
+	http.Error(w, "Gateway error", http.StatusBadGateway)
+}
+
+// createTransport 创建自定义传输层
+func (h *ProxyHandler) createTransport() http.RoundTripper {
+	// 创建基础传输层
+	transport := &http.Transport{
+		// 连接池配置
+		MaxIdleConns:          h.maxIdleConns,
+		MaxIdleConnsPerHost:   h.maxIdleConnsPerHost,
+		IdleConnTimeout:       h.idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: h.timeout,
+		ExpectContinueTimeout: h.expectContinueTimeout, // 等待后端对Expect: 100-continue的响应，后端拒绝时客户端不必发送请求体
+		// 使用自定义DNS解析的DialContext
+		DialContext: h.dialWithCustomDNS,
+		// 启用HTTP/2支持
+		ForceAttemptHTTP2: true,
+		// 禁用压缩（加密数据压缩效果差，反而消耗CPU）
+		DisableCompression: true,
+		// 增加TLS会话缓存大小
+		TLSClientConfig: &tls.Config{
+			SessionTicketsDisabled: false,
+			MinVersion:             tls.VersionTLS12,
+			MaxVersion:             tls.VersionTLS13,
+			Renegotiation:          tls.RenegotiateFreelyAsClient,
+			ClientSessionCache:     tls.NewLRUClientSessionCache(1000),
+		},
+	}
+
+	h.transport = transport
+
+	// 返回我们的加密传输层
+	return &proxyTransport{
+		handler: h,
+		base:    transport,
+	}
+}
+
+// baseRoundTripper 获取不含加解密的基础传输层
+func (h *ProxyHandler) baseRoundTripper() http.RoundTripper {
+	if h.transport != nil {
+		return h.transport
+	}
+	return http.DefaultTransport
+}
+
+// 使用自定义DNS解析的DialContext函数
+func (h *ProxyHandler) dialWithCustomDNS(ctx context.Context, network, addr string) (net.Conn, error) {
+	// 解析地址，获取主机名和端口
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用自定义DNS服务器解析域名
+	ips, err := h.resolveWithCustomDNS(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// 尝试连接解析得到的IP地址
+	var conn net.Conn
+	for _, ip := range ips {
+		// 构建IP地址:端口
+		ipAddr := net.JoinHostPort(ip, port)
+		// 创建连接
+		conn, err = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: false, // 禁用IPv6
+		}).DialContext(ctx, network, ipAddr)
+		if err == nil {
+			break
+		}
+	}
+
+	return conn, err
+}
+
+// 使用自定义DNS服务器解析域名
+func (h *ProxyHandler) resolveWithCustomDNS(ctx context.Context, host string) ([]string, error) {
+	// 如果是IP地址，直接返回
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	// 检查DNS缓存
+	if cached, ok := h.dnsCache.Load(host); ok {
+		entry := cached.(dnsCacheEntry)
+		if time.Now().Before(entry.expires) {
+			return entry.ips, nil
+		}
+		// 缓存过期，删除它
+		h.dnsCache.Delete(host)
+	}
+
+	// 使用配置的DNS服务器进行解析
+	var ips []string
+	var err error
+
+	for _, dnsServer := range h.dnsServers {
+		ips, err = h.queryDNS(ctx, host, dnsServer)
+		if err == nil && len(ips) > 0 {
+			// 缓存解析结果
+			h.dnsCache.Store(host, dnsCacheEntry{
+				ips:     ips,
+				expires: time.Now().Add(h.dnsCacheTTL),
+			})
+			return ips, nil
+		}
+	}
+
+	// 如果没有配置DNS服务器或所有DNS服务器都失败，使用系统默认解析
+	if len(h.dnsServers) == 0 {
+		addrs, err := net.LookupHost(host)
+		if err == nil && len(addrs) > 0 {
+			// 缓存解析结果
+			h.dnsCache.Store(host, dnsCacheEntry{
+				ips:     addrs,
+				expires: time.Now().Add(h.dnsCacheTTL),
+			})
+			return addrs, nil
+		}
+	}
+
+	// 如果所有解析都失败，返回最后一个错误
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("failed to resolve domain %s", host)
+}
+
+// 查询DNS服务器
+func (h *ProxyHandler) queryDNS(ctx context.Context, host, dnsServer string) ([]string, error) {
+	// 建立UDP连接到DNS服务器
+	conn, err := net.DialTimeout("udp", dnsServer, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// 创建DNS查询消息
+	var msg dnsmessage.Message
+	msg.Header.ID = uint16(time.Now().UnixNano() % 65536)
+	msg.Header.RecursionDesired = true
+
+	// 添加查询
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, err
+	}
+	msg.Questions = append(msg.Questions, dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	})
+
+	// 序列化查询消息
+	buf, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// 设置连接超时
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 发送查询
+	_, err = conn.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// 接收响应
+	response := make([]byte, 512)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析响应
+	var respMsg dnsmessage.Message
+	err = respMsg.Unpack(response[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	// 提取A记录
+	var ips []string
+	for _, answer := range respMsg.Answers {
+		if answer.Header.Type == dnsmessage.TypeA {
+			// 使用类型断言来获取A记录
+			if aRecord, ok := answer.Body.(*dnsmessage.AResource); ok {
+				// 将[4]byte转换为net.IP并转换为字符串
+				ips = append(ips, net.IP(aRecord.A[:]).String())
+			}
+		}
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no A records found for %s", host)
+	}
+
+	return ips, nil
+}
+
+// newEncryptor 创建加密器，密钥派生的结果会被缓存，加密器带有读写位置，不能在请求之间共用
+func (h *ProxyHandler) newEncryptor(params encryptionParams, fileSize int64) (encryption.Encryptor, error) {
+	return encryption.NewFlowEnc(h.keys.derive(params.algorithm, params.password), params.algorithm, fileSize, func(msg string) {
+		h.logger.Debug("[ENCRYPTION] %s", msg)
+	})
+}
+
+// KeyCacheStats 返回派生密钥缓存的统计
+func (h *ProxyHandler) KeyCacheStats() KeyCacheStats {
+	return h.keys.Stats()
+}
+
+// Close 关闭资源
+func (h *ProxyHandler) Close() {
+	close(h.stopCleanupChan)
+}
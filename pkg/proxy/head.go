@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// handleHead 处理HEAD请求：转发给后端，像GET一样修正Content-Length、Accept-Ranges等响应头，
+// 加密不改变文件大小，因此不需要创建解密器，也不会读取任何内容
+func (t *proxyTransport) handleHead(req *http.Request) (*http.Response, error) {
+	t.handler.logger.Debug("[HEAD] 开始处理: %s", req.URL.Path)
+
+	// 命中不加密规则的文件原样转发
+	if isPlaintext(req) {
+		return t.roundTripWithRetry(req)
+	}
+
+	// 压缩保存的文件按索引返回原始大小
+	if t.handler.compression != "" {
+		if resp, ok, err := t.handleCompressedDownload(req); ok {
+			return resp, err
+		}
+	}
+
+	resp, _, err := t.fetchDownload(req)
+	if err != nil {
+		return nil, err
+	}
+	if isRedirect(resp.StatusCode) {
+		return resp, nil
+	}
+
+	// 分片上传的文件按清单返回完整文件的大小
+	if t.handler.splitSize > 0 {
+		resp, _ = t.resolveSplitFile(req, resp)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return resp, nil
+	}
+
+	// 后端的HEAD响应没有Content-Length时，用一个字节的Range请求获取文件大小
+	size := resp.ContentLength
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if _, total, ok := strings.Cut(contentRange, "/"); ok {
+			if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+				size = n
+			}
+		}
+	} else if size < 0 {
+		size = t.probeSize(req)
+		if size >= 0 {
+			resp.ContentLength = size
+			resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+	}
+
+	if !t.handler.isFileContent(req.URL.Path, resp.Header.Get("Content-Type"), resp.Header.Get("Content-Disposition"), size) {
+		t.handler.logger.Debug("[HEAD] 非文件类型，直接返回: %s", req.URL.Path)
+		return resp, nil
+	}
+
+	// 与GET的响应头保持一致
+	resp.Header.Set("Accept-Ranges", "bytes")
+	t.handler.cacheControl.apply(resp.Header, t.handler.relativePath(req))
+	return resp, nil
+}
+
+// probeSize 通过只请求第一个字节的GET获取文件大小，无法获取时返回-1
+func (t *proxyTransport) probeSize(req *http.Request) int64 {
+	probeReq := req.Clone(req.Context())
+	probeReq.Method = http.MethodGet
+	probeReq.Header.Set("Range", "bytes=0-0")
+	probeReq.Header.Del("If-Range")
+	resp, _, err := t.fetchDownload(probeReq)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return -1
+	}
+	_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 请求头和响应头规则的操作
+const (
+	HeaderSet    = "set"    // 设置头，替换已有的值
+	HeaderAdd    = "add"    // 在已有的值之后追加
+	HeaderRemove = "remove" // 删除头
+)
+
+// HeaderRule 修改请求头或响应头的规则，Value中可以使用以下占位符：
+// {client_ip}客户端IP、{host}客户端请求的Host、{scheme}客户端使用的协议、{user}认证用户名
+type HeaderRule struct {
+	Name   string // 头名称
+	Value  string // 头的值，remove时不使用
+	Action string // set、add或remove，默认set
+}
+
+// HeaderRulesConfig 按规则修改发往后端的请求头和返回给客户端的响应头
+type HeaderRulesConfig struct {
+	Request  []HeaderRule // 在设置后端认证之后应用，可以覆盖代理设置的请求头
+	Response []HeaderRule // 在改写Location、ETag等响应头之前应用，只影响后端返回的响应，不影响代理自己生成的响应
+}
+
+// validate 检查规则的名称和操作
+func (c *HeaderRulesConfig) validate() error {
+	for _, rules := range [][]HeaderRule{c.Request, c.Response} {
+		for _, rule := range rules {
+			if rule.Name == "" {
+				return fmt.Errorf("header rule name is required")
+			}
+			switch rule.Action {
+			case "", HeaderSet, HeaderAdd, HeaderRemove:
+			default:
+				return fmt.Errorf("unsupported header rule action: %s, supported: [%s %s %s]", rule.Action, HeaderSet, HeaderAdd, HeaderRemove)
+			}
+		}
+	}
+	return nil
+}
+
+// clientHostKey 在请求上下文中保存客户端请求的Host，转发时Host会被替换为后端地址
+type clientHostKey struct{}
+
+// withClientHost 配置了头规则时在请求上下文中保存客户端请求的Host，供{host}占位符使用
+func (h *ProxyHandler) withClientHost(r *http.Request) *http.Request {
+	if h.headerRules == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientHostKey{}, r.Host))
+}
+
+// applyHeaderRules 按顺序把规则应用到头上，占位符按请求替换
+func applyHeaderRules(header http.Header, rules []HeaderRule, r *http.Request) {
+	if len(rules) == 0 {
+		return
+	}
+	host, _ := r.Context().Value(clientHostKey{}).(string)
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	replacer := strings.NewReplacer("{client_ip}", clientIP(r), "{host}", host, "{scheme}", scheme, "{user}", UserFromRequest(r))
+
+	for _, rule := range rules {
+		name := http.CanonicalHeaderKey(rule.Name)
+		switch rule.Action {
+		case HeaderRemove:
+			header.Del(name)
+			// 反向代理会在Director之后添加X-Forwarded-For，值为nil时不添加
+			if name == "X-Forwarded-For" {
+				header[name] = nil
+			}
+		case HeaderAdd:
+			header.Add(name, replacer.Replace(rule.Value))
+		default:
+			header.Set(name, replacer.Replace(rule.Value))
+		}
+	}
+}
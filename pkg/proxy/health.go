@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// HealthCheckConfig 后端健康检查配置
+type HealthCheckConfig struct {
+	Interval           time.Duration // 检查间隔，0表示不启用
+	Timeout            time.Duration // 单次检查超时时间
+	Method             string        // 检查方法：OPTIONS或PROPFIND
+	UnhealthyThreshold int           // 连续失败多少次后标记为不可用
+	HealthyThreshold   int           // 连续成功多少次后恢复为可用
+}
+
+// BackendHealth 后端健康状态快照
+type BackendHealth struct {
+	URL                 string        `json:"url"`
+	Healthy             bool          `json:"healthy"`
+	Latency             time.Duration `json:"latency_ns"`
+	LastCheck           time.Time     `json:"last_check"`
+	LastError           string        `json:"last_error,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Fallback            bool          `json:"fallback,omitempty"`
+}
+
+// healthChecker 定期探测单个后端的可用性和延迟
+type healthChecker struct {
+	target    *url.URL
+	config    *HealthCheckConfig
+	transport http.RoundTripper
+	setAuth   func(*http.Request) bool
+	logger    utils.Logger
+
+	mu        sync.RWMutex
+	state     BackendHealth
+	successes int
+}
+
+// newHealthChecker 创建健康检查器，初始状态视为可用
+func newHealthChecker(target *url.URL, config *HealthCheckConfig, transport http.RoundTripper,
+	setAuth func(*http.Request) bool, logger utils.Logger) *healthChecker {
+	return &healthChecker{
+		target:    target,
+		config:    config,
+		transport: transport,
+		setAuth:   setAuth,
+		logger:    logger,
+		state: BackendHealth{
+			URL:     target.Scheme + "://" + target.Host + target.Path,
+			Healthy: true,
+		},
+	}
+}
+
+// run 按配置的间隔执行检查，直到stop关闭
+func (c *healthChecker) run(stop <-chan struct{}) {
+	c.check()
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check 执行一次健康检查并更新状态
+func (c *healthChecker) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	method := strings.ToUpper(c.config.Method)
+	req, err := http.NewRequestWithContext(ctx, method, c.target.String(), nil)
+	if err != nil {
+		c.record(0, err)
+		return
+	}
+	if method == "PROPFIND" {
+		req.Header.Set("Depth", "0")
+	}
+	if c.setAuth != nil {
+		c.setAuth(req)
+	}
+
+	start := time.Now()
+	resp, err := c.transport.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		c.record(latency, err)
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	// 5xx视为不可用，认证失败等4xx说明后端仍在响应
+	if resp.StatusCode >= 500 {
+		c.record(latency, &healthStatusError{status: resp.Status})
+		return
+	}
+	c.record(latency, nil)
+}
+
+// healthStatusError 健康检查收到的错误状态码
+type healthStatusError struct {
+	status string
+}
+
+func (e *healthStatusError) Error() string {
+	return "unexpected status: " + e.status
+}
+
+// record 记录检查结果，并根据阈值切换可用状态
+func (c *healthChecker) record(latency time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.LastCheck = time.Now()
+	c.state.Latency = latency
+
+	if err != nil {
+		c.successes = 0
+		c.state.ConsecutiveFailures++
+		c.state.LastError = err.Error()
+		if c.state.Healthy && c.state.ConsecutiveFailures >= c.config.UnhealthyThreshold {
+			c.state.Healthy = false
+			c.logger.Error("[HEALTH] 后端不可用: %s, 错误: %v", c.state.URL, err)
+		} else {
+			c.logger.Debug("[HEALTH] 后端检查失败(%d): %s, 错误: %v", c.state.ConsecutiveFailures, c.state.URL, err)
+		}
+		return
+	}
+
+	c.successes++
+	c.state.ConsecutiveFailures = 0
+	c.state.LastError = ""
+	if !c.state.Healthy && c.successes >= c.config.HealthyThreshold {
+		c.state.Healthy = true
+		c.logger.Info("[HEALTH] 后端已恢复: %s, 延迟: %v", c.state.URL, latency)
+	} else {
+		c.logger.Trace("[HEALTH] 后端检查成功: %s, 延迟: %v", c.state.URL, latency)
+	}
+}
+
+// Status 返回当前健康状态
+func (c *healthChecker) Status() BackendHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// startHealthCheck 启动后端健康检查
+func (h *ProxyHandler) startHealthCheck(config *HealthCheckConfig) {
+	if config == nil || config.Interval <= 0 {
+		return
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.Method == "" {
+		config.Method = http.MethodOptions
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = 1
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = 1
+	}
+
+	// 健康检查请求与转发的请求使用相同的认证和User-Agent
+	setAuth := func(req *http.Request) bool {
+		h.setUserAgent(req)
+		return h.setBackendAuth(req)
+	}
+	h.healthCheckers = make([]*healthChecker, len(h.backends))
+	for i, backend := range h.backends {
+		h.healthCheckers[i] = newHealthChecker(backend, config, h.baseRoundTripper(), setAuth, h.logger)
+		go h.healthCheckers[i].run(h.stopCleanupChan)
+	}
+	if h.fallback != nil {
+		h.fallbackChecker = newHealthChecker(h.fallback, config, h.baseRoundTripper(), setAuth, h.logger)
+		h.fallbackChecker.state.Fallback = true
+		go h.fallbackChecker.run(h.stopCleanupChan)
+	}
+	h.logger.Info("后端健康检查已启用，间隔: %v，方法: %s，后端数: %d", config.Interval, config.Method, len(h.backends))
+}
+
+// BackendHealth 返回所有后端的健康状态，未启用健康检查时返回nil
+func (h *ProxyHandler) BackendHealth() []BackendHealth {
+	if h.healthCheckers == nil {
+		return nil
+	}
+	states := make([]BackendHealth, len(h.healthCheckers))
+	for i, checker := range h.healthCheckers {
+		states[i] = checker.Status()
+	}
+	if h.fallbackChecker != nil {
+		states = append(states, h.fallbackChecker.Status())
+	}
+	return states
+}
+
+// healthMiddleware 健康检查端点，不需要认证
+type healthMiddleware struct {
+	handler http.Handler
+	path    string
+	proxies []*ProxyHandler
+}
+
+// NewHealthMiddleware 创建健康检查端点中间件，后端不可用时返回503。
+// 使用虚拟挂载点时传入所有挂载点的代理处理器
+func NewHealthMiddleware(handler http.Handler, path string, proxyHandlers ...*ProxyHandler) http.Handler {
+	if path == "" {
+		return handler
+	}
+	return &healthMiddleware{
+		handler: handler,
+		path:    path,
+		proxies: proxyHandlers,
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *healthMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != m.path || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	// 只要有一个后端可用，代理就可以继续服务，仅备用后端可用时标记为降级
+	// 使用虚拟挂载点时，任意挂载点不可用都会返回503
+	var backends []BackendHealth
+	statusText := "ok"
+	for _, proxy := range m.proxies {
+		states := proxy.BackendHealth()
+		backends = append(backends, states...)
+
+		healthy := len(states) == 0
+		fallbackOnly := false
+		for _, backend := range states {
+			if backend.Healthy {
+				if !healthy {
+					fallbackOnly = backend.Fallback
+				}
+				healthy = true
+			}
+		}
+		if !healthy {
+			statusText = "unavailable"
+		} else if fallbackOnly && statusText == "ok" {
+			statusText = "degraded"
+		}
+	}
+
+	status := http.StatusOK
+	if statusText == "unavailable" {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   statusText,
+			"backends": backends,
+		})
+	}
+}
+
+// getLogger 实现loggerProvider接口
+func (m *healthMiddleware) getLogger() utils.Logger {
+	return handlerLogger(m.handler)
+}
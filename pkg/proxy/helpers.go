@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// 辅助函数
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func removeHopHeaders(header http.Header) {
+	hopHeaders := []string{
+		"Connection",
+		"Proxy-Connection",
+		"Keep-Alive",
+		"Proxy-Authenticate",
+		"Proxy-Authorization",
+		"Te",
+		"Trailers",
+		"Transfer-Encoding",
+		"Upgrade",
+	}
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+}
+
+// statusRecorder 记录响应状态码和写入字节数的ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader 记录状态码，100 Continue等1xx信息响应之后还会有最终响应，不记录
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 && status >= 200 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write 记录写入字节数
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush 实现http.Flusher接口
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供http.ResponseController获取原始ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Status 返回响应状态码，未写入时返回200
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// countingReader 统计读取字节数的ReadCloser
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read 读取数据并累计字节数
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// headerOverrideWriter 在写入最终的响应头前调用override修改响应头，可以覆盖内层处理器和后端返回的值
+type headerOverrideWriter struct {
+	http.ResponseWriter
+	override    func(http.Header)
+	wroteHeader bool
+}
+
+// WriteHeader 写入状态码前修改响应头
+func (w *headerOverrideWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.override(w.ResponseWriter.Header())
+		// 1xx响应之后还会写入最终的响应头
+		w.wroteHeader = code >= http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write 实现io.Writer接口
+func (w *headerOverrideWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush 实现http.Flusher接口
+func (w *headerOverrideWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供http.ResponseController获取原始ResponseWriter
+func (w *headerOverrideWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
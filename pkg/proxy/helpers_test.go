@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+
+	"webdav-proxy/utils"
+)
+
+// newDAVBackend 启动保存在内存中的WebDAV后端
+func newDAVBackend(t *testing.T) *httptest.Server {
+	backend := httptest.NewServer(&webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	})
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// newTestProxy 创建指向backendURL的代理处理器，opts中的Backend、Password和Logger未设置时使用测试默认值
+func newTestProxy(t *testing.T, backendURL string, opts Options) *ProxyHandler {
+	backend, err := url.Parse(backendURL)
+	if err != nil {
+		t.Fatalf("解析后端地址失败: %v", err)
+	}
+	opts.Backend = backend
+	if opts.Password == "" {
+		opts.Password = "test"
+	}
+	if opts.Logger == nil {
+		opts.Logger = utils.NewLogger(utils.LogLevelError)
+	}
+	h, err := New(opts)
+	if err != nil {
+		t.Fatalf("创建代理失败: %v", err)
+	}
+	t.Cleanup(h.Close)
+	return h
+}
+
+// serve 以user的身份向h发送请求，user为空时不带认证用户
+func serve(h http.Handler, user, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	if user != "" {
+		req = req.WithContext(ContextWithUser(req.Context(), user))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
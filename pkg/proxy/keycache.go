@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"webdav-proxy/pkg/encryption"
+)
+
+// 派生密钥缓存的默认容量和有效期
+const (
+	defaultKeyCacheSize = 1000
+	defaultKeyCacheTTL  = time.Hour
+)
+
+// KeyCacheConfig 派生密钥缓存配置
+type KeyCacheConfig struct {
+	Size int           // 最多缓存的密钥数，超过时淘汰最近最少使用的项，默认1000
+	TTL  time.Duration // 密钥多长时间未使用后过期，默认1小时
+}
+
+// KeyCacheStats 派生密钥缓存的统计
+type KeyCacheStats struct {
+	Entries     int    `json:"entries"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`   // 超过容量被淘汰的项
+	Expirations uint64 `json:"expirations"` // 超过有效期被清理的项
+}
+
+// keyCache 按算法和密码缓存PBKDF2派生的密钥，超过容量时淘汰最近最少使用的项，长时间未使用的项过期。
+// 加密器带有读写位置，不能在并发的请求之间共用，每个请求用缓存的密钥单独创建
+type keyCache struct {
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // 最近使用的在前
+	stats   KeyCacheStats
+}
+
+// keyCacheEntry 派生密钥缓存项
+type keyCacheEntry struct {
+	key     string
+	derived string
+	expires time.Time
+}
+
+// newKeyCache 创建派生密钥缓存，零值使用默认容量和有效期
+func newKeyCache(config *KeyCacheConfig) *keyCache {
+	c := &keyCache{
+		size:    defaultKeyCacheSize,
+		ttl:     defaultKeyCacheTTL,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if config != nil && config.Size > 0 {
+		c.size = config.Size
+	}
+	if config != nil && config.TTL > 0 {
+		c.ttl = config.TTL
+	}
+	return c
+}
+
+// derive 返回算法和密码对应的派生密钥，插件算法不支持派生时返回原密码
+func (c *keyCache) derive(algorithm, password string) string {
+	key := algorithm + "\x00" + password
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*keyCacheEntry)
+		if time.Now().Before(entry.expires) {
+			entry.expires = time.Now().Add(c.ttl)
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return entry.derived
+		}
+		c.remove(elem)
+		c.stats.Expirations++
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// 派生耗时较长，不持有锁，同时未命中的请求各自派生，结果相同
+	derived, ok := encryption.DeriveKey(password, algorithm)
+	if !ok {
+		return password
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*keyCacheEntry).expires = time.Now().Add(c.ttl)
+		c.lru.MoveToFront(elem)
+		return derived
+	}
+	c.entries[key] = c.lru.PushFront(&keyCacheEntry{key: key, derived: derived, expires: time.Now().Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+	return derived
+}
+
+// remove 删除缓存项，调用方需要持有锁
+func (c *keyCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*keyCacheEntry).key)
+}
+
+// sweep 清理过期的项，返回清理的数量。最久未使用的项在链表末尾，遇到未过期的项即可停止
+func (c *keyCache) sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var removed int
+	for elem := c.lru.Back(); elem != nil && now.After(elem.Value.(*keyCacheEntry).expires); elem = c.lru.Back() {
+		c.remove(elem)
+		removed++
+	}
+	c.stats.Expirations += uint64(removed)
+	return removed
+}
+
+// Stats 返回缓存统计
+func (c *keyCache) Stats() KeyCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// run 定期清理过期的项，直到stop关闭
+func (c *keyCache) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(min(c.ttl, 10*time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// warmKeys 启动时为默认密码和所有加密规则派生密钥，重启后的第一个请求不必等待派生
+func (h *ProxyHandler) warmKeys() {
+	start := time.Now()
+	h.keys.derive(h.algorithm, h.password)
+	for _, rule := range h.encryptionRules {
+		h.keys.derive(rule.Algorithm, rule.Password)
+	}
+	h.logger.Debug("[ENCRYPTION] 预先派生密钥 %d 个，耗时: %v", h.keys.Stats().Entries, time.Since(start))
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"webdav-proxy/pkg/encryption"
+)
+
+// EncryptionRule 按路径前缀指定加密算法和密码，多条规则匹配时最长的前缀优先
+type EncryptionRule struct {
+	Prefix    string // 路径前缀，如 /photos，使用挂载点时为挂载点内的路径
+	Algorithm string // 加密算法，为空时使用默认算法
+	Password  string // 加密密码，为空时使用默认密码
+}
+
+// encryptionRules 按前缀长度从长到短排列的加密规则
+type encryptionRules []EncryptionRule
+
+// newEncryptionRules 检查并整理加密规则，未设置的算法和密码使用默认值
+func newEncryptionRules(rules []EncryptionRule, algorithm, password string) (encryptionRules, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	sorted := make(encryptionRules, 0, len(rules))
+	for _, rule := range rules {
+		if !strings.HasPrefix(rule.Prefix, "/") {
+			return nil, fmt.Errorf("encryption rule prefix must start with /: %s", rule.Prefix)
+		}
+		rule.Prefix = path.Clean(rule.Prefix)
+		if rule.Algorithm == "" {
+			rule.Algorithm = algorithm
+		}
+		if rule.Password == "" {
+			rule.Password = password
+		}
+		if !encryption.HasEncryptor(rule.Algorithm) {
+			return nil, fmt.Errorf("unsupported algorithm in encryption rule %s: %s", rule.Prefix, rule.Algorithm)
+		}
+		sorted = append(sorted, rule)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	return sorted, nil
+}
+
+// match 查找路径对应的规则，没有匹配的规则时返回nil
+func (rules encryptionRules) match(p string) *EncryptionRule {
+	for i := range rules {
+		prefix := rules[i].Prefix
+		if prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// relativePath 把发往后端的请求路径转换为后端根目录下的相对路径，即客户端在挂载点内看到的路径。
+// 根据主机找到对应的后端再去掉其路径前缀，负载均衡的各个后端路径前缀可以不同
+func (h *ProxyHandler) relativePath(req *http.Request) string {
+	backend := h.backendForHost(req.URL.Host)
+	if backend == nil {
+		backend = h.backend
+	}
+	p := req.URL.Path
+	if base := strings.TrimSuffix(backend.Path, "/"); base != "" && (p == base || strings.HasPrefix(p, base+"/")) {
+		p = strings.TrimPrefix(p, base)
+	}
+	if p == "" {
+		p = "/"
+	}
+	return p
+}
+
+// encryptionParams 请求使用的加密参数
+type encryptionParams struct {
+	algorithm string
+	password  string
+}
+
+// encryptionFor 获取请求路径对应的加密参数，没有匹配的规则时使用默认算法和密码
+func (h *ProxyHandler) encryptionFor(req *http.Request) encryptionParams {
+	if rule := h.encryptionRules.match(h.relativePath(req)); rule != nil {
+		return encryptionParams{algorithm: rule.Algorithm, password: rule.Password}
+	}
+	return encryptionParams{algorithm: h.algorithm, password: h.password}
+}
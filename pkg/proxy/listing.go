@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 回收站和历史版本文件名中的时间戳格式，按字符串排序即按时间排序
+const timestampNameFormat = "20060102-150405.000"
+
+// collectionListing PROPFIND响应中列目录需要的部分
+type collectionListing struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength string    `xml:"getcontentlength"`
+				LastModified  string    `xml:"getlastmodified"`
+				ResourceType  *struct{} `xml:"resourcetype>collection"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// collectionEntry 目录中的一项
+type collectionEntry struct {
+	name         string
+	size         int64 // 目录或没有大小时为-1
+	lastModified string
+	collection   bool
+}
+
+// newInternalRequest 创建后台任务使用的内部请求，与客户端请求一样经过director转发到后端
+func newInternalRequest(ctx context.Context) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+}
+
+// listCollection 用Depth 1的PROPFIND列出目录中的直接子项，不包括目录本身。
+// r提供认证、挂载点等上下文，dir为客户端路径
+func (h *ProxyHandler) listCollection(r *http.Request, dir string) ([]collectionEntry, int, error) {
+	body := `<?xml version="1.0"?><d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/><d:getlastmodified/><d:resourcetype/></d:prop></d:propfind>`
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	propfindReq := r.Clone(r.Context())
+	propfindReq.Method = "PROPFIND"
+	propfindReq.URL.Path = dir
+	propfindReq.URL.RawPath = ""
+	propfindReq.URL.RawQuery = ""
+	propfindReq.Body = io.NopCloser(strings.NewReader(body))
+	propfindReq.ContentLength = int64(len(body))
+	propfindReq.Header = cleanChunkHeader(r.Header)
+	propfindReq.Header.Set("Depth", "1")
+	propfindReq.Header.Set("Content-Type", "application/xml")
+
+	recorder := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: &discardResponseWriter{header: make(http.Header)}}, limit: maxPropfindCacheResponse}
+	h.reverseProxy.ServeHTTP(recorder, propfindReq)
+	if recorder.Status() != http.StatusMultiStatus || recorder.overflow {
+		return nil, recorder.Status(), fmt.Errorf("backend returned %d", recorder.Status())
+	}
+
+	var listing collectionListing
+	if err := xml.Unmarshal(recorder.buf.Bytes(), &listing); err != nil {
+		return nil, recorder.Status(), err
+	}
+	// 目录本身的href可能是客户端路径（挂载点下已被改写）或后端路径
+	self := strings.TrimSuffix(dir, "/")
+	backendSelf := strings.TrimSuffix(backendPath(h.backend, mountPrefix(r), dir), "/")
+	var entries []collectionEntry
+	for _, response := range listing.Responses {
+		href, err := url.Parse(strings.TrimSpace(response.Href))
+		if err != nil {
+			continue
+		}
+		if p := strings.TrimSuffix(href.Path, "/"); p == self || p == backendSelf {
+			continue
+		}
+		entry := collectionEntry{name: path.Base(strings.TrimSuffix(href.Path, "/")), size: -1}
+		for _, propstat := range response.Propstat {
+			if propstat.Prop.ContentLength != "" {
+				entry.size, _ = strconv.ParseInt(propstat.Prop.ContentLength, 10, 64)
+			}
+			if propstat.Prop.LastModified != "" {
+				entry.lastModified = propstat.Prop.LastModified
+			}
+			if propstat.Prop.ResourceType != nil {
+				entry.collection = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, recorder.Status(), nil
+}
+
+// internalRequest 基于r发送不带请求体的内部请求，返回状态码
+func (h *ProxyHandler) internalRequest(r *http.Request, method, p string) int {
+	req := r.Clone(r.Context())
+	req.Method = method
+	req.URL.Path = p
+	req.URL.RawPath = ""
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	req.Header = cleanChunkHeader(r.Header)
+	req.Header.Del("Depth")
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	h.reverseProxy.ServeHTTP(recorder, req)
+	return recorder.status
+}
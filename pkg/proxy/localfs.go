@@ -0,0 +1,303 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"webdav-proxy/pkg/encryption"
+	"webdav-proxy/utils"
+
+	"golang.org/x/net/webdav"
+)
+
+// LocalConfig 本地目录模式配置，代理直接作为WebDAV服务器，文件内容加密后保存在本地磁盘
+type LocalConfig struct {
+	Dir       string // 保存加密文件的本地目录
+	Password  string // 加密密码
+	Algorithm string // 加密算法
+
+	ExcludePaths    []string         // 不加密的路径规则，命中的文件按明文保存
+	EncryptionRules []EncryptionRule // 按路径前缀指定加密算法和密码
+}
+
+// expectedSizeKey 请求上下文中保存PUT请求Content-Length的键
+type expectedSizeKey struct{}
+
+// localHandler 本地目录模式的WebDAV处理器
+type localHandler struct {
+	webdav *webdav.Handler
+	logger utils.Logger
+}
+
+// NewLocalHandler 创建本地目录模式的WebDAV处理器
+func NewLocalHandler(config *LocalConfig, logger utils.Logger) (http.Handler, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, err
+	}
+	// 提前创建一次加密器，尽早发现不支持的算法
+	if _, err := encryption.NewEncryptor(config.Password, config.Algorithm, 0, func(string) {}); err != nil {
+		return nil, err
+	}
+
+	excludePaths, err := newPathMatcher(config.ExcludePaths)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := newEncryptionRules(config.EncryptionRules, config.Algorithm, config.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &encryptedFS{
+		dir:          webdav.Dir(config.Dir),
+		password:     config.Password,
+		algorithm:    config.Algorithm,
+		excludePaths: excludePaths,
+		rules:        rules,
+		logger:       logger,
+	}
+	return &localHandler{
+		webdav: &webdav.Handler{
+			FileSystem: fs,
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					logger.Error("[LOCAL] %s %s: %v", r.Method, r.URL.Path, err)
+				} else {
+					logger.Debug("[LOCAL] %s %s", r.Method, r.URL.Path)
+				}
+			},
+		},
+		logger: logger,
+	}, nil
+}
+
+// ServeHTTP 实现http.Handler接口
+func (h *localHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 加密密钥与文件大小相关，提前把上传文件的大小传给文件系统
+	if r.Method == http.MethodPut && r.ContentLength >= 0 {
+		r = r.WithContext(context.WithValue(r.Context(), expectedSizeKey{}, r.ContentLength))
+	}
+	h.webdav.ServeHTTP(w, r)
+}
+
+// getLogger 实现loggerProvider接口
+func (h *localHandler) getLogger() utils.Logger {
+	return h.logger
+}
+
+// encryptedFS 对文件内容进行加解密的webdav.FileSystem，加密后文件大小不变
+type encryptedFS struct {
+	dir          webdav.Dir
+	password     string
+	algorithm    string
+	excludePaths *pathMatcher
+	rules        encryptionRules
+	logger       utils.Logger
+}
+
+// Mkdir 实现webdav.FileSystem接口
+func (fs *encryptedFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return fs.dir.Mkdir(ctx, name, perm)
+}
+
+// RemoveAll 实现webdav.FileSystem接口
+func (fs *encryptedFS) RemoveAll(ctx context.Context, name string) error {
+	return fs.dir.RemoveAll(ctx, name)
+}
+
+// Rename 实现webdav.FileSystem接口
+func (fs *encryptedFS) Rename(ctx context.Context, oldName, newName string) error {
+	return fs.dir.Rename(ctx, oldName, newName)
+}
+
+// Stat 实现webdav.FileSystem接口
+func (fs *encryptedFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return fs.dir.Stat(ctx, name)
+}
+
+// OpenFile 实现webdav.FileSystem接口，普通文件会被包装为加解密文件
+func (fs *encryptedFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	// 命中不加密规则的文件直接读写
+	if fs.excludePaths.match(name) {
+		return fs.dir.OpenFile(ctx, name, flag, perm)
+	}
+
+	writing := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if writing && flag&os.O_TRUNC == 0 {
+		// 流式加密只支持从头写入完整文件
+		return nil, os.ErrPermission
+	}
+
+	f, err := fs.dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+
+	size := info.Size()
+	if writing {
+		// 未知大小时先按0加密，关闭时再按实际大小重新加密
+		size, _ = ctx.Value(expectedSizeKey{}).(int64)
+	}
+	enc, err := fs.newEncryptor(name, size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &encryptedFile{File: f, fs: fs, name: name, enc: enc, size: size, writing: writing}, nil
+}
+
+// newEncryptor 为指定路径和大小的文件创建加密器，加密器有状态，不能在文件之间共享
+func (fs *encryptedFS) newEncryptor(name string, size int64) (encryption.Encryptor, error) {
+	password, algorithm := fs.password, fs.algorithm
+	if rule := fs.rules.match(name); rule != nil {
+		password, algorithm = rule.Password, rule.Algorithm
+	}
+	return encryption.NewEncryptor(password, algorithm, size, func(msg string) {
+		fs.logger.Trace("[LOCAL] %s", msg)
+	})
+}
+
+// encryptedFile 读取时解密、写入时加密的文件
+type encryptedFile struct {
+	webdav.File
+	fs      *encryptedFS
+	name    string
+	enc     encryption.Encryptor
+	size    int64 // 创建加密器时使用的文件大小
+	pos     int64 // 当前读写位置
+	encPos  int64 // 加密器当前位置
+	writing bool
+	written int64
+}
+
+// Read 读取并解密数据
+func (f *encryptedFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if n > 0 {
+		f.sync()
+		encryption.DecryptInPlace(f.enc, p[:n])
+		f.advance(n)
+	}
+	return n, err
+}
+
+// Write 加密并写入数据
+func (f *encryptedFile) Write(p []byte) (int, error) {
+	if !f.writing {
+		return 0, os.ErrPermission
+	}
+	f.sync()
+	// p属于调用方，不能原地加密，分块复制到缓冲区后加密写入
+	bufp := localBuffers.Get()
+	defer localBuffers.Put(bufp)
+	buf := *bufp
+
+	written := 0
+	var err error
+	for written < len(p) {
+		chunk := copy(buf, p[written:])
+		encryption.EncryptInPlace(f.enc, buf[:chunk])
+		var n int
+		n, err = f.File.Write(buf[:chunk])
+		written += n
+		f.advance(n)
+		if err != nil {
+			if n < chunk {
+				// 加密器已经越过未写入的数据，下次读写前重新定位
+				f.encPos = -1
+			}
+			break
+		}
+	}
+	if f.pos > f.written {
+		f.written = f.pos
+	}
+	return written, err
+}
+
+// Seek 移动读写位置，下次读写前重新定位加密器
+func (f *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil {
+		f.pos = pos
+	}
+	return pos, err
+}
+
+// Close 关闭文件，写入大小与加密时使用的大小不一致时按实际大小重新加密
+func (f *encryptedFile) Close() error {
+	if f.writing && f.written != f.size {
+		if err := f.reencrypt(); err != nil {
+			f.File.Close()
+			return err
+		}
+	}
+	return f.File.Close()
+}
+
+// sync 加密器位置与文件位置不一致时重新定位
+func (f *encryptedFile) sync() {
+	if f.encPos != f.pos {
+		f.enc.SetPosition(f.pos)
+		f.encPos = f.pos
+	}
+}
+
+// advance 读写n个字节后同步更新位置
+func (f *encryptedFile) advance(n int) {
+	f.pos += int64(n)
+	f.encPos = f.pos
+}
+
+// reencrypt 用实际文件大小派生的密钥原地重新加密整个文件
+func (f *encryptedFile) reencrypt() error {
+	file, ok := f.File.(*os.File)
+	if !ok {
+		return errors.New("re-encryption requires a regular file")
+	}
+	f.fs.logger.Debug("[LOCAL] 文件大小变化，重新加密: %s, %d -> %d 字节", file.Name(), f.size, f.written)
+
+	oldEnc, err := f.fs.newEncryptor(f.name, f.size)
+	if err != nil {
+		return err
+	}
+	newEnc, err := f.fs.newEncryptor(f.name, f.written)
+	if err != nil {
+		return err
+	}
+
+	bufp := localBuffers.Get()
+	defer localBuffers.Put(bufp)
+	buf := *bufp
+	for offset := int64(0); offset < f.written; {
+		n, err := file.ReadAt(buf, offset)
+		if n > 0 {
+			encryption.DecryptInPlace(oldEnc, buf[:n])
+			encryption.EncryptInPlace(newEnc, buf[:n])
+			if _, err := file.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	f.size = f.written
+	return nil
+}
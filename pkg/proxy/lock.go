@@ -0,0 +1,412 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"webdav-proxy/utils"
+
+	"golang.org/x/net/webdav"
+)
+
+// 锁处理方式
+const (
+	LockModePassthrough = "passthrough" // LOCK/UNLOCK转发给后端
+	LockModeLocal       = "local"       // 由代理在内存中管理锁，适用于不支持锁的后端
+)
+
+// LockConfig 内置锁管理器配置
+type LockConfig struct {
+	Mode       string                       // 锁处理方式：passthrough或local
+	MaxTimeout time.Duration                // 锁的最长有效期，客户端请求更长或无限期时使用该值
+	Namespace  func(r *http.Request) string // 返回请求所属的锁命名空间，不同后端的同名路径互不影响，为nil表示共用
+}
+
+// lockMiddleware 在本地应答LOCK/UNLOCK，并在写操作前按If头校验锁，其他请求交给内层处理器
+type lockMiddleware struct {
+	handler http.Handler
+	config  *LockConfig
+	locks   webdav.LockSystem
+	prefix  string // 锁令牌前缀，每次启动不同，重启前的令牌不会被误认
+	logger  utils.Logger
+}
+
+// NewLockMiddleware 创建内置锁管理器中间件，未启用时直接返回原处理器
+func NewLockMiddleware(handler http.Handler, config *LockConfig) http.Handler {
+	if config == nil || config.Mode != LockModeLocal {
+		return handler
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &lockMiddleware{
+		handler: handler,
+		config:  config,
+		locks:   webdav.NewMemLS(),
+		prefix:  "opaquelocktoken:" + hex.EncodeToString(id) + "-",
+		logger:  handlerLogger(handler),
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *lockMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "LOCK":
+		m.handleLock(w, r)
+		return
+	case "UNLOCK":
+		m.handleUnlock(w, r)
+		return
+	case http.MethodOptions:
+		// 后端不支持锁时只声明DAV 1，Windows资源管理器会把目录挂载为只读
+		m.handler.ServeHTTP(&lockOptionsWriter{ResponseWriter: w}, r)
+		return
+	}
+
+	var src, dst string
+	switch r.Method {
+	case http.MethodPut, http.MethodPost, http.MethodDelete, "PROPPATCH", "MKCOL", "MOVE":
+		src = m.lockName(r, r.URL.Path)
+	}
+	if r.Method == "COPY" || r.Method == "MOVE" {
+		if u, err := url.Parse(r.Header.Get("Destination")); err == nil && u.Path != "" {
+			dst = m.lockName(r, u.Path)
+		}
+	}
+	if src == "" && dst == "" {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	release, status := m.confirm(r, src, dst)
+	if status != 0 {
+		m.logger.Info("[LOCK] 资源已被锁定: %s %s", r.Method, r.URL.Path)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	defer release()
+
+	// 锁令牌只有代理认识，不能转发给后端
+	r.Header.Del("If")
+	m.handler.ServeHTTP(w, r)
+}
+
+// getLogger 实现loggerProvider接口
+func (m *lockMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// lockName 返回路径在锁管理器中的名称
+func (m *lockMiddleware) lockName(r *http.Request, p string) string {
+	name := path.Clean("/" + p)
+	if m.config.Namespace != nil {
+		if ns := m.config.Namespace(r); ns != "" {
+			name = path.Join("/", url.PathEscape(ns), name)
+		}
+	}
+	return name
+}
+
+// confirm 确认请求可以修改src和dst：资源未被锁定，或者If头中提供了对应的锁令牌。
+// 返回释放函数，失败时返回状态码
+func (m *lockMiddleware) confirm(r *http.Request, src, dst string) (func(), int) {
+	now := time.Now()
+	var conditions []webdav.Condition
+	for _, token := range ifHeaderTokens(r.Header.Get("If")) {
+		if strings.HasPrefix(token, m.prefix) {
+			conditions = append(conditions, webdav.Condition{Token: strings.TrimPrefix(token, m.prefix)})
+		}
+	}
+	if len(conditions) > 0 {
+		if release, err := m.locks.Confirm(now, src, dst, conditions...); err == nil {
+			return release, 0
+		}
+	}
+
+	// 逐个确认：持有锁的资源需要令牌，未锁定的资源用临时锁防止并发的LOCK
+	var releases []func()
+	releaseAll := func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	for _, name := range []string{src, dst} {
+		if name == "" {
+			continue
+		}
+		if len(conditions) > 0 {
+			if release, err := m.locks.Confirm(now, name, "", conditions...); err == nil {
+				releases = append(releases, release)
+				continue
+			}
+		}
+		token, err := m.locks.Create(now, webdav.LockDetails{Root: name, Duration: -1, ZeroDepth: true})
+		if err != nil {
+			releaseAll()
+			if err == webdav.ErrLocked {
+				return nil, http.StatusLocked
+			}
+			return nil, http.StatusInternalServerError
+		}
+		releases = append(releases, func() { m.locks.Unlock(now, token) })
+	}
+	return releaseAll, 0
+}
+
+// lockInfo LOCK请求体
+type lockInfo struct {
+	XMLName   xml.Name  `xml:"lockinfo"`
+	Exclusive *struct{} `xml:"lockscope>exclusive"`
+	Shared    *struct{} `xml:"lockscope>shared"`
+	Write     *struct{} `xml:"locktype>write"`
+	Owner     struct {
+		InnerXML string `xml:",innerxml"`
+	} `xml:"owner"`
+}
+
+// handleLock 处理LOCK请求：有请求体时创建新锁，没有请求体时刷新If头中的锁
+func (m *lockMiddleware) handleLock(w http.ResponseWriter, r *http.Request) {
+	duration := m.lockTimeout(r.Header.Get("Timeout"))
+	name := m.lockName(r, r.URL.Path)
+	now := time.Now()
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		tokens := ifHeaderTokens(r.Header.Get("If"))
+		if len(tokens) != 1 || !strings.HasPrefix(tokens[0], m.prefix) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		details, err := m.locks.Refresh(now, strings.TrimPrefix(tokens[0], m.prefix), duration)
+		if err != nil {
+			m.logger.Info("[LOCK] 刷新锁失败: %s, 错误: %v", r.URL.Path, err)
+			http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+			return
+		}
+		m.logger.Debug("[LOCK] 刷新锁: %s, 有效期: %v", r.URL.Path, duration)
+		m.writeLockDiscovery(w, http.StatusOK, tokens[0], r.URL.Path, details)
+		return
+	}
+
+	var info lockInfo
+	if err := xml.Unmarshal(body, &info); err != nil || info.Write == nil || (info.Exclusive == nil && info.Shared == nil) {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if info.Shared != nil {
+		http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		return
+	}
+	depth := r.Header.Get("Depth")
+	if depth != "" && depth != "0" && !strings.EqualFold(depth, "infinity") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	details := webdav.LockDetails{
+		Root:      name,
+		Duration:  duration,
+		OwnerXML:  info.Owner.InnerXML,
+		ZeroDepth: depth == "0",
+	}
+	token, err := m.locks.Create(now, details)
+	if err == webdav.ErrLocked {
+		m.logger.Info("[LOCK] 资源已被锁定: %s", r.URL.Path)
+		http.Error(w, "Locked", http.StatusLocked)
+		return
+	} else if err != nil {
+		m.logger.Error("[LOCK] 创建锁失败: %s, 错误: %v", r.URL.Path, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// 锁定不存在的路径时创建空文件，与支持锁的WebDAV服务器行为一致
+	status := http.StatusOK
+	if created, err := m.createEmpty(r); err != nil {
+		m.locks.Unlock(now, token)
+		m.logger.Error("[LOCK] 创建空文件失败: %s, 错误: %v", r.URL.Path, err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	} else if created {
+		status = http.StatusCreated
+	}
+
+	m.logger.Info("[LOCK] 创建锁: %s, 有效期: %v", r.URL.Path, duration)
+	w.Header().Set("Lock-Token", "<"+m.prefix+token+">")
+	m.writeLockDiscovery(w, status, m.prefix+token, r.URL.Path, details)
+}
+
+// createEmpty 目标路径不存在时通过内层处理器上传一个空文件，返回是否创建了文件
+func (m *lockMiddleware) createEmpty(r *http.Request) (bool, error) {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		return false, nil
+	}
+	headReq := r.Clone(r.Context())
+	headReq.Method = http.MethodHead
+	headReq.Body = http.NoBody
+	headReq.ContentLength = 0
+	headReq.Header.Del("If")
+	headReq.Header.Del("Timeout")
+	headReq.Header.Del("Depth")
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	m.handler.ServeHTTP(recorder, headReq)
+	if recorder.status != http.StatusNotFound {
+		return false, nil
+	}
+
+	putReq := headReq.Clone(r.Context())
+	putReq.Method = http.MethodPut
+	putReq.Header.Set("Content-Length", "0")
+	putReq.Header.Del("Content-Type")
+	recorder = &discardResponseWriter{header: make(http.Header)}
+	m.handler.ServeHTTP(recorder, putReq)
+	if recorder.status < 200 || recorder.status >= 300 {
+		return false, fmt.Errorf("backend returned %d", recorder.status)
+	}
+	return true, nil
+}
+
+// handleUnlock 处理UNLOCK请求
+func (m *lockMiddleware) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	token := strings.Trim(strings.TrimSpace(r.Header.Get("Lock-Token")), "<>")
+	if !strings.HasPrefix(token, m.prefix) {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	switch err := m.locks.Unlock(time.Now(), strings.TrimPrefix(token, m.prefix)); err {
+	case nil:
+		m.logger.Info("[LOCK] 释放锁: %s", r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	case webdav.ErrForbidden:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case webdav.ErrLocked:
+		http.Error(w, "Locked", http.StatusLocked)
+	case webdav.ErrNoSuchLock:
+		http.Error(w, "Conflict", http.StatusConflict)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// lockTimeout 解析Timeout头（如 Second-3600, Infinite），不超过配置的最长有效期
+func (m *lockMiddleware) lockTimeout(header string) time.Duration {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if seconds, ok := strings.CutPrefix(value, "Second-"); ok {
+			if n, err := strconv.ParseInt(seconds, 10, 64); err == nil && n > 0 {
+				if n > int64(m.config.MaxTimeout/time.Second) {
+					return m.config.MaxTimeout
+				}
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return m.config.MaxTimeout
+}
+
+// writeLockDiscovery 写入包含锁信息的LOCK响应
+func (m *lockMiddleware) writeLockDiscovery(w http.ResponseWriter, status int, token, root string, details webdav.LockDetails) {
+	depth := "infinity"
+	if details.ZeroDepth {
+		depth = "0"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	buf.WriteString(`<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`)
+	buf.WriteString(`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>`)
+	fmt.Fprintf(&buf, `<D:depth>%s</D:depth>`, depth)
+	if details.OwnerXML != "" {
+		fmt.Fprintf(&buf, `<D:owner>%s</D:owner>`, details.OwnerXML)
+	}
+	fmt.Fprintf(&buf, `<D:timeout>Second-%d</D:timeout>`, int64(details.Duration/time.Second))
+	fmt.Fprintf(&buf, `<D:locktoken><D:href>%s</D:href></D:locktoken>`, xmlEscape(token))
+	fmt.Fprintf(&buf, `<D:lockroot><D:href>%s</D:href></D:lockroot>`, xmlEscape(escapePath(root)))
+	buf.WriteString(`</D:activelock></D:lockdiscovery></D:prop>` + "\n")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// ifHeaderTokens 提取If头中的锁令牌，跳过资源标签、ETag和Not条件
+func ifHeaderTokens(header string) []string {
+	var tokens []string
+	inList, not := false, false
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case c == '(':
+			inList = true
+		case c == ')':
+			inList, not = false, false
+		case c == '[':
+			if end := strings.IndexByte(header[i:], ']'); end >= 0 {
+				i += end
+			}
+			not = false
+		case c == '<':
+			end := strings.IndexByte(header[i:], '>')
+			if end < 0 {
+				return tokens
+			}
+			// 括号外的是资源标签
+			if inList && !not {
+				tokens = append(tokens, header[i+1:i+end])
+			}
+			i += end
+			not = false
+		case inList && (c == 'N' || c == 'n') && strings.EqualFold(header[i:min(i+3, len(header))], "not"):
+			not = true
+			i += 2
+		}
+	}
+	return tokens
+}
+
+// lockOptionsWriter 在OPTIONS响应中声明对锁的支持
+type lockOptionsWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader 实现http.ResponseWriter接口
+func (w *lockOptionsWriter) WriteHeader(status int) {
+	if !w.wroteHeader && status >= 200 && status < 300 {
+		header := w.Header()
+		if dav := header.Get("DAV"); dav != "" && !strings.Contains(dav, "2") {
+			header.Set("DAV", strings.Replace(dav, "1", "1, 2", 1))
+		}
+		if allow := header.Get("Allow"); allow != "" && !strings.Contains(allow, "LOCK") {
+			header.Set("Allow", allow+", LOCK, UNLOCK")
+		}
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write 实现http.ResponseWriter接口
+func (w *lockOptionsWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap 返回原始ResponseWriter，供http.ResponseController使用
+func (w *lockOptionsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
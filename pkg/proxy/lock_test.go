@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLockBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>alice</D:owner></D:lockinfo>`
+
+func newLockTestHandler(t *testing.T, namespace func(r *http.Request) string) (http.Handler, string) {
+	backend := newDAVBackend(t)
+	h := NewLockMiddleware(newTestProxy(t, backend.URL, Options{}), &LockConfig{
+		Mode:       LockModeLocal,
+		MaxTimeout: time.Hour,
+		Namespace:  namespace,
+	})
+	return h, backend.URL
+}
+
+// lockPath 锁定p，返回锁令牌
+func lockPath(t *testing.T, h http.Handler, user, p string) string {
+	w := serve(h, user, "LOCK", p, testLockBody, "Timeout", "Second-600", "Content-Type", "application/xml")
+	if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("LOCK失败: %d %s", w.Code, w.Body.String())
+	}
+	token := strings.Trim(w.Header().Get("Lock-Token"), "<>")
+	if !strings.HasPrefix(token, "opaquelocktoken:") {
+		t.Fatalf("锁令牌错误: %s", token)
+	}
+	if !strings.Contains(w.Body.String(), "<D:timeout>Second-600</D:timeout>") {
+		t.Errorf("响应中的有效期错误: %s", w.Body.String())
+	}
+	return token
+}
+
+func TestLockCreatesEmptyFileAndBlocksWrites(t *testing.T) {
+	h, backendURL := newLockTestHandler(t, nil)
+	token := lockPath(t, h, "", "/a.txt")
+
+	if status, data := backendGet(t, backendURL, "/a.txt"); status != http.StatusOK || len(data) != 0 {
+		t.Fatalf("锁定不存在的路径应创建空文件: %d", status)
+	}
+
+	if w := serve(h, "", "PUT", "/a.txt", "hello"); w.Code != http.StatusLocked {
+		t.Fatalf("没有锁令牌的写入应返回423, 实际 %d", w.Code)
+	}
+	if w := serve(h, "", "DELETE", "/a.txt", ""); w.Code != http.StatusLocked {
+		t.Fatalf("没有锁令牌的删除应返回423, 实际 %d", w.Code)
+	}
+	if w := serve(h, "", "PUT", "/a.txt", "hello", "If", "(<"+token+">)"); w.Code/100 != 2 {
+		t.Fatalf("带有锁令牌的写入失败: %d", w.Code)
+	}
+	// 读取不受锁影响
+	if w := serve(h, "", "GET", "/a.txt", ""); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("读取失败: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(h, "", "UNLOCK", "/a.txt", "", "Lock-Token", "<"+token+">"); w.Code != http.StatusNoContent {
+		t.Fatalf("UNLOCK失败: %d", w.Code)
+	}
+	if w := serve(h, "", "DELETE", "/a.txt", ""); w.Code != http.StatusNoContent {
+		t.Errorf("解锁后应可以删除: %d", w.Code)
+	}
+}
+
+func TestLockConflictsAndRefresh(t *testing.T) {
+	h, _ := newLockTestHandler(t, nil)
+	serve(h, "", "MKCOL", "/dir/", "")
+	token := lockPath(t, h, "", "/dir/")
+
+	// 目录的锁默认为Depth: infinity，覆盖其中的文件
+	if w := serve(h, "", "LOCK", "/dir/a.txt", testLockBody); w.Code != http.StatusLocked {
+		t.Errorf("已锁定目录中的文件不能再加锁: %d", w.Code)
+	}
+	if w := serve(h, "", "MOVE", "/x.txt", "", "Destination", "http://proxy/dir/x.txt"); w.Code != http.StatusLocked {
+		t.Errorf("移动到已锁定的目录应返回423: %d", w.Code)
+	}
+
+	w := serve(h, "", "LOCK", "/dir/", "", "If", "(<"+token+">)", "Timeout", "Second-7200")
+	if w.Code != http.StatusOK {
+		t.Fatalf("刷新锁失败: %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Second-3600") {
+		t.Errorf("有效期应限制为max_timeout: %s", w.Body.String())
+	}
+	if w := serve(h, "", "UNLOCK", "/dir/", "", "Lock-Token", "<opaquelocktoken:other-1>"); w.Code != http.StatusBadRequest {
+		t.Errorf("其他来源的锁令牌应返回400: %d", w.Code)
+	}
+}
+
+func TestLockNamespaces(t *testing.T) {
+	h, _ := newLockTestHandler(t, func(r *http.Request) string { return UserFromRequest(r) })
+	lockPath(t, h, "alice", "/a.txt")
+
+	if w := serve(h, "alice", "PUT", "/a.txt", "x"); w.Code != http.StatusLocked {
+		t.Errorf("同一命名空间内应被锁定: %d", w.Code)
+	}
+	if w := serve(h, "bob", "PUT", "/a.txt", "x"); w.Code == http.StatusLocked {
+		t.Error("其他命名空间的同名路径不应被锁定")
+	}
+}
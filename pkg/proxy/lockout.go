@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// authFailureRecord 单个IP的认证失败记录
+type authFailureRecord struct {
+	failures    int
+	windowStart time.Time
+	bannedUntil time.Time
+}
+
+// authLockout 按IP统计认证失败次数，超过阈值后临时封禁
+type authLockout struct {
+	maxFailures int
+	window      time.Duration
+	banDuration time.Duration
+
+	mu          sync.Mutex
+	records     map[string]*authFailureRecord
+	lastCleanup time.Time
+}
+
+// newAuthLockout 创建认证失败封禁器，maxFailures<=0时返回nil表示不启用
+func newAuthLockout(maxFailures int, window, banDuration time.Duration) *authLockout {
+	if maxFailures <= 0 {
+		return nil
+	}
+	return &authLockout{
+		maxFailures: maxFailures,
+		window:      window,
+		banDuration: banDuration,
+		records:     make(map[string]*authFailureRecord),
+		lastCleanup: time.Now(),
+	}
+}
+
+// banned 检查IP是否处于封禁状态，返回剩余封禁时间
+func (l *authLockout) banned(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, ok := l.records[ip]
+	if !ok {
+		return false, 0
+	}
+	remaining := time.Until(record.bannedUntil)
+	return remaining > 0, remaining
+}
+
+// recordFailure 记录一次认证失败，返回当前窗口内的失败次数以及是否触发封禁
+func (l *authLockout) recordFailure(ip string) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.cleanup(now)
+
+	record, ok := l.records[ip]
+	if !ok || now.Sub(record.windowStart) > l.window {
+		record = &authFailureRecord{windowStart: now}
+		l.records[ip] = record
+	}
+	record.failures++
+
+	if record.failures >= l.maxFailures {
+		record.bannedUntil = now.Add(l.banDuration)
+		failures := record.failures
+		// 封禁后重新开始计数
+		record.failures = 0
+		record.windowStart = now
+		return failures, true
+	}
+	return record.failures, false
+}
+
+// reset 认证成功后清除IP的失败记录
+func (l *authLockout) reset(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if record, ok := l.records[ip]; ok && time.Now().After(record.bannedUntil) {
+		delete(l.records, ip)
+	}
+}
+
+// cleanup 清理过期的记录，调用方需持有锁
+func (l *authLockout) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < l.window {
+		return
+	}
+	for ip, record := range l.records {
+		if now.Sub(record.windowStart) > l.window && now.After(record.bannedUntil) {
+			delete(l.records, ip)
+		}
+	}
+	l.lastCleanup = now
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthLockoutBansAfterFailures(t *testing.T) {
+	h := newAuthTestServer(&ProxyAuthConfig{
+		Username:      "alice",
+		Password:      "secret",
+		MaxFailures:   3,
+		FailureWindow: time.Minute,
+		BanDuration:   time.Hour,
+	})
+
+	do := func(remoteAddr, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.RemoteAddr = remoteAddr
+		if password != "" {
+			req.SetBasicAuth("alice", password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// 不带凭据的请求是客户端正常的首次请求，不计入失败
+	for i := 0; i < 5; i++ {
+		if w := do("10.0.0.1:1", ""); w.Code != http.StatusUnauthorized {
+			t.Fatalf("不带凭据的请求应返回401, 实际 %d", w.Code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if w := do("10.0.0.1:1", "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("第 %d 次失败应返回401, 实际 %d", i+1, w.Code)
+		}
+	}
+	w := do("10.0.0.1:1", "secret")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("封禁期间正确的密码也应被拒绝, 实际 %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("封禁响应缺少Retry-After")
+	}
+	if w := do("10.0.0.2:1", "secret"); w.Code != http.StatusOK {
+		t.Errorf("其他IP不应被封禁: %d", w.Code)
+	}
+}
+
+func TestAuthLockoutResetOnSuccess(t *testing.T) {
+	l := newAuthLockout(3, time.Minute, time.Hour)
+	l.recordFailure("10.0.0.1")
+	l.recordFailure("10.0.0.1")
+	l.reset("10.0.0.1")
+	if failures, banned := l.recordFailure("10.0.0.1"); failures != 1 || banned {
+		t.Errorf("认证成功后应重新计数: failures=%d banned=%v", failures, banned)
+	}
+}
+
+func TestAuthLockoutWindowExpires(t *testing.T) {
+	l := newAuthLockout(2, 50*time.Millisecond, time.Hour)
+	l.recordFailure("10.0.0.1")
+	time.Sleep(100 * time.Millisecond)
+	if _, banned := l.recordFailure("10.0.0.1"); banned {
+		t.Error("窗口外的失败不应累计")
+	}
+	if _, banned := l.recordFailure("10.0.0.1"); !banned {
+		t.Error("窗口内达到上限应封禁")
+	}
+	if banned, remaining := l.banned("10.0.0.1"); !banned || remaining <= 0 {
+		t.Errorf("应处于封禁状态: %v %v", banned, remaining)
+	}
+}
+
+func TestAuthLockoutDisabled(t *testing.T) {
+	if l := newAuthLockout(0, time.Minute, time.Hour); l != nil {
+		t.Error("max_failures为0时不应启用")
+	}
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"webdav-proxy/utils"
+)
+
+// Mount 虚拟挂载点，将路径前缀映射到独立的代理处理器
+type Mount struct {
+	Prefix  string        // 路径前缀，如 /dropbox
+	Handler *ProxyHandler // 该挂载点的代理处理器，拥有独立的后端、认证和加密配置
+}
+
+// mountPrefixKey 请求上下文中保存挂载点前缀的键
+type mountPrefixKey struct{}
+
+// mountPrefix 获取请求所属挂载点的前缀，未使用挂载点时返回空字符串
+func mountPrefix(r *http.Request) string {
+	prefix, _ := r.Context().Value(mountPrefixKey{}).(string)
+	return prefix
+}
+
+// mountRouter 按路径前缀将请求分发到不同的挂载点，并在本地生成虚拟根目录
+type mountRouter struct {
+	mounts []Mount
+	logger utils.Logger
+}
+
+// NewMountRouter 创建虚拟挂载点路由
+func NewMountRouter(mounts []Mount, logger utils.Logger) http.Handler {
+	sorted := make([]Mount, len(mounts))
+	for i, m := range mounts {
+		sorted[i] = Mount{Prefix: "/" + strings.Trim(m.Prefix, "/"), Handler: m.Handler}
+	}
+	// 最长前缀优先匹配，允许 /nas 和 /nas/photos 同时存在
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	return &mountRouter{mounts: sorted, logger: logger}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *mountRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, mount := range m.mounts {
+		if r.URL.Path == mount.Prefix || strings.HasPrefix(r.URL.Path, mount.Prefix+"/") {
+			m.logger.Debug("[MOUNT] %s %s -> %s", r.Method, r.URL.Path, mount.Prefix)
+			ctx := context.WithValue(r.Context(), mountPrefixKey{}, mount.Prefix)
+			mount.Handler.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+	}
+
+	if r.URL.Path != "/" && r.URL.Path != "" {
+		http.NotFound(w, r)
+		return
+	}
+	m.serveRoot(w, r)
+}
+
+// serveRoot 处理虚拟根目录的请求，根目录只包含各挂载点
+func (m *mountRouter) serveRoot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+		w.Header().Set("DAV", "1")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		body := m.rootMultistatus(r.Header.Get("Depth") != "0")
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write(body)
+	case http.MethodGet, http.MethodHead:
+		var buf bytes.Buffer
+		buf.WriteString("<html><body><ul>\n")
+		for _, mount := range m.sortedMounts() {
+			fmt.Fprintf(&buf, "<li><a href=\"%s/\">%s/</a></li>\n", xmlEscape(escapePath(mount.Prefix)), xmlEscape(mount.Prefix))
+		}
+		buf.WriteString("</ul></body></html>\n")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(buf.Bytes())
+		}
+	default:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// rootMultistatus 生成虚拟根目录的PROPFIND响应
+func (m *mountRouter) rootMultistatus(withChildren bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	buf.WriteString(`<D:multistatus xmlns:D="DAV:">` + "\n")
+	writeCollection(&buf, "/", "")
+	if withChildren {
+		for _, mount := range m.sortedMounts() {
+			writeCollection(&buf, escapePath(mount.Prefix)+"/", strings.TrimPrefix(mount.Prefix, "/"))
+		}
+	}
+	buf.WriteString(`</D:multistatus>` + "\n")
+	return buf.Bytes()
+}
+
+// sortedMounts 返回按前缀字母顺序排列的挂载点，用于目录列表
+func (m *mountRouter) sortedMounts() []Mount {
+	mounts := make([]Mount, len(m.mounts))
+	copy(mounts, m.mounts)
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].Prefix < mounts[j].Prefix
+	})
+	return mounts
+}
+
+// getLogger 实现loggerProvider接口
+func (m *mountRouter) getLogger() utils.Logger {
+	return m.logger
+}
+
+// writeCollection 写入一个集合资源的PROPFIND响应项
+func writeCollection(buf *bytes.Buffer, href, name string) {
+	fmt.Fprintf(buf, "<D:response><D:href>%s</D:href><D:propstat><D:prop>"+
+		"<D:displayname>%s</D:displayname><D:resourcetype><D:collection/></D:resourcetype>"+
+		"</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>\n",
+		xmlEscape(href), xmlEscape(name))
+}
+
+// xmlEscape 转义XML文本
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// escapePath 对路径进行URL编码
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// hrefPattern 匹配PROPFIND响应中的href元素，兼容不同的命名空间前缀
+var hrefPattern = regexp.MustCompile(`(<(?:[A-Za-z0-9_.-]+:)?href(?:\s[^>]*)?>)([^<]*)(</(?:[A-Za-z0-9_.-]+:)?href>)`)
+
+// rewriteMountHrefs 将PROPFIND响应中的后端路径替换为挂载点路径
+func (h *ProxyHandler) rewriteMountHrefs(resp *http.Response, prefix string) error {
+	backend := h.backendForHost(resp.Request.URL.Host)
+	if backend == nil {
+		return nil
+	}
+	base := strings.TrimSuffix(backend.EscapedPath(), "/")
+	mountBase := escapePath(prefix)
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	body = hrefPattern.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := hrefPattern.FindSubmatch(match)
+		href := strings.ReplaceAll(string(parts[2]), "&amp;", "&")
+		u, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			return match
+		}
+		p := u.EscapedPath()
+		if p != base && !strings.HasPrefix(p, base+"/") {
+			return match
+		}
+		rewritten := mountBase + p[len(base):]
+		return []byte(string(parts[1]) + xmlEscape(rewritten) + string(parts[3]))
+	})
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// chunkAssemblyPattern 匹配Nextcloud/ownCloud分块上传的合并请求：MOVE uploads/<用户>/<传输ID>/.file
+var chunkAssemblyPattern = regexp.MustCompile(`/remote\.php/dav/uploads/[^/]+/[^/]+/\.file$`)
+
+// isChunkAssembly 判断请求是否为分块上传的合并请求
+func (h *ProxyHandler) isChunkAssembly(r *http.Request) bool {
+	return h.ncChunking && r.Method == "MOVE" && chunkAssemblyPattern.MatchString(r.URL.Path)
+}
+
+// uploadChunk 上传目录中的一个分块
+type uploadChunk struct {
+	name string
+	size int64
+}
+
+// assembleChunks 处理分块上传的合并请求。每个分块上传时按分块自身的大小加密，
+// 后端直接合并会得到无法解密的文件，因此由代理依次读取解密各分块，再按完整文件大小加密上传到目标路径
+func (h *ProxyHandler) assembleChunks(w http.ResponseWriter, r *http.Request) {
+	uploadDir := path.Dir(r.URL.Path)
+	destination, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || destination.Path == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	chunks, err := h.listChunks(r, uploadDir)
+	if err != nil {
+		h.logger.Error("[CHUNKING] 读取分块列表失败: %s, 错误: %v", uploadDir, err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	var total int64
+	for _, chunk := range chunks {
+		total += chunk.size
+	}
+	if expected := r.Header.Get("OC-Total-Length"); expected != "" && expected != strconv.FormatInt(total, 10) {
+		h.logger.Error("[CHUNKING] 分块总大小不一致: %s, 期望 %s 字节, 实际 %d 字节", uploadDir, expected, total)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	h.logger.Info("[CHUNKING] 合并分块上传: %s -> %s, %d 个分块, %d 字节", uploadDir, destination.Path, len(chunks), total)
+
+	// 依次下载解密各分块，写入管道作为上传请求的请求体
+	pr, pw := io.Pipe()
+	go func() {
+		for _, chunk := range chunks {
+			getReq := r.Clone(r.Context())
+			getReq.Method = http.MethodGet
+			getReq.URL.Path = uploadDir + "/" + chunk.name
+			getReq.URL.RawPath = ""
+			getReq.Body = http.NoBody
+			getReq.ContentLength = 0
+			getReq.Header = cleanChunkHeader(r.Header)
+
+			writer := &pipeResponseWriter{header: make(http.Header), pipe: pw}
+			h.reverseProxy.ServeHTTP(writer, getReq)
+			if writer.status != http.StatusOK || writer.written != chunk.size {
+				h.logger.Error("[CHUNKING] 读取分块失败: %s, 状态码: %d", getReq.URL.Path, writer.status)
+				pw.CloseWithError(io.ErrUnexpectedEOF)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	putReq := r.Clone(r.Context())
+	putReq.Method = http.MethodPut
+	putReq.URL.Path = destination.Path
+	putReq.URL.RawPath = ""
+	putReq.Body = pr
+	putReq.ContentLength = total
+	putReq.Header = cleanChunkHeader(r.Header)
+	putReq.Header.Set("Content-Length", strconv.FormatInt(total, 10))
+	putReq.Header.Set("Content-Type", "application/octet-stream")
+
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	h.reverseProxy.ServeHTTP(recorder, putReq)
+	pr.CloseWithError(io.ErrClosedPipe)
+	if recorder.status < 200 || recorder.status >= 300 {
+		h.logger.Error("[CHUNKING] 上传合并后的文件失败: %s, 状态码: %d", destination.Path, recorder.status)
+		http.Error(w, http.StatusText(recorder.status), recorder.status)
+		return
+	}
+
+	// 合并成功后删除上传目录
+	deleteReq := r.Clone(r.Context())
+	deleteReq.Method = http.MethodDelete
+	deleteReq.URL.Path = uploadDir
+	deleteReq.URL.RawPath = ""
+	deleteReq.Body = http.NoBody
+	deleteReq.ContentLength = 0
+	deleteReq.Header = cleanChunkHeader(r.Header)
+	h.reverseProxy.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, deleteReq)
+
+	for _, name := range []string{"ETag", "OC-ETag", "OC-FileId", "X-OC-MTime"} {
+		if value := recorder.header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(recorder.status)
+}
+
+// listChunks 列出上传目录中的分块，按分块编号排序
+func (h *ProxyHandler) listChunks(r *http.Request, uploadDir string) ([]uploadChunk, error) {
+	entries, _, err := h.listCollection(r, uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []uploadChunk
+	for _, entry := range entries {
+		if entry.name == ".file" || entry.collection || entry.size < 0 {
+			continue
+		}
+		chunks = append(chunks, uploadChunk{name: entry.name, size: entry.size})
+	}
+
+	// 分块名为编号（NC v2）或偏移量（ownCloud），都按数值排序
+	sort.Slice(chunks, func(i, j int) bool {
+		a, errA := strconv.ParseInt(chunks[i].name, 10, 64)
+		b, errB := strconv.ParseInt(chunks[j].name, 10, 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return chunks[i].name < chunks[j].name
+	})
+	return chunks, nil
+}
+
+// cleanChunkHeader 复制内部请求需要的请求头，去掉分块协议、条件请求和请求体相关的头
+func cleanChunkHeader(header http.Header) http.Header {
+	cleaned := header.Clone()
+	for _, name := range []string{"Destination", "Overwrite", "OC-Total-Length", "If", "Range", "Content-Length", "Content-Type", "Expect"} {
+		cleaned.Del(name)
+	}
+	removeConditionalHeaders(cleaned)
+	return cleaned
+}
+
+// pipeResponseWriter 把响应体写入管道的ResponseWriter，用于串联内部请求
+type pipeResponseWriter struct {
+	header  http.Header
+	status  int
+	written int64
+	pipe    *io.PipeWriter
+}
+
+// Header 实现http.ResponseWriter接口
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader 实现http.ResponseWriter接口
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write 实现http.ResponseWriter接口，只有成功的响应体才写入管道
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status != http.StatusOK {
+		return len(p), nil
+	}
+	n, err := w.pipe.Write(p)
+	w.written += int64(n)
+	return n, err
+}
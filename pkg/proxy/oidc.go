@@ -0,0 +1,362 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// OIDCConfig OIDC/JWT访问令牌认证配置
+type OIDCConfig struct {
+	Issuer   string // 令牌签发者，需与iss声明一致
+	Audience string // 令牌受众，需包含在aud声明中，为空则不校验
+	JWKSURL  string // JWKS地址，为空时通过issuer的发现文档获取
+}
+
+// jwtClaims 需要校验的JWT声明
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+	Username  string          `json:"preferred_username"`
+}
+
+// jsonWebKey JWKS中的单个公钥
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// oidcVerifier JWT校验器，缓存JWKS公钥
+type oidcVerifier struct {
+	config *OIDCConfig
+	client *http.Client
+	logger utils.Logger
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// JWKS公钥缓存时间，以及未知kid时的最小刷新间隔
+const (
+	jwksCacheTTL        = time.Hour
+	jwksMinRefreshDelay = time.Minute
+	jwtClockSkew        = 30 * time.Second
+)
+
+// newOIDCVerifier 创建JWT校验器
+func newOIDCVerifier(config *OIDCConfig, logger utils.Logger) *oidcVerifier {
+	return &oidcVerifier{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// Verify 校验JWT签名和声明，成功时返回用户名
+func (v *oidcVerifier) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("decode header: %w", err)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("decode claims: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("decode signature: %w", err)
+	}
+
+	key, err := v.getKey(header.Kid)
+	if err != nil {
+		return "", err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return "", err
+	}
+
+	if err := v.checkClaims(&claims); err != nil {
+		return "", err
+	}
+
+	if claims.Username != "" {
+		return claims.Username, nil
+	}
+	return claims.Subject, nil
+}
+
+// checkClaims 校验签发者、受众和有效期
+func (v *oidcVerifier) checkClaims(claims *jwtClaims) error {
+	if strings.TrimSuffix(claims.Issuer, "/") != strings.TrimSuffix(v.config.Issuer, "/") {
+		return fmt.Errorf("unexpected issuer: %s", claims.Issuer)
+	}
+
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtClockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(jwtClockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return fmt.Errorf("token not yet valid")
+	}
+
+	if v.config.Audience == "" {
+		return nil
+	}
+	// aud可以是字符串或字符串数组
+	var audiences []string
+	var single string
+	if err := json.Unmarshal(claims.Audience, &single); err == nil {
+		audiences = []string{single}
+	} else if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		return fmt.Errorf("invalid audience claim")
+	}
+	for _, aud := range audiences {
+		if aud == v.config.Audience {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected audience: %v", audiences)
+}
+
+// getKey 根据kid获取公钥，必要时刷新JWKS
+func (v *oidcVerifier) getKey(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.lookupKey(kid)
+	expired := time.Since(v.fetchedAt) > jwksCacheTTL
+	canRefresh := time.Since(v.fetchedAt) > jwksMinRefreshDelay
+	v.mu.RUnlock()
+
+	if ok && !expired {
+		return key, nil
+	}
+	if !ok && !expired && !canRefresh {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	if err := v.refreshKeys(); err != nil {
+		v.logger.Error("[AUTH] 获取JWKS失败: %v", err)
+		if ok {
+			// 刷新失败时继续使用旧公钥
+			return key, nil
+		}
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id: %s", kid)
+}
+
+// lookupKey 查找公钥，令牌未指定kid且只有一个公钥时直接使用该公钥
+func (v *oidcVerifier) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// refreshKeys 重新下载JWKS
+func (v *oidcVerifier) refreshKeys() error {
+	v.mu.Lock()
+	v.fetchedAt = time.Now()
+	v.mu.Unlock()
+
+	jwksURL := v.config.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		discoveryURL := strings.TrimSuffix(v.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(discoveryURL, &discovery); err != nil {
+			return fmt.Errorf("fetch discovery document: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return fmt.Errorf("discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.getJSON(jwksURL, &jwks); err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			v.logger.Debug("[AUTH] 跳过无法解析的JWK %s: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	v.logger.Debug("[AUTH] 已加载 %d 个JWKS公钥", len(keys))
+	return nil
+}
+
+// getJSON 下载并解析JSON文档
+func (v *oidcVerifier) getJSON(url string, out interface{}) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// publicKey 将JWK转换为公钥
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// verifyJWTSignature 校验JWT签名，支持RS*和ES*算法
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256([]byte(signingInput))
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384([]byte(signingInput))
+		digest = sum[:]
+	default:
+		sum := sha512.Sum512([]byte(signingInput))
+		digest = sum[:]
+	}
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s does not match RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm %s does not match EC key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key")
+	}
+}
+
+// decodeJWTSegment 解码JWT的base64url JSON段
+func decodeJWTSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
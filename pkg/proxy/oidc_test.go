@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testIssuer 发布发现文档和JWKS并签发ES256令牌的测试签发者
+type testIssuer struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	issuer := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.server.URL, "jwks_uri": issuer.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "k1",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// sign 签发带有指定声明的令牌
+func (i *testIssuer) sign(t *testing.T, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, i.key, digest[:])
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCVerify(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+	v := newOIDCVerifier(&OIDCConfig{Issuer: issuer.server.URL, Audience: "webdav"}, newTestHandler(t, "http://backend/").logger)
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{"有效令牌", issuer.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u1", "preferred_username": "alice", "aud": "webdav", "exp": now + 60}), "alice", false},
+		{"aud为数组且没有用户名", issuer.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u2", "aud": []string{"other", "webdav"}, "exp": now + 60}), "u2", false},
+		{"已过期", issuer.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u1", "aud": "webdav", "exp": now - 3600}), "", true},
+		{"尚未生效", issuer.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u1", "aud": "webdav", "exp": now + 7200, "nbf": now + 3600}), "", true},
+		{"受众不符", issuer.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u1", "aud": "other", "exp": now + 60}), "", true},
+		{"签发者不符", issuer.sign(t, map[string]any{"iss": "https://evil.example.com", "sub": "u1", "aud": "webdav", "exp": now + 60}), "", true},
+		{"其他密钥签名", other.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u1", "aud": "webdav", "exp": now + 60}), "", true},
+		{"格式错误", "not-a-jwt", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := v.Verify(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("应校验失败，实际得到用户 %s", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("校验失败: %v", err)
+			}
+			if user != tt.want {
+				t.Errorf("用户名错误: 期望 %s, 实际 %s", tt.want, user)
+			}
+		})
+	}
+}
+
+func TestOIDCRejectsAlgorithmMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	if err := verifyJWTSignature("RS256", issuer.key.Public(), "a.b", make([]byte, 64)); err == nil {
+		t.Error("RS256算法不应接受EC公钥")
+	}
+	if err := verifyJWTSignature("none", issuer.key.Public(), "a.b", nil); err == nil {
+		t.Error("不应接受none算法")
+	}
+}
+
+func TestProxyAuthOIDCToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	h := newAuthTestServer(&ProxyAuthConfig{OIDC: &OIDCConfig{Issuer: issuer.server.URL}})
+	token := issuer.sign(t, map[string]any{"iss": issuer.server.URL, "sub": "u1", "preferred_username": "alice", "exp": time.Now().Unix() + 60})
+
+	req := httptest.NewRequest("GET", "/a.txt", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Fatalf("OIDC令牌认证失败: %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/a.txt", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("签名错误的令牌应返回401, 实际 %d", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != `Bearer realm="WebDAV Proxy"` {
+		t.Errorf("只启用令牌认证时应提示Bearer: %s", got)
+	}
+}
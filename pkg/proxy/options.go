@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// davMethods 代理能够处理的方法
+var davMethods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// serveOptions 由代理应答OPTIONS请求。DAV和Allow按照代理的配置和后端的实际能力生成，
+// 后端声明的扩展（如CalDAV、ACL）经过代理后不一定可用，不再透传给客户端
+func (h *ProxyHandler) serveOptions(w http.ResponseWriter, r *http.Request) {
+	optionsReq := r.Clone(r.Context())
+	optionsReq.Body = http.NoBody
+	optionsReq.ContentLength = 0
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	h.reverseProxy.ServeHTTP(recorder, optionsReq)
+
+	backendClasses := map[string]bool{}
+	var backendAllow map[string]bool
+	if recorder.status >= 200 && recorder.status < 300 {
+		for _, class := range splitHeaderList(recorder.header.Values("DAV")) {
+			backendClasses[class] = true
+		}
+		if allow := recorder.header.Values("Allow"); len(allow) > 0 {
+			backendAllow = make(map[string]bool)
+			for _, method := range splitHeaderList(allow) {
+				backendAllow[strings.ToUpper(method)] = true
+			}
+		}
+	} else {
+		h.logger.Debug("[OPTIONS] 后端OPTIONS请求失败: %s, 状态码: %d", r.URL.Path, recorder.status)
+	}
+
+	// 后端不支持锁时只声明DAV 1，启用内置锁管理器时由锁中间件补充
+	classes := []string{"1"}
+	lockSupported := backendClasses["2"]
+	if lockSupported {
+		classes = append(classes, "2")
+	}
+	if backendClasses["3"] {
+		classes = append(classes, "3")
+	}
+
+	var methods []string
+	for _, method := range davMethods {
+		if h.allowedMethods != nil && !h.allowedMethods[method] && method != http.MethodOptions {
+			continue
+		}
+		if (method == "LOCK" || method == "UNLOCK") && !lockSupported {
+			continue
+		}
+		// 后端给出了该路径允许的方法时取交集，例如文件上不允许MKCOL
+		if backendAllow != nil && !backendAllow[method] && method != http.MethodOptions {
+			continue
+		}
+		methods = append(methods, method)
+	}
+
+	w.Header().Set("DAV", strings.Join(classes, ", "))
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.Header().Set("MS-Author-Via", "DAV")
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
+
+// splitHeaderList 拆分逗号分隔的多值响应头
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ParallelDownloadConfig 大文件并行分段下载配置
+type ParallelDownloadConfig struct {
+	Threshold   int64 // 下载范围达到该大小时启用并行下载，0表示不启用
+	Connections int   // 同时请求的分段数
+	SegmentSize int64 // 每个分段的大小
+}
+
+// useParallelDownload 判断是否对该下载启用并行分段下载，后端必须支持Range请求
+func (t *proxyTransport) useParallelDownload(req *http.Request, resp *http.Response, start, end int64) bool {
+	config := t.handler.parallelDownload
+	if config == nil || config.Threshold <= 0 || config.Connections < 2 || req.Method != http.MethodGet {
+		return false
+	}
+	if end-start+1 < config.Threshold || end-start+1 <= config.SegmentSize {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Header.Get("Content-Range") != ""
+	case http.StatusOK:
+		return req.Header.Get("Range") == "" && strings.Contains(resp.Header.Get("Accept-Ranges"), "bytes")
+	}
+	return false
+}
+
+// segmentResult 分段下载结果
+type segmentResult struct {
+	data []byte
+	err  error
+}
+
+// parallelRangeReader 并发地按Range分段从后端下载，并按顺序拼接成连续的数据流。
+// 第一个分段直接读取已有的响应体，同时下载和已下载未读取的分段总数不超过Connections，内存占用有上限
+type parallelRangeReader struct {
+	transport *proxyTransport
+	req       *http.Request
+	first     io.ReadCloser
+	etag      string
+	config    *ParallelDownloadConfig
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	slots   chan struct{}
+	results chan chan segmentResult
+	current []byte
+	err     error
+}
+
+// newParallelRangeReader 创建并行分段读取器，resp为后端对[start, end]范围的响应
+func (t *proxyTransport) newParallelRangeReader(req *http.Request, resp *http.Response, start, end int64) *parallelRangeReader {
+	config := t.handler.parallelDownload
+	ctx, cancel := context.WithCancel(req.Context())
+	r := &parallelRangeReader{
+		transport: t,
+		req:       req,
+		first:     resp.Body,
+		etag:      resp.Header.Get("ETag"),
+		config:    config,
+		ctx:       ctx,
+		cancel:    cancel,
+		slots:     make(chan struct{}, config.Connections),
+		results:   make(chan chan segmentResult, config.Connections),
+	}
+	go r.schedule(start, end)
+	return r
+}
+
+// schedule 按顺序启动各分段的下载
+func (r *parallelRangeReader) schedule(start, end int64) {
+	defer close(r.results)
+	for offset := start; offset <= end; offset += r.config.SegmentSize {
+		segmentEnd := min(offset+r.config.SegmentSize-1, end)
+
+		select {
+		case r.slots <- struct{}{}:
+		case <-r.ctx.Done():
+			return
+		}
+		result := make(chan segmentResult, 1)
+		r.results <- result
+
+		go func(first bool, offset, segmentEnd int64) {
+			if first {
+				result <- r.readFirst(segmentEnd - offset + 1)
+			} else {
+				result <- r.fetch(offset, segmentEnd)
+			}
+		}(offset == start, offset, segmentEnd)
+	}
+}
+
+// readFirst 从原始响应体读取第一个分段，读完后关闭原始连接
+func (r *parallelRangeReader) readFirst(length int64) segmentResult {
+	defer r.first.Close()
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.first, data); err != nil {
+		return segmentResult{err: err}
+	}
+	return segmentResult{data: data}
+}
+
+// fetch 用Range请求下载一个分段
+func (r *parallelRangeReader) fetch(start, end int64) segmentResult {
+	segmentReq := r.req.Clone(r.ctx)
+	segmentReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	// 前提条件已由第一个分段的响应满足，后续分段通过ETag确认文件未变化
+	removeConditionalHeaders(segmentReq.Header)
+
+	resp, err := r.transport.roundTripWithRetry(segmentReq)
+	if err != nil {
+		return segmentResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return segmentResult{err: fmt.Errorf("backend returned %d for range %d-%d", resp.StatusCode, start, end)}
+	}
+	// 文件在下载过程中被修改时，拼接出的数据会不一致
+	if etag := resp.Header.Get("ETag"); r.etag != "" && etag != "" && etag != r.etag {
+		return segmentResult{err: fmt.Errorf("file changed during download: ETag %s -> %s", r.etag, etag)}
+	}
+
+	data := make([]byte, end-start+1)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return segmentResult{err: err}
+	}
+	return segmentResult{data: data}
+}
+
+// Read 实现io.Reader接口，按顺序返回各分段的数据
+func (r *parallelRangeReader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		result, ok := <-r.results
+		if !ok {
+			// 调度因请求取消而提前结束时不能当作正常结束
+			if err := r.ctx.Err(); err != nil {
+				r.err = err
+			} else {
+				r.err = io.EOF
+			}
+			continue
+		}
+		segment := <-result
+		<-r.slots
+		if segment.err != nil {
+			r.transport.handler.logger.Error("[DOWNLOAD] 并行分段下载失败: %s, 错误: %v", r.req.URL.Path, segment.err)
+			r.err = segment.err
+			r.cancel()
+			continue
+		}
+		r.current = segment.data
+	}
+
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close 取消未完成的分段下载并关闭原始响应体
+func (r *parallelRangeReader) Close() error {
+	r.cancel()
+	return r.first.Close()
+}
@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 可缓存的PROPFIND请求体和响应体大小上限
+const (
+	maxPropfindCacheRequest  = 64 * 1024
+	maxPropfindCacheResponse = 4 << 20
+	maxPropfindCacheEntries  = 10000
+)
+
+// propfindCache 按路径、Depth和请求体缓存PROPFIND响应，经过代理的写操作会使相关条目失效
+type propfindCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*propfindCacheEntry
+}
+
+// propfindCacheEntry PROPFIND缓存项
+type propfindCacheEntry struct {
+	path    string
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// newPropfindCache 创建PROPFIND缓存，ttl<=0时返回nil
+func newPropfindCache(ttl time.Duration) *propfindCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &propfindCache{
+		ttl:     ttl,
+		entries: make(map[string]*propfindCacheEntry),
+	}
+}
+
+// cleanCachePath 规范化缓存路径，去掉末尾的斜杠
+func cleanCachePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// get 获取未过期的缓存项
+func (c *propfindCache) get(key string) *propfindCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// set 写入缓存项，条目过多时先清理过期项
+func (c *propfindCache) set(key, p string, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxPropfindCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// 仍然过多时随机淘汰，保证内存有上限
+		for k := range c.entries {
+			if len(c.entries) < maxPropfindCacheEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = &propfindCacheEntry{
+		path:    cleanCachePath(p),
+		header:  header,
+		body:    body,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// invalidate 使路径本身、其所有子路径以及父目录的缓存失效
+func (c *propfindCache) invalidate(paths ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range paths {
+		p = cleanCachePath(p)
+		parent := path.Dir(p)
+		for k, entry := range c.entries {
+			if entry.path == p || entry.path == parent || strings.HasPrefix(entry.path, strings.TrimSuffix(p, "/")+"/") {
+				delete(c.entries, k)
+			}
+		}
+	}
+}
+
+// propfindCacheKey 计算缓存键，不同用户的认证信息和不同的请求属性分开缓存
+func propfindCacheKey(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(cleanCachePath(r.URL.Path)))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Header.Get("Depth")))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Header.Get("Authorization")))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeTargets 返回写操作影响的路径，COPY和MOVE还包括目标路径
+func writeTargets(r *http.Request) []string {
+	targets := []string{r.URL.Path}
+	if destination := r.Header.Get("Destination"); destination != "" {
+		if u, err := url.Parse(destination); err == nil {
+			targets = append(targets, u.Path)
+		}
+	}
+	return targets
+}
+
+// servePropfind 处理PROPFIND请求，优先返回缓存的响应
+func (h *ProxyHandler) servePropfind(w http.ResponseWriter, r *http.Request) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxPropfindCacheRequest+1))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxPropfindCacheRequest {
+			// 请求体过大，不缓存
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			h.reverseProxy.ServeHTTP(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+
+	key := propfindCacheKey(r, body)
+	if entry := h.propfindCache.get(key); entry != nil {
+		h.logger.Debug("[PROPFIND-CACHE] 命中缓存: %s, Depth: %s", r.URL.Path, r.Header.Get("Depth"))
+		for k, v := range entry.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write(entry.body)
+		return
+	}
+
+	recorder := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w}, limit: maxPropfindCacheResponse}
+	h.reverseProxy.ServeHTTP(recorder, r)
+	if recorder.Status() == http.StatusMultiStatus && !recorder.overflow {
+		header := w.Header().Clone()
+		header.Del("Date")
+		h.propfindCache.set(key, r.URL.Path, header, recorder.buf.Bytes())
+	}
+}
+
+// bodyRecorder 在写入响应的同时保存响应体，超过上限后停止保存
+type bodyRecorder struct {
+	statusRecorder
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+// Write 写入响应并保存副本
+func (r *bodyRecorder) Write(p []byte) (int, error) {
+	if !r.overflow {
+		if r.buf.Len()+len(p) > r.limit {
+			r.overflow = true
+			r.buf.Reset()
+		} else {
+			r.buf.Write(p)
+		}
+	}
+	return r.statusRecorder.Write(p)
+}
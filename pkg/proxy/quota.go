@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"webdav-proxy/pkg/davclient"
+	"webdav-proxy/utils"
+)
+
+// QuotaConfig 用户存储配额配置
+type QuotaConfig struct {
+	Limit     int64  // 每个用户允许存储的总字节数，0表示不限制
+	StateFile string // 已用配额的持久化文件路径
+}
+
+// quotaMiddleware 按认证用户统计存储的字节数，超出配额时拒绝上传。上传过程中按已读取的字节数
+// 预留配额，同时进行的上传不会一起超出配额；删除和覆盖文件时减去原文件的大小
+type quotaMiddleware struct {
+	handler http.Handler
+	config  *QuotaConfig
+	logger  utils.Logger
+
+	mu       sync.Mutex
+	usage    map[string]int64
+	reserved map[string]int64 // 进行中的上传预留的字节数
+}
+
+// errQuotaExceeded 上传的数据超出了剩余配额
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// NewQuotaMiddleware 创建用户配额中间件
+func NewQuotaMiddleware(handler http.Handler, config *QuotaConfig) (http.Handler, error) {
+	if config == nil || config.Limit <= 0 {
+		return handler, nil
+	}
+
+	m := &quotaMiddleware{
+		handler:  handler,
+		config:   config,
+		logger:   handlerLogger(handler),
+		usage:    make(map[string]int64),
+		reserved: make(map[string]int64),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *quotaMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		m.servePut(w, r)
+	case http.MethodDelete, "MOVE", "COPY":
+		m.serveRelease(w, r)
+	default:
+		m.handler.ServeHTTP(w, r)
+	}
+}
+
+// quotaUser 返回统计配额的用户名，未认证时统一记为anonymous
+func quotaUser(r *http.Request) string {
+	if user := UserFromRequest(r); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// servePut 预留上传的字节数后转发请求，覆盖已有文件时只需要预留超出原文件大小的部分。
+// 没有Content-Length的分块上传在读取过程中逐步预留，超出配额时中止上传
+func (m *quotaMiddleware) servePut(w http.ResponseWriter, r *http.Request) {
+	user := quotaUser(r)
+	old := m.size(r, r.URL.Path)
+	size := max(r.ContentLength, 0)
+
+	upload := &quotaReservation{m: m, user: user, credit: old}
+	if err := upload.grow(size); err != nil {
+		m.logger.Warn("[QUOTA] 用户 %s 超出配额: 已用 %d 字节, 本次 %d 字节, 配额 %d 字节", user, m.used(user), r.ContentLength, m.config.Limit)
+		http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+		return
+	}
+	defer upload.release()
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &quotaReader{ReadCloser: r.Body, upload: upload}
+	}
+	recorder := &statusRecorder{ResponseWriter: w}
+	m.handler.ServeHTTP(recorder, r)
+
+	if upload.exceeded {
+		m.logger.Warn("[QUOTA] 用户 %s 的上传超出配额，已中止: %s", user, r.URL.Path)
+	}
+	if recorder.Status() >= 200 && recorder.Status() < 300 {
+		m.add(user, upload.read-old)
+	}
+}
+
+// serveRelease DELETE减去删除的文件大小；MOVE和COPY覆盖已有的目标时减去目标的大小，COPY加上复制的大小
+func (m *quotaMiddleware) serveRelease(w http.ResponseWriter, r *http.Request) {
+	user := quotaUser(r)
+	var delta int64
+	if r.Method == http.MethodDelete {
+		delta = -m.size(r, r.URL.Path)
+	} else {
+		destination, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil || destination.Path == "" {
+			m.handler.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Overwrite") != "F" {
+			delta = -m.size(r, destination.Path)
+		}
+		if r.Method == "COPY" {
+			copied := m.size(r, r.URL.Path)
+			if m.used(user)+delta+copied > m.config.Limit {
+				m.logger.Warn("[QUOTA] 用户 %s 超出配额: 已用 %d 字节, 复制 %d 字节, 配额 %d 字节", user, m.used(user), copied, m.config.Limit)
+				http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+				return
+			}
+			delta += copied
+		}
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w}
+	m.handler.ServeHTTP(recorder, r)
+	if delta != 0 && recorder.Status() >= 200 && recorder.Status() < 300 {
+		m.add(user, delta)
+	}
+}
+
+// size 返回客户端路径p上的文件大小，目录为其中所有文件大小之和，不存在时返回0
+func (m *quotaMiddleware) size(r *http.Request, p string) int64 {
+	client := davclient.New(m.handler).WithRemoteAddr(r.RemoteAddr)
+	e, err := client.Stat(r.Context(), p)
+	if err != nil {
+		if !davclient.IsNotFound(err) {
+			m.logger.Debug("[QUOTA] 获取 %s 的大小失败: %v", p, err)
+		}
+		return 0
+	}
+	if !e.Dir {
+		return max(e.Size, 0)
+	}
+	var total int64
+	entries, err := client.List(r.Context(), p)
+	if err != nil {
+		m.logger.Debug("[QUOTA] 列出 %s 失败: %v", p, err)
+		return 0
+	}
+	for _, e := range entries {
+		if e.Dir {
+			total += m.size(r, path.Join(p, e.Name))
+		} else {
+			total += max(e.Size, 0)
+		}
+	}
+	return total
+}
+
+// getLogger 实现loggerProvider接口
+func (m *quotaMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// used 返回用户已用配额
+func (m *quotaMiddleware) used(user string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage[user]
+}
+
+// add 增减用户已用配额并持久化，已用配额不会小于0
+func (m *quotaMiddleware) add(user string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.usage[user] = max(m.usage[user]+n, 0)
+	if m.usage[user] == 0 {
+		delete(m.usage, user)
+	}
+	m.logger.Debug("[QUOTA] 用户 %s 已用配额: %d/%d 字节", user, m.usage[user], m.config.Limit)
+	if err := m.save(); err != nil {
+		m.logger.Error("[QUOTA] 保存配额状态失败: %v", err)
+	}
+}
+
+// quotaReservation 一次上传预留的配额，credit为被覆盖的原文件大小，不需要预留
+type quotaReservation struct {
+	m        *quotaMiddleware
+	user     string
+	credit   int64
+	reserved int64
+	read     int64
+	exceeded bool
+}
+
+// grow 确保预留的字节数足够上传total字节，在同一把锁内检查和预留
+func (u *quotaReservation) grow(total int64) error {
+	need := total - u.credit - u.reserved
+	if need <= 0 {
+		return nil
+	}
+	m := u.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.usage[u.user]+m.reserved[u.user]+need > m.config.Limit {
+		u.exceeded = true
+		return errQuotaExceeded
+	}
+	m.reserved[u.user] += need
+	u.reserved += need
+	return nil
+}
+
+// release 上传结束后释放预留，成功的上传由调用方计入已用配额
+func (u *quotaReservation) release() {
+	m := u.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reserved[u.user] -= u.reserved
+	if m.reserved[u.user] <= 0 {
+		delete(m.reserved, u.user)
+	}
+	u.reserved = 0
+}
+
+// quotaReader 统计读取的字节数，超过预留时继续预留，配额不足时返回错误中止上传
+type quotaReader struct {
+	io.ReadCloser
+	upload *quotaReservation
+}
+
+// Read 实现io.Reader接口
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.upload.read += int64(n)
+	if growErr := r.upload.grow(r.upload.read); growErr != nil {
+		return n, growErr
+	}
+	return n, err
+}
+
+// load 从状态文件加载已用配额
+func (m *quotaMiddleware) load() error {
+	if m.config.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.config.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &m.usage)
+}
+
+// save 将已用配额写入状态文件，调用方需持有锁
+func (m *quotaMiddleware) save() error {
+	if m.config.StateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免写入中断导致状态文件损坏
+	tmpFile := m.config.StateFile + ".tmp"
+	if dir := filepath.Dir(m.config.StateFile); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, m.config.StateFile)
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newQuotaTestHandler(t *testing.T, limit int64) *quotaMiddleware {
+	backend := newDAVBackend(t)
+	h, err := NewQuotaMiddleware(newTestProxy(t, backend.URL, Options{}), &QuotaConfig{Limit: limit})
+	if err != nil {
+		t.Fatalf("创建配额中间件失败: %v", err)
+	}
+	return h.(*quotaMiddleware)
+}
+
+func TestQuotaRejectsUploadOverLimit(t *testing.T) {
+	m := newQuotaTestHandler(t, 100)
+
+	if w := serve(m, "alice", "PUT", "/a.bin", strings.Repeat("a", 60)); w.Code != http.StatusCreated {
+		t.Fatalf("上传失败: %d", w.Code)
+	}
+	if w := serve(m, "alice", "PUT", "/b.bin", strings.Repeat("b", 60)); w.Code != http.StatusInsufficientStorage {
+		t.Fatalf("超出配额应返回507, 实际 %d", w.Code)
+	}
+	if got := m.used("alice"); got != 60 {
+		t.Errorf("已用配额错误: %d", got)
+	}
+	if w := serve(m, "bob", "PUT", "/b.bin", strings.Repeat("b", 60)); w.Code != http.StatusCreated {
+		t.Errorf("其他用户不应受影响: %d", w.Code)
+	}
+}
+
+func TestQuotaOverwriteAndDelete(t *testing.T) {
+	m := newQuotaTestHandler(t, 100)
+
+	serve(m, "alice", "PUT", "/a.bin", strings.Repeat("a", 80))
+	// 覆盖时只计算与原文件的差值，满额时也可以覆盖为相同大小的内容
+	if w := serve(m, "alice", "PUT", "/a.bin", strings.Repeat("b", 90)); w.Code != http.StatusNoContent && w.Code != http.StatusCreated {
+		t.Fatalf("覆盖失败: %d", w.Code)
+	}
+	if got := m.used("alice"); got != 90 {
+		t.Fatalf("覆盖后已用配额应为90, 实际 %d", got)
+	}
+
+	if w := serve(m, "alice", "DELETE", "/a.bin", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("删除失败: %d", w.Code)
+	}
+	if got := m.used("alice"); got != 0 {
+		t.Fatalf("删除后已用配额应为0, 实际 %d", got)
+	}
+	if w := serve(m, "alice", "PUT", "/c.bin", strings.Repeat("c", 100)); w.Code != http.StatusCreated {
+		t.Errorf("删除后应可以重新上传: %d", w.Code)
+	}
+}
+
+func TestQuotaDeleteCollection(t *testing.T) {
+	m := newQuotaTestHandler(t, 1000)
+
+	serve(m, "alice", "MKCOL", "/dir/", "")
+	serve(m, "alice", "MKCOL", "/dir/sub/", "")
+	serve(m, "alice", "PUT", "/dir/a.bin", strings.Repeat("a", 100))
+	serve(m, "alice", "PUT", "/dir/sub/b.bin", strings.Repeat("b", 200))
+	serve(m, "alice", "PUT", "/keep.bin", strings.Repeat("k", 50))
+	if got := m.used("alice"); got != 350 {
+		t.Fatalf("已用配额错误: %d", got)
+	}
+	if w := serve(m, "alice", "DELETE", "/dir/", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("删除目录失败: %d", w.Code)
+	}
+	if got := m.used("alice"); got != 50 {
+		t.Errorf("删除目录后应减去其中所有文件的大小, 实际 %d", got)
+	}
+}
+
+func TestQuotaMoveAndCopy(t *testing.T) {
+	m := newQuotaTestHandler(t, 1000)
+
+	serve(m, "alice", "PUT", "/a.bin", strings.Repeat("a", 100))
+	serve(m, "alice", "PUT", "/b.bin", strings.Repeat("b", 300))
+	// 移动覆盖b.bin，b.bin原来的300字节被释放
+	if w := serve(m, "alice", "MOVE", "/a.bin", "", "Destination", "http://proxy/b.bin", "Overwrite", "T"); w.Code != http.StatusNoContent {
+		t.Fatalf("移动失败: %d", w.Code)
+	}
+	if got := m.used("alice"); got != 100 {
+		t.Fatalf("移动覆盖后已用配额应为100, 实际 %d", got)
+	}
+	if w := serve(m, "alice", "COPY", "/b.bin", "", "Destination", "http://proxy/c.bin"); w.Code != http.StatusCreated {
+		t.Fatalf("复制失败: %d", w.Code)
+	}
+	if got := m.used("alice"); got != 200 {
+		t.Errorf("复制后已用配额应为200, 实际 %d", got)
+	}
+}
+
+func TestQuotaConcurrentUploadsReserve(t *testing.T) {
+	m := newQuotaTestHandler(t, 100)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(m, "alice", "PUT", "/f"+strings.Repeat("x", i)+".bin", strings.Repeat("a", 40)).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		if code == http.StatusCreated {
+			created++
+		}
+	}
+	if created != 2 {
+		t.Errorf("100字节的配额只能容纳2个40字节的上传, 实际成功 %d 个: %v", created, codes)
+	}
+	if got := m.used("alice"); got != 80 {
+		t.Errorf("已用配额错误: %d", got)
+	}
+	if len(m.reserved) != 0 {
+		t.Errorf("上传结束后预留应全部释放: %v", m.reserved)
+	}
+}
+
+func TestQuotaAbortsChunkedUploadOverLimit(t *testing.T) {
+	m := newQuotaTestHandler(t, 100)
+
+	req := httptest.NewRequest("PUT", "/a.bin", io.NopCloser(strings.NewReader(strings.Repeat("a", 200))))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req = req.WithContext(ContextWithUser(req.Context(), "alice"))
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("没有Content-Length的上传超出配额时应返回507, 实际 %d", w.Code)
+	}
+	if got := m.used("alice"); got != 0 {
+		t.Errorf("失败的上传不应计入配额: %d", got)
+	}
+}
@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// byteRange 字节范围，end包含在内
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// parseRanges 按文件大小解析Range头中的全部范围，支持 bytes=100-199、bytes=100- 和 bytes=-500。
+// 结果按起始位置排序并合并重叠或相邻的范围；格式错误返回false，所有范围都无法满足时返回空列表
+func parseRanges(rangeHeader string, size int64) ([]byteRange, bool) {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok {
+		return nil, false
+	}
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		startStr, endStr, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return nil, false
+		}
+		if startStr == "" {
+			// 后缀范围：文件最后n个字节
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			if n == 0 || size <= 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			ranges = append(ranges, byteRange{start: size - n, end: size - 1})
+			continue
+		}
+		start, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil || start < 0 {
+			return nil, false
+		}
+		end := size - 1
+		if endStr != "" {
+			end, err = strconv.ParseInt(endStr, 10, 64)
+			if err != nil || end < start {
+				return nil, false
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start: start, end: end})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if last := len(merged) - 1; last >= 0 && r.start <= merged[last].end+1 {
+			if r.end > merged[last].end {
+				merged[last].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged, true
+}
+
+// parseSingleRange 解析单个字节范围，如 bytes=100-199、bytes=100- 或 bytes=-500，多个范围或无法满足时返回false
+func parseSingleRange(rangeHeader string, size int64) (int64, int64, bool) {
+	if rangeHeader == "" {
+		return 0, size - 1, true
+	}
+	if strings.Contains(rangeHeader, ",") {
+		return 0, 0, false
+	}
+	ranges, ok := parseRanges(rangeHeader, size)
+	if !ok || len(ranges) != 1 {
+		return 0, 0, false
+	}
+	return ranges[0].start, ranges[0].end, true
+}
+
+// coveringRange 计算覆盖多个范围的单个范围，在不知道文件大小时发给后端。
+// 有后缀范围或不带结束位置的范围时覆盖到文件末尾，全部是后缀范围时取最长的后缀
+func coveringRange(rangeHeader string) (string, bool) {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok {
+		return "", false
+	}
+	minStart, maxEnd, maxSuffix := int64(-1), int64(-1), int64(0)
+	toEnd := false
+	for _, part := range strings.Split(spec, ",") {
+		startStr, endStr, ok := strings.Cut(strings.TrimSpace(part), "-")
+		if !ok {
+			return "", false
+		}
+		if startStr == "" {
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return "", false
+			}
+			maxSuffix = max(maxSuffix, n)
+			toEnd = true
+			continue
+		}
+		start, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil || start < 0 {
+			return "", false
+		}
+		if minStart < 0 || start < minStart {
+			minStart = start
+		}
+		if endStr == "" {
+			toEnd = true
+			continue
+		}
+		end, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return "", false
+		}
+		maxEnd = max(maxEnd, end)
+	}
+	switch {
+	case minStart < 0:
+		return fmt.Sprintf("bytes=-%d", maxSuffix), true
+	case toEnd:
+		return fmt.Sprintf("bytes=%d-", minStart), true
+	default:
+		return fmt.Sprintf("bytes=%d-%d", minStart, maxEnd), true
+	}
+}
+
+// multipartBody 由后台协程写入的multipart/byteranges响应体，关闭时同时关闭原始响应体
+type multipartBody struct {
+	*io.PipeReader
+	source io.Closer
+}
+
+// Close 实现io.Closer接口
+func (b *multipartBody) Close() error {
+	b.PipeReader.Close()
+	return b.source.Close()
+}
+
+// multipartSize 计算multipart/byteranges响应体的长度
+func multipartSize(ranges []byteRange, boundary, contentType string, size int64) int64 {
+	counter := &countingWriter{w: io.Discard}
+	mw := multipart.NewWriter(counter)
+	mw.SetBoundary(boundary)
+	for _, r := range ranges {
+		mw.CreatePart(rangePartHeader(r, contentType, size))
+		counter.n += r.end - r.start + 1
+	}
+	mw.Close()
+	return counter.n
+}
+
+// rangePartHeader multipart/byteranges中每个部分的头信息
+func rangePartHeader(r byteRange, contentType string, size int64) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size))
+	return header
+}
+
+// splitRanges 把覆盖全部范围的206响应拆分为客户端请求的多个范围。
+// start为响应体在文件中的起始位置，只有一个范围时返回普通的206响应，否则返回multipart/byteranges
+func (h *ProxyHandler) splitRanges(resp *http.Response, rangeHeader string, start, size int64) {
+	ranges, ok := parseRanges(rangeHeader, size)
+	if !ok || len(ranges) == 0 || ranges[0].start < start {
+		return
+	}
+	source := resp.Body
+	resp.Header.Del("Content-Range")
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := io.CopyN(io.Discard, source, r.start-start)
+			if err == nil {
+				_, err = io.CopyN(pw, source, r.end-r.start+1)
+			}
+			pw.CloseWithError(err)
+		}()
+		resp.Body = &multipartBody{PipeReader: pr, source: source}
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size))
+		resp.Header.Set("Content-Length", strconv.FormatInt(r.end-r.start+1, 10))
+		resp.ContentLength = r.end - r.start + 1
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	length := multipartSize(ranges, mw.Boundary(), contentType, size)
+	h.logger.Debug("[DOWNLOAD] 多范围请求: %d 个范围, 响应长度: %d", len(ranges), length)
+
+	go func() {
+		pos := start
+		for _, r := range ranges {
+			if _, err := io.CopyN(io.Discard, source, r.start-pos); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			part, err := mw.CreatePart(rangePartHeader(r, contentType, size))
+			if err == nil {
+				_, err = io.CopyN(part, source, r.end-r.start+1)
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			pos = r.end + 1
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+
+	resp.Body = &multipartBody{PipeReader: pr, source: source}
+	resp.Header.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	resp.ContentLength = length
+}
@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// RateLimitConfig 客户端限流配置
+type RateLimitConfig struct {
+	KeyBy             string  // 限流维度：ip（客户端IP）或user（认证用户，未认证时回退到IP）
+	RequestsPerSecond float64 // 每个客户端每秒允许的请求数，0表示不限制
+	Burst             int     // 请求突发上限
+	BytesPerSecond    int64   // 每个客户端的带宽上限(字节/秒)，0表示不限制
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // 每秒补充的令牌数
+	capacity float64 // 桶容量
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket 创建令牌桶，初始为满
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	capacity := float64(burst)
+	if capacity < 1 {
+		capacity = math.Max(1, rate)
+	}
+	return &tokenBucket{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// refill 根据经过的时间补充令牌，调用方需持有锁
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// Allow 尝试获取n个令牌，失败时返回需要等待的时间
+func (b *tokenBucket) Allow(n float64) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, 0
+	}
+	wait := time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// Wait 获取n个令牌，令牌不足时阻塞等待，允许预支超过桶容量的令牌
+func (b *tokenBucket) Wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader 按令牌桶限速的读取器
+type throttledReader struct {
+	io.ReadCloser
+	ctx     context.Context
+	buckets []*tokenBucket
+}
+
+// Read 读取数据后按读取字节数消耗令牌
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		for _, bucket := range r.buckets {
+			if waitErr := bucket.Wait(r.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
+
+// throttledResponseWriter 按令牌桶限速的响应写入器
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	buckets []*tokenBucket
+}
+
+// 限速时每次读写的最大字节数，避免一次预支过多令牌
+const throttleChunkSize = 32 * 1024
+
+// Write 分块写入数据，每块写入前消耗令牌
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + throttleChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		for _, bucket := range w.buckets {
+			if err := bucket.Wait(w.ctx, end-written); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Flush 实现http.Flusher接口
+func (w *throttledResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 供http.ResponseController获取原始ResponseWriter
+func (w *throttledResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clientLimiter 单个客户端的限流状态
+type clientLimiter struct {
+	requests  *tokenBucket
+	bandwidth *tokenBucket
+	lastSeen  time.Time
+}
+
+// rateLimitMiddleware 客户端限流中间件
+type rateLimitMiddleware struct {
+	handler http.Handler
+	config  *RateLimitConfig
+	logger  utils.Logger
+
+	mu          sync.Mutex
+	clients     map[string]*clientLimiter
+	lastCleanup time.Time
+}
+
+// 客户端限流状态的空闲回收时间
+const clientLimiterIdleTimeout = 10 * time.Minute
+
+// NewRateLimitMiddleware 创建客户端限流中间件
+func NewRateLimitMiddleware(handler http.Handler, config *RateLimitConfig) http.Handler {
+	if config == nil || (config.RequestsPerSecond <= 0 && config.BytesPerSecond <= 0) {
+		return handler
+	}
+
+	return &rateLimitMiddleware{
+		handler:     handler,
+		config:      config,
+		logger:      handlerLogger(handler),
+		clients:     make(map[string]*clientLimiter),
+		lastCleanup: time.Now(),
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *rateLimitMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := m.clientKey(r)
+	limiter := m.getLimiter(key)
+
+	if limiter.requests != nil {
+		if ok, wait := limiter.requests.Allow(1); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			m.logger.Warn("[RATELIMIT] 请求过于频繁: %s %s %s", key, r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if limiter.bandwidth != nil {
+		buckets := []*tokenBucket{limiter.bandwidth}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &throttledReader{ReadCloser: r.Body, ctx: r.Context(), buckets: buckets}
+		}
+		w = &throttledResponseWriter{ResponseWriter: w, ctx: r.Context(), buckets: buckets}
+	}
+
+	m.handler.ServeHTTP(w, r)
+}
+
+// getLogger 实现loggerProvider接口
+func (m *rateLimitMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// clientKey 计算限流键
+func (m *rateLimitMiddleware) clientKey(r *http.Request) string {
+	if m.config.KeyBy == "user" {
+		if user := UserFromRequest(r); user != "" {
+			return "user:" + user
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// getLimiter 获取或创建客户端的限流状态，并顺带回收长时间空闲的状态
+func (m *rateLimitMiddleware) getLimiter(key string) *clientLimiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastCleanup) > clientLimiterIdleTimeout {
+		for k, l := range m.clients {
+			if now.Sub(l.lastSeen) > clientLimiterIdleTimeout {
+				delete(m.clients, k)
+			}
+		}
+		m.lastCleanup = now
+	}
+
+	limiter, ok := m.clients[key]
+	if !ok {
+		limiter = &clientLimiter{}
+		if m.config.RequestsPerSecond > 0 {
+			limiter.requests = newTokenBucket(m.config.RequestsPerSecond, m.config.Burst)
+		}
+		if m.config.BytesPerSecond > 0 {
+			limiter.bandwidth = newTokenBucket(float64(m.config.BytesPerSecond), throttleChunkSize)
+		}
+		m.clients[key] = limiter
+	}
+	limiter.lastSeen = now
+	return limiter
+}
+
+// clientIP 获取客户端IP地址
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// okHandler 读取请求体后返回200
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestRateLimitPerClient(t *testing.T) {
+	h := NewRateLimitMiddleware(okHandler, &RateLimitConfig{KeyBy: "ip", RequestsPerSecond: 0.001, Burst: 2})
+
+	do := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PROPFIND", "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := do("10.0.0.1:1000"); w.Code != http.StatusOK {
+			t.Fatalf("突发上限内的第 %d 个请求被拒绝: %d", i+1, w.Code)
+		}
+	}
+	w := do("10.0.0.1:2000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("超过突发上限应返回429, 实际 %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429响应缺少Retry-After")
+	}
+	if w := do("10.0.0.2:1000"); w.Code != http.StatusOK {
+		t.Errorf("其他客户端不应受影响: %d", w.Code)
+	}
+}
+
+func TestRateLimitKeyByUser(t *testing.T) {
+	h := NewRateLimitMiddleware(okHandler, &RateLimitConfig{KeyBy: "user", RequestsPerSecond: 0.001, Burst: 1})
+
+	do := func(user, remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		if user != "" {
+			req = req.WithContext(ContextWithUser(req.Context(), user))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := do("alice", "10.0.0.1:1"); code != http.StatusOK {
+		t.Fatalf("首个请求被拒绝: %d", code)
+	}
+	// 同一用户换了IP仍然共用限额
+	if code := do("alice", "10.0.0.2:1"); code != http.StatusTooManyRequests {
+		t.Errorf("同一用户应共用限额, 实际 %d", code)
+	}
+	if code := do("bob", "10.0.0.1:1"); code != http.StatusOK {
+		t.Errorf("其他用户不应受影响: %d", code)
+	}
+	// 未认证的请求按IP限流
+	if code := do("", "10.0.0.3:1"); code != http.StatusOK {
+		t.Errorf("未认证请求被拒绝: %d", code)
+	}
+}
+
+func TestRateLimitBandwidth(t *testing.T) {
+	const rate = 64 * 1024
+	h := NewRateLimitMiddleware(okHandler, &RateLimitConfig{BytesPerSecond: rate})
+
+	// 令牌桶初始有32KiB，再上传64KiB至少需要1秒
+	body := strings.NewReader(strings.Repeat("x", throttleChunkSize+rate))
+	req := httptest.NewRequest("PUT", "/a.bin", body)
+	start := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("上传没有被限速: %v", elapsed)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	if _, ok := NewRateLimitMiddleware(okHandler, &RateLimitConfig{}).(*rateLimitMiddleware); ok {
+		t.Error("没有配置限额时不应添加中间件")
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ReadAheadConfig 顺序下载的预读配置
+type ReadAheadConfig struct {
+	Chunks    int // 预读的块数，0表示不启用
+	ChunkSize int // 每块的大小
+}
+
+// isSequentialRead 判断GET请求是否为顺序流式读取：没有Range或Range为开放区间（如 bytes=1000-），
+// 媒体播放器通常这样请求；缩略图扫描等带结束位置的小范围请求不做预读
+func isSequentialRead(req *http.Request) bool {
+	rangeHeader := req.Header.Get("Range")
+	if rangeHeader == "" {
+		return true
+	}
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	return ok && !strings.Contains(spec, ",") && strings.HasSuffix(spec, "-") && !strings.HasPrefix(spec, "-")
+}
+
+// readAheadReader 在后台从源读取并解密后续数据块，缓冲区大小有上限，
+// 客户端读取较慢时后台读取会阻塞，不会无限占用内存
+type readAheadReader struct {
+	source  io.ReadCloser
+	chunks  chan []byte
+	done    chan struct{}
+	err     error
+	current []byte
+	once    sync.Once
+}
+
+// newReadAheadReader 创建预读Reader并启动后台读取
+func newReadAheadReader(source io.ReadCloser, chunks, chunkSize int) *readAheadReader {
+	r := &readAheadReader{
+		source: source,
+		chunks: make(chan []byte, chunks),
+		done:   make(chan struct{}),
+	}
+	go r.fill(chunkSize)
+	return r
+}
+
+// fill 后台读取数据块直到源结束或Reader被关闭
+func (r *readAheadReader) fill(chunkSize int) {
+	defer close(r.chunks)
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(r.source, buf)
+		if n > 0 {
+			select {
+			case r.chunks <- buf[:n]:
+			case <-r.done:
+				return
+			}
+		}
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			r.err = err
+			return
+		}
+	}
+}
+
+// Read 实现io.Reader接口
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	if len(r.current) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			return 0, r.err
+		}
+		r.current = chunk
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Close 停止后台读取并关闭源
+func (r *readAheadReader) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return r.source.Close()
+}
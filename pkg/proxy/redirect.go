@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// 下载时后端返回重定向的处理方式
+const (
+	RedirectFollow  = "follow"  // 代理跟随重定向，解密后返回给客户端
+	RedirectRewrite = "rewrite" // 把Location改写为代理地址，由客户端重新通过代理请求
+)
+
+// defaultRedirectMaxHops 未指定时最多跟随的重定向次数
+const defaultRedirectMaxHops = 10
+
+// 改写后的重定向地址中保存目标地址和签名的查询参数
+const (
+	redirectTargetParam    = "redirect_to"
+	redirectSignatureParam = "redirect_sig"
+)
+
+// errRedirectSignature 改写后的重定向地址签名无效
+var errRedirectSignature = errors.New("invalid redirect signature")
+
+// RedirectConfig 下载时后端重定向的处理规则
+type RedirectConfig struct {
+	Mode       string   // follow或rewrite，默认follow
+	MaxHops    int      // 最多跟随的重定向次数，默认10
+	AllowHosts []string // 允许重定向到的主机，支持*通配符，为空时允许所有主机；后端自身总是允许
+}
+
+// setDefaults 为省略的参数填充默认值
+func (c *RedirectConfig) setDefaults() {
+	if c.Mode == "" {
+		c.Mode = RedirectFollow
+	}
+	if c.MaxHops <= 0 {
+		c.MaxHops = defaultRedirectMaxHops
+	}
+}
+
+// isRedirect 检查状态码是否为需要处理的重定向
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectAllowed 检查是否允许重定向到目标地址
+func (h *ProxyHandler) redirectAllowed(target *url.URL) bool {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return false
+	}
+	if len(h.redirect.AllowHosts) == 0 || h.isBackendHost(target.Host) {
+		return true
+	}
+	host := strings.ToLower(target.Hostname())
+	for _, pattern := range h.redirect.AllowHosts {
+		if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// signRedirect 计算改写后重定向地址的签名，签名覆盖原始路径和目标地址，防止通过代理访问任意地址
+func (h *ProxyHandler) signRedirect(p, target string) string {
+	mac := hmac.New(sha256.New, []byte(h.password))
+	mac.Write([]byte(p + "\n" + target))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// rewriteRedirect 把后端的重定向改写为指向代理的地址，地址中带有签名后的目标地址。
+// Location保持后端地址的形式，由modifyResponse统一转换为客户端路径
+func (h *ProxyHandler) rewriteRedirect(req *http.Request, resp *http.Response, target *url.URL) {
+	location := *req.URL
+	query := location.Query()
+	query.Set(redirectTargetParam, target.String())
+	query.Set(redirectSignatureParam, h.signRedirect(h.relativePath(req), target.String()))
+	location.RawQuery = query.Encode()
+
+	h.logger.Info("[DOWNLOAD] 改写%d重定向为代理地址: %s", resp.StatusCode, req.URL.Path)
+	resp.Header.Set("Location", location.String())
+	// 目标地址通常是临时的预签名地址，不能让客户端缓存为永久重定向
+	resp.StatusCode = http.StatusTemporaryRedirect
+	resp.Status = "307 Temporary Redirect"
+}
+
+// redirectTarget 解析客户端通过改写后的地址发来的请求，返回签名有效的目标地址
+func (h *ProxyHandler) redirectTarget(req *http.Request) (*url.URL, bool, error) {
+	query := req.URL.Query()
+	if !query.Has(redirectSignatureParam) {
+		return nil, false, nil
+	}
+	target := query.Get(redirectTargetParam)
+	expected := h.signRedirect(h.relativePath(req), target)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(redirectSignatureParam))) {
+		return nil, true, errRedirectSignature
+	}
+	u, err := url.Parse(target)
+	if err != nil || !h.redirectAllowed(u) {
+		return nil, true, fmt.Errorf("redirect target not allowed: %s", target)
+	}
+	return u, true, nil
+}
+
+// redirectRequest 创建发往重定向目标的请求，保留原始请求的头信息（包括Range和认证信息）
+func (t *proxyTransport) redirectRequest(req *http.Request, target *url.URL) *http.Request {
+	redirectReq := req.Clone(req.Context())
+	redirectReq.URL = target
+	redirectReq.Host = target.Host
+
+	// 如果重定向URL包含查询参数（可能是预签名URL），则移除Authorization头以避免冲突
+	if target.RawQuery != "" {
+		redirectReq.Header.Del("Authorization")
+		t.handler.logger.Debug("[DOWNLOAD] 重定向URL包含查询参数，已移除Authorization头")
+	}
+	return redirectReq
+}
+
+// followRedirects 跟随后端的重定向直到得到最终响应，超过次数或目标不允许时返回错误，
+// 不能把重定向目标返回的密文直接交给客户端
+func (t *proxyTransport) followRedirects(req *http.Request, resp *http.Response) (*http.Response, error) {
+	for hops := 0; isRedirect(resp.StatusCode); hops++ {
+		target, err := resp.Location()
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid redirect location: %w", err)
+		}
+		if hops >= t.handler.redirect.MaxHops {
+			return nil, fmt.Errorf("too many redirects")
+		}
+		if !t.handler.redirectAllowed(target) {
+			return nil, fmt.Errorf("redirect target not allowed: %s", target.Host)
+		}
+		t.handler.logger.Info("[DOWNLOAD] 跟随%d重定向: %s", resp.StatusCode, target)
+
+		resp, err = t.baseTransport().RoundTrip(t.redirectRequest(req, target))
+		if err != nil {
+			t.handler.logger.Error("[DOWNLOAD] 重定向请求发送失败: %v", err)
+			return nil, err
+		}
+	}
+	// 确保响应日志和后续处理使用原始请求
+	resp.Request = req
+	t.handler.logger.Debug("[DOWNLOAD] 重定向响应状态码: %d, 头信息: %v", resp.StatusCode, resp.Header)
+	return resp, nil
+}
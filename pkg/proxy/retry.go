@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryConfig 后端请求重试配置，只对幂等方法生效
+type RetryConfig struct {
+	Count       int           // 最大重试次数，0表示不重试
+	Backoff     time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxBackoff  time.Duration // 单次等待时间上限
+	StatusCodes []int         // 需要重试的后端响应状态码
+}
+
+// 可重放的请求体大小上限，超过时不重试
+const maxRetryBodySize = 1 << 20
+
+// retryableMethod 检查方法是否允许重试
+func retryableMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, "PROPFIND":
+		return true
+	}
+	return false
+}
+
+// roundTripWithRetry 发送请求到后端，对网络错误和可重试状态码按指数退避重试
+func (t *proxyTransport) roundTripWithRetry(req *http.Request) (*http.Response, error) {
+	retry := t.handler.retry
+	if retry == nil || retry.Count <= 0 || !retryableMethod(req.Method) {
+		return t.baseTransport().RoundTrip(req)
+	}
+
+	// 缓存请求体（如PROPFIND的XML），以便重试时重新发送
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.ContentLength < 0 || req.ContentLength > maxRetryBodySize {
+			return t.baseTransport().RoundTrip(req)
+		}
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := retry.Backoff
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		resp, err := t.baseTransport().RoundTrip(req)
+		if attempt >= retry.Count || !t.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := backoff
+		if resp != nil {
+			// 后端返回了Retry-After时优先使用
+			if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds >= 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+		if retry.MaxBackoff > 0 && wait > retry.MaxBackoff {
+			wait = retry.MaxBackoff
+		}
+
+		if resp != nil {
+			t.handler.logger.Warn("[RETRY] 后端返回 %d，%v 后重试(%d/%d): %s %s", resp.StatusCode, wait, attempt+1, retry.Count, req.Method, req.URL.Path)
+		} else {
+			t.handler.logger.Warn("[RETRY] 后端请求失败: %v，%v 后重试(%d/%d): %s %s", err, wait, attempt+1, retry.Count, req.Method, req.URL.Path)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// shouldRetry 判断响应或错误是否需要重试
+func (t *proxyTransport) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		// 客户端已经取消的请求不再重试
+		return req.Context().Err() == nil
+	}
+	for _, code := range t.handler.retry.StatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
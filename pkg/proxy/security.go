@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// SecurityHeadersConfig 附加在所有响应上的安全响应头
+type SecurityHeadersConfig struct {
+	HSTSMaxAge            time.Duration // Strict-Transport-Security的max-age，0表示不发送
+	HSTSIncludeSubdomains bool          // HSTS是否包含子域名
+	NoSniff               bool          // 发送X-Content-Type-Options: nosniff，禁止浏览器猜测内容类型
+}
+
+// securityHeadersMiddleware 安全响应头中间件
+type securityHeadersMiddleware struct {
+	handler http.Handler
+	logger  utils.Logger
+	headers http.Header
+}
+
+// NewSecurityHeadersMiddleware 创建安全响应头中间件，没有启用任何响应头时直接返回原处理器
+func NewSecurityHeadersMiddleware(handler http.Handler, config *SecurityHeadersConfig) http.Handler {
+	if config == nil || (config.HSTSMaxAge <= 0 && !config.NoSniff) {
+		return handler
+	}
+
+	headers := make(http.Header)
+	if config.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(config.HSTSMaxAge.Seconds()), 10)
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		headers.Set("Strict-Transport-Security", hsts)
+	}
+	if config.NoSniff {
+		headers.Set("X-Content-Type-Options", "nosniff")
+	}
+	return &securityHeadersMiddleware{
+		handler: handler,
+		logger:  handlerLogger(handler),
+		headers: headers,
+	}
+}
+
+// ServeHTTP 实现http.Handler接口，覆盖后端返回的同名响应头
+func (m *securityHeadersMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(&headerOverrideWriter{ResponseWriter: w, override: func(header http.Header) {
+		for key, values := range m.headers {
+			header[key] = values
+		}
+	}}, r)
+}
+
+// getLogger 实现loggerProvider接口
+func (m *securityHeadersMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
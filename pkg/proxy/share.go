@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// 分享链接的查询参数
+const (
+	shareExpiresParam   = "share_expires"
+	shareUserParam      = "share_user"
+	shareSignatureParam = "share_sig"
+)
+
+// defaultShareExpiry 生成分享链接时未指定有效期使用的默认值
+const defaultShareExpiry = 24 * time.Hour
+
+// ShareConfig 分享链接配置
+type ShareConfig struct {
+	Secret    string        // HMAC签名密钥
+	MaxExpiry time.Duration // 分享链接的最长有效期，0表示不限制
+}
+
+// sign 计算分享链接的签名，签名覆盖路径、过期时间和生成链接的用户
+func (c *ShareConfig) sign(p string, expires int64, user string) string {
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write([]byte(p + "\n" + strconv.FormatInt(expires, 10) + "\n" + user))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isShareRequest 检查请求是否携带分享链接签名
+func isShareRequest(r *http.Request) bool {
+	return r.URL.Query().Has(shareSignatureParam)
+}
+
+// verify 校验分享链接，只允许GET和HEAD，成功时返回生成链接的用户
+func (c *ShareConfig) verify(r *http.Request) (string, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get(shareExpiresParam), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+	user := query.Get(shareUserParam)
+	expected := c.sign(r.URL.Path, expires, user)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(shareSignatureParam))) {
+		return "", false
+	}
+	return user, true
+}
+
+// stripShareParams 去掉分享链接的查询参数，避免转发给后端
+func stripShareParams(r *http.Request) *http.Request {
+	query := r.URL.Query()
+	query.Del(shareExpiresParam)
+	query.Del(shareUserParam)
+	query.Del(shareSignatureParam)
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	return r
+}
+
+// shareMiddleware 为已认证的用户生成分享链接：POST <文件>?share[=<有效期>]
+type shareMiddleware struct {
+	handler http.Handler
+	config  *ShareConfig
+	logger  utils.Logger
+}
+
+// NewShareMiddleware 创建分享链接生成中间件，需要放在认证中间件内层，分享链接的校验由认证中间件完成
+func NewShareMiddleware(handler http.Handler, config *ShareConfig) http.Handler {
+	if config == nil || config.Secret == "" {
+		return handler
+	}
+	return &shareMiddleware{
+		handler: handler,
+		config:  config,
+		logger:  handlerLogger(handler),
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *shareMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !r.URL.Query().Has("share") {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	expiry := defaultShareExpiry
+	if value := r.URL.Query().Get("share"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		expiry = d
+	}
+	if m.config.MaxExpiry > 0 && expiry > m.config.MaxExpiry {
+		expiry = m.config.MaxExpiry
+	}
+
+	// 检查文件是否存在，经过内层处理器可以同时应用挂载点、多租户路由和路径过滤
+	headReq := r.Clone(r.Context())
+	headReq.Method = http.MethodHead
+	headReq.URL.RawQuery = ""
+	headReq.Body = http.NoBody
+	headReq.ContentLength = 0
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	m.handler.ServeHTTP(recorder, headReq)
+	if recorder.status != 0 && recorder.status != http.StatusOK {
+		http.Error(w, http.StatusText(recorder.status), recorder.status)
+		return
+	}
+
+	user := UserFromRequest(r)
+	expires := time.Now().Add(expiry).Unix()
+	query := url.Values{}
+	query.Set(shareExpiresParam, strconv.FormatInt(expires, 10))
+	if user != "" {
+		query.Set(shareUserParam, user)
+	}
+	query.Set(shareSignatureParam, m.config.sign(r.URL.Path, expires, user))
+	link := (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	// 链接中的&不转义为\u0026，便于脚本直接取用
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(map[string]string{
+		"path":    link,
+		"url":     scheme + "://" + r.Host + link,
+		"expires": time.Unix(expires, 0).UTC().Format(time.RFC3339),
+	})
+	m.logger.Info("[SHARE] 生成分享链接: %s, 用户: %s, 有效期: %v", r.URL.Path, user, expiry)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// getLogger 实现loggerProvider接口
+func (m *shareMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
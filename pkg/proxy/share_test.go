@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newShareTestHandler 返回启用分享链接和多用户认证的代理
+func newShareTestHandler(t *testing.T, share *ShareConfig) http.Handler {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{})
+	return NewProxyAuthMiddleware(NewShareMiddleware(h, share), &ProxyAuthConfig{
+		Enabled: true,
+		Users:   map[string]string{"alice": "a-secret", "bob": "b-secret"},
+		Share:   share,
+	})
+}
+
+// serveAs 以Basic认证发送请求
+func serveAs(h http.Handler, user, password, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// createShare 生成分享链接，返回链接的路径和查询参数
+func createShare(t *testing.T, h http.Handler, target string) string {
+	w := serveAs(h, "alice", "a-secret", "POST", target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("生成分享链接失败: %d %s", w.Code, w.Body.String())
+	}
+	var result map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析分享链接失败: %v", err)
+	}
+	if !strings.HasSuffix(result["url"], result["path"]) {
+		t.Errorf("url与path不一致: %v", result)
+	}
+	return result["path"]
+}
+
+func TestShareLinkDownload(t *testing.T) {
+	h := newShareTestHandler(t, &ShareConfig{Secret: "share-secret"})
+	serveAs(h, "alice", "a-secret", "PUT", "/a.txt", "hello")
+
+	link := createShare(t, h, "/a.txt?share=1h")
+	w := serveAs(h, "", "", "GET", link, "")
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("通过分享链接下载失败: %d %q", w.Code, w.Body.String())
+	}
+
+	// 分享链接只允许读取，无效的链接返回403而不是提示输入密码
+	if w := serveAs(h, "", "", "PUT", link, "x"); w.Code != http.StatusForbidden {
+		t.Errorf("分享链接不能用于写入: %d", w.Code)
+	}
+	// 修改路径或用户后签名不再有效
+	for _, tampered := range []string{
+		strings.Replace(link, "/a.txt", "/b.txt", 1),
+		strings.Replace(link, "share_user=alice", "share_user=bob", 1),
+	} {
+		if w := serveAs(h, "", "", "GET", tampered, ""); w.Code != http.StatusForbidden {
+			t.Errorf("篡改的分享链接应返回403: %s, 实际 %d", tampered, w.Code)
+		}
+	}
+	if w := serveAs(h, "", "", "GET", "/a.txt", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("没有签名的请求仍需认证: %d", w.Code)
+	}
+}
+
+func TestShareLinkExpiry(t *testing.T) {
+	h := newShareTestHandler(t, &ShareConfig{Secret: "share-secret", MaxExpiry: time.Hour})
+	serveAs(h, "alice", "a-secret", "PUT", "/a.txt", "hello")
+
+	// 有效期被限制为max_expiry
+	link := createShare(t, h, "/a.txt?share=720h")
+	parsed, _ := url.Parse(link)
+	expires, err := strconv.ParseInt(parsed.Query().Get(shareExpiresParam), 10, 64)
+	if err != nil || expires > time.Now().Add(time.Hour+time.Minute).Unix() {
+		t.Fatalf("有效期应限制为max_expiry: %s", link)
+	}
+
+	// 过期的链接被拒绝
+	share := &ShareConfig{Secret: "share-secret"}
+	expired := time.Now().Add(-time.Minute).Unix()
+	query := url.Values{}
+	query.Set(shareExpiresParam, strconv.FormatInt(expired, 10))
+	query.Set(shareUserParam, "alice")
+	query.Set(shareSignatureParam, share.sign("/a.txt", expired, "alice"))
+	if w := serveAs(h, "", "", "GET", "/a.txt?"+query.Encode(), ""); w.Code != http.StatusForbidden {
+		t.Errorf("过期的分享链接应返回403: %d", w.Code)
+	}
+
+	for _, target := range []string{"/a.txt?share=abc", "/a.txt?share=-1h", "/dir/?share"} {
+		if w := serveAs(h, "alice", "a-secret", "POST", target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("无效的分享请求 %s 应返回400, 实际 %d", target, w.Code)
+		}
+	}
+	if w := serveAs(h, "alice", "a-secret", "POST", "/missing.txt?share", ""); w.Code != http.StatusNotFound {
+		t.Errorf("分享不存在的文件应返回404, 实际 %d", w.Code)
+	}
+}
@@ -0,0 +1,467 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 分片上传的清单文件标识和大小上限
+const (
+	splitManifestMagic   = `{"webdav_encrypt_split":`
+	maxSplitManifestSize = 1024
+	splitETagPrefix      = "split-"
+)
+
+// splitManifest 分片文件的清单，保存在原文件路径上，分片保存为 文件名.part0001、文件名.part0002……
+type splitManifest struct {
+	Version     int    `json:"webdav_encrypt_split"`
+	Size        int64  `json:"size"`
+	PartSize    int64  `json:"part_size"`
+	Parts       int    `json:"parts"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// splitPartSuffix 返回第index个分片（从1开始）的文件名后缀
+func splitPartSuffix(index int) string {
+	return fmt.Sprintf(".part%04d", index)
+}
+
+// parseSplitManifest 解析清单文件内容，不是清单时返回nil
+func parseSplitManifest(data []byte) *splitManifest {
+	if !bytes.HasPrefix(data, []byte(splitManifestMagic)) {
+		return nil
+	}
+	var manifest splitManifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.PartSize <= 0 || manifest.Parts <= 0 {
+		return nil
+	}
+	return &manifest
+}
+
+// partRequest 基于原请求创建访问第index个分片的请求，COPY和MOVE的目标路径同样加上分片后缀
+func partRequest(req *http.Request, method string, index int) *http.Request {
+	partReq := req.Clone(req.Context())
+	partReq.Method = method
+	partReq.URL.Path += splitPartSuffix(index)
+	partReq.URL.RawPath = ""
+	partReq.Body = nil
+	partReq.ContentLength = 0
+	partReq.Header.Del("Range")
+	// 条件请求针对的是清单文件，不适用于分片
+	removeConditionalHeaders(partReq.Header)
+	if destination := partReq.Header.Get("Destination"); destination != "" {
+		partReq.Header.Set("Destination", destination+splitPartSuffix(index))
+	}
+	return partReq
+}
+
+// handleSplitUpload 将超过分片大小的上传加密后拆分为多个后端文件，最后写入清单
+func (t *proxyTransport) handleSplitUpload(req *http.Request, body io.ReadCloser, size int64) (*http.Response, error) {
+	partSize := t.handler.splitSize
+	parts := int((size + partSize - 1) / partSize)
+	t.handler.logger.Info("[SPLIT] 拆分上传: %s, %d 字节, %d 个分片", req.URL.Path, size, parts)
+
+	// 提前返回时关闭加密管道，让加密goroutine退出
+	defer body.Close()
+
+	// 前提条件必须在上传分片之前检查，否则条件不满足时已有文件的分片已经被覆盖
+	if hasConditionalHeaders(req.Header) {
+		resp, err := t.checkPreconditions(req)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
+	for index := 1; index <= parts; index++ {
+		length := min(partSize, size-int64(index-1)*partSize)
+		partReq := partRequest(req, http.MethodPut, index)
+		partReq.Body = t.handler.throttle(req.Context(), io.NopCloser(io.LimitReader(body, length)), true)
+		partReq.ContentLength = length
+		partReq.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+		resp, err := t.baseTransport().RoundTrip(partReq)
+		if err != nil {
+			t.handler.logger.Error("[SPLIT] 上传分片失败: %s, 错误: %v", partReq.URL.Path, err)
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			t.handler.logger.Error("[SPLIT] 上传分片失败: %s, 后端响应: %d", partReq.URL.Path, resp.StatusCode)
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		t.handler.logger.Debug("[SPLIT] 分片上传完成: %s (%d/%d)", partReq.URL.Path, index, parts)
+	}
+
+	manifest, err := json.Marshal(&splitManifest{
+		Version:     1,
+		Size:        size,
+		PartSize:    partSize,
+		Parts:       parts,
+		ContentType: req.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifestReq := req.Clone(req.Context())
+	manifestReq.Body = io.NopCloser(bytes.NewReader(manifest))
+	manifestReq.ContentLength = int64(len(manifest))
+	manifestReq.Header.Set("Content-Length", strconv.Itoa(len(manifest)))
+	manifestReq.Header.Set("Content-Type", "application/json")
+	resp, err := t.baseTransport().RoundTrip(manifestReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// 之前的版本可能有更多分片，删除多余的分片
+		t.removeSplitParts(req, parts+1)
+	}
+	return resp, nil
+}
+
+// removeSplitParts 从第from个分片开始依次删除，直到分片不存在
+func (t *proxyTransport) removeSplitParts(req *http.Request, from int) {
+	for index := from; ; index++ {
+		resp, err := t.baseTransport().RoundTrip(partRequest(req, http.MethodDelete, index))
+		if err != nil {
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return
+		}
+		t.handler.logger.Debug("[SPLIT] 删除分片: %s%s", req.URL.Path, splitPartSuffix(index))
+	}
+}
+
+// handleSplitParts 转发DELETE、COPY、MOVE请求，成功后对分片执行同样的操作
+func (t *proxyTransport) handleSplitParts(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTripWithRetry(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, err
+	}
+	for index := 1; ; index++ {
+		partResp, err := t.baseTransport().RoundTrip(partRequest(req, req.Method, index))
+		if err != nil {
+			t.handler.logger.Error("[SPLIT] %s 分片失败: %s%s, 错误: %v", req.Method, req.URL.Path, splitPartSuffix(index), err)
+			break
+		}
+		partResp.Body.Close()
+		if partResp.StatusCode < 200 || partResp.StatusCode >= 300 {
+			break
+		}
+		t.handler.logger.Debug("[SPLIT] %s 分片: %s%s", req.Method, req.URL.Path, splitPartSuffix(index))
+	}
+	return resp, nil
+}
+
+// checkPreconditions 用HEAD请求检查上传的前提条件，不满足时返回412响应
+func (t *proxyTransport) checkPreconditions(req *http.Request) (*http.Response, error) {
+	headReq := req.Clone(req.Context())
+	headReq.Method = http.MethodHead
+	headReq.Body = nil
+	headReq.ContentLength = 0
+	headReq.Header.Del("Content-Length")
+	resp, err := t.baseTransport().RoundTrip(headReq)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	// 对HEAD请求If-None-Match不满足时返回304，对PUT来说相当于412
+	if resp.StatusCode != http.StatusPreconditionFailed && resp.StatusCode != http.StatusNotModified {
+		return nil, nil
+	}
+	t.handler.logger.Info("[SPLIT] 上传前提条件不满足: %s", req.URL.Path)
+	return &http.Response{
+		Status:        "412 Precondition Failed",
+		StatusCode:    http.StatusPreconditionFailed,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}, nil
+}
+
+// fetchSplitManifest 检查后端响应的文件是否为分片清单，是则返回清单。
+// 清单很小，Range请求或HEAD请求无法判断时重新获取完整内容
+func (t *proxyTransport) fetchSplitManifest(req *http.Request, resp *http.Response) (*splitManifest, error) {
+	size := resp.ContentLength
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		if _, total, ok := strings.Cut(contentRange, "/"); ok {
+			size, _ = strconv.ParseInt(total, 10, 64)
+		}
+	}
+	if resp.StatusCode == http.StatusOK && req.Method == http.MethodGet {
+		if size < 0 || size > maxSplitManifestSize {
+			return nil, nil
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxSplitManifestSize+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return parseSplitManifest(data), nil
+	}
+
+	// Range请求的总大小超过上限时一定不是清单
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable && (size < 0 || size > maxSplitManifestSize) {
+		return nil, nil
+	}
+	getReq := req.Clone(req.Context())
+	getReq.Method = http.MethodGet
+	getReq.Header.Del("Range")
+	removeConditionalHeaders(getReq.Header)
+	getResp, err := t.baseTransport().RoundTrip(getReq)
+	if err != nil {
+		return nil, err
+	}
+	defer getResp.Body.Close()
+	if getResp.StatusCode != http.StatusOK || getResp.ContentLength > maxSplitManifestSize {
+		return nil, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(getResp.Body, maxSplitManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	return parseSplitManifest(data), nil
+}
+
+// resolveSplitFile 下载分片文件时，用各分片的内容拼接出与未分片时相同的后端响应
+func (t *proxyTransport) resolveSplitFile(req *http.Request, resp *http.Response) (*http.Response, bool) {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+	default:
+		return resp, false
+	}
+	manifest, err := t.fetchSplitManifest(req, resp)
+	if err != nil {
+		t.handler.logger.Error("[SPLIT] 读取分片清单失败: %s, 错误: %v", req.URL.Path, err)
+		return resp, false
+	}
+	if manifest == nil {
+		return resp, false
+	}
+
+	start, end, ok := parseSingleRange(req.Header.Get("Range"), manifest.Size)
+	if !ok {
+		// 不支持的Range格式按完整文件返回
+		start, end = 0, manifest.Size-1
+	}
+	partial := ok && req.Header.Get("Range") != ""
+	t.handler.logger.Debug("[SPLIT] 下载分片文件: %s, %d 字节, %d 个分片, 范围: %d-%d", req.URL.Path, manifest.Size, manifest.Parts, start, end)
+
+	resp.Body.Close()
+	header := make(http.Header)
+	for _, name := range []string{"Last-Modified", "Date"} {
+		if value := resp.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	// ETag与清单本身区分开，避免块缓存用清单大小匹配分片文件的数据
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		header.Set("ETag", `"`+splitETagPrefix+strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)+`"`)
+	}
+	contentType := manifest.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+
+	split := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        header,
+		ContentLength: end - start + 1,
+		Request:       resp.Request,
+		Body:          http.NoBody,
+	}
+	if manifest.Size == 0 {
+		split.ContentLength = 0
+		header.Set("Content-Length", "0")
+		return split, true
+	}
+	if partial || start > 0 {
+		split.Status = "206 Partial Content"
+		split.StatusCode = http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, manifest.Size))
+	}
+	if req.Method == http.MethodGet {
+		split.Body = &splitReader{transport: t, req: req, manifest: manifest, pos: start, end: end}
+	}
+	return split, true
+}
+
+// splitReader 依次从各分片读取指定范围的数据，拼接成连续的密文流
+type splitReader struct {
+	transport *proxyTransport
+	req       *http.Request
+	manifest  *splitManifest
+	pos       int64
+	end       int64 // 结束位置（包含）
+	current   io.ReadCloser
+}
+
+// Read 实现io.Reader接口
+func (r *splitReader) Read(p []byte) (int, error) {
+	for {
+		if r.pos > r.end {
+			return 0, io.EOF
+		}
+		if r.current == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := r.current.Read(p)
+		r.pos += int64(n)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// open 打开当前位置所在分片的Range请求
+func (r *splitReader) open() error {
+	index := r.pos / r.manifest.PartSize
+	offset := r.pos - index*r.manifest.PartSize
+	last := min(r.end-index*r.manifest.PartSize, r.manifest.PartSize-1)
+
+	partReq := partRequest(r.req, http.MethodGet, int(index)+1)
+	partReq.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, last))
+	resp, err := r.transport.roundTripWithRetry(partReq)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusPartialContent && !(resp.StatusCode == http.StatusOK && offset == 0) {
+		resp.Body.Close()
+		return fmt.Errorf("backend returned %d for %s", resp.StatusCode, partReq.URL.Path)
+	}
+	r.current = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, last-offset+1), resp.Body}
+	return nil
+}
+
+// Close 实现io.Closer接口
+func (r *splitReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// responsePattern 匹配PROPFIND响应中的response元素
+var responsePattern = regexp.MustCompile(`(?s)<(?:[A-Za-z0-9_.-]+:)?response(?:\s[^>]*)?>.*?</(?:[A-Za-z0-9_.-]+:)?response>`)
+
+// contentLengthPattern 匹配getcontentlength元素
+var contentLengthPattern = regexp.MustCompile(`(<(?:[A-Za-z0-9_.-]+:)?getcontentlength(?:\s[^>]*)?>)\s*(\d+)\s*(</(?:[A-Za-z0-9_.-]+:)?getcontentlength>)`)
+
+// splitPartPattern 匹配分片文件的href
+var splitPartPattern = regexp.MustCompile(`^(.*)\.part\d{4,}$`)
+
+// rewriteSplitListing 从PROPFIND响应中隐藏分片文件，并把清单的大小替换为原文件的大小
+func (h *ProxyHandler) rewriteSplitListing(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	// 统计每个文件所有分片的总大小
+	sizes := make(map[string]int64)
+	blocks := responsePattern.FindAll(body, -1)
+	for _, block := range blocks {
+		href := hrefPattern.FindSubmatch(block)
+		if href == nil {
+			continue
+		}
+		if match := splitPartPattern.FindStringSubmatch(strings.TrimSpace(string(href[2]))); match != nil {
+			if length := contentLengthPattern.FindSubmatch(block); length != nil {
+				size, _ := strconv.ParseInt(string(length[2]), 10, 64)
+				sizes[match[1]] += size
+			}
+		}
+	}
+
+	// Depth为0时列表中没有分片，直接读取清单获取大小
+	if len(sizes) == 0 && len(blocks) == 1 {
+		if length := contentLengthPattern.FindSubmatch(blocks[0]); length != nil {
+			if size, _ := strconv.ParseInt(string(length[2]), 10, 64); size <= maxSplitManifestSize {
+				if manifest := h.statSplitManifest(resp.Request); manifest != nil {
+					href := hrefPattern.FindSubmatch(blocks[0])
+					sizes[strings.TrimSpace(string(href[2]))] = manifest.Size
+				}
+			}
+		}
+	}
+
+	if len(sizes) > 0 {
+		body = responsePattern.ReplaceAllFunc(body, func(block []byte) []byte {
+			href := hrefPattern.FindSubmatch(block)
+			if href == nil {
+				return block
+			}
+			p := strings.TrimSpace(string(href[2]))
+			if match := splitPartPattern.FindStringSubmatch(p); match != nil {
+				if _, ok := sizes[match[1]]; ok {
+					return nil
+				}
+			}
+			if size, ok := sizes[p]; ok {
+				return contentLengthPattern.ReplaceAll(block, []byte("${1}"+strconv.FormatInt(size, 10)+"${3}"))
+			}
+			return block
+		})
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// statSplitManifest 读取PROPFIND目标文件的内容，判断是否为分片清单
+func (h *ProxyHandler) statSplitManifest(propfind *http.Request) *splitManifest {
+	req, err := http.NewRequestWithContext(propfind.Context(), http.MethodGet, propfind.URL.String(), nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Authorization", propfind.Header.Get("Authorization"))
+	h.setUserAgent(req)
+	client := &http.Client{Transport: h.transport, Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength > maxSplitManifestSize {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSplitManifestSize+1))
+	if err != nil {
+		return nil
+	}
+	return parseSplitManifest(data)
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// backendGet 直接从后端读取文件，返回状态码和内容
+func backendGet(t *testing.T, backendURL, p string) (int, []byte) {
+	resp, err := http.Get(backendURL + p)
+	if err != nil {
+		t.Fatalf("读取后端文件失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func TestSplitUploadRoundTrip(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{SplitSize: 1000})
+	content := make([]byte, 2500)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	if w := serve(h, "", "PUT", "/a.bin", string(content)); w.Code != http.StatusCreated {
+		t.Fatalf("上传失败: %d %s", w.Code, w.Body.String())
+	}
+
+	// 原路径上是清单，内容拆分为3个加密的分片
+	_, manifest := backendGet(t, backend.URL, "/a.bin")
+	if parsed := parseSplitManifest(manifest); parsed == nil || parsed.Parts != 3 || parsed.Size != 2500 {
+		t.Fatalf("清单错误: %s", manifest)
+	}
+	for i, want := range []int{1000, 1000, 500} {
+		status, part := backendGet(t, backend.URL, "/a.bin"+splitPartSuffix(i+1))
+		if status != http.StatusOK || len(part) != want {
+			t.Fatalf("分片 %d 错误: %d, %d 字节", i+1, status, len(part))
+		}
+		if bytes.Equal(part, content[i*1000:i*1000+want]) {
+			t.Fatalf("分片 %d 没有加密", i+1)
+		}
+	}
+
+	w := serve(h, "", "GET", "/a.bin", "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Fatalf("下载的内容与上传的不一致: %d, %d 字节", w.Code, w.Body.Len())
+	}
+
+	// 跨越分片边界的Range请求
+	w = serve(h, "", "GET", "/a.bin", "", "Range", "bytes=900-2099")
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), content[900:2100]) {
+		t.Fatalf("跨分片的Range请求错误: %d, %d 字节", w.Code, w.Body.Len())
+	}
+}
+
+func TestSplitListingAndDelete(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{SplitSize: 1000})
+	serve(h, "", "PUT", "/a.bin", strings.Repeat("a", 2500))
+
+	w := serve(h, "", "PROPFIND", "/", "", "Depth", "1")
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND失败: %d", w.Code)
+	}
+	listing := w.Body.String()
+	if strings.Contains(listing, ".part0001") {
+		t.Error("列表中不应出现分片文件")
+	}
+	if !strings.Contains(listing, "2500") {
+		t.Errorf("列表中应显示原文件的大小: %s", listing)
+	}
+
+	if w := serve(h, "", "DELETE", "/a.bin", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("删除失败: %d", w.Code)
+	}
+	for i := 1; i <= 3; i++ {
+		if status, _ := backendGet(t, backend.URL, "/a.bin"+splitPartSuffix(i)); status != http.StatusNotFound {
+			t.Errorf("分片 %d 没有被删除: %d", i, status)
+		}
+	}
+}
+
+func TestSplitSmallFileNotSplit(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{SplitSize: 1000})
+	serve(h, "", "PUT", "/small.bin", strings.Repeat("s", 999))
+
+	_, data := backendGet(t, backend.URL, "/small.bin")
+	if len(data) != 999 || parseSplitManifest(data) != nil {
+		t.Errorf("不超过分片大小的文件不应拆分: %d 字节", len(data))
+	}
+	if status, _ := backendGet(t, backend.URL, "/small.bin"+splitPartSuffix(1)); status != http.StatusNotFound {
+		t.Error("不应创建分片")
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+
+	"webdav-proxy/utils"
+)
+
+// userRouter 多租户模式下按认证用户将请求分发到各自的代理处理器，
+// 每个用户拥有独立的后端和加密密码，彼此之间的数据互相隔离
+type userRouter struct {
+	users    map[string]*ProxyHandler
+	fallback http.Handler
+	logger   utils.Logger
+}
+
+// NewUserRouter 创建多租户路由，需要放在认证中间件内层。
+// 不在users中的用户（如全局认证用户或令牌）交给fallback处理，fallback为nil时返回403
+func NewUserRouter(users map[string]*ProxyHandler, fallback http.Handler, logger utils.Logger) http.Handler {
+	return &userRouter{
+		users:    users,
+		fallback: fallback,
+		logger:   logger,
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (u *userRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user := UserFromRequest(r)
+	if handler, ok := u.users[user]; ok {
+		u.logger.Debug("[TENANT] 用户 %s: %s %s", user, r.Method, r.URL.Path)
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	if u.fallback != nil {
+		u.fallback.ServeHTTP(w, r)
+		return
+	}
+	u.logger.Warn("[TENANT] 用户 %q 没有配置后端，拒绝请求: %s %s", user, r.Method, r.URL.Path)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// getLogger 实现loggerProvider接口
+func (u *userRouter) getLogger() utils.Logger {
+	return u.logger
+}
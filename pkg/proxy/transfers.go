@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// TransferStatus 进行中的文件传输的状态快照
+type TransferStatus struct {
+	ID             uint64        `json:"id"`
+	RequestID      string        `json:"request_id"` // 客户端请求中的X-Request-Id，没有时使用ID
+	Method         string        `json:"method"`
+	Direction      string        `json:"direction"` // upload或download
+	Path           string        `json:"path"`
+	User           string        `json:"user,omitempty"`
+	ClientIP       string        `json:"client_ip"`
+	Bytes          int64         `json:"bytes"`           // 已传输的字节数
+	Total          int64         `json:"total,omitempty"` // 总字节数，客户端或后端没有提供长度时为0
+	BytesPerSecond int64         `json:"bytes_per_second"`
+	Start          time.Time     `json:"start"`
+	Elapsed        time.Duration `json:"elapsed_ns"`
+}
+
+// transferEventInterval 传输进度事件的发送间隔
+const transferEventInterval = time.Second
+
+// transfer 正在进行的文件传输
+type transfer struct {
+	status TransferStatus // 固定不变的字段
+	bytes  atomic.Int64
+	total  atomic.Int64
+}
+
+// snapshot 返回当前状态，吞吐量按开始以来的平均速度计算
+func (t *transfer) snapshot() TransferStatus {
+	status := t.status
+	status.Bytes = t.bytes.Load()
+	status.Total = t.total.Load()
+	status.Elapsed = time.Since(status.Start)
+	if seconds := status.Elapsed.Seconds(); seconds > 0 {
+		status.BytesPerSecond = int64(float64(status.Bytes) / seconds)
+	}
+	return status
+}
+
+// transferStatusMiddleware 记录经过代理的上传下载，在path提供JSON格式的传输列表，
+// 在path/events以Server-Sent Events推送传输进度。放在认证内层，查看传输需要认证，也能记录发起传输的用户，
+// 每个用户只能看到自己发起的传输
+type transferStatusMiddleware struct {
+	handler http.Handler
+	path    string
+	logger  utils.Logger
+	proxies []*ProxyHandler
+
+	mu          sync.Mutex
+	transfers   map[uint64]*transfer
+	nextID      uint64
+	subscribers map[chan TransferStatus]struct{} // 接收传输结束事件的进度订阅
+}
+
+// NewTransferStatusMiddleware 创建传输状态中间件，path为空时直接返回原处理器。
+// 传入的代理处理器的派生密钥缓存统计会合并后一起返回，使用虚拟挂载点时传入所有挂载点的代理处理器
+func NewTransferStatusMiddleware(handler http.Handler, path string, proxyHandlers ...*ProxyHandler) http.Handler {
+	if path == "" {
+		return handler
+	}
+	return &transferStatusMiddleware{
+		handler:     handler,
+		path:        path,
+		logger:      handlerLogger(handler),
+		proxies:     proxyHandlers,
+		transfers:   make(map[uint64]*transfer),
+		subscribers: make(map[chan TransferStatus]struct{}),
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *transferStatusMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		switch r.URL.Path {
+		case m.path:
+			m.serveStatus(w, r)
+			return
+		case m.eventsPath():
+			m.serveEvents(w, r)
+			return
+		}
+	}
+	// 状态端点遮住了后端的同名路径，不允许在这里创建文件，否则上传的文件无法再通过GET读取
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions && m.coversPath(r) {
+		m.logger.Warn("[STATUS] 拒绝写入传输状态端点路径: %s %s", r.Method, r.URL.Path)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var direction string
+	switch r.Method {
+	case http.MethodGet:
+		direction = "download"
+	case http.MethodPut, http.MethodPatch:
+		direction = "upload"
+	default:
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	t := m.start(r, direction)
+	defer m.finish(t)
+	w.Header().Set("X-Request-Id", t.status.RequestID)
+
+	if direction == "upload" {
+		if r.ContentLength > 0 {
+			t.total.Store(r.ContentLength)
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &drainBody{ReadCloser: r.Body, n: &t.bytes}
+		}
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+	m.handler.ServeHTTP(&transferResponseWriter{drainResponseWriter: drainResponseWriter{ResponseWriter: w, n: &t.bytes}, total: &t.total}, r)
+}
+
+// start 登记一个新的传输
+func (m *transferStatusMiddleware) start(r *http.Request, direction string) *transfer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	requestID := r.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = strconv.FormatUint(m.nextID, 10)
+	}
+	t := &transfer{status: TransferStatus{
+		ID:        m.nextID,
+		RequestID: requestID,
+		Method:    r.Method,
+		Direction: direction,
+		Path:      r.URL.Path,
+		User:      UserFromRequest(r),
+		ClientIP:  clientIP(r),
+		Start:     time.Now(),
+	}}
+	m.transfers[t.status.ID] = t
+	return t
+}
+
+// finish 传输结束后移除，并把最终状态发给进度订阅
+func (m *transferStatusMiddleware) finish(t *transfer) {
+	status := t.snapshot()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.transfers, t.status.ID)
+	for ch := range m.subscribers {
+		// 订阅方处理不过来时丢弃，进度事件只用于展示
+		select {
+		case ch <- status:
+		default:
+		}
+	}
+}
+
+// coversPath 检查请求的路径或MOVE、COPY的目标是否为状态端点或在其之下
+func (m *transferStatusMiddleware) coversPath(r *http.Request) bool {
+	base := strings.TrimSuffix(m.path, "/")
+	covers := func(p string) bool {
+		p = strings.TrimSuffix(p, "/")
+		return p == base || strings.HasPrefix(p, base+"/")
+	}
+	if covers(r.URL.Path) {
+		return true
+	}
+	if destination, err := url.Parse(r.Header.Get("Destination")); err == nil && destination.Path != "" {
+		return covers(destination.Path)
+	}
+	return false
+}
+
+// Transfers 返回进行中的传输，按开始时间排序
+func (m *transferStatusMiddleware) Transfers() []TransferStatus {
+	return m.transfersOf(nil)
+}
+
+// userTransfers 返回请求的用户发起的传输
+func (m *transferStatusMiddleware) userTransfers(r *http.Request) []TransferStatus {
+	user := UserFromRequest(r)
+	return m.transfersOf(func(status TransferStatus) bool { return status.User == user })
+}
+
+// transfersOf 返回进行中的传输中满足filter的部分，filter为nil时返回全部
+func (m *transferStatusMiddleware) transfersOf(filter func(TransferStatus) bool) []TransferStatus {
+	m.mu.Lock()
+	statuses := make([]TransferStatus, 0, len(m.transfers))
+	for _, t := range m.transfers {
+		if filter == nil || filter(t.status) {
+			statuses = append(statuses, t.snapshot())
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+// serveStatus 返回请求的用户进行中的传输列表和派生密钥缓存统计
+func (m *transferStatusMiddleware) serveStatus(w http.ResponseWriter, r *http.Request) {
+	transfers := m.userTransfers(r)
+	var keyCache KeyCacheStats
+	for _, proxy := range m.proxies {
+		stats := proxy.KeyCacheStats()
+		keyCache.Entries += stats.Entries
+		keyCache.Hits += stats.Hits
+		keyCache.Misses += stats.Misses
+		keyCache.Evictions += stats.Evictions
+		keyCache.Expirations += stats.Expirations
+	}
+	m.logger.Debug("[STATUS] 查询传输状态，进行中的传输: %d", len(transfers))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"transfers": transfers,
+			"key_cache": keyCache,
+		})
+	}
+}
+
+// eventsPath 传输进度事件端点的路径
+func (m *transferStatusMiddleware) eventsPath() string {
+	return strings.TrimSuffix(m.path, "/") + "/events"
+}
+
+// serveEvents 以Server-Sent Events推送请求的用户的传输进度，每秒发送一次progress事件，传输结束时发送done事件。
+// 查询参数id指定请求ID时只推送该传输，传输结束后关闭连接；传输还没有开始时等待它开始
+func (m *transferStatusMiddleware) serveEvents(w http.ResponseWriter, r *http.Request) {
+	requestID := r.URL.Query().Get("id")
+	user := UserFromRequest(r)
+	done := make(chan TransferStatus, 64)
+	m.mu.Lock()
+	m.subscribers[done] = struct{}{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.subscribers, done)
+		m.mu.Unlock()
+	}()
+
+	// 事件流的持续时间不固定，不受服务器写超时的限制
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	m.logger.Debug("[STATUS] 开始推送传输进度: %s", requestID)
+
+	send := func(event string, status TransferStatus) error {
+		data, _ := json.Marshal(status)
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		return err
+	}
+
+	sendProgress := func() error {
+		for _, status := range m.userTransfers(r) {
+			if requestID == "" || status.RequestID == requestID {
+				if err := send("progress", status); err != nil {
+					return err
+				}
+			}
+		}
+		return rc.Flush()
+	}
+	if sendProgress() != nil {
+		return
+	}
+
+	ticker := time.NewTicker(transferEventInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if sendProgress() != nil {
+				return
+			}
+		case status := <-done:
+			if status.User != user || (requestID != "" && status.RequestID != requestID) {
+				continue
+			}
+			if send("done", status) != nil || rc.Flush() != nil || requestID != "" {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// getLogger 实现loggerProvider接口
+func (m *transferStatusMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// transferResponseWriter 统计下载的字节数，并从响应头中获取下载的总长度
+type transferResponseWriter struct {
+	drainResponseWriter
+	total *atomic.Int64
+}
+
+// WriteHeader 记录最终响应的Content-Length
+func (w *transferResponseWriter) WriteHeader(code int) {
+	if code >= http.StatusOK {
+		if n, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil {
+			w.total.Store(n)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
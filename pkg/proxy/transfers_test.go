@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTransferTestHandler 返回传输状态中间件，内层处理器的下载在release关闭前不会结束
+func newTransferTestHandler(t *testing.T) (*transferStatusMiddleware, chan struct{}) {
+	release := make(chan struct{})
+	h := NewTransferStatusMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Length", "10")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("01234"))
+			<-release
+			w.Write([]byte("56789"))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}), "/.status")
+	return h.(*transferStatusMiddleware), release
+}
+
+// startTransfer 在后台以user的身份开始一个下载，等待前5个字节发送完成
+func startTransfer(t *testing.T, m *transferStatusMiddleware, user, p string) {
+	go serve(m, user, "GET", p, "", "X-Request-Id", user+"-download")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range m.Transfers() {
+			if status.Path == p && status.Bytes == 5 {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("传输没有开始: %s", p)
+}
+
+func TestTransferStatusFiltersByUser(t *testing.T) {
+	m, release := newTransferTestHandler(t)
+	defer close(release)
+	startTransfer(t, m, "alice", "/alice/secret.bin")
+	startTransfer(t, m, "bob", "/bob/report.pdf")
+
+	for user, want := range map[string]string{"alice": "/alice/secret.bin", "bob": "/bob/report.pdf"} {
+		w := serve(m, user, "GET", "/.status", "")
+		var result struct {
+			Transfers []TransferStatus `json:"transfers"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("解析传输列表失败: %v", err)
+		}
+		if len(result.Transfers) != 1 || result.Transfers[0].Path != want || result.Transfers[0].Bytes != 5 || result.Transfers[0].Total != 10 {
+			t.Errorf("%s 的传输列表错误: %+v", user, result.Transfers)
+		}
+	}
+	if w := serve(m, "mallory", "GET", "/.status", ""); strings.Contains(w.Body.String(), "secret.bin") {
+		t.Errorf("其他用户不应看到别人的传输: %s", w.Body.String())
+	}
+}
+
+func TestTransferEventsFilterByUser(t *testing.T) {
+	m, release := newTransferTestHandler(t)
+	defer close(release)
+	startTransfer(t, m, "alice", "/alice/secret.bin")
+
+	events := func(user string) string {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest("GET", "/.status/events", nil).WithContext(ContextWithUser(ctx, user))
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := events("alice"); !strings.Contains(body, "event: progress") || !strings.Contains(body, "/alice/secret.bin") {
+		t.Errorf("alice应收到自己的传输进度: %s", body)
+	}
+	if body := events("bob"); strings.Contains(body, "secret.bin") {
+		t.Errorf("bob不应收到别人的传输进度: %s", body)
+	}
+}
+
+func TestTransferStatusPathNotWritable(t *testing.T) {
+	m, release := newTransferTestHandler(t)
+	close(release)
+
+	for _, tt := range []struct {
+		method, target string
+		header         []string
+	}{
+		{"PUT", "/.status", nil},
+		{"PUT", "/.status/events", nil},
+		{"MKCOL", "/.status/", nil},
+		{"MOVE", "/a.txt", []string{"Destination", "http://proxy/.status"}},
+		{"COPY", "/a.txt", []string{"Destination", "http://proxy/.status/x"}},
+	} {
+		if w := serve(m, "", tt.method, tt.target, "", tt.header...); w.Code != http.StatusForbidden {
+			t.Errorf("%s %s 应返回403, 实际 %d", tt.method, tt.target, w.Code)
+		}
+	}
+	if w := serve(m, "", "PUT", "/.statusfile", "x"); w.Code != http.StatusCreated {
+		t.Errorf("前缀相同的其他路径不受影响: %d", w.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// TrashConfig 回收站配置，启用后DELETE会把文件移动到回收站而不是直接删除
+type TrashConfig struct {
+	Dir       string        // 回收站目录，相对于代理根目录，如 /.trash
+	Retention time.Duration // 回收站中的文件保留时间，超过后自动清除，0表示不清除
+}
+
+// inTrash 检查请求路径是否在回收站内，回收站内的删除是真正的删除
+func (h *ProxyHandler) inTrash(r *http.Request, p string) bool {
+	trash := strings.TrimSuffix(backendPath(h.backend, "", path.Join("/", h.trash.Dir)), "/")
+	target := strings.TrimSuffix(backendPath(h.backend, mountPrefix(r), p), "/")
+	return target == trash || strings.HasPrefix(target, trash+"/")
+}
+
+// shouldTrash 检查DELETE请求是否需要转换为移动到回收站
+func (h *ProxyHandler) shouldTrash(r *http.Request) bool {
+	return h.trash != nil && r.Method == http.MethodDelete && !h.inTrash(r, r.URL.Path)
+}
+
+// moveToTrash 把要删除的文件或目录移动到回收站，名称加上删除时间前缀避免重名
+func (h *ProxyHandler) moveToTrash(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(r.URL.Path, "/")
+	if name == "" || name == mountPrefix(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// 保留原文件名和扩展名，从回收站下载时仍能按扩展名识别并解密
+	trashName := time.Now().UTC().Format(timestampNameFormat) + "-" + path.Base(name)
+	destination := (&url.URL{Path: mountPrefix(r) + path.Join("/", h.trash.Dir, trashName)}).String()
+
+	status := h.trashMove(r, destination)
+	if (status < 200 || status >= 300) && status != http.StatusNotFound {
+		// 回收站目录可能还不存在，后端对此返回409或403
+		h.internalRequest(r, "MKCOL", mountPrefix(r)+path.Join("/", h.trash.Dir)+"/")
+		status = h.trashMove(r, destination)
+	}
+	if status < 200 || status >= 300 {
+		h.logger.Error("[TRASH] 移动到回收站失败: %s, 状态码: %d", r.URL.Path, status)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	h.logger.Info("[TRASH] 已移动到回收站: %s -> %s", r.URL.Path, trashName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// trashMove 发送MOVE请求把原请求的目标移动到destination，返回状态码
+func (h *ProxyHandler) trashMove(r *http.Request, destination string) int {
+	moveReq := r.Clone(r.Context())
+	moveReq.Method = "MOVE"
+	moveReq.Body = http.NoBody
+	moveReq.ContentLength = 0
+	moveReq.Header.Set("Destination", destination)
+	moveReq.Header.Set("Overwrite", "F")
+	moveReq.Header.Set("Depth", "infinity")
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	h.reverseProxy.ServeHTTP(recorder, moveReq)
+	return recorder.status
+}
+
+// startTrashPurge 启动回收站定期清除，删除超过保留时间的文件
+func (h *ProxyHandler) startTrashPurge() {
+	if h.trash == nil || h.trash.Retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			h.purgeTrash()
+			select {
+			case <-ticker.C:
+			case <-h.stopCleanupChan:
+				return
+			}
+		}
+	}()
+}
+
+// purgeTrash 清除回收站中超过保留时间的文件
+func (h *ProxyHandler) purgeTrash() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	req, err := newInternalRequest(ctx)
+	if err != nil {
+		return
+	}
+	dir := path.Join("/", h.trash.Dir) + "/"
+	entries, status, err := h.listCollection(req, dir)
+	if status == http.StatusNotFound {
+		return
+	}
+	if err != nil {
+		h.logger.Warn("[TRASH] 读取回收站失败: %v", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-h.trash.Retention)
+	for _, entry := range entries {
+		if len(entry.name) <= len(timestampNameFormat) {
+			continue
+		}
+		deleted, err := time.Parse(timestampNameFormat, entry.name[:len(timestampNameFormat)])
+		if err != nil || deleted.After(cutoff) {
+			continue
+		}
+		status := h.internalRequest(req, http.MethodDelete, dir+entry.name)
+		if status >= 200 && status < 300 {
+			h.logger.Info("[TRASH] 已清除过期文件: %s", entry.name)
+		} else {
+			h.logger.Warn("[TRASH] 清除过期文件失败: %s, 状态码: %d", entry.name, status)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trashEntries 列出回收站目录中的项目名称
+func trashEntries(t *testing.T, h *ProxyHandler) []string {
+	req, err := newInternalRequest(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _, err := h.listCollection(req, "/.trash/")
+	if err != nil {
+		t.Fatalf("读取回收站失败: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.name)
+	}
+	return names
+}
+
+func TestTrashDeleteMovesToTrash(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Trash: &TrashConfig{Dir: "/.trash"}})
+	serve(h, "", "PUT", "/a.txt", "hello")
+
+	if w := serve(h, "", "DELETE", "/a.txt", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("删除失败: %d %s", w.Code, w.Body.String())
+	}
+	if status, _ := backendGet(t, backend.URL, "/a.txt"); status != http.StatusNotFound {
+		t.Fatalf("原文件应已移走: %d", status)
+	}
+
+	// 回收站目录自动创建，文件名带有删除时间前缀
+	names := trashEntries(t, h)
+	if len(names) != 1 || !strings.HasSuffix(names[0], "-a.txt") || len(names[0]) != len(timestampNameFormat)+len("-a.txt") {
+		t.Fatalf("回收站内容错误: %v", names)
+	}
+	// 移动的是密文，从回收站下载时仍能解密
+	if w := serve(h, "", "GET", "/.trash/"+names[0], ""); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("从回收站下载失败: %d %q", w.Code, w.Body.String())
+	}
+
+	// 回收站内的删除是真正的删除
+	if w := serve(h, "", "DELETE", "/.trash/"+names[0], ""); w.Code != http.StatusNoContent {
+		t.Fatalf("清除回收站文件失败: %d", w.Code)
+	}
+	if names := trashEntries(t, h); len(names) != 0 {
+		t.Errorf("回收站内的删除不应再移动: %v", names)
+	}
+}
+
+func TestTrashRejectsRoot(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Trash: &TrashConfig{Dir: "/.trash"}})
+
+	if w := serve(h, "", "DELETE", "/", ""); w.Code != http.StatusForbidden {
+		t.Errorf("删除根目录应返回403, 实际 %d", w.Code)
+	}
+}
+
+func TestTrashPurgeExpired(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Trash: &TrashConfig{Dir: "/.trash", Retention: time.Hour}})
+	serve(h, "", "MKCOL", "/.trash/", "")
+	old := time.Now().Add(-2*time.Hour).UTC().Format(timestampNameFormat) + "-old.txt"
+	recent := time.Now().UTC().Format(timestampNameFormat) + "-recent.txt"
+	serve(h, "", "PUT", "/.trash/"+old, "old")
+	serve(h, "", "PUT", "/.trash/"+recent, "recent")
+	serve(h, "", "PUT", "/.trash/other.txt", "other")
+
+	h.purgeTrash()
+
+	names := strings.Join(trashEntries(t, h), ",")
+	if strings.Contains(names, old) {
+		t.Errorf("超过保留时间的文件应被清除: %s", names)
+	}
+	if !strings.Contains(names, recent) || !strings.Contains(names, "other.txt") {
+		t.Errorf("未过期或不带时间前缀的文件不应被清除: %s", names)
+	}
+}
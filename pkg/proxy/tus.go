@@ -0,0 +1,453 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// TUS协议版本和支持的扩展
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// TusConfig TUS断点续传上传配置
+type TusConfig struct {
+	Path       string        // TUS端点路径，为空表示不启用
+	Dir        string        // 暂存未完成上传的本地目录
+	MaxSize    int64         // 单个上传的大小上限，0表示不限制
+	Expiration time.Duration // 未完成的上传超过该时间没有新数据时删除
+}
+
+// tusUpload 未完成上传的信息，与暂存数据一起保存在磁盘上，重启后可以继续上传
+type tusUpload struct {
+	ID          string `json:"id"`
+	Length      int64  `json:"length"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type,omitempty"`
+	User        string `json:"user,omitempty"`
+}
+
+// tusMiddleware 在指定端点上接收TUS断点续传上传，数据在本地暂存，
+// 全部接收后作为一个普通PUT请求交给内层处理器加密并上传到后端
+type tusMiddleware struct {
+	handler http.Handler
+	config  *TusConfig
+	logger  utils.Logger
+
+	mu     sync.Mutex
+	active map[string]bool // 正在写入的上传，同一上传不允许并发PATCH
+}
+
+// NewTusMiddleware 创建TUS断点续传上传中间件，需要放在认证中间件内层
+func NewTusMiddleware(handler http.Handler, config *TusConfig) (http.Handler, error) {
+	if config == nil || config.Path == "" {
+		return handler, nil
+	}
+	config.Path = "/" + strings.Trim(config.Path, "/")
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	m := &tusMiddleware{
+		handler: handler,
+		config:  config,
+		logger:  handlerLogger(handler),
+		active:  make(map[string]bool),
+	}
+	if config.Expiration > 0 {
+		go m.cleanupLoop()
+	}
+	return m, nil
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *tusMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != m.config.Path && !strings.HasPrefix(r.URL.Path, m.config.Path+"/") {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	// 部分客户端和代理不支持PATCH、DELETE，通过该头指定实际方法
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" && r.Method == http.MethodPost {
+		method = strings.ToUpper(override)
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		if m.config.MaxSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(m.config.MaxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported TUS version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, m.config.Path), "/")
+	if id == "" {
+		if method == http.MethodPost {
+			m.create(w, r)
+		} else {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	upload, offset, err := m.load(id)
+	if err != nil || upload.User != UserFromRequest(r) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	switch method {
+	case http.MethodHead:
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		m.patch(w, r, upload, offset)
+	case http.MethodDelete:
+		m.remove(id)
+		m.logger.Info("[TUS] 取消上传: %s -> %s", id, upload.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// getLogger 实现loggerProvider接口
+func (m *tusMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// create 创建新的上传，目标路径由Upload-Metadata中的path或filename指定
+func (m *tusMiddleware) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Upload-Length required", http.StatusBadRequest)
+		return
+	}
+	if m.config.MaxSize > 0 && length > m.config.MaxSize {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	target := metadata["path"]
+	if target == "" {
+		target = metadata["filename"]
+	}
+	if target == "" {
+		http.Error(w, "Upload-Metadata must contain path or filename", http.StatusBadRequest)
+		return
+	}
+
+	upload := &tusUpload{
+		ID:          newTusID(),
+		Length:      length,
+		Path:        path.Clean("/" + target),
+		ContentType: metadata["filetype"],
+		User:        UserFromRequest(r),
+	}
+	if err := m.save(upload); err != nil {
+		m.logger.Error("[TUS] 创建上传失败: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	m.logger.Info("[TUS] 创建上传: %s -> %s, %d 字节", upload.ID, upload.Path, upload.Length)
+
+	w.Header().Set("Location", m.config.Path+"/"+upload.ID)
+	if r.Header.Get("Content-Type") == tusChunkType || length == 0 {
+		// creation-with-upload：创建请求中直接带有第一段数据
+		m.patch(&createdWriter{ResponseWriter: w}, r, upload, 0)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// patch 追加一段数据，数据全部接收后上传到后端
+func (m *tusMiddleware) patch(w http.ResponseWriter, r *http.Request, upload *tusUpload, offset int64) {
+	if _, created := w.(*createdWriter); !created {
+		if r.Header.Get("Content-Type") != tusChunkType {
+			http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+			return
+		}
+		if requested, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64); err != nil || requested != offset {
+			http.Error(w, "Upload-Offset mismatch", http.StatusConflict)
+			return
+		}
+	}
+	if !m.acquire(upload.ID) {
+		http.Error(w, "Upload is locked", http.StatusLocked)
+		return
+	}
+	defer m.release(upload.ID)
+
+	file, err := os.OpenFile(m.dataFile(upload.ID), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		m.logger.Error("[TUS] 打开暂存文件失败: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	// 中断的PATCH也保留已收到的数据，客户端通过HEAD获取偏移后继续
+	n, copyErr := io.Copy(&offsetWriter{file: file, offset: offset}, io.LimitReader(r.Body, upload.Length-offset))
+	file.Close()
+	newOffset := offset + n
+	m.logger.Debug("[TUS] 接收数据: %s, %d 字节, 进度: %d/%d", upload.ID, n, newOffset, upload.Length)
+
+	if copyErr != nil {
+		m.logger.Warn("[TUS] 接收数据中断: %s, 已保存 %d/%d 字节: %v", upload.ID, newOffset, upload.Length, copyErr)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if newOffset == upload.Length {
+		if status := m.finish(r, upload); status < 200 || status >= 300 {
+			// 上传到后端失败时回退本次数据，客户端重试最后一段时会再次上传
+			os.Truncate(m.dataFile(upload.ID), offset)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	if m.config.Expiration > 0 && newOffset < upload.Length {
+		w.Header().Set("Upload-Expires", time.Now().Add(m.config.Expiration).UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finish 将暂存的完整文件作为PUT请求交给内层处理器，返回内层处理器的响应状态码
+func (m *tusMiddleware) finish(r *http.Request, upload *tusUpload) int {
+	file, err := os.Open(m.dataFile(upload.ID))
+	if err != nil {
+		m.logger.Error("[TUS] 打开暂存文件失败: %v", err)
+		return http.StatusInternalServerError
+	}
+	defer file.Close()
+
+	putReq := r.Clone(r.Context())
+	putReq.Method = http.MethodPut
+	putReq.URL.Path = upload.Path
+	putReq.URL.RawPath = ""
+	putReq.RequestURI = upload.Path
+	putReq.Body = file
+	putReq.ContentLength = upload.Length
+	for name := range putReq.Header {
+		if strings.HasPrefix(name, "Upload-") || strings.HasPrefix(name, "Tus-") || name == "X-Http-Method-Override" {
+			putReq.Header.Del(name)
+		}
+	}
+	putReq.Header.Set("Content-Length", strconv.FormatInt(upload.Length, 10))
+	contentType := upload.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	putReq.Header.Set("Content-Type", contentType)
+
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	m.handler.ServeHTTP(recorder, putReq)
+	if recorder.status >= 200 && recorder.status < 300 {
+		m.logger.Info("[TUS] 上传完成: %s -> %s, %d 字节", upload.ID, upload.Path, upload.Length)
+		m.remove(upload.ID)
+	} else {
+		m.logger.Error("[TUS] 上传到后端失败: %s -> %s, 状态码: %d", upload.ID, upload.Path, recorder.status)
+	}
+	return recorder.status
+}
+
+// infoFile 返回上传信息文件的路径
+func (m *tusMiddleware) infoFile(id string) string {
+	return filepath.Join(m.config.Dir, id+".json")
+}
+
+// dataFile 返回暂存数据文件的路径
+func (m *tusMiddleware) dataFile(id string) string {
+	return filepath.Join(m.config.Dir, id+".bin")
+}
+
+// save 保存上传信息并创建空的暂存文件
+func (m *tusMiddleware) save(upload *tusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.dataFile(upload.ID), nil, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(m.infoFile(upload.ID), data, 0600)
+}
+
+// load 读取上传信息，当前偏移为暂存文件的大小
+func (m *tusMiddleware) load(id string) (*tusUpload, int64, error) {
+	if !isTusID(id) {
+		return nil, 0, errors.New("invalid upload id")
+	}
+	data, err := os.ReadFile(m.infoFile(id))
+	if err != nil {
+		return nil, 0, err
+	}
+	var upload tusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, 0, err
+	}
+	info, err := os.Stat(m.dataFile(id))
+	if err != nil {
+		return nil, 0, err
+	}
+	return &upload, info.Size(), nil
+}
+
+// remove 删除上传信息和暂存数据
+func (m *tusMiddleware) remove(id string) {
+	os.Remove(m.dataFile(id))
+	os.Remove(m.infoFile(id))
+}
+
+// acquire 标记上传正在写入，已在写入时返回false
+func (m *tusMiddleware) acquire(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active[id] {
+		return false
+	}
+	m.active[id] = true
+	return true
+}
+
+// release 清除上传的写入标记
+func (m *tusMiddleware) release(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, id)
+}
+
+// cleanupLoop 定期删除过期的未完成上传
+func (m *tusMiddleware) cleanupLoop() {
+	ticker := time.NewTicker(m.config.Expiration / 4)
+	defer ticker.Stop()
+	for range ticker.C {
+		entries, err := os.ReadDir(m.config.Dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			id, ok := strings.CutSuffix(entry.Name(), ".json")
+			if !ok || !isTusID(id) {
+				continue
+			}
+			info, err := os.Stat(m.dataFile(id))
+			if err == nil && time.Since(info.ModTime()) < m.config.Expiration {
+				continue
+			}
+			m.logger.Info("[TUS] 删除过期的上传: %s", id)
+			m.remove(id)
+		}
+	}
+}
+
+// newTusID 生成随机的上传ID
+func newTusID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// isTusID 检查上传ID格式，避免路径穿越
+func isTusID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// parseTusMetadata 解析Upload-Metadata头，格式为逗号分隔的 键 base64值
+func parseTusMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
+
+// offsetWriter 从指定偏移开始写入文件
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+// Write 实现io.Writer接口
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// createdWriter 创建请求同时带有数据时，把成功的204响应改为201
+type createdWriter struct {
+	http.ResponseWriter
+}
+
+// WriteHeader 实现http.ResponseWriter接口
+func (w *createdWriter) WriteHeader(status int) {
+	if status == http.StatusNoContent {
+		status = http.StatusCreated
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// discardResponseWriter 只记录状态码、丢弃响应体的ResponseWriter，用于内部请求
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+// Header 实现http.ResponseWriter接口
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader 实现http.ResponseWriter接口
+func (w *discardResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write 实现http.ResponseWriter接口
+func (w *discardResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(p), nil
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTusTestHandler(t *testing.T, maxSize int64) (http.Handler, string) {
+	backend := newDAVBackend(t)
+	h, err := NewTusMiddleware(newTestProxy(t, backend.URL, Options{}), &TusConfig{
+		Path:    "/.tus",
+		Dir:     t.TempDir(),
+		MaxSize: maxSize,
+	})
+	if err != nil {
+		t.Fatalf("创建TUS中间件失败: %v", err)
+	}
+	return h, backend.URL
+}
+
+// tusCreate 创建上传，返回上传地址
+func tusCreate(t *testing.T, h http.Handler, user string, length int, target string) string {
+	w := serve(h, user, "POST", "/.tus", "",
+		"Tus-Resumable", tusVersion,
+		"Upload-Length", strconv.Itoa(length),
+		"Upload-Metadata", "path "+base64.StdEncoding.EncodeToString([]byte(target)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建上传失败: %d %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/.tus/") {
+		t.Fatalf("Location错误: %s", location)
+	}
+	return location
+}
+
+func TestTusResumableUpload(t *testing.T) {
+	h, backendURL := newTusTestHandler(t, 0)
+	content := strings.Repeat("0123456789", 30)
+	location := tusCreate(t, h, "alice", len(content), "/docs/a.bin")
+	serve(h, "alice", "MKCOL", "/docs/", "")
+
+	w := serve(h, "alice", "PATCH", location, content[:100],
+		"Tus-Resumable", tusVersion, "Upload-Offset", "0", "Content-Type", tusChunkType)
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "100" {
+		t.Fatalf("第一段上传失败: %d offset=%s", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// 偏移不一致的PATCH被拒绝
+	w = serve(h, "alice", "PATCH", location, content[50:],
+		"Tus-Resumable", tusVersion, "Upload-Offset", "50", "Content-Type", tusChunkType)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("偏移不一致应返回409, 实际 %d", w.Code)
+	}
+
+	w = serve(h, "alice", "HEAD", location, "", "Tus-Resumable", tusVersion)
+	if w.Header().Get("Upload-Offset") != "100" || w.Header().Get("Upload-Length") != "300" {
+		t.Fatalf("HEAD返回的进度错误: %v", w.Header())
+	}
+
+	w = serve(h, "alice", "PATCH", location, content[100:],
+		"Tus-Resumable", tusVersion, "Upload-Offset", "100", "Content-Type", tusChunkType)
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "300" {
+		t.Fatalf("最后一段上传失败: %d", w.Code)
+	}
+
+	// 完成的上传加密后写入后端，通过代理读取为原文
+	if status, data := backendGet(t, backendURL, "/docs/a.bin"); status != http.StatusOK || len(data) != len(content) || string(data) == content {
+		t.Fatalf("后端文件错误: %d, %d 字节", status, len(data))
+	}
+	if w := serve(h, "alice", "GET", "/docs/a.bin", ""); w.Body.String() != content {
+		t.Fatalf("下载的内容与上传的不一致")
+	}
+	// 完成后上传地址不再可用
+	if w := serve(h, "alice", "HEAD", location, "", "Tus-Resumable", tusVersion); w.Code != http.StatusNotFound {
+		t.Errorf("完成的上传应返回404, 实际 %d", w.Code)
+	}
+}
+
+func TestTusUploadOwnedByCreator(t *testing.T) {
+	h, _ := newTusTestHandler(t, 0)
+	location := tusCreate(t, h, "alice", 10, "/a.bin")
+
+	for _, method := range []string{"HEAD", "DELETE"} {
+		if w := serve(h, "bob", method, location, "", "Tus-Resumable", tusVersion); w.Code != http.StatusNotFound {
+			t.Errorf("其他用户%s别人的上传应返回404, 实际 %d", method, w.Code)
+		}
+	}
+	w := serve(h, "bob", "PATCH", location, "0123456789",
+		"Tus-Resumable", tusVersion, "Upload-Offset", "0", "Content-Type", tusChunkType)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("其他用户不能写入别人的上传: %d", w.Code)
+	}
+	if w := serve(h, "alice", "DELETE", location, "", "Tus-Resumable", tusVersion); w.Code != http.StatusNoContent {
+		t.Errorf("创建者应可以取消上传: %d", w.Code)
+	}
+}
+
+func TestTusProtocolChecks(t *testing.T) {
+	h, _ := newTusTestHandler(t, 100)
+
+	w := serve(h, "", "OPTIONS", "/.tus", "")
+	if w.Code != http.StatusNoContent || w.Header().Get("Tus-Max-Size") != "100" || w.Header().Get("Tus-Extension") != tusExtensions {
+		t.Errorf("OPTIONS响应错误: %d %v", w.Code, w.Header())
+	}
+	if w := serve(h, "", "POST", "/.tus", "", "Upload-Length", "10"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("缺少Tus-Resumable应返回412, 实际 %d", w.Code)
+	}
+	if w := serve(h, "", "POST", "/.tus", "", "Tus-Resumable", tusVersion, "Upload-Length", "101",
+		"Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("a.bin"))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过大小上限应返回413, 实际 %d", w.Code)
+	}
+	if w := serve(h, "", "POST", "/.tus", "", "Tus-Resumable", tusVersion, "Upload-Length", "10"); w.Code != http.StatusBadRequest {
+		t.Errorf("没有目标路径应返回400, 实际 %d", w.Code)
+	}
+}
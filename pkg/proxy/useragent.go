@@ -0,0 +1,28 @@
+package proxy
+
+import "net/http"
+
+// userAgentPresets 常见WebDAV客户端的User-Agent，部分服务商会限制或拒绝不认识的客户端
+var userAgentPresets = map[string]string{
+	"windows":   "Microsoft-WebDAV-MiniRedir/10.0.19045",
+	"finder":    "WebDAVFS/3.0.0 (03008000) Darwin/23.5.0 (arm64)",
+	"davfs2":    "davfs2/1.7.0 neon/0.32.5",
+	"rclone":    "rclone/v1.67.0",
+	"cyberduck": "Cyberduck/8.9.0.41584 (Mac OS X/14.5) (aarch64)",
+	"winscp":    "WinSCP/6.3.4 neon/0.32.5",
+}
+
+// resolveUserAgent 把预设名称转换为对应的User-Agent，其他值原样使用
+func resolveUserAgent(userAgent string) string {
+	if preset, ok := userAgentPresets[userAgent]; ok {
+		return preset
+	}
+	return userAgent
+}
+
+// setUserAgent 配置了后端User-Agent时替换发往后端的请求中客户端的User-Agent
+func (h *ProxyHandler) setUserAgent(req *http.Request) {
+	if h.userAgent != "" {
+		req.Header.Set("User-Agent", h.userAgent)
+	}
+}
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionConfig 覆盖上传时保留历史版本的配置
+type VersionConfig struct {
+	Dir  string // 历史版本目录，相对于代理根目录，如 /.versions
+	Keep int    // 每个文件保留的历史版本数量
+}
+
+// versionInfo 历史版本列表接口返回的一项
+type versionInfo struct {
+	Name         string `json:"name"`
+	Time         string `json:"time"`
+	Size         int64  `json:"size"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// inVersions 检查路径是否在历史版本目录内
+func (h *ProxyHandler) inVersions(r *http.Request, p string) bool {
+	versions := strings.TrimSuffix(backendPath(h.backend, "", path.Join("/", h.versions.Dir)), "/")
+	target := strings.TrimSuffix(backendPath(h.backend, mountPrefix(r), p), "/")
+	return target == versions || strings.HasPrefix(target, versions+"/")
+}
+
+// shouldVersion 检查上传前是否需要保存旧版本，分块上传的临时分块不保存
+func (h *ProxyHandler) shouldVersion(r *http.Request) bool {
+	return h.versions != nil && r.Method == http.MethodPut && !strings.HasSuffix(r.URL.Path, "/") &&
+		!strings.Contains(r.URL.Path, "/remote.php/dav/uploads/") && !h.inVersions(r, r.URL.Path)
+}
+
+// versionDir 返回文件的历史版本目录（客户端路径）
+func (h *ProxyHandler) versionDir(r *http.Request, filePath string) string {
+	prefix := mountPrefix(r)
+	return prefix + path.Join("/", h.versions.Dir, strings.TrimPrefix(filePath, prefix))
+}
+
+// saveVersion 在覆盖文件前把旧的密文复制到历史版本目录，名称为时间戳加原扩展名，
+// 复制的是密文，解密不依赖路径，从历史版本目录下载时仍能按扩展名识别并解密。返回是否保存了旧版本
+func (h *ProxyHandler) saveVersion(r *http.Request, filePath string) bool {
+	dir := h.versionDir(r, filePath)
+	name := time.Now().UTC().Format(timestampNameFormat) + path.Ext(filePath)
+
+	status := h.copyVersion(r, filePath, dir+"/"+name, false)
+	if status == http.StatusNotFound {
+		// 新文件，没有旧版本
+		return false
+	}
+	if status < 200 || status >= 300 {
+		// 历史版本目录可能还不存在，逐级创建后重试
+		h.mkcolAll(r, dir)
+		status = h.copyVersion(r, filePath, dir+"/"+name, false)
+	}
+	if status < 200 || status >= 300 {
+		if status != http.StatusNotFound {
+			h.logger.Warn("[VERSIONS] 保存旧版本失败: %s, 状态码: %d", filePath, status)
+		}
+		return false
+	}
+	h.logger.Info("[VERSIONS] 已保存旧版本: %s -> %s", filePath, name)
+	return true
+}
+
+// copyVersion 发送COPY请求复制单个文件，返回状态码
+func (h *ProxyHandler) copyVersion(r *http.Request, src, dst string, overwrite bool) int {
+	copyReq := r.Clone(r.Context())
+	copyReq.Method = "COPY"
+	copyReq.URL.Path = src
+	copyReq.URL.RawPath = ""
+	copyReq.URL.RawQuery = ""
+	copyReq.Body = http.NoBody
+	copyReq.ContentLength = 0
+	copyReq.Header = cleanChunkHeader(r.Header)
+	copyReq.Header.Set("Destination", (&url.URL{Path: dst}).String())
+	copyReq.Header.Set("Depth", "0")
+	if overwrite {
+		copyReq.Header.Set("Overwrite", "T")
+	} else {
+		copyReq.Header.Set("Overwrite", "F")
+	}
+	recorder := &discardResponseWriter{header: make(http.Header)}
+	h.reverseProxy.ServeHTTP(recorder, copyReq)
+	return recorder.status
+}
+
+// mkcolAll 逐级创建目录，已存在的目录忽略
+func (h *ProxyHandler) mkcolAll(r *http.Request, dir string) {
+	prefix := mountPrefix(r)
+	current := prefix
+	for _, part := range strings.Split(strings.Trim(strings.TrimPrefix(dir, prefix), "/"), "/") {
+		current += "/" + part
+		h.internalRequest(r, "MKCOL", current+"/")
+	}
+}
+
+// listVersions 列出文件的历史版本，按时间从旧到新排序
+func (h *ProxyHandler) listVersions(r *http.Request, dir string) ([]versionInfo, error) {
+	entries, status, err := h.listCollection(r, dir)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []versionInfo
+	for _, entry := range entries {
+		if entry.collection || len(entry.name) < len(timestampNameFormat) {
+			continue
+		}
+		saved, err := time.Parse(timestampNameFormat, entry.name[:len(timestampNameFormat)])
+		if err != nil {
+			continue
+		}
+		versions = append(versions, versionInfo{
+			Name:         entry.name,
+			Time:         saved.Format(time.RFC3339Nano),
+			Size:         entry.size,
+			LastModified: entry.lastModified,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Name < versions[j].Name
+	})
+	return versions, nil
+}
+
+// versionBeforeUpload 上传覆盖文件前保存旧版本并删除超出数量的旧版本
+func (h *ProxyHandler) versionBeforeUpload(r *http.Request) {
+	if h.saveVersion(r, r.URL.Path) {
+		h.pruneVersions(r, h.versionDir(r, r.URL.Path))
+	}
+}
+
+// pruneVersions 删除超出保留数量的最旧版本
+func (h *ProxyHandler) pruneVersions(r *http.Request, dir string) {
+	versions, err := h.listVersions(r, dir)
+	if err != nil {
+		h.logger.Warn("[VERSIONS] 读取历史版本失败: %s, 错误: %v", dir, err)
+		return
+	}
+	for len(versions) > h.versions.Keep {
+		status := h.internalRequest(r, http.MethodDelete, dir+"/"+versions[0].Name)
+		if status < 200 || status >= 300 {
+			h.logger.Warn("[VERSIONS] 删除旧版本失败: %s/%s, 状态码: %d", dir, versions[0].Name, status)
+		}
+		versions = versions[1:]
+	}
+}
+
+// isVersionRequest 检查是否为历史版本管理请求：GET <文件>?versions 列出版本，POST <文件>?restore=<版本> 恢复版本
+func (h *ProxyHandler) isVersionRequest(r *http.Request) bool {
+	if h.versions == nil {
+		return false
+	}
+	query := r.URL.Query()
+	return (r.Method == http.MethodGet && query.Has("versions")) || (r.Method == http.MethodPost && query.Has("restore"))
+}
+
+// serveVersions 处理历史版本的列出和恢复
+func (h *ProxyHandler) serveVersions(w http.ResponseWriter, r *http.Request) {
+	dir := h.versionDir(r, r.URL.Path)
+	if r.Method == http.MethodGet {
+		versions, err := h.listVersions(r, dir)
+		if err != nil {
+			h.logger.Error("[VERSIONS] 读取历史版本失败: %s, 错误: %v", r.URL.Path, err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+		if versions == nil {
+			versions = []versionInfo{}
+		}
+		body, _ := json.Marshal(versions)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		return
+	}
+
+	name := r.URL.Query().Get("restore")
+	if name == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	versions, err := h.listVersions(r, dir)
+	if err != nil {
+		h.logger.Error("[VERSIONS] 读取历史版本失败: %s, 错误: %v", r.URL.Path, err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	found := false
+	for _, version := range versions {
+		if version.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	// 恢复前先保存当前版本，恢复操作本身也可以撤销；超出数量的旧版本在恢复后再删除，避免删掉要恢复的版本
+	h.saveVersion(r, r.URL.Path)
+	status := h.copyVersion(r, dir+"/"+name, r.URL.Path, true)
+	h.pruneVersions(r, dir)
+	if status < 200 || status >= 300 {
+		h.logger.Error("[VERSIONS] 恢复历史版本失败: %s <- %s, 状态码: %d", r.URL.Path, name, status)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	h.logger.Info("[VERSIONS] 已恢复历史版本: %s <- %s", r.URL.Path, name)
+	w.WriteHeader(http.StatusNoContent)
+}
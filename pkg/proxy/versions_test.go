@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// listTestVersions 通过GET <文件>?versions列出历史版本
+func listTestVersions(t *testing.T, h http.Handler, p string) []versionInfo {
+	w := serve(h, "", "GET", p+"?versions", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("列出历史版本失败: %d %s", w.Code, w.Body.String())
+	}
+	var versions []versionInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &versions); err != nil {
+		t.Fatalf("解析历史版本列表失败: %v", err)
+	}
+	return versions
+}
+
+func TestVersionsSavedOnOverwrite(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Versions: &VersionConfig{Dir: "/.versions", Keep: 2}})
+
+	if versions := listTestVersions(t, h, "/a.txt"); len(versions) != 0 {
+		t.Fatalf("新文件不应有历史版本: %v", versions)
+	}
+	for _, content := range []string{"v1", "v2", "v3", "v4"} {
+		if w := serve(h, "", "PUT", "/a.txt", content); w.Code/100 != 2 {
+			t.Fatalf("上传 %s 失败: %d", content, w.Code)
+		}
+		// 版本名称精确到毫秒
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// 只保留最近的2个旧版本
+	versions := listTestVersions(t, h, "/a.txt")
+	if len(versions) != 2 {
+		t.Fatalf("应保留2个历史版本, 实际 %v", versions)
+	}
+	for i, want := range []string{"v2", "v3"} {
+		w := serve(h, "", "GET", "/.versions/a.txt/"+versions[i].Name, "")
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("历史版本 %d 的内容错误: %d %q", i, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestVersionsRestore(t *testing.T) {
+	backend := newDAVBackend(t)
+	h := newTestProxy(t, backend.URL, Options{Versions: &VersionConfig{Dir: "/.versions", Keep: 5}})
+	serve(h, "", "PUT", "/a.txt", "old")
+	time.Sleep(2 * time.Millisecond)
+	serve(h, "", "PUT", "/a.txt", "new")
+	time.Sleep(2 * time.Millisecond)
+
+	versions := listTestVersions(t, h, "/a.txt")
+	if len(versions) != 1 {
+		t.Fatalf("应有1个历史版本: %v", versions)
+	}
+	if w := serve(h, "", "POST", "/a.txt?restore="+versions[0].Name, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("恢复失败: %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(h, "", "GET", "/a.txt", ""); w.Body.String() != "old" {
+		t.Fatalf("恢复后的内容错误: %q", w.Body.String())
+	}
+	// 恢复前的当前版本也被保存，恢复操作可以撤销
+	if versions := listTestVersions(t, h, "/a.txt"); len(versions) != 2 {
+		t.Errorf("恢复前应保存当前版本: %v", versions)
+	}
+
+	for _, name := range []string{"missing", "../a.txt", ""} {
+		if w := serve(h, "", "POST", "/a.txt?restore="+name, ""); w.Code != http.StatusNotFound && w.Code != http.StatusBadRequest {
+			t.Errorf("恢复无效的版本 %q 应失败, 实际 %d", name, w.Code)
+		}
+	}
+}
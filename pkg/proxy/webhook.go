@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"webdav-proxy/utils"
+)
+
+// webhookQueueSize 等待发送的事件数量上限，超出时丢弃新事件
+const webhookQueueSize = 1000
+
+// webhookMethods 触发通知的写操作
+var webhookMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+	"MKCOL":           true,
+	"MOVE":            true,
+	"COPY":            true,
+	"PROPPATCH":       true,
+}
+
+// WebhookConfig 事件通知配置
+type WebhookConfig struct {
+	URL     string        // 接收事件的地址，为空表示不启用
+	Secret  string        // 签名密钥，设置后在X-Webhook-Signature头中携带HMAC-SHA256签名
+	Retries int           // 发送失败后的重试次数
+	Timeout time.Duration // 单次发送的超时时间，0表示不限制
+}
+
+// WebhookEvent 发送给webhook的事件
+type WebhookEvent struct {
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination,omitempty"`
+	Size        int64     `json:"size"`
+	User        string    `json:"user,omitempty"`
+	Status      int       `json:"status"`
+	Time        time.Time `json:"time"`
+}
+
+// webhookMiddleware 在写操作成功后异步发送事件通知
+type webhookMiddleware struct {
+	handler http.Handler
+	config  *WebhookConfig
+	client  *http.Client
+	logger  utils.Logger
+	events  chan *WebhookEvent
+}
+
+// NewWebhookMiddleware 创建事件通知中间件，需要放在认证中间件内层才能获取用户
+func NewWebhookMiddleware(handler http.Handler, config *WebhookConfig) http.Handler {
+	if config == nil || config.URL == "" {
+		return handler
+	}
+
+	m := &webhookMiddleware{
+		handler: handler,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		logger:  handlerLogger(handler),
+		events:  make(chan *WebhookEvent, webhookQueueSize),
+	}
+	go m.run()
+	return m
+}
+
+// ServeHTTP 实现http.Handler接口
+func (m *webhookMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !webhookMethods[r.Method] {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+
+	var counter *countingReader
+	if r.Body != nil && r.Body != http.NoBody {
+		counter = &countingReader{ReadCloser: r.Body}
+		r.Body = counter
+	}
+	recorder := &statusRecorder{ResponseWriter: w}
+	m.handler.ServeHTTP(recorder, r)
+	if recorder.Status() < 200 || recorder.Status() >= 300 {
+		return
+	}
+
+	event := &WebhookEvent{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		User:   UserFromRequest(r),
+		Status: recorder.Status(),
+		Time:   time.Now().UTC(),
+	}
+	if counter != nil {
+		event.Size = counter.n
+	}
+	if destination, err := url.Parse(r.Header.Get("Destination")); err == nil && destination.Path != "" {
+		event.Destination = destination.Path
+	}
+
+	select {
+	case m.events <- event:
+	default:
+		m.logger.Warn("[WEBHOOK] 事件队列已满，丢弃事件: %s %s", event.Method, event.Path)
+	}
+}
+
+// getLogger 实现loggerProvider接口
+func (m *webhookMiddleware) getLogger() utils.Logger {
+	return m.logger
+}
+
+// run 依次发送队列中的事件，保证事件按发生顺序到达
+func (m *webhookMiddleware) run() {
+	for event := range m.events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		for attempt := 0; ; attempt++ {
+			err = m.send(body)
+			if err == nil {
+				m.logger.Debug("[WEBHOOK] 已发送事件: %s %s", event.Method, event.Path)
+				break
+			}
+			if attempt >= m.config.Retries {
+				m.logger.Error("[WEBHOOK] 发送事件失败: %s %s, 错误: %v", event.Method, event.Path, err)
+				break
+			}
+			// 指数退避，最长等待1分钟
+			backoff := time.Second << attempt
+			if backoff > time.Minute {
+				backoff = time.Minute
+			}
+			m.logger.Warn("[WEBHOOK] 发送事件失败，%v后重试: %v", backoff, err)
+			time.Sleep(backoff)
+		}
+	}
+}
+
+// send 发送一次事件
+func (m *webhookMiddleware) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, m.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "webdav-proxy-webhook")
+	if m.config.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(m.config.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
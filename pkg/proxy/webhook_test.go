@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookDelivery 接收端收到的一次请求
+type webhookDelivery struct {
+	event     WebhookEvent
+	signature string
+	body      []byte
+}
+
+// newWebhookReceiver 启动接收事件的服务器，前failures次请求返回500
+func newWebhookReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan webhookDelivery) {
+	deliveries := make(chan webhookDelivery, 10)
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= failures {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("解析事件失败: %v", err)
+		}
+		deliveries <- webhookDelivery{event: event, signature: r.Header.Get("X-Webhook-Signature"), body: body}
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver, deliveries
+}
+
+// nextDelivery 等待下一个事件
+func nextDelivery(t *testing.T, deliveries <-chan webhookDelivery) webhookDelivery {
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待事件超时")
+		return webhookDelivery{}
+	}
+}
+
+func TestWebhookSendsWriteEvents(t *testing.T) {
+	receiver, deliveries := newWebhookReceiver(t, 0)
+	backend := newDAVBackend(t)
+	h := NewWebhookMiddleware(newTestProxy(t, backend.URL, Options{}), &WebhookConfig{URL: receiver.URL, Secret: "hook-secret"})
+
+	serve(h, "alice", "GET", "/missing.txt", "")
+	// 失败的写操作不发送事件
+	serve(h, "alice", "DELETE", "/missing.txt", "")
+	serve(h, "alice", "PUT", "/a.txt", "hello")
+	serve(h, "alice", "MOVE", "/a.txt", "", "Destination", "http://proxy/b.txt")
+
+	put := nextDelivery(t, deliveries)
+	if put.event.Method != "PUT" || put.event.Path != "/a.txt" || put.event.Size != 5 || put.event.User != "alice" || put.event.Status != http.StatusCreated {
+		t.Errorf("PUT事件错误: %+v", put.event)
+	}
+	mac := hmac.New(sha256.New, []byte("hook-secret"))
+	mac.Write(put.body)
+	if put.signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("签名错误: %s", put.signature)
+	}
+
+	move := nextDelivery(t, deliveries)
+	if move.event.Method != "MOVE" || move.event.Destination != "/b.txt" {
+		t.Errorf("MOVE事件错误: %+v", move.event)
+	}
+	select {
+	case d := <-deliveries:
+		t.Errorf("不应有其他事件: %+v", d.event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	receiver, deliveries := newWebhookReceiver(t, 1)
+	backend := newDAVBackend(t)
+	h := NewWebhookMiddleware(newTestProxy(t, backend.URL, Options{}), &WebhookConfig{URL: receiver.URL, Retries: 1})
+
+	serve(h, "", "MKCOL", "/dir/", "")
+	if d := nextDelivery(t, deliveries); d.event.Method != "MKCOL" || d.signature != "" {
+		t.Errorf("重试后的事件错误: %+v, 签名: %q", d.event, d.signature)
+	}
+}
@@ -0,0 +1,247 @@
+package sftpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"webdav-proxy/pkg/davclient"
+	"webdav-proxy/utils"
+)
+
+// readBlockSize 每次从代理读取的数据长度，同一个打开的文件缓存最近读取的一块
+const readBlockSize = 1 << 20
+
+// serveSFTP 在channel上运行SFTP请求服务器，直到客户端断开
+func (s *Server) serveSFTP(ctx context.Context, remoteAddr string, channel io.ReadWriteCloser) {
+	h := &handlers{
+		ctx:    ctx,
+		client: davclient.New(s.config.Handler).WithRemoteAddr(remoteAddr),
+		logger: s.config.Logger,
+	}
+	server := sftp.NewRequestServer(channel, sftp.Handlers{
+		FileGet:  h,
+		FilePut:  h,
+		FileCmd:  h,
+		FileList: h,
+	})
+	if err := server.Serve(); err != nil && err != io.EOF {
+		s.config.Logger.Debug("[SFTP] 会话结束: %v", err)
+	}
+	server.Close()
+}
+
+// handlers 把SFTP操作转换为WebDAV请求
+type handlers struct {
+	ctx    context.Context // 带有登录用户名，连接断开时取消
+	client *davclient.Client
+	logger utils.Logger
+}
+
+var (
+	_ sftp.FileReader           = (*handlers)(nil)
+	_ sftp.FileWriter           = (*handlers)(nil)
+	_ sftp.PosixRenameFileCmder = (*handlers)(nil)
+	_ sftp.FileLister           = (*handlers)(nil)
+)
+
+// sftpError 把请求错误转换为SFTP状态码
+func sftpError(err error) error {
+	var statusErr *davclient.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.Status {
+		case http.StatusNotFound:
+			return sftp.ErrSSHFxNoSuchFile
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusMethodNotAllowed:
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return fmt.Errorf("%w: %v", sftp.ErrSSHFxFailure, err)
+	}
+	return err
+}
+
+// Fileread 实现sftp.FileReader接口
+func (h *handlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	e, err := h.client.Stat(h.ctx, r.Filepath)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	if e.Dir {
+		return nil, sftp.ErrSSHFxFailure
+	}
+	return &reader{h: h, path: r.Filepath}, nil
+}
+
+// reader 打开用于读取的文件，缓存最近读取的一块数据
+type reader struct {
+	h    *handlers
+	path string
+
+	mu          sync.Mutex
+	block       []byte
+	blockOffset int64
+}
+
+// ReadAt 实现io.ReaderAt接口，需要时按块从代理读取
+func (rd *reader) ReadAt(p []byte, off int64) (int, error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if rd.block == nil || pos < rd.blockOffset || pos >= rd.blockOffset+readBlockSize {
+			blockOffset := pos - pos%readBlockSize
+			data, err := rd.h.client.ReadRange(rd.h.ctx, rd.path, blockOffset, readBlockSize)
+			if err != nil {
+				return n, sftpError(err)
+			}
+			rd.block, rd.blockOffset = data, blockOffset
+		}
+		if pos >= rd.blockOffset+int64(len(rd.block)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], rd.block[pos-rd.blockOffset:])
+		if len(rd.block) < readBlockSize && n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// Filewrite 实现sftp.FileWriter接口。SFTP可以乱序写入，数据先写入本地临时文件，关闭时整个文件上传
+func (h *handlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	tmp, err := os.CreateTemp("", "webdav-encrypt-sftp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &writer{h: h, path: r.Filepath, tmp: tmp}, nil
+}
+
+// writer 打开用于写入的文件
+type writer struct {
+	h    *handlers
+	path string
+	tmp  *os.File
+}
+
+// WriteAt 实现io.WriterAt接口
+func (w *writer) WriteAt(p []byte, off int64) (int, error) {
+	return w.tmp.WriteAt(p, off)
+}
+
+// Close 上传临时文件的内容并删除临时文件，上传失败时客户端的close请求返回错误
+func (w *writer) Close() error {
+	defer os.Remove(w.tmp.Name())
+	defer w.tmp.Close()
+
+	info, err := w.tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.h.client.Put(w.h.ctx, w.path, w.tmp, info.Size(), time.Time{}); err != nil {
+		w.h.logger.Warn("[SFTP] 上传 %s 失败: %v", w.path, err)
+		return sftpError(err)
+	}
+	return nil
+}
+
+// Filecmd 实现sftp.FileCmder接口
+func (h *handlers) Filecmd(r *sftp.Request) error {
+	var err error
+	switch r.Method {
+	case "Setstat":
+		// WebDAV不能修改权限和时间，忽略这些请求使客户端上传后设置属性时不报错
+		return nil
+	case "Rename":
+		err = h.client.Move(h.ctx, r.Filepath, r.Target, false)
+	case "Rmdir", "Remove":
+		err = h.client.Delete(h.ctx, r.Filepath)
+	case "Mkdir":
+		err = h.client.Mkcol(h.ctx, r.Filepath)
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	return sftpError(err)
+}
+
+// PosixRename 实现sftp.PosixRenameFileCmder接口，目标已经存在时覆盖
+func (h *handlers) PosixRename(r *sftp.Request) error {
+	return sftpError(h.client.Move(h.ctx, r.Filepath, r.Target, true))
+}
+
+// Filelist 实现sftp.FileLister接口
+func (h *handlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		entries, err := h.client.List(h.ctx, r.Filepath)
+		if err != nil {
+			return nil, sftpError(err)
+		}
+		infos := make(listerAt, 0, len(entries))
+		for _, e := range entries {
+			infos = append(infos, fileInfo{e})
+		}
+		return infos, nil
+	case "Stat", "Lstat":
+		e, err := h.client.Stat(h.ctx, r.Filepath)
+		if err != nil {
+			return nil, sftpError(err)
+		}
+		e.Name = path.Base(r.Filepath)
+		return listerAt{fileInfo{e}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// listerAt 实现sftp.ListerAt接口
+type listerAt []os.FileInfo
+
+// ListAt 从offset开始复制目录项
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fileInfo 把目录项转换为os.FileInfo
+type fileInfo struct {
+	e davclient.Entry
+}
+
+func (fi fileInfo) Name() string { return fi.e.Name }
+
+func (fi fileInfo) Size() int64 {
+	if fi.e.Size < 0 {
+		return 0
+	}
+	return fi.e.Size
+}
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.e.Dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi fileInfo) ModTime() time.Time { return fi.e.ModTime }
+func (fi fileInfo) IsDir() bool        { return fi.e.Dir }
+func (fi fileInfo) Sys() any           { return nil }
@@ -0,0 +1,275 @@
+// Package sftpd 通过SFTP提供与WebDAV监听相同的加密存储，供只支持SFTP的备份工具使用。
+//
+// SSH服务器在进程内运行，每个SFTP操作都转换为WebDAV请求交给代理的完整处理链，
+// 加密、多租户、配额、限流、事件通知等与通过WebDAV访问时完全相同。
+package sftpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"webdav-proxy/pkg/proxy"
+	"webdav-proxy/utils"
+)
+
+// userExtension SSH认证结果中保存登录用户名的键
+const userExtension = "webdav-user"
+
+// Config SFTP服务器配置
+type Config struct {
+	Handler        http.Handler // 代理的完整处理链，包括认证中间件
+	HostKeyFile    string       // 主机私钥文件，不存在时生成ed25519密钥并保存
+	AuthorizedKeys string       // 允许公钥登录的authorized_keys文件，必须包含%u，替换为登录的用户名，为空时不允许公钥登录
+	PasswordAuth   bool         // 是否允许用代理认证的用户名和密码登录
+	Logger         utils.Logger
+}
+
+// Server SFTP服务器
+type Server struct {
+	config    *Config
+	sshConfig *ssh.ServerConfig
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// NewServer 加载或生成主机密钥并创建SFTP服务器
+func NewServer(config *Config) (*Server, error) {
+	if !config.PasswordAuth && config.AuthorizedKeys == "" {
+		return nil, errors.New("sftp requires password or public key authentication")
+	}
+	// 用户名由客户端任意指定，只有每个用户使用各自的文件时，公钥才能确定登录的是哪个用户
+	if config.AuthorizedKeys != "" && !strings.Contains(config.AuthorizedKeys, "%u") {
+		return nil, fmt.Errorf("sftp authorized keys path %q must contain %%u", config.AuthorizedKeys)
+	}
+	hostKey, err := loadHostKey(config.HostKeyFile, config.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{config: config, conns: make(map[net.Conn]struct{})}
+	s.sshConfig = &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-webdav-encrypt",
+	}
+	if config.PasswordAuth {
+		s.sshConfig.PasswordCallback = s.checkPassword
+	}
+	if config.AuthorizedKeys != "" {
+		s.sshConfig.PublicKeyCallback = s.checkPublicKey
+	}
+	s.sshConfig.AddHostKey(hostKey)
+	return s, nil
+}
+
+// loadHostKey 读取主机私钥，文件不存在时生成ed25519密钥并以OpenSSH格式保存
+func loadHostKey(path string, logger utils.Logger) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "webdav-encrypt sftp host key")
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("save sftp host key: %w", err)
+		}
+		logger.Info("[SFTP] 已生成主机密钥 %s", path)
+	} else if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse sftp host key %s: %w", path, err)
+	}
+	logger.Info("[SFTP] 主机密钥指纹: %s", ssh.FingerprintSHA256(signer.PublicKey()))
+	return signer, nil
+}
+
+// checkPassword 用代理认证检查用户名和密码：向处理链发送带基本认证的PROPFIND，
+// 只有成功的响应才允许登录，后端出错等其他状态码也拒绝。认证失败的计数、封禁和日志与WebDAV登录相同
+func (s *Server) checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	req, err := http.NewRequest("PROPFIND", "http://localhost/", http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = "/"
+	req.RemoteAddr = conn.RemoteAddr().String()
+	req.Header.Set("Depth", "0")
+	req.SetBasicAuth(conn.User(), string(password))
+
+	w := &statusWriter{header: make(http.Header)}
+	s.config.Handler.ServeHTTP(w, req)
+	if w.status < http.StatusOK || w.status >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("authentication failed: %d", w.status)
+	}
+	return &ssh.Permissions{Extensions: map[string]string{userExtension: conn.User()}}, nil
+}
+
+// checkPublicKey 在登录用户自己的authorized_keys文件中查找客户端的公钥，每次登录时重新读取文件
+func (s *Server) checkPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	user := conn.User()
+	if user == "" || user == "." || user == ".." || strings.ContainsAny(user, `/\`) {
+		return nil, fmt.Errorf("invalid user name %q", user)
+	}
+	path := strings.ReplaceAll(s.config.AuthorizedKeys, "%u", user)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	marshaled := key.Marshal()
+	for len(data) > 0 {
+		authorized, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			break
+		}
+		if bytes.Equal(authorized.Marshal(), marshaled) {
+			return &ssh.Permissions{Extensions: map[string]string{userExtension: user}}, nil
+		}
+		data = rest
+	}
+	return nil, errors.New("public key not authorized")
+}
+
+// Serve 接受SFTP连接，直到Close被调用
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭监听和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// serveConn 完成SSH握手并处理会话
+func (s *Server) serveConn(conn net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.sshConfig)
+	if err != nil {
+		s.config.Logger.Debug("[SFTP] %s 握手失败: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer sshConn.Close()
+	user := sshConn.Permissions.Extensions[userExtension]
+	s.config.Logger.Info("[SFTP] 用户 %s 从 %s 登录", user, conn.RemoteAddr())
+	go ssh.DiscardRequests(reqs)
+
+	// 连接断开时取消进行中的请求
+	ctx, cancel := context.WithCancel(proxy.ContextWithUser(context.Background(), user))
+	defer cancel()
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			s.config.Logger.Warn("[SFTP] 接受会话失败: %v", err)
+			continue
+		}
+		go s.serveSession(ctx, conn.RemoteAddr().String(), channel, requests)
+	}
+	s.config.Logger.Info("[SFTP] 用户 %s 从 %s 断开", user, conn.RemoteAddr())
+}
+
+// serveSession 只接受sftp子系统，不提供shell和命令执行
+func (s *Server) serveSession(ctx context.Context, remoteAddr string, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		// subsystem请求的负载是长度前缀的子系统名
+		if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+		s.serveSFTP(ctx, remoteAddr, channel)
+		return
+	}
+}
+
+// statusWriter 只记录状态码的http.ResponseWriter
+type statusWriter struct {
+	header http.Header
+	status int
+}
+
+// Header 实现http.ResponseWriter接口
+func (w *statusWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader 记录最终的状态码
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+	}
+}
+
+// Write 丢弃响应体
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(p), nil
+}
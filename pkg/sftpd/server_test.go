@@ -0,0 +1,198 @@
+package sftpd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/webdav"
+
+	"webdav-proxy/pkg/proxy"
+	"webdav-proxy/utils"
+)
+
+// userRecorder 记录处理链收到的用户名，请求交给内存中的WebDAV服务
+type userRecorder struct {
+	dav   *webdav.Handler
+	mu    sync.Mutex
+	users map[string]bool
+}
+
+// newUserRecorder 创建空的内存WebDAV服务
+func newUserRecorder() *userRecorder {
+	return &userRecorder{
+		dav:   &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()},
+		users: make(map[string]bool),
+	}
+}
+
+// ServeHTTP 实现http.Handler接口
+func (h *userRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.users[proxy.UserFromRequest(r)] = true
+	h.mu.Unlock()
+	h.dav.ServeHTTP(w, r)
+}
+
+// seen 返回处理链是否收到过user的请求
+func (h *userRecorder) seen(user string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.users[user]
+}
+
+// startServer 在随机端口上启动SFTP服务器，返回监听地址
+func startServer(t *testing.T, config *Config) string {
+	config.HostKeyFile = filepath.Join(t.TempDir(), "host_key")
+	config.Logger = utils.NewLogger(utils.LogLevelError)
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("创建SFTP服务器失败: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String()
+}
+
+// dial 以user的身份登录SFTP服务器
+func dial(t *testing.T, addr, user string, auth ssh.AuthMethod) (*sftp.Client, error) {
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client, nil
+}
+
+// newKey 生成客户端密钥
+func newKey(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestPasswordLogin(t *testing.T) {
+	recorder := newUserRecorder()
+	addr := startServer(t, &Config{
+		Handler: proxy.NewProxyAuthMiddleware(recorder, &proxy.ProxyAuthConfig{
+			Enabled: true,
+			Users:   map[string]string{"alice": "a-secret"},
+		}),
+		PasswordAuth: true,
+	})
+
+	if _, err := dial(t, addr, "alice", ssh.Password("wrong")); err == nil {
+		t.Fatal("密码错误时不应允许登录")
+	}
+	client, err := dial(t, addr, "alice", ssh.Password("a-secret"))
+	if err != nil {
+		t.Fatalf("登录失败: %v", err)
+	}
+
+	f, err := client.Create("/a.txt")
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	f.Write([]byte("hello"))
+	if err := f.Close(); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	f, err = client.Open("/a.txt")
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("读取的内容错误: %q, %v", data, err)
+	}
+	if !recorder.seen("alice") {
+		t.Error("SFTP请求应以登录的用户身份发送")
+	}
+}
+
+func TestPasswordLoginRequiresSuccess(t *testing.T) {
+	// 处理链返回的不是成功的响应时，不能当作认证通过
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError, http.StatusBadGateway} {
+		addr := startServer(t, &Config{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}),
+			PasswordAuth: true,
+		})
+		if _, err := dial(t, addr, "alice", ssh.Password("a-secret")); err == nil {
+			t.Errorf("状态码%d时不应允许登录", status)
+		}
+	}
+}
+
+func TestPublicKeyLoginUsesKeyOwner(t *testing.T) {
+	dir := t.TempDir()
+	alice, bob := newKey(t), newKey(t)
+	if err := os.WriteFile(filepath.Join(dir, "alice"), ssh.MarshalAuthorizedKey(alice.PublicKey()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bob"), ssh.MarshalAuthorizedKey(bob.PublicKey()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 所有用户共用的文件无法确定公钥属于哪个用户
+	if _, err := NewServer(&Config{
+		Handler:        http.NotFoundHandler(),
+		HostKeyFile:    filepath.Join(dir, "host_key"),
+		AuthorizedKeys: filepath.Join(dir, "alice"),
+		Logger:         utils.NewLogger(utils.LogLevelError),
+	}); err == nil {
+		t.Error("期望不含%u的公钥文件路径创建失败")
+	}
+
+	recorder := newUserRecorder()
+	addr := startServer(t, &Config{Handler: recorder, AuthorizedKeys: filepath.Join(dir, "%u")})
+
+	// alice的公钥不能用来登录bob或其他用户
+	for _, user := range []string{"bob", "mallory", "../alice"} {
+		if _, err := dial(t, addr, user, ssh.PublicKeys(alice)); err == nil {
+			t.Errorf("alice的公钥不应允许以 %s 登录", user)
+		}
+	}
+	client, err := dial(t, addr, "alice", ssh.PublicKeys(alice))
+	if err != nil {
+		t.Fatalf("公钥登录失败: %v", err)
+	}
+	if _, err := client.ReadDir("/"); err != nil {
+		t.Fatalf("列出目录失败: %v", err)
+	}
+	if !recorder.seen("alice") || recorder.seen("bob") {
+		t.Errorf("SFTP请求的用户名错误: %v", recorder.users)
+	}
+}
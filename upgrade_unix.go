@@ -0,0 +1,300 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"webdav-proxy/config"
+	"webdav-proxy/utils"
+)
+
+// 平滑升级时传给新进程的文件描述符编号。监听socket以"名称=描述符"的形式逗号分隔，
+// 如"http=3,sftp=4"；envListenFD是只传递WebDAV监听的早期版本使用的，从早期版本升级时仍然需要识别
+const (
+	envListenFDs = "WEBDAV_PROXY_LISTEN_FDS"
+	envListenFD  = "WEBDAV_PROXY_LISTEN_FD"
+	envReadyFD   = "WEBDAV_PROXY_READY_FD"
+)
+
+// upgradeReadyTimeout 等待新进程就绪的最长时间，新进程需要在这段时间内完成配置加载
+const upgradeReadyTimeout = 30 * time.Second
+
+// inheritedListener 旧进程或systemd传入的监听socket
+type inheritedListener struct {
+	fd     int
+	source string
+}
+
+var (
+	inheritedMu sync.Mutex
+	// inherited 尚未使用的继承监听socket，按监听名称索引
+	inherited = parseInheritedListeners()
+)
+
+// parseInheritedListeners 读取旧进程或systemd传入的监听socket并清除相关环境变量，避免传给子进程。
+// systemd的socket单元用FileDescriptorName指定名称，只有一个socket且名称不是监听名称时用于WebDAV
+func parseInheritedListeners() map[string]inheritedListener {
+	listeners := make(map[string]inheritedListener)
+	if fds := os.Getenv(envListenFDs); fds != "" {
+		os.Unsetenv(envListenFDs)
+		for _, item := range strings.Split(fds, ",") {
+			name, fd, _ := strings.Cut(item, "=")
+			if n, err := strconv.Atoi(fd); err == nil {
+				listeners[name] = inheritedListener{n, "inherited"}
+			}
+		}
+	}
+	if fd := os.Getenv(envListenFD); fd != "" {
+		os.Unsetenv(envListenFD)
+		if n, err := strconv.Atoi(fd); err == nil {
+			listeners[listenerHTTP] = inheritedListener{n, "inherited"}
+		}
+	}
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		for i := 0; i < count; i++ {
+			name := ""
+			if i < len(names) {
+				name = names[i]
+			}
+			if !slices.Contains(listenerNames, name) {
+				if count != 1 {
+					continue
+				}
+				name = listenerHTTP
+			}
+			listeners[name] = inheritedListener{3 + i, "systemd"}
+		}
+	}
+	return listeners
+}
+
+// listen 创建名为name的监听socket。由旧进程平滑升级启动或由systemd socket激活启动时
+// 使用传入的同名socket，否则监听指定地址
+func listen(name, addr string) (net.Listener, error) {
+	inheritedMu.Lock()
+	l, ok := inherited[name]
+	delete(inherited, name)
+	inheritedMu.Unlock()
+	if ok {
+		return fileListener(l.fd, l.source)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// closeInheritedListeners 关闭没有使用的继承监听socket，例如新的配置中关闭了SFTP。
+// 不关闭时端口仍然处于监听状态，连接会一直排队而没有进程处理
+func closeInheritedListeners() {
+	inheritedMu.Lock()
+	defer inheritedMu.Unlock()
+	for name, l := range inherited {
+		syscall.Close(l.fd)
+		delete(inherited, name)
+	}
+}
+
+// fileListener 从继承的文件描述符创建监听，原描述符在复制后关闭
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("use %s listener fd %d: %w", name, fd, err)
+	}
+	return ln, nil
+}
+
+// notifyReady 通知启动本进程的旧进程已经开始接收请求，不是由平滑升级启动时什么也不做
+func notifyReady() {
+	fd := os.Getenv(envReadyFD)
+	if fd == "" {
+		return
+	}
+	os.Unsetenv(envReadyFD)
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(n), "ready")
+	f.Write([]byte{1})
+	f.Close()
+}
+
+// watchUpgrade 收到SIGUSR2时用当前的可执行文件和参数启动新进程并把全部监听socket交给它，
+// 新进程就绪后关闭返回的channel，由调用方停止接收新请求并等待进行中的请求完成。
+// 新进程启动失败时继续使用当前进程，可以修正问题后再次发送信号
+func watchUpgrade(listeners map[string]net.Listener, logger utils.Logger) <-chan struct{} {
+	upgraded := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+	go func() {
+		for range sigs {
+			logger.Info("接收到信号: SIGUSR2，启动新进程接管监听端口")
+			pid, err := startSuccessor(listeners)
+			if err != nil {
+				logger.Error("平滑升级失败，继续使用当前进程: %v", err)
+				continue
+			}
+			logger.Info("新进程 %d 已就绪", pid)
+			sdNotify(fmt.Sprintf("MAINPID=%d", pid), logger)
+			signal.Stop(sigs)
+			close(upgraded)
+			return
+		}
+	}()
+	return upgraded
+}
+
+// startSuccessor 启动新进程并等待它开始接收请求，返回新进程的PID
+func startSuccessor(listeners map[string]net.Listener) (int, error) {
+	// 新进程中监听socket按名称顺序依次为描述符3、4……，之后是就绪通知和密钥管道
+	names := slices.Sorted(maps.Keys(listeners))
+	files := []uintptr{0, 1, 2}
+	fdNames := make([]string, 0, len(names))
+	for _, name := range names {
+		fd, err := dupListener(listeners[name])
+		if err != nil {
+			return 0, fmt.Errorf("%s listener: %w", name, err)
+		}
+		defer syscall.Close(fd)
+		fdNames = append(fdNames, fmt.Sprintf("%s=%d", name, len(files)))
+		files = append(files, uintptr(fd))
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	// 从标准输入或终端读取的密钥通过管道交给新进程，新进程的标准输入不再可用，
+	// 密钥也不能放在会被所有子进程继承的环境变量中。内容很少，启动新进程前全部写入管道的缓冲区
+	secretsR, err := secretsPipe()
+	if err != nil {
+		readyW.Close()
+		return 0, err
+	}
+	defer secretsR.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return 0, fmt.Errorf("find executable: %w", err)
+	}
+	env := append(os.Environ(),
+		envListenFDs+"="+strings.Join(fdNames, ","),
+		fmt.Sprintf("%s=%d", envReadyFD, len(files)),
+		fmt.Sprintf("%s=%d", config.SecretsFDEnv, len(files)+1))
+	files = append(files, readyW.Fd(), secretsR.Fd())
+	pid, err := syscall.ForkExec(executable, os.Args, &syscall.ProcAttr{Env: env, Files: files})
+	readyW.Close()
+	if err != nil {
+		return 0, fmt.Errorf("start %s: %w", executable, err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	// 新进程退出时管道的写端随之关闭，读取会返回EOF
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			state, _ := process.Wait()
+			return 0, fmt.Errorf("new process exited before ready: %s", state)
+		}
+	case <-time.After(upgradeReadyTimeout):
+		process.Kill()
+		process.Wait()
+		return 0, fmt.Errorf("new process not ready after %v", upgradeReadyTimeout)
+	}
+	process.Release()
+	return pid, nil
+}
+
+// dupListener 复制监听socket的描述符。不能使用File或os/exec：它们会把描述符切换为阻塞模式，
+// 而该模式由两个进程共享，当前进程关闭监听时阻塞在accept中的Serve将无法返回
+func dupListener(ln net.Listener) (int, error) {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return 0, fmt.Errorf("listener %T does not support handoff", ln)
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("get listener fd: %w", err)
+	}
+	var dup int
+	var dupErr error
+	err = rawConn.Control(func(fd uintptr) {
+		// 持有ForkLock，避免复制的描述符在设置close-on-exec之前被同时启动的其他子进程继承
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		dup, dupErr = syscall.Dup(int(fd))
+		if dupErr == nil {
+			syscall.CloseOnExec(dup)
+		}
+	})
+	if err == nil {
+		err = dupErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("duplicate listener fd: %w", err)
+	}
+	return dup, nil
+}
+
+// secretsPipe 创建已写入全部密钥的管道，返回读端
+func secretsPipe() (*os.File, error) {
+	secrets, err := config.InputSecrets()
+	if err != nil {
+		return nil, fmt.Errorf("encode secrets: %w", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("create secrets pipe: %w", err)
+	}
+	_, err = w.Write(secrets)
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("write secrets pipe: %w", err)
+	}
+	return r, nil
+}
+
+// sdNotify 向systemd发送状态通知，不是由systemd启动时什么也不做
+func sdNotify(state string, logger utils.Logger) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		logger.Warn("通知systemd失败: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		logger.Warn("通知systemd失败: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain 平滑升级测试把测试程序本身作为新进程启动，此时运行successor而不是测试
+func TestMain(m *testing.M) {
+	if os.Getenv(envListenFDs) != "" {
+		successor()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// successor 作为新进程接管全部监听，在每个监听上接受一个连接并回复监听的名称
+func successor() {
+	names := []string{listenerHTTP, listenerSFTP}
+	listeners := make([]net.Listener, len(names))
+	for i, name := range names {
+		// 地址为空时没有继承到监听，会监听随机端口，旧的地址上不会得到回复
+		ln, err := listen(name, "127.0.0.1:0")
+		if err != nil {
+			os.Exit(2)
+		}
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+		listeners[i] = ln
+	}
+	closeInheritedListeners()
+	notifyReady()
+	for i, ln := range listeners {
+		conn, err := ln.Accept()
+		if err != nil {
+			os.Exit(3)
+		}
+		conn.Write([]byte(names[i]))
+		conn.Close()
+	}
+	os.Exit(0)
+}
+
+func TestStartSuccessorHandsOverAllListeners(t *testing.T) {
+	listeners := make(map[string]net.Listener)
+	for _, name := range []string{listenerHTTP, listenerSFTP} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		listeners[name] = ln
+	}
+
+	pid, err := startSuccessor(listeners)
+	if err != nil {
+		t.Fatalf("启动新进程失败: %v", err)
+	}
+	// 当前进程停止接收后，连接由新进程处理
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	for name, ln := range listeners {
+		conn, err := net.DialTimeout("tcp", ln.Addr().String(), 5*time.Second)
+		if err != nil {
+			t.Fatalf("连接 %s 监听失败: %v", name, err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		reply, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil || string(reply) != name {
+			t.Errorf("%s 监听没有交给新进程: %q, %v", name, reply, err)
+		}
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := process.Wait()
+	if err != nil || !state.Success() {
+		t.Errorf("新进程没有正常退出: %v, %v", state, err)
+	}
+}
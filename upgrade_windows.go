@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"net"
+
+	"webdav-proxy/utils"
+)
+
+// listen Windows上不支持继承监听socket，直接监听指定地址
+func listen(name, addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// closeInheritedListeners Windows上不支持继承监听socket
+func closeInheritedListeners() {}
+
+// notifyReady Windows上不支持平滑升级
+func notifyReady() {}
+
+// watchUpgrade Windows上不支持平滑升级，返回的channel永远不会关闭
+func watchUpgrade(listeners map[string]net.Listener, logger utils.Logger) <-chan struct{} {
+	return nil
+}